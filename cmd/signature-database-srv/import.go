@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/config"
+	service "github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/importer"
+	log "github.com/sirupsen/logrus"
+	"os"
+)
+
+// runImport bulk loads dump files straight into the database configured for the service
+func runImport(args []string) error {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	format := flags.String("format", string(importer.FormatAuto), "the format of the files: auto, hashcsv, csv, ndjson or json")
+	typ := flags.String("type", string(client.SignatureTypeFunction), "the type of signatures whose type isn't given and which have no hash")
+	batchSize := flags.Int("batch-size", 50000, "the number of signatures copied into the database at once")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: %s import [flags] file...\n\nfiles may be gzip or zstd compressed, - reads stdin\n\n", os.Args[0])
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return fmt.Errorf("no files given")
+	}
+
+	if !importer.Format(*format).Valid() {
+		return fmt.Errorf("invalid format: %s", *format)
+	}
+
+	if t := client.SignatureType(*typ); t != client.SignatureTypeFunction && t != client.SignatureTypeEvent {
+		return fmt.Errorf("invalid type: %s", *typ)
+	}
+
+	var cfg service.Config
+	if err := config.LoadConfig(&cfg); err != nil {
+		return fmt.Errorf("failed to load config: %w", err)
+	}
+
+	db, err := service.OpenStorage(&cfg)
+	if err != nil {
+		return err
+	}
+
+	imp := importer.New(db, importer.Options{
+		DefaultType: client.SignatureType(*typ),
+		BatchSize:   *batchSize,
+	})
+
+	for _, file := range flags.Args() {
+		if err := importFile(imp, file, importer.Format(*format)); err != nil {
+			return fmt.Errorf("failed to import %s: %w", file, err)
+		}
+	}
+
+	if err := imp.Flush(); err != nil {
+		return fmt.Errorf("failed to import: %w", err)
+	}
+
+	stats := imp.Stats()
+	log.WithFields(log.Fields{
+		"read":       stats.Read,
+		"imported":   stats.Imported,
+		"duplicated": stats.Duplicated,
+		"invalid":    stats.Invalid,
+		"mismatched": stats.Mismatched,
+	}).Infof("finished importing")
+
+	return nil
+}
+
+func importFile(imp *importer.Importer, file string, format importer.Format) error {
+	reader, closer, err := importer.Open(file, format)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	log.WithField("file", file).Infof("importing")
+
+	return imp.Import(file, reader)
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/openchainxyz/openchainxyz-monorepo/internal/config"
 	service "github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv"
 	log "github.com/sirupsen/logrus"
+	"os"
 )
 
 func run() error {
@@ -27,6 +28,13 @@ func run() error {
 
 func main() {
 	log.SetLevel(log.DebugLevel)
+	if len(os.Args) > 1 && os.Args[1] == "import" {
+		if err := runImport(os.Args[2:]); err != nil {
+			log.WithError(err).Fatalf("failed to import")
+		}
+		return
+	}
+
 	if err := run(); err != nil {
 		log.WithError(err).Fatalf("failed to run service")
 	}
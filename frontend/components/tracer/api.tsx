@@ -1,4 +1,5 @@
 import { JsonFragment } from 'ethers';
+import { VariableInfo } from './types';
 
 export type AddressInfo = {
     label: string;
@@ -53,10 +54,13 @@ export type TraceResponse = {
 };
 
 export type StorageResponse = {
-    allStructs: any[];
-    arrays: any[];
-    structs: any[];
-    slots: Record<string, any>;
+    // map of struct name => layout of the struct on its own
+    allStructs: Record<string, StorageResponse>;
+    // map of slot => fixed size array or struct starting at the slot
+    arrays: Record<string, VariableInfo>;
+    structs: Record<string, VariableInfo>;
+    // map of slot => offset => variable
+    slots: Record<string, Record<number, VariableInfo>>;
 };
 
 export function apiEndpoint() {
@@ -25,6 +25,7 @@ export type TypeName = {
     typeDescriptions: TypeDescriptions;
     keyType: TypeName;
     valueType: TypeName;
+    baseType?: TypeName;
 };
 
 export type VariableInfo = {
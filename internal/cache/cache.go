@@ -0,0 +1,179 @@
+// Package cache implements a size-bounded least recently used cache with optional per-entry expiry.
+package cache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+type entry[K comparable, V any] struct {
+	key     K
+	value   V
+	weight  int64
+	expires time.Time
+}
+
+// Stats is a snapshot of the counters of a cache
+type Stats struct {
+	Entries   int    `json:"entries"`
+	Capacity  int    `json:"capacity"`
+	Weight    int64  `json:"weight,omitempty"`
+	Hits      uint64 `json:"hits"`
+	Misses    uint64 `json:"misses"`
+	Evictions uint64 `json:"evictions"`
+}
+
+// HitRate is the fraction of lookups which were served from the cache
+func (s Stats) HitRate() float64 {
+	if s.Hits+s.Misses == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(s.Hits+s.Misses)
+}
+
+// LRU holds up to capacity entries, evicting the least recently used entry when it is full. It is safe for
+// concurrent use.
+type LRU[K comparable, V any] struct {
+	capacity int
+	// weigh is set for caches which are also bounded by the total weight of their values
+	weigh     func(V) int64
+	maxWeight int64
+	weight    int64
+
+	lock  sync.Mutex
+	items map[K]*list.Element
+	order *list.List
+
+	hits      uint64
+	misses    uint64
+	evictions uint64
+
+	now func() time.Time
+}
+
+// New creates a cache which holds at most capacity entries
+func New[K comparable, V any](capacity int) *LRU[K, V] {
+	if capacity < 1 {
+		capacity = 1
+	}
+
+	return &LRU[K, V]{
+		capacity: capacity,
+		items:    make(map[K]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// NewWeighted creates a cache which holds at most capacity entries, whose weights add up to at most maxWeight. A
+// value which is heavier than maxWeight on its own isn't stored.
+func NewWeighted[K comparable, V any](capacity int, maxWeight int64, weigh func(V) int64) *LRU[K, V] {
+	c := New[K, V](capacity)
+	c.weigh = weigh
+	c.maxWeight = maxWeight
+	return c
+}
+
+// Get returns the value stored for key, if there is one and it hasn't expired
+func (c *LRU[K, V]) Get(key K) (V, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry[K, V])
+		if e.expires.IsZero() || c.now().Before(e.expires) {
+			c.order.MoveToFront(elem)
+			c.hits++
+			return e.value, true
+		}
+
+		c.remove(elem)
+	}
+
+	c.misses++
+
+	var zero V
+	return zero, false
+}
+
+// Set stores value for key, replacing any existing value. The entry expires after ttl, or never if ttl is zero.
+func (c *LRU[K, V]) Set(key K, value V, ttl time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	var expires time.Time
+	if ttl > 0 {
+		expires = c.now().Add(ttl)
+	}
+
+	var weight int64
+	if c.weigh != nil {
+		weight = c.weigh(value)
+		if weight > c.maxWeight {
+			if elem, ok := c.items[key]; ok {
+				c.remove(elem)
+			}
+			return
+		}
+	}
+
+	if elem, ok := c.items[key]; ok {
+		e := elem.Value.(*entry[K, V])
+		c.weight += weight - e.weight
+		e.value = value
+		e.weight = weight
+		e.expires = expires
+		c.order.MoveToFront(elem)
+	} else {
+		c.items[key] = c.order.PushFront(&entry[K, V]{key: key, value: value, weight: weight, expires: expires})
+		c.weight += weight
+	}
+
+	for c.order.Len() > c.capacity || c.weight > c.maxWeight {
+		c.remove(c.order.Back())
+		c.evictions++
+	}
+}
+
+// Delete removes the entry for key, if there is one
+func (c *LRU[K, V]) Delete(key K) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.remove(elem)
+	}
+}
+
+// Purge removes every entry, the counters are kept
+func (c *LRU[K, V]) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	c.items = make(map[K]*list.Element)
+	c.order.Init()
+	c.weight = 0
+}
+
+// Stats returns a snapshot of the counters
+func (c *LRU[K, V]) Stats() Stats {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return Stats{
+		Entries:   c.order.Len(),
+		Capacity:  c.capacity,
+		Weight:    c.weight,
+		Hits:      c.hits,
+		Misses:    c.misses,
+		Evictions: c.evictions,
+	}
+}
+
+// remove unlinks the element, must be called with the lock held
+func (c *LRU[K, V]) remove(elem *list.Element) {
+	e := c.order.Remove(elem).(*entry[K, V])
+	delete(c.items, e.key)
+	c.weight -= e.weight
+}
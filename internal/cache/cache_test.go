@@ -0,0 +1,104 @@
+package cache
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLRU_Eviction(t *testing.T) {
+	c := New[string, int](2)
+
+	c.Set("a", 1, 0)
+	c.Set("b", 2, 0)
+
+	// touching a makes b the least recently used entry
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+
+	c.Set("c", 3, 0)
+
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+
+	v, ok := c.Get("a")
+	assert.True(t, ok)
+	assert.Equal(t, 1, v)
+
+	stats := c.Stats()
+	assert.Equal(t, 2, stats.Entries)
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(1), stats.Misses)
+	assert.Equal(t, uint64(1), stats.Evictions)
+	assert.InDelta(t, 2.0/3.0, stats.HitRate(), 0.0001)
+}
+
+func TestLRU_Expiry(t *testing.T) {
+	now := time.Unix(0, 0)
+
+	c := New[string, int](10)
+	c.now = func() time.Time {
+		return now
+	}
+
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, 0)
+
+	now = now.Add(2 * time.Minute)
+
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	_, ok = c.Get("b")
+	assert.True(t, ok)
+
+	assert.Equal(t, 1, c.Stats().Entries)
+}
+
+func TestLRU_Delete(t *testing.T) {
+	c := New[string, int](10)
+
+	c.Set("a", 1, 0)
+	c.Set("b", 2, 0)
+
+	c.Delete("a")
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+
+	c.Purge()
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 0, c.Stats().Entries)
+}
+
+func TestLRU_Weighted(t *testing.T) {
+	c := NewWeighted[string, []byte](10, 10, func(v []byte) int64 {
+		return int64(len(v))
+	})
+
+	c.Set("a", make([]byte, 4), 0)
+	c.Set("b", make([]byte, 4), 0)
+	assert.Equal(t, int64(8), c.Stats().Weight)
+
+	// c doesn't fit next to a and b, so the least recently used is evicted
+	c.Set("c", make([]byte, 4), 0)
+	_, ok := c.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, int64(8), c.Stats().Weight)
+
+	// replacing a value updates the weight
+	c.Set("b", make([]byte, 1), 0)
+	assert.Equal(t, int64(5), c.Stats().Weight)
+
+	// a value heavier than the whole cache isn't stored, and the old value for its key is dropped
+	c.Set("c", make([]byte, 11), 0)
+	_, ok = c.Get("c")
+	assert.False(t, ok)
+	_, ok = c.Get("b")
+	assert.True(t, ok)
+	assert.Equal(t, int64(1), c.Stats().Weight)
+
+	c.Purge()
+	assert.Equal(t, int64(0), c.Stats().Weight)
+}
@@ -0,0 +1,145 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/cache"
+)
+
+// ResultCache stores compilation results by the hash of their input. Results are kept in memory, and optionally on
+// disk so that they survive restarts.
+type ResultCache struct {
+	dir    string
+	memory *cache.LRU[common.Hash, []byte]
+}
+
+// NewResultCache creates a cache which holds up to size results, taking up to maxBytes, in memory. Results larger
+// than maxBytes are only kept on disk. If dir is set, results are also written there. A size of zero disables the
+// in-memory cache, and a maxBytes of zero only bounds it by size.
+func NewResultCache(dir string, size int, maxBytes int64) (*ResultCache, error) {
+	result := &ResultCache{
+		dir: dir,
+	}
+
+	if dir != "" {
+		if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+			return nil, fmt.Errorf("failed to create cache dir: %w", err)
+		}
+	}
+
+	if size > 0 && maxBytes > 0 {
+		result.memory = cache.NewWeighted[common.Hash, []byte](size, maxBytes, func(result []byte) int64 {
+			return int64(len(result))
+		})
+	} else if size > 0 {
+		result.memory = cache.New[common.Hash, []byte](size)
+	}
+
+	return result, nil
+}
+
+// ResultKey is the key a compilation is cached under, keccak(version || input) where the input is encoded as
+// canonical JSON. Inputs which only differ in formatting or key order have the same key.
+func ResultKey(version string, input any) (common.Hash, error) {
+	canonical, err := canonicalJSON(input)
+	if err != nil {
+		return common.Hash{}, err
+	}
+
+	return crypto.Keccak256Hash([]byte(version), canonical), nil
+}
+
+// canonicalJSON encodes v without whitespace and with object keys sorted
+func canonicalJSON(v any) ([]byte, error) {
+	encoded, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode input: %w", err)
+	}
+
+	// decoding into generic values turns every object into a map, which encoding/json sorts by key
+	decoder := json.NewDecoder(bytes.NewReader(encoded))
+	decoder.UseNumber()
+
+	var generic any
+	if err := decoder.Decode(&generic); err != nil {
+		return nil, fmt.Errorf("failed to decode input: %w", err)
+	}
+
+	return json.Marshal(generic)
+}
+
+func (c *ResultCache) path(key common.Hash) string {
+	name := key.Hex()[2:]
+	return filepath.Join(c.dir, name[:2], name+".json")
+}
+
+// Get returns the result stored for key, if there is one
+func (c *ResultCache) Get(key common.Hash) ([]byte, bool) {
+	if c.memory != nil {
+		if result, ok := c.memory.Get(key); ok {
+			return result, true
+		}
+	}
+
+	if c.dir == "" {
+		return nil, false
+	}
+
+	result, err := os.ReadFile(c.path(key))
+	if err != nil {
+		return nil, false
+	}
+
+	if c.memory != nil {
+		c.memory.Set(key, result, 0)
+	}
+	return result, true
+}
+
+// Set stores the result for key. The result is written atomically, so that a concurrent Get never sees a partial
+// result.
+func (c *ResultCache) Set(key common.Hash, result []byte) error {
+	if c.memory != nil {
+		c.memory.Set(key, result, 0)
+	}
+
+	if c.dir == "" {
+		return nil
+	}
+
+	return writeFileAtomic(c.path(key), result)
+}
+
+// writeFileAtomic writes the data to a temporary file and then moves it into place, so that a concurrent reader
+// never sees a partial file
+func writeFileAtomic(file string, data []byte) error {
+	if err := os.MkdirAll(filepath.Dir(file), os.FileMode(0755)); err != nil {
+		return fmt.Errorf("failed to create dir: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(file), filepath.Base(file)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+
+	if err := os.Rename(tmp.Name(), file); err != nil {
+		return fmt.Errorf("failed to move file into place: %w", err)
+	}
+
+	return nil
+}
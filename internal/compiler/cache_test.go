@@ -0,0 +1,114 @@
+package compiler
+
+import (
+	"os"
+	"testing"
+)
+
+func TestResultKey(t *testing.T) {
+	a := &StandardJsonInput{
+		Language: "Solidity",
+		Sources:  map[string]*StandardJsonSourceFile{"A.sol": {Content: "contract A {}"}},
+		Settings: map[string]any{"optimizer": map[string]any{"enabled": true, "runs": 200}, "evmVersion": "london"},
+	}
+	// the same input, decoded from differently formatted json
+	b := map[string]any{
+		"settings": map[string]any{"evmVersion": "london", "optimizer": map[string]any{"runs": 200, "enabled": true}},
+		"sources":  map[string]any{"A.sol": map[string]any{"content": "contract A {}", "urls": nil, "keccak256": ""}},
+		"language": "Solidity",
+	}
+
+	keyA, err := ResultKey("0.8.17", a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyB, err := ResultKey("0.8.17", b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyA != keyB {
+		t.Errorf("expected equivalent inputs to have the same key")
+	}
+
+	other, err := ResultKey("0.8.16", a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == keyA {
+		t.Errorf("expected the version to be part of the key")
+	}
+}
+
+func TestResultCache(t *testing.T) {
+	dir := t.TempDir()
+	key, err := ResultKey("0.8.17", "contract A {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewResultCache(dir, 16, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(key); ok {
+		t.Fatal("expected a miss")
+	}
+	if err := c.Set(key, []byte(`{"contracts":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if result, ok := c.Get(key); !ok || string(result) != `{"contracts":{}}` {
+		t.Fatalf("expected a hit, got %q", result)
+	}
+
+	// results written to disk survive a restart, even without an in-memory cache
+	c, err = NewResultCache(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result, ok := c.Get(key); !ok || string(result) != `{"contracts":{}}` {
+		t.Fatalf("expected a hit from disk, got %q", result)
+	}
+
+	// a memory only cache forgets everything
+	c, err = NewResultCache("", 16, 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(key); ok {
+		t.Fatal("expected a miss")
+	}
+}
+
+func TestResultCacheMemoryBytes(t *testing.T) {
+	small, err := ResultKey("0.8.17", "contract A {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := ResultKey("0.8.17", "contract B {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	c, err := NewResultCache(dir, 16, 32)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(small, []byte(`{"contracts":{}}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Set(large, []byte(`{"contracts":{"B.sol":{"B":{"abi":[]}}}}`)); err != nil {
+		t.Fatal(err)
+	}
+
+	// once the disk copies are gone, only what was kept in memory is left
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.Get(small); !ok {
+		t.Error("expected the small result to be kept in memory")
+	}
+	if _, ok := c.Get(large); ok {
+		t.Error("expected the large result to only be kept on disk")
+	}
+}
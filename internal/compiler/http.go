@@ -0,0 +1,158 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+)
+
+// The responses shared by the compiler services, their clients each have their own copy of these types
+
+type compileResponse struct {
+	Ok      bool            `json:"ok"`
+	Error   string          `json:"error,omitempty"`
+	Version string          `json:"version,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+}
+
+type compilerVersion struct {
+	Version     string `json:"version"`
+	LongVersion string `json:"longVersion"`
+	Installed   bool   `json:"installed"`
+}
+
+type versionList struct {
+	LatestRelease string             `json:"latestRelease"`
+	Releases      []*compilerVersion `json:"releases"`
+}
+
+type versionsResponse struct {
+	Ok     bool         `json:"ok"`
+	Error  string       `json:"error,omitempty"`
+	Result *versionList `json:"result,omitempty"`
+}
+
+type runnerStats struct {
+	Workers   int    `json:"workers"`
+	Running   int64  `json:"running"`
+	Queued    int64  `json:"queued"`
+	Completed uint64 `json:"completed"`
+	Failed    uint64 `json:"failed"`
+	Timeouts  uint64 `json:"timeouts"`
+	Rejected  uint64 `json:"rejected"`
+}
+
+type statsResponse struct {
+	Ok     bool         `json:"ok"`
+	Result *runnerStats `json:"result,omitempty"`
+}
+
+// InstallError is returned when the compiler a request needs couldn't be installed
+type InstallError struct {
+	Err error
+}
+
+func (e *InstallError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *InstallError) Unwrap() error {
+	return e.Err
+}
+
+// CompileStatus is the status to report for an error returned while compiling. Being overloaded or failing to
+// install a compiler which exists is our problem, anything else is the request's.
+func CompileStatus(err error) int {
+	if errors.Is(err, ErrOverloaded) {
+		return http.StatusServiceUnavailable
+	}
+	if errors.As(err, new(*InstallError)) && !errors.Is(err, ErrUnknownVersion) {
+		return http.StatusServiceUnavailable
+	}
+	return http.StatusBadRequest
+}
+
+// ResolveStatus is the status to report for an error returned while resolving the version a request needs
+func ResolveStatus(err error) int {
+	if errors.Is(err, ErrInvalidPragma) || errors.Is(err, ErrNoMatchingVersion) {
+		return http.StatusBadRequest
+	}
+	return http.StatusServiceUnavailable
+}
+
+func WriteResponse(w http.ResponseWriter, status int, response any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// FailCompile writes a failed compile response, along with the output of the compiler if it wrote any
+func FailCompile(w http.ResponseWriter, status int, version string, message string, result json.RawMessage) {
+	WriteResponse(w, status, &compileResponse{
+		Ok:      false,
+		Error:   message,
+		Version: version,
+		Result:  result,
+	})
+}
+
+func SucceedCompile(w http.ResponseWriter, version string, result json.RawMessage) {
+	WriteResponse(w, http.StatusOK, &compileResponse{
+		Ok:      true,
+		Version: version,
+		Result:  result,
+	})
+}
+
+// ServeVersions lists the releases known to the manager, newest first
+func ServeVersions(m *Manager) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		versions, err := m.Versions(r.Context())
+		if err != nil {
+			WriteResponse(w, http.StatusServiceUnavailable, &versionsResponse{
+				Ok:    false,
+				Error: err.Error(),
+			})
+			return
+		}
+
+		result := &versionList{
+			Releases: make([]*compilerVersion, 0, len(versions)),
+		}
+		for _, build := range versions {
+			result.Releases = append(result.Releases, &compilerVersion{
+				Version:     build.Version,
+				LongVersion: build.LongVersion,
+				Installed:   m.Installed(build),
+			})
+		}
+		if len(versions) > 0 {
+			result.LatestRelease = versions[0].Version
+		}
+
+		WriteResponse(w, http.StatusOK, &versionsResponse{
+			Ok:     true,
+			Result: result,
+		})
+	}
+}
+
+// ServeStats reports the load on the runner
+func ServeStats(runner *Runner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		stats := runner.Stats()
+
+		WriteResponse(w, http.StatusOK, &statsResponse{
+			Ok: true,
+			Result: &runnerStats{
+				Workers:   stats.Workers,
+				Running:   stats.Running,
+				Queued:    stats.Queued,
+				Completed: stats.Completed,
+				Failed:    stats.Failed,
+				Timeouts:  stats.Timeouts,
+				Rejected:  stats.Rejected,
+			},
+		})
+	}
+}
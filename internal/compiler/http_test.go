@@ -0,0 +1,39 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestCompileStatus(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+	}{
+		{fmt.Errorf("queue: %w", ErrOverloaded), http.StatusServiceUnavailable},
+		{&InstallError{errors.New("download failed")}, http.StatusServiceUnavailable},
+		{&InstallError{fmt.Errorf("0.0.1: %w", ErrUnknownVersion)}, http.StatusBadRequest},
+		{ErrTimeout, http.StatusBadRequest},
+	} {
+		if status := CompileStatus(test.err); status != test.status {
+			t.Errorf("%v: got status %d, expected %d", test.err, status, test.status)
+		}
+	}
+}
+
+func TestResolveStatus(t *testing.T) {
+	for _, test := range []struct {
+		err    error
+		status int
+	}{
+		{fmt.Errorf("A.sol: %w", ErrInvalidPragma), http.StatusBadRequest},
+		{ErrNoMatchingVersion, http.StatusBadRequest},
+		{errors.New("failed to fetch manifest"), http.StatusServiceUnavailable},
+	} {
+		if status := ResolveStatus(test.err); status != test.status {
+			t.Errorf("%v: got status %d, expected %d", test.err, status, test.status)
+		}
+	}
+}
@@ -0,0 +1,592 @@
+package compiler
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	log "github.com/sirupsen/logrus"
+)
+
+type Language string
+
+const (
+	LanguageSolidity Language = "Solidity"
+	LanguageVyper    Language = "Vyper"
+)
+
+var (
+	ErrUnknownVersion = errors.New("unknown compiler version")
+	ErrNoChecksum     = errors.New("no checksum published for compiler")
+)
+
+// Build is a single compiler binary, as described by the list.json manifests published at
+// https://binaries.soliditylang.org
+type Build struct {
+	// Path is relative to the manifest, or an absolute url
+	Path        string   `json:"path"`
+	Version     string   `json:"version"`
+	Prerelease  string   `json:"prerelease,omitempty"`
+	Build       string   `json:"build"`
+	LongVersion string   `json:"longVersion"`
+	Keccak256   string   `json:"keccak256"`
+	SHA256      string   `json:"sha256"`
+	URLs        []string `json:"urls"`
+}
+
+type Manifest struct {
+	Builds []*Build `json:"builds"`
+	// Releases maps each release version to the path of its build
+	Releases      map[string]string `json:"releases"`
+	LatestRelease string            `json:"latestRelease"`
+}
+
+// Release returns the build for the given release version, or nil if there isn't one
+func (m *Manifest) Release(version string) *Build {
+	buildPath, ok := m.Releases[version]
+	if !ok {
+		return nil
+	}
+	for _, build := range m.Builds {
+		if build.Path == buildPath {
+			return build
+		}
+	}
+	return nil
+}
+
+type ManagerConfig struct {
+	// Manifest is the url or local path of the manifest listing the available binaries. Binaries are downloaded
+	// relative to it, so a mirror only needs to replicate the directory layout. Solidity defaults to the official
+	// list.json, Vyper defaults to the GitHub releases of vyperlang/vyper.
+	Manifest string
+	// Dir is where downloaded binaries are installed
+	Dir string
+	// OfflineDir is a directory of preloaded binaries, named as in the manifest, which are used in place. If it
+	// contains a list.json, that is used as the manifest unless Manifest is set. Binaries in it are trusted even if
+	// the manifest has no checksum for them, as is the case for older Vyper releases.
+	OfflineDir string
+	// ManifestTTL is how long the manifest is cached before it's fetched again
+	ManifestTTL time.Duration
+}
+
+// Manager installs compiler binaries on demand. Binaries are verified against the checksums in the manifest and
+// installed atomically, so a binary at its final path is always complete.
+type Manager struct {
+	language Language
+	config   *ManagerConfig
+	client   *http.Client
+
+	// fetchLock is held while fetching the manifest, so that only one fetch runs at a time
+	fetchLock sync.Mutex
+
+	lock           sync.Mutex
+	manifest       *Manifest
+	manifestLoaded time.Time
+	versionLocks   map[string]*sync.Mutex
+	// verified maps each version to the path of a binary which has been checked in this process
+	verified map[string]string
+}
+
+func NewManager(language Language, config *ManagerConfig) (*Manager, error) {
+	if language != LanguageSolidity && language != LanguageVyper {
+		return nil, fmt.Errorf("unsupported language %s", language)
+	}
+
+	cfg := *config
+	if cfg.Dir == "" {
+		cfg.Dir = path.Join(os.TempDir(), strings.ToLower(string(language)))
+	}
+	if cfg.ManifestTTL == 0 {
+		cfg.ManifestTTL = time.Hour
+	}
+	if cfg.Manifest == "" && cfg.OfflineDir != "" {
+		if _, err := os.Stat(filepath.Join(cfg.OfflineDir, "list.json")); err == nil {
+			cfg.Manifest = filepath.Join(cfg.OfflineDir, "list.json")
+		}
+	}
+	if cfg.Manifest == "" {
+		var err error
+		cfg.Manifest, err = defaultManifest(language)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &Manager{
+		language:     language,
+		config:       &cfg,
+		client:       &http.Client{Timeout: 5 * time.Minute},
+		versionLocks: make(map[string]*sync.Mutex),
+		verified:     make(map[string]string),
+	}, nil
+}
+
+func defaultManifest(language Language) (string, error) {
+	if language == LanguageVyper {
+		// vyper has fewer than 100 releases, so the first page is all of them
+		return "https://api.github.com/repos/vyperlang/vyper/releases?per_page=100", nil
+	}
+
+	var platform string
+	switch runtime.GOOS {
+	case "linux":
+		platform = "linux-amd64"
+	case "darwin":
+		platform = "macosx-amd64"
+	case "windows":
+		platform = "windows-amd64"
+	default:
+		return "", fmt.Errorf("unsupported os %s", runtime.GOOS)
+	}
+	return fmt.Sprintf("https://binaries.soliditylang.org/%s/list.json", platform), nil
+}
+
+func (m *Manager) Language() Language {
+	return m.language
+}
+
+// Manifest returns the current manifest, fetching it if the cached copy is stale. If fetching fails, or another
+// caller is already fetching it, the stale copy is used.
+func (m *Manager) Manifest(ctx context.Context) (*Manifest, error) {
+	manifest, fresh := m.cachedManifest()
+	if fresh {
+		return manifest, nil
+	}
+
+	// the fetch can take minutes, so it's done without holding m.lock, which every install needs
+	if !m.fetchLock.TryLock() {
+		if manifest != nil {
+			return manifest, nil
+		}
+		m.fetchLock.Lock()
+	}
+	defer m.fetchLock.Unlock()
+
+	// the manifest may have been fetched while waiting for the lock
+	manifest, fresh = m.cachedManifest()
+	if fresh {
+		return manifest, nil
+	}
+
+	fetched, err := m.fetchManifest(ctx)
+	if err != nil {
+		if manifest != nil {
+			log.WithError(err).WithField("language", m.language).Warnf("failed to refresh compiler manifest, using cached copy")
+			return manifest, nil
+		}
+		return nil, err
+	}
+
+	m.lock.Lock()
+	m.manifest = fetched
+	m.manifestLoaded = time.Now()
+	m.lock.Unlock()
+
+	return fetched, nil
+}
+
+// cachedManifest returns the cached manifest, if any, and whether it's still fresh
+func (m *Manager) cachedManifest() (*Manifest, bool) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.manifest, m.manifest != nil && time.Since(m.manifestLoaded) < m.config.ManifestTTL
+}
+
+func (m *Manager) fetchManifest(ctx context.Context) (*Manifest, error) {
+	reader, err := m.open(ctx, m.config.Manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch manifest: %w", err)
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	return parseManifest(data)
+}
+
+// parseManifest accepts either a list.json manifest or a list of GitHub releases
+func parseManifest(data []byte) (*Manifest, error) {
+	if trimmed := bytes.TrimSpace(data); len(trimmed) > 0 && trimmed[0] == '[' {
+		return parseGithubReleases(trimmed)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to decode manifest: %w", err)
+	}
+	return &manifest, nil
+}
+
+type githubRelease struct {
+	TagName    string `json:"tag_name"`
+	Prerelease bool   `json:"prerelease"`
+	Assets     []struct {
+		Name               string `json:"name"`
+		BrowserDownloadURL string `json:"browser_download_url"`
+		// Digest is of the form sha256:<hex>, and is missing for older assets
+		Digest string `json:"digest"`
+	} `json:"assets"`
+}
+
+// githubAssetSuffix is the suffix of the vyper release asset for the current os
+func githubAssetSuffix() string {
+	switch runtime.GOOS {
+	case "darwin":
+		return ".darwin"
+	case "windows":
+		return ".windows.exe"
+	default:
+		return "." + runtime.GOOS
+	}
+}
+
+func parseGithubReleases(data []byte) (*Manifest, error) {
+	var releases []*githubRelease
+	if err := json.Unmarshal(data, &releases); err != nil {
+		return nil, fmt.Errorf("failed to decode releases: %w", err)
+	}
+
+	manifest := &Manifest{
+		Releases: make(map[string]string),
+	}
+
+	suffix := githubAssetSuffix()
+	for _, release := range releases {
+		if release.Prerelease {
+			continue
+		}
+
+		version := strings.TrimPrefix(release.TagName, "v")
+		for _, asset := range release.Assets {
+			// assets are named like vyper.0.3.7+commit.6020b8bb.linux
+			if !strings.HasPrefix(asset.Name, "vyper.") || !strings.HasSuffix(asset.Name, suffix) {
+				continue
+			}
+
+			build := &Build{
+				Path:        asset.BrowserDownloadURL,
+				Version:     version,
+				LongVersion: strings.TrimSuffix(strings.TrimPrefix(asset.Name, "vyper."), suffix),
+			}
+			if _, commit, ok := strings.Cut(build.LongVersion, "+"); ok {
+				build.Build = commit
+			}
+			if strings.HasPrefix(asset.Digest, "sha256:") {
+				build.SHA256 = "0x" + strings.TrimPrefix(asset.Digest, "sha256:")
+			}
+
+			manifest.Builds = append(manifest.Builds, build)
+			manifest.Releases[version] = build.Path
+			if manifest.LatestRelease == "" || CompareVersions(version, manifest.LatestRelease) > 0 {
+				manifest.LatestRelease = version
+			}
+			break
+		}
+	}
+
+	return manifest, nil
+}
+
+// open reads a url or a local path
+func (m *Manager) open(ctx context.Context, location string) (io.ReadCloser, error) {
+	if !strings.HasPrefix(location, "http://") && !strings.HasPrefix(location, "https://") {
+		return os.Open(strings.TrimPrefix(location, "file://"))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", location, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := m.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("expected http 200 but got %d from %s", resp.StatusCode, location)
+	}
+	return resp.Body, nil
+}
+
+// resolve returns the location of a build's binary, relative to the manifest
+func (m *Manager) resolve(build *Build) (string, error) {
+	if strings.HasPrefix(build.Path, "http://") || strings.HasPrefix(build.Path, "https://") {
+		return build.Path, nil
+	}
+	if strings.Contains(build.Path, "..") || strings.HasPrefix(build.Path, "/") {
+		return "", fmt.Errorf("unsafe path: %s", build.Path)
+	}
+
+	if strings.HasPrefix(m.config.Manifest, "http://") || strings.HasPrefix(m.config.Manifest, "https://") {
+		base, err := url.Parse(m.config.Manifest)
+		if err != nil {
+			return "", err
+		}
+		return base.ResolveReference(&url.URL{Path: build.Path}).String(), nil
+	}
+
+	return filepath.Join(filepath.Dir(strings.TrimPrefix(m.config.Manifest, "file://")), build.Path), nil
+}
+
+// binaryName is the file name a build is installed under
+func binaryName(build *Build) string {
+	name := path.Base(build.Path)
+	if u, err := url.Parse(build.Path); err == nil && u.Path != "" {
+		name = path.Base(u.Path)
+	}
+	return name
+}
+
+func (m *Manager) versionLock(version string) *sync.Mutex {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	lock, ok := m.versionLocks[version]
+	if !ok {
+		lock = &sync.Mutex{}
+		m.versionLocks[version] = lock
+	}
+	return lock
+}
+
+// Versions returns all releases, newest first
+func (m *Manager) Versions(ctx context.Context) ([]*Build, error) {
+	manifest, err := m.Manifest(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []*Build
+	for version := range manifest.Releases {
+		if build := manifest.Release(version); build != nil {
+			result = append(result, build)
+		}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return CompareVersions(result[i].Version, result[j].Version) > 0
+	})
+
+	return result, nil
+}
+
+// Installed returns whether the given version has already been installed, without installing it
+func (m *Manager) Installed(build *Build) bool {
+	for _, dir := range []string{m.config.OfflineDir, m.config.Dir} {
+		if dir == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(dir, binaryName(build))); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Install returns the path to the binary for the given release, downloading and verifying it first if needed
+func (m *Manager) Install(ctx context.Context, version string) (string, error) {
+	lock := m.versionLock(version)
+	lock.Lock()
+	defer lock.Unlock()
+
+	m.lock.Lock()
+	binary, ok := m.verified[version]
+	m.lock.Unlock()
+	if ok {
+		return binary, nil
+	}
+
+	manifest, err := m.Manifest(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	build := manifest.Release(version)
+	if build == nil {
+		return "", fmt.Errorf("%w: %s %s", ErrUnknownVersion, m.language, version)
+	}
+	if build.SHA256 == "" && build.Keccak256 == "" {
+		binary, err = m.preloaded(build)
+	} else {
+		binary, err = m.install(ctx, build)
+	}
+	if err != nil {
+		return "", err
+	}
+
+	m.lock.Lock()
+	m.verified[version] = binary
+	m.lock.Unlock()
+
+	return binary, nil
+}
+
+// preloaded returns the binary for a build without a checksum, which is only trusted if it was preloaded into the
+// offline dir. Nothing is ever downloaded without a checksum.
+func (m *Manager) preloaded(build *Build) (string, error) {
+	if m.config.OfflineDir != "" {
+		binary := filepath.Join(m.config.OfflineDir, binaryName(build))
+		if _, err := os.Stat(binary); err == nil {
+			return binary, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %s %s", ErrNoChecksum, m.language, build.Version)
+}
+
+func (m *Manager) install(ctx context.Context, build *Build) (string, error) {
+	name := binaryName(build)
+
+	// binaries which are already on disk are still checked, once per process
+	for _, dir := range []string{m.config.OfflineDir, m.config.Dir} {
+		if dir == "" {
+			continue
+		}
+
+		binary := filepath.Join(dir, name)
+		err := verifyFile(binary, build)
+		if err == nil {
+			return binary, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			log.WithError(err).WithField("path", binary).Warnf("ignoring invalid compiler binary")
+		}
+	}
+
+	location, err := m.resolve(build)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(m.config.Dir, os.FileMode(0755)); err != nil {
+		return "", fmt.Errorf("failed to create compiler dir: %w", err)
+	}
+
+	reader, err := m.open(ctx, location)
+	if err != nil {
+		return "", fmt.Errorf("failed to download %s %s: %w", m.language, build.Version, err)
+	}
+	defer reader.Close()
+
+	// write to a temporary file first, so that a partial download is never mistaken for the binary
+	tmp, err := os.CreateTemp(m.config.Dir, name+".*.tmp")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	sha, keccak := sha256.New(), crypto.NewKeccakState()
+	if _, err := io.Copy(io.MultiWriter(tmp, sha, keccak), reader); err != nil {
+		tmp.Close()
+		return "", fmt.Errorf("failed to download %s %s: %w", m.language, build.Version, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", fmt.Errorf("failed to write compiler: %w", err)
+	}
+
+	if err := verifyChecksums(build, sha, keccak); err != nil {
+		return "", err
+	}
+
+	if err := os.Chmod(tmp.Name(), os.FileMode(0755)); err != nil {
+		return "", fmt.Errorf("failed to make compiler executable: %w", err)
+	}
+
+	binary := filepath.Join(m.config.Dir, name)
+	if err := os.Rename(tmp.Name(), binary); err != nil {
+		return "", fmt.Errorf("failed to install compiler: %w", err)
+	}
+
+	log.WithFields(log.Fields{"language": m.language, "version": build.Version, "path": binary}).Infof("installed compiler")
+
+	return binary, nil
+}
+
+func verifyFile(file string, build *Build) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sha, keccak := sha256.New(), crypto.NewKeccakState()
+	if _, err := io.Copy(io.MultiWriter(sha, keccak), f); err != nil {
+		return err
+	}
+
+	return verifyChecksums(build, sha, keccak)
+}
+
+// verifyChecksums checks every checksum the manifest publishes for the build
+func verifyChecksums(build *Build, sha hash.Hash, keccak hash.Hash) error {
+	checks := []struct {
+		name     string
+		expected string
+		actual   []byte
+	}{
+		{"sha256", build.SHA256, sha.Sum(nil)},
+		{"keccak256", build.Keccak256, keccak.Sum(nil)},
+	}
+
+	for _, check := range checks {
+		if check.expected == "" {
+			continue
+		}
+
+		expected := strings.ToLower(strings.TrimPrefix(check.expected, "0x"))
+		if actual := hex.EncodeToString(check.actual); actual != expected {
+			return fmt.Errorf("%s mismatch for %s: expected %s but got %s", check.name, build.Path, expected, actual)
+		}
+	}
+
+	return nil
+}
+
+// CompareVersions orders two versions of the form major.minor.patch, returning -1, 0 or 1
+func CompareVersions(a, b string) int {
+	pa, pb := parseVersion(a), parseVersion(b)
+	for i := range pa {
+		if pa[i] < pb[i] {
+			return -1
+		}
+		if pa[i] > pb[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+func parseVersion(version string) [3]int {
+	var result [3]int
+	matches := versionRegexp.FindStringSubmatch(version)
+	if matches == nil {
+		return result
+	}
+	for i := range result {
+		result[i], _ = strconv.Atoi(matches[i+1])
+	}
+	return result
+}
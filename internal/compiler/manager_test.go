@@ -0,0 +1,416 @@
+package compiler
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func testBuild(version string, binary []byte) *Build {
+	sha := sha256.Sum256(binary)
+	return &Build{
+		Path:        "solc-linux-amd64-v" + version + "+commit.00000000",
+		Version:     version,
+		Build:       "commit.00000000",
+		LongVersion: version + "+commit.00000000",
+		SHA256:      "0x" + hex.EncodeToString(sha[:]),
+		Keccak256:   crypto.Keccak256Hash(binary).Hex(),
+	}
+}
+
+func testManifest(builds ...*Build) *Manifest {
+	manifest := &Manifest{
+		Builds:   builds,
+		Releases: make(map[string]string),
+	}
+	for _, build := range builds {
+		manifest.Releases[build.Version] = build.Path
+		if manifest.LatestRelease == "" || CompareVersions(build.Version, manifest.LatestRelease) > 0 {
+			manifest.LatestRelease = build.Version
+		}
+	}
+	return manifest
+}
+
+// testServer serves the manifest and binaries, counting binary downloads
+func testServer(t *testing.T, manifest *Manifest, binaries map[string][]byte) (*httptest.Server, *int32) {
+	var downloads int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/list.json" {
+			json.NewEncoder(w).Encode(manifest)
+			return
+		}
+		binary, ok := binaries[r.URL.Path[1:]]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		atomic.AddInt32(&downloads, 1)
+		w.Write(binary)
+	}))
+	t.Cleanup(server.Close)
+	return server, &downloads
+}
+
+func TestManagerInstall(t *testing.T) {
+	binary := []byte("#!/bin/sh\necho solc\n")
+	build := testBuild("0.8.17", binary)
+	server, downloads := testServer(t, testManifest(build), map[string][]byte{build.Path: binary})
+
+	dir := t.TempDir()
+	manager, err := NewManager(LanguageSolidity, &ManagerConfig{Manifest: server.URL + "/list.json", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manager.Installed(build) {
+		t.Error("expected the build not to be installed yet")
+	}
+
+	var wg sync.WaitGroup
+	paths := make([]string, 8)
+	errs := make([]error, 8)
+	for i := range paths {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			paths[i], errs[i] = manager.Install(context.Background(), "0.8.17")
+		}(i)
+	}
+	wg.Wait()
+
+	for i := range paths {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		if paths[i] != filepath.Join(dir, build.Path) {
+			t.Errorf("unexpected path %s", paths[i])
+		}
+	}
+	if *downloads != 1 {
+		t.Errorf("expected one download, got %d", *downloads)
+	}
+
+	info, err := os.Stat(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("expected the binary to be executable, got %v", info.Mode())
+	}
+	if !manager.Installed(build) {
+		t.Error("expected the build to be installed")
+	}
+
+	// a new manager verifies the existing binary instead of downloading it again
+	manager, err = NewManager(LanguageSolidity, &ManagerConfig{Manifest: server.URL + "/list.json", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Install(context.Background(), "0.8.17"); err != nil {
+		t.Fatal(err)
+	}
+	if *downloads != 1 {
+		t.Errorf("expected the installed binary to be reused, got %d downloads", *downloads)
+	}
+
+	// a corrupted binary is replaced
+	if err := os.WriteFile(paths[0], []byte("truncated"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	manager, err = NewManager(LanguageSolidity, &ManagerConfig{Manifest: server.URL + "/list.json", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Install(context.Background(), "0.8.17"); err != nil {
+		t.Fatal(err)
+	}
+	if *downloads != 2 {
+		t.Errorf("expected the corrupted binary to be downloaded again, got %d downloads", *downloads)
+	}
+	if data, _ := os.ReadFile(paths[0]); string(data) != string(binary) {
+		t.Errorf("expected the corrupted binary to be replaced")
+	}
+}
+
+func TestManagerChecksumMismatch(t *testing.T) {
+	build := testBuild("0.8.17", []byte("the real solc"))
+	server, _ := testServer(t, testManifest(build), map[string][]byte{build.Path: []byte("something else")})
+
+	dir := t.TempDir()
+	manager, err := NewManager(LanguageSolidity, &ManagerConfig{Manifest: server.URL + "/list.json", Dir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.Install(context.Background(), "0.8.17"); err == nil {
+		t.Fatal("expected a checksum mismatch")
+	}
+
+	// nothing is left behind, not even the temporary file
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("expected an empty dir, got %d entries", len(entries))
+	}
+}
+
+func TestManagerUnknownVersion(t *testing.T) {
+	build := testBuild("0.8.17", []byte("solc"))
+	unverified := &Build{Path: "solc-v0.8.16", Version: "0.8.16"}
+	server, _ := testServer(t, testManifest(build, unverified), nil)
+
+	manager, err := NewManager(LanguageSolidity, &ManagerConfig{Manifest: server.URL + "/list.json", Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.Install(context.Background(), "0.4.0"); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected ErrUnknownVersion, got %v", err)
+	}
+	if _, err := manager.Install(context.Background(), "0.8.16"); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("expected ErrNoChecksum, got %v", err)
+	}
+}
+
+func TestManagerOffline(t *testing.T) {
+	binary := []byte("solc")
+	build := testBuild("0.8.17", binary)
+
+	offline := t.TempDir()
+	manifest, err := json.Marshal(testManifest(build))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(offline, "list.json"), manifest, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(offline, build.Path), binary, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := NewManager(LanguageSolidity, &ManagerConfig{OfflineDir: offline, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binaryPath, err := manager.Install(context.Background(), "0.8.17")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binaryPath != filepath.Join(offline, build.Path) {
+		t.Errorf("expected the preloaded binary to be used in place, got %s", binaryPath)
+	}
+}
+
+func TestManagerOfflineWithoutChecksum(t *testing.T) {
+	// older vyper releases have no published checksums
+	build := &Build{Path: "vyper.0.3.1+commit.0463ea4c.linux", Version: "0.3.1"}
+	missing := &Build{Path: "vyper.0.3.0+commit.8a23feb6.linux", Version: "0.3.0"}
+	server, downloads := testServer(t, testManifest(build, missing), map[string][]byte{
+		build.Path:   []byte("vyper"),
+		missing.Path: []byte("vyper"),
+	})
+
+	offline := t.TempDir()
+	if err := os.WriteFile(filepath.Join(offline, build.Path), []byte("vyper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := NewManager(LanguageVyper, &ManagerConfig{Manifest: server.URL + "/list.json", OfflineDir: offline, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	binaryPath, err := manager.Install(context.Background(), "0.3.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if binaryPath != filepath.Join(offline, build.Path) {
+		t.Errorf("expected the preloaded binary to be used in place, got %s", binaryPath)
+	}
+
+	// binaries which aren't preloaded are never downloaded without a checksum
+	if _, err := manager.Install(context.Background(), "0.3.0"); !errors.Is(err, ErrNoChecksum) {
+		t.Errorf("expected ErrNoChecksum, got %v", err)
+	}
+	if *downloads != 0 {
+		t.Errorf("expected no downloads, got %d", *downloads)
+	}
+}
+
+func TestManagerSlowManifest(t *testing.T) {
+	binary := []byte("solc")
+	build := testBuild("0.8.17", binary)
+
+	var slow atomic.Bool
+	release := make(chan struct{})
+	fetching := make(chan struct{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/list.json" {
+			if slow.Load() {
+				fetching <- struct{}{}
+				<-release
+			}
+			json.NewEncoder(w).Encode(testManifest(build))
+			return
+		}
+		w.Write(binary)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	manager, err := NewManager(LanguageSolidity, &ManagerConfig{Manifest: server.URL + "/list.json", Dir: t.TempDir(), ManifestTTL: time.Nanosecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := manager.Install(context.Background(), "0.8.17"); err != nil {
+		t.Fatal(err)
+	}
+
+	// start a refresh which doesn't finish until the end of the test
+	slow.Store(true)
+	go manager.Manifest(context.Background())
+	<-fetching
+
+	done := make(chan error)
+	go func() {
+		// installed versions and the stale manifest don't wait for the refresh
+		if _, err := manager.Install(context.Background(), "0.8.17"); err != nil {
+			done <- err
+			return
+		}
+		_, err := manager.Manifest(context.Background())
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("blocked behind the manifest refresh")
+	}
+}
+
+func TestManagerVersions(t *testing.T) {
+	server, _ := testServer(t, testManifest(
+		testBuild("0.8.9", []byte("a")),
+		testBuild("0.8.17", []byte("b")),
+		testBuild("0.4.26", []byte("c")),
+	), nil)
+
+	manager, err := NewManager(LanguageSolidity, &ManagerConfig{Manifest: server.URL + "/list.json", Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	versions, err := manager.Versions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	for _, build := range versions {
+		got = append(got, build.Version)
+	}
+	expected := []string{"0.8.17", "0.8.9", "0.4.26"}
+	if len(got) != len(expected) {
+		t.Fatalf("expected %v, got %v", expected, got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	}
+}
+
+func TestParseGithubReleases(t *testing.T) {
+	suffix := githubAssetSuffix()
+	releases := []map[string]any{
+		{
+			"tag_name": "v0.3.7",
+			"assets": []map[string]any{
+				{"name": "vyper.0.3.7+commit.6020b8bb.other", "browser_download_url": "https://example.com/other"},
+				{"name": "vyper.0.3.7+commit.6020b8bb" + suffix, "browser_download_url": "https://example.com/0.3.7", "digest": "sha256:abcd"},
+			},
+		},
+		{
+			"tag_name": "v0.3.10",
+			"assets": []map[string]any{
+				{"name": "vyper.0.3.10+commit.91361694" + suffix, "browser_download_url": "https://example.com/0.3.10"},
+			},
+		},
+		{
+			"tag_name":   "v0.4.0rc1",
+			"prerelease": true,
+			"assets": []map[string]any{
+				{"name": "vyper.0.4.0rc1+commit.00000000" + suffix, "browser_download_url": "https://example.com/0.4.0rc1"},
+			},
+		},
+	}
+	data, err := json.Marshal(releases)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest, err := parseManifest(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if manifest.LatestRelease != "0.3.10" {
+		t.Errorf("expected latest release 0.3.10, got %s", manifest.LatestRelease)
+	}
+	if len(manifest.Builds) != 2 {
+		t.Fatalf("expected 2 builds, got %d", len(manifest.Builds))
+	}
+
+	build := manifest.Release("0.3.7")
+	if build == nil {
+		t.Fatal("expected a build for 0.3.7")
+	}
+	if build.Path != "https://example.com/0.3.7" || build.LongVersion != "0.3.7+commit.6020b8bb" || build.Build != "commit.6020b8bb" {
+		t.Errorf("unexpected build %+v", build)
+	}
+	if build.SHA256 != "0xabcd" {
+		t.Errorf("expected the digest to be used as the checksum, got %s", build.SHA256)
+	}
+	if manifest.Release("0.3.10").SHA256 != "" {
+		t.Errorf("expected no checksum without a digest")
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"0.8.17", "0.8.9", 1},
+		{"0.4.26", "0.5.0", -1},
+		{"0.3.10", "0.3.10", 0},
+		{"1.0.0", "0.99.99", 1},
+	}
+
+	for _, test := range tests {
+		if got := CompareVersions(test.a, test.b); got != test.expected {
+			t.Errorf("CompareVersions(%s, %s): expected %d, got %d", test.a, test.b, test.expected, got)
+		}
+	}
+}
@@ -0,0 +1,295 @@
+package compiler
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+var ErrNoMetadata = errors.New("code has no metadata")
+
+// Metadata is the CBOR encoded metadata solc and vyper append to runtime code. Solc appends a map with the hash of
+// the metadata JSON and, since 0.5.9, its version. Vyper appends its version, either on its own or at the end of a
+// list of the sizes of the code and its data sections.
+type Metadata struct {
+	// IPFS, Bzzr0 and Bzzr1 are the hash of the metadata JSON, at most one of which is set. IPFS is a multihash,
+	// the swarm hashes are plain keccak hashes.
+	IPFS  []byte
+	Bzzr0 []byte
+	Bzzr1 []byte
+
+	// Compiler is solc or vyper, and Version is its version. Version is empty for solc before 0.5.9, and includes
+	// the commit and date for prereleases.
+	Compiler     string
+	Version      string
+	Experimental bool
+
+	// Length is the number of bytes of code taken by the metadata, including its length
+	Length int
+}
+
+// DecodeMetadata decodes the metadata at the end of the code, or returns ErrNoMetadata if there isn't any
+func DecodeMetadata(code []byte) (*Metadata, error) {
+	if len(code) < 2 {
+		return nil, ErrNoMetadata
+	}
+
+	// the last two bytes are the length of the CBOR, which some vyper versions count the length in
+	length := int(code[len(code)-2])<<8 | int(code[len(code)-1])
+	for _, n := range []int{length, length - 2} {
+		if n <= 0 || n+2 > len(code) {
+			continue
+		}
+
+		value, err := decodeCBOR(code[len(code)-2-n : len(code)-2])
+		if err != nil {
+			continue
+		}
+
+		result, err := parseMetadata(value)
+		if err != nil {
+			continue
+		}
+		result.Length = n + 2
+		return result, nil
+	}
+
+	return nil, ErrNoMetadata
+}
+
+func parseMetadata(value any) (*Metadata, error) {
+	// vyper 0.4 appends a list which ends with the map holding its version
+	if list, ok := value.([]any); ok && len(list) > 0 {
+		value = list[len(list)-1]
+	}
+
+	fields, ok := value.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("expected a map, got %T", value)
+	}
+
+	result := &Metadata{}
+	for key, field := range fields {
+		var ok bool
+		switch key {
+		case "ipfs":
+			result.IPFS, ok = field.([]byte)
+		case "bzzr0":
+			result.Bzzr0, ok = field.([]byte)
+		case "bzzr1":
+			result.Bzzr1, ok = field.([]byte)
+		case "experimental":
+			result.Experimental, ok = field.(bool)
+		case "solc":
+			result.Compiler = "solc"
+			result.Version, ok = parseMetadataVersion(field)
+		case "vyper":
+			result.Compiler = "vyper"
+			result.Version, ok = parseMetadataVersion(field)
+		default:
+			// unknown fields are allowed, solc may add more in the future
+			ok = true
+		}
+		if !ok {
+			return nil, fmt.Errorf("invalid %s: %v", key, field)
+		}
+	}
+
+	if result.Compiler == "" && result.IPFS == nil && result.Bzzr0 == nil && result.Bzzr1 == nil {
+		return nil, fmt.Errorf("no known fields")
+	}
+
+	return result, nil
+}
+
+// parseMetadataVersion parses a version which is either three bytes or integers for a release, or a string for a
+// prerelease
+func parseMetadataVersion(field any) (string, bool) {
+	switch v := field.(type) {
+	case string:
+		return v, true
+	case []byte:
+		if len(v) != 3 {
+			return "", false
+		}
+		return fmt.Sprintf("%d.%d.%d", v[0], v[1], v[2]), true
+	case []any:
+		parts := make([]string, 0, len(v))
+		for _, part := range v {
+			n, ok := part.(uint64)
+			if !ok {
+				return "", false
+			}
+			parts = append(parts, fmt.Sprint(n))
+		}
+		return strings.Join(parts, "."), len(parts) > 0
+	default:
+		return "", false
+	}
+}
+
+// IsRelease returns whether the compiler version is a release, rather than a prerelease or unknown
+func (m *Metadata) IsRelease() bool {
+	_, n, err := parsePartialVersion(m.Version)
+	return err == nil && n == 3
+}
+
+// HashURI returns the location of the metadata JSON, e.g. ipfs://Qm..., or an empty string if there is no hash
+func (m *Metadata) HashURI() string {
+	switch {
+	case m.IPFS != nil:
+		return "ipfs://" + base58Encode(m.IPFS)
+	case m.Bzzr1 != nil:
+		return "bzz-raw://" + hex.EncodeToString(m.Bzzr1)
+	case m.Bzzr0 != nil:
+		return "bzz-raw://" + hex.EncodeToString(m.Bzzr0)
+	default:
+		return ""
+	}
+}
+
+const base58Alphabet = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
+
+// base58Encode encodes b with the bitcoin alphabet, as used by ipfs
+func base58Encode(b []byte) string {
+	var result []byte
+
+	n := new(big.Int).SetBytes(b)
+	radix := big.NewInt(58)
+	mod := new(big.Int)
+	for n.Sign() > 0 {
+		n.DivMod(n, radix, mod)
+		result = append(result, base58Alphabet[mod.Int64()])
+	}
+
+	// leading zero bytes are kept as leading ones
+	for _, c := range b {
+		if c != 0 {
+			break
+		}
+		result = append(result, base58Alphabet[0])
+	}
+
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return string(result)
+}
+
+// cborDecoder decodes the subset of CBOR compilers use: integers, byte and text strings, arrays, maps with text
+// keys, and booleans. Indefinite lengths, tags and floats aren't supported.
+type cborDecoder struct {
+	data []byte
+	pos  int
+}
+
+// decodeCBOR decodes a single value which must take up all of data
+func decodeCBOR(data []byte) (any, error) {
+	d := &cborDecoder{data: data}
+	value, err := d.decode()
+	if err != nil {
+		return nil, err
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("%d trailing bytes", len(data)-d.pos)
+	}
+	return value, nil
+}
+
+func (d *cborDecoder) take(n uint64) ([]byte, error) {
+	if n > uint64(len(d.data)-d.pos) {
+		return nil, fmt.Errorf("unexpected end of data")
+	}
+	result := d.data[d.pos : d.pos+int(n)]
+	d.pos += int(n)
+	return result, nil
+}
+
+// header reads the major type of the next item and its argument
+func (d *cborDecoder) header() (byte, uint64, byte, error) {
+	b, err := d.take(1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	major, info := b[0]>>5, b[0]&0x1f
+	if info < 24 {
+		return major, uint64(info), info, nil
+	}
+	if info > 27 {
+		return 0, 0, 0, fmt.Errorf("unsupported additional info %d", info)
+	}
+
+	raw, err := d.take(1 << (info - 24))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	var arg uint64
+	for _, c := range raw {
+		arg = arg<<8 | uint64(c)
+	}
+	return major, arg, info, nil
+}
+
+func (d *cborDecoder) decode() (any, error) {
+	major, arg, info, err := d.header()
+	if err != nil {
+		return nil, err
+	}
+
+	switch major {
+	case 0:
+		return arg, nil
+	case 2:
+		return d.take(arg)
+	case 3:
+		b, err := d.take(arg)
+		return string(b), err
+	case 4:
+		if arg > uint64(len(d.data)) {
+			return nil, fmt.Errorf("array of %d items is too long", arg)
+		}
+		result := make([]any, 0, arg)
+		for i := uint64(0); i < arg; i++ {
+			item, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			result = append(result, item)
+		}
+		return result, nil
+	case 5:
+		if arg > uint64(len(d.data)) {
+			return nil, fmt.Errorf("map of %d items is too long", arg)
+		}
+		result := make(map[string]any, arg)
+		for i := uint64(0); i < arg; i++ {
+			key, err := d.decode()
+			if err != nil {
+				return nil, err
+			}
+			name, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported map key %v", key)
+			}
+			if result[name], err = d.decode(); err != nil {
+				return nil, err
+			}
+		}
+		return result, nil
+	case 7:
+		switch info {
+		case 20:
+			return false, nil
+		case 21:
+			return true, nil
+		case 22, 23:
+			return nil, nil
+		}
+		return nil, fmt.Errorf("unsupported simple value %d", info)
+	default:
+		return nil, fmt.Errorf("unsupported major type %d", major)
+	}
+}
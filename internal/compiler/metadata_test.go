@@ -0,0 +1,123 @@
+package compiler
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecodeMetadata(t *testing.T) {
+	hash := strings.Repeat("01", 32)
+	code := "6080604052"
+
+	for _, test := range []struct {
+		name     string
+		metadata string
+		expected Metadata
+		uri      string
+	}{
+		{
+			name:     "solc ipfs",
+			metadata: "a2646970667358221220" + hash + "64736f6c63430008110033",
+			expected: Metadata{Compiler: "solc", Version: "0.8.17"},
+			uri:      "ipfs://QmNQa1FSTXNHmrjjfgUW3Px3Vkke4oKiFWdigWkYSux2Pi",
+		},
+		{
+			name:     "solc prerelease",
+			metadata: "a2646970667358221220" + hash + "64736f6c6378" + "1c" + hex.EncodeToString([]byte("0.8.18-nightly.2022.11.1+abc")) + "004d",
+			expected: Metadata{Compiler: "solc", Version: "0.8.18-nightly.2022.11.1+abc"},
+			uri:      "ipfs://QmNQa1FSTXNHmrjjfgUW3Px3Vkke4oKiFWdigWkYSux2Pi",
+		},
+		{
+			name:     "solc experimental",
+			metadata: "a3646970667358221220" + hash + "6c6578706572696d656e74616cf564736f6c634300060c0041",
+			expected: Metadata{Compiler: "solc", Version: "0.6.12", Experimental: true},
+			uri:      "ipfs://QmNQa1FSTXNHmrjjfgUW3Px3Vkke4oKiFWdigWkYSux2Pi",
+		},
+		{
+			name:     "solc bzzr1",
+			metadata: "a265627a7a72315820" + hash + "64736f6c634300050b0032",
+			expected: Metadata{Compiler: "solc", Version: "0.5.11"},
+			uri:      "bzz-raw://" + hash,
+		},
+		{
+			name:     "solc bzzr0",
+			metadata: "a165627a7a72305820" + hash + "0029",
+			expected: Metadata{},
+			uri:      "bzz-raw://" + hash,
+		},
+		{
+			name:     "vyper",
+			metadata: "a165767970657283000307000b",
+			expected: Metadata{Compiler: "vyper", Version: "0.3.7"},
+		},
+		{
+			name:     "vyper counting the length",
+			metadata: "a165767970657283000309000d",
+			expected: Metadata{Compiler: "vyper", Version: "0.3.9"},
+		},
+		{
+			name:     "vyper 0.4",
+			metadata: "841901238000a1657679706572830004000013",
+			expected: Metadata{Compiler: "vyper", Version: "0.4.0"},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			metadata, err := DecodeMetadata(append(hexToBytes(t, code), hexToBytes(t, test.metadata)...))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if metadata.Compiler != test.expected.Compiler || metadata.Version != test.expected.Version || metadata.Experimental != test.expected.Experimental {
+				t.Errorf("unexpected metadata %+v", metadata)
+			}
+			if metadata.Length != len(test.metadata)/2 {
+				t.Errorf("expected length %d, got %d", len(test.metadata)/2, metadata.Length)
+			}
+			if uri := metadata.HashURI(); uri != test.uri {
+				t.Errorf("expected %q, got %q", test.uri, uri)
+			}
+		})
+	}
+}
+
+func TestDecodeMetadataMissing(t *testing.T) {
+	for _, code := range []string{
+		"",
+		"00",
+		"60806040520002",
+		"6080604052a1650000",
+		// a map without any of the fields compilers use
+		"a1636b6579f50007",
+		// truncated
+		"a2646970667358221220" + strings.Repeat("01", 32) + "64736f6c6343000811",
+	} {
+		if _, err := DecodeMetadata(hexToBytes(t, code)); !errors.Is(err, ErrNoMetadata) {
+			t.Errorf("expected ErrNoMetadata for %s, got %v", code, err)
+		}
+	}
+}
+
+func TestBase58Encode(t *testing.T) {
+	for input, expected := range map[string]string{
+		"":         "",
+		"00":       "1",
+		"000001":   "112",
+		"61":       "2g",
+		"626262":   "a3gV",
+		"00000000": "1111",
+	} {
+		if actual := base58Encode(hexToBytes(t, input)); actual != expected {
+			t.Errorf("expected %s to encode to %q, got %q", input, expected, actual)
+		}
+	}
+}
+
+func hexToBytes(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,423 @@
+package compiler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPragma     = errors.New("invalid version pragma")
+	ErrNoMatchingVersion = errors.New("no compiler version satisfies the pragmas")
+)
+
+// comparator is a single bound on a version, e.g. >=0.8.0. The != comparator excludes the versions from version up to
+// but not including upper, so that it can exclude a whole prefix like !=0.3.*.
+type comparator struct {
+	op      string
+	version [3]int
+	upper   [3]int
+}
+
+func (c comparator) matches(version [3]int) bool {
+	cmp := compareParts(version, c.version)
+	switch c.op {
+	case "!=":
+		return cmp < 0 || compareParts(version, c.upper) >= 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case ">=":
+		return cmp >= 0
+	default:
+		return cmp == 0
+	}
+}
+
+func compareParts(a, b [3]int) int {
+	for i := range a {
+		if a[i] < b[i] {
+			return -1
+		}
+		if a[i] > b[i] {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Constraint is a semver range, as used by version pragmas. The syntax is that of npm, which solc follows:
+// comparators (>=0.6.2 <0.9.0), caret and tilde ranges (^0.8.0, ~0.4.24), partial and wildcard versions (0.8, 0.8.x),
+// hyphen ranges (0.6.0 - 0.8.0) and alternatives (^0.6.0 || ^0.8.0). Vyper pragmas may also be PEP 440 specifiers,
+// see VyperPragmas.
+type Constraint struct {
+	raw string
+	// alternatives are ORed, the comparators of each alternative are ANDed
+	alternatives [][]comparator
+}
+
+func (c *Constraint) String() string {
+	return c.raw
+}
+
+// Matches returns whether the version, of the form major.minor.patch, satisfies the constraint
+func (c *Constraint) Matches(version string) bool {
+	parts, n, err := parsePartialVersion(version)
+	if err != nil || n != 3 {
+		return false
+	}
+
+	for _, alternative := range c.alternatives {
+		ok := true
+		for _, comparator := range alternative {
+			if !comparator.matches(parts) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return true
+		}
+	}
+	return false
+}
+
+func ParseConstraint(raw string) (*Constraint, error) {
+	result := &Constraint{
+		raw: strings.TrimSpace(raw),
+	}
+
+	for _, alternative := range strings.Split(raw, "||") {
+		comparators, err := parseRange(alternative)
+		if err != nil {
+			return nil, fmt.Errorf("invalid version constraint %q: %w", raw, err)
+		}
+		result.alternatives = append(result.alternatives, comparators)
+	}
+
+	return result, nil
+}
+
+var rangeTermRegexp = regexp.MustCompile(`(\^|~|>=|<=|>|<|=)?\s*([0-9xX*][0-9xX*.]*)`)
+
+func parseRange(raw string) ([]comparator, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || raw == "*" {
+		return nil, nil
+	}
+
+	// hyphen ranges are the only place a bare dash can appear
+	if from, to, ok := strings.Cut(raw, " - "); ok {
+		lower, err := parseTerm(">=", strings.TrimSpace(from))
+		if err != nil {
+			return nil, err
+		}
+		upper, err := parseTerm("<=", strings.TrimSpace(to))
+		if err != nil {
+			return nil, err
+		}
+		return append(lower, upper...), nil
+	}
+
+	var result []comparator
+	rest := raw
+	for rest != "" {
+		loc := rangeTermRegexp.FindStringSubmatchIndex(rest)
+		if loc == nil || strings.TrimSpace(rest[:loc[0]]) != "" {
+			return nil, fmt.Errorf("unexpected %q", strings.TrimSpace(rest))
+		}
+
+		op := ""
+		if loc[2] >= 0 {
+			op = rest[loc[2]:loc[3]]
+		}
+
+		comparators, err := parseTerm(op, rest[loc[4]:loc[5]])
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, comparators...)
+
+		rest = strings.TrimSpace(rest[loc[1]:])
+	}
+
+	return result, nil
+}
+
+var pep440SpecifierRegexp = regexp.MustCompile(`^(~=|==|!=|>=|<=|>|<)\s*([0-9]+(?:\.[0-9]+){0,2})(\.\*)?$`)
+
+// parsePEP440 parses comma separated PEP 440 version specifiers, e.g. ~=0.4.0 or >=0.4.0,<0.5.0. Unlike npm ranges,
+// missing components are zero, so ==0.4 only matches 0.4.0, and only == and != take a trailing .* to match a prefix.
+func parsePEP440(raw string) (*Constraint, error) {
+	var comparators []comparator
+	for _, specifier := range strings.Split(raw, ",") {
+		match := pep440SpecifierRegexp.FindStringSubmatch(strings.TrimSpace(specifier))
+		if match == nil {
+			return nil, fmt.Errorf("invalid version specifier %q", strings.TrimSpace(specifier))
+		}
+		op, wildcard := match[1], match[3] != ""
+
+		parts, n, err := parsePartialVersion(match[2])
+		if err != nil {
+			return nil, err
+		}
+		if wildcard && op != "==" && op != "!=" {
+			return nil, fmt.Errorf("invalid version specifier %q", strings.TrimSpace(specifier))
+		}
+
+		switch op {
+		case "~=":
+			// the last component given may change, e.g. ~=0.4.1 is >=0.4.1 and ==0.4.*
+			if n < 2 {
+				return nil, fmt.Errorf("invalid version specifier %q", strings.TrimSpace(specifier))
+			}
+			comparators = append(comparators, comparator{op: ">=", version: parts}, comparator{op: "<", version: bump(parts, n-2)})
+		case "==":
+			if wildcard {
+				comparators = append(comparators, comparator{op: ">=", version: parts}, comparator{op: "<", version: bump(parts, n-1)})
+			} else {
+				comparators = append(comparators, comparator{op: "=", version: parts})
+			}
+		case "!=":
+			upper := bump(parts, 2)
+			if wildcard {
+				upper = bump(parts, n-1)
+			}
+			comparators = append(comparators, comparator{op: "!=", version: parts, upper: upper})
+		default:
+			comparators = append(comparators, comparator{op: op, version: parts})
+		}
+	}
+
+	return &Constraint{
+		raw:          strings.TrimSpace(raw),
+		alternatives: [][]comparator{comparators},
+	}, nil
+}
+
+// parsePartialVersion parses a version which may be missing components or use wildcards, returning the number of
+// components which were given
+func parsePartialVersion(raw string) ([3]int, int, error) {
+	var parts [3]int
+
+	fields := strings.Split(raw, ".")
+	if len(fields) > 3 {
+		return parts, 0, fmt.Errorf("invalid version %q", raw)
+	}
+
+	for i, field := range fields {
+		if field == "x" || field == "X" || field == "*" {
+			return parts, i, nil
+		}
+
+		value, err := strconv.Atoi(field)
+		if err != nil || value < 0 {
+			return parts, 0, fmt.Errorf("invalid version %q", raw)
+		}
+		parts[i] = value
+	}
+
+	return parts, len(fields), nil
+}
+
+// bump increments the component at index i and zeroes the ones after it
+func bump(parts [3]int, i int) [3]int {
+	parts[i]++
+	for j := i + 1; j < len(parts); j++ {
+		parts[j] = 0
+	}
+	return parts
+}
+
+// parseTerm turns a single operator and partial version into the comparators it stands for
+func parseTerm(op string, raw string) ([]comparator, error) {
+	parts, n, err := parsePartialVersion(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	if n == 0 {
+		// a wildcard matches everything, except that < * matches nothing
+		if op == "<" || op == ">" {
+			return []comparator{{op: "<", version: [3]int{}}}, nil
+		}
+		return nil, nil
+	}
+
+	switch op {
+	case "^":
+		// the first non-zero component may not change, or the last given one if they are all zero
+		i := n - 1
+		for j := 0; j < n; j++ {
+			if parts[j] != 0 {
+				i = j
+				break
+			}
+		}
+		return []comparator{{op: ">=", version: parts}, {op: "<", version: bump(parts, i)}}, nil
+	case "~":
+		// the minor version may not change if it is given, otherwise the major version may not
+		i := 1
+		if n == 1 {
+			i = 0
+		}
+		return []comparator{{op: ">=", version: parts}, {op: "<", version: bump(parts, i)}}, nil
+	case ">":
+		if n < 3 {
+			return []comparator{{op: ">=", version: bump(parts, n-1)}}, nil
+		}
+		return []comparator{{op: ">", version: parts}}, nil
+	case "<=":
+		if n < 3 {
+			return []comparator{{op: "<", version: bump(parts, n-1)}}, nil
+		}
+		return []comparator{{op: "<=", version: parts}}, nil
+	case ">=", "<":
+		return []comparator{{op: op, version: parts}}, nil
+	default:
+		if n < 3 {
+			return []comparator{{op: ">=", version: parts}, {op: "<", version: bump(parts, n-1)}}, nil
+		}
+		return []comparator{{op: "=", version: parts}}, nil
+	}
+}
+
+// maskSolidity replaces comments and the contents of string literals with spaces, so that only code is left
+func maskSolidity(source string) string {
+	var result strings.Builder
+	result.Grow(len(source))
+
+	for i := 0; i < len(source); i++ {
+		c := source[i]
+		switch {
+		case c == '"' || c == '\'':
+			// skip to the closing quote, minding escaped quotes
+			j := i + 1
+			for j < len(source) && source[j] != c && source[j] != '\n' {
+				if source[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(source) {
+				j = len(source) - 1
+			}
+			result.WriteByte(c)
+			if j > i {
+				result.WriteString(strings.Repeat(" ", j-i-1))
+				result.WriteByte(source[j])
+			}
+			i = j
+		case c == '/' && i+1 < len(source) && source[i+1] == '/':
+			for i < len(source) && source[i] != '\n' {
+				result.WriteByte(' ')
+				i++
+			}
+			if i < len(source) {
+				result.WriteByte('\n')
+			}
+		case c == '/' && i+1 < len(source) && source[i+1] == '*':
+			end := strings.Index(source[i+2:], "*/")
+			if end < 0 {
+				end = len(source)
+			} else {
+				end += i + 4
+			}
+			for ; i < end; i++ {
+				if source[i] == '\n' {
+					result.WriteByte('\n')
+				} else {
+					result.WriteByte(' ')
+				}
+			}
+			i--
+		default:
+			result.WriteByte(c)
+		}
+	}
+
+	return result.String()
+}
+
+var solidityPragmaRegexp = regexp.MustCompile(`\bpragma\s+solidity\s+([^;]*);`)
+
+// SolidityPragmas returns the constraints of every `pragma solidity` in the source
+func SolidityPragmas(source string) ([]*Constraint, error) {
+	var result []*Constraint
+	for _, match := range solidityPragmaRegexp.FindAllStringSubmatch(maskSolidity(source), -1) {
+		constraint, err := ParseConstraint(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPragma, err)
+		}
+		result = append(result, constraint)
+	}
+	return result, nil
+}
+
+var vyperPragmaRegexp = regexp.MustCompile(`(?m)^[ \t]*#[ \t]*(?:@version|pragma[ \t]+version)[ \t]+(.+?)[ \t]*$`)
+
+// isPEP440 returns whether the constraint uses syntax only PEP 440 specifiers have, otherwise it's parsed as an npm
+// range. The two agree on single comparators like >=0.3.0 and exact versions.
+func isPEP440(raw string) bool {
+	return strings.Contains(raw, ",") || strings.Contains(raw, "~=") || strings.Contains(raw, "==") || strings.Contains(raw, "!=")
+}
+
+// VyperPragmas returns the constraints of every `# @version` and `#pragma version` comment in the source. Vyper 0.4
+// takes PEP 440 specifiers like ~=0.4.0 or >=0.4.0,<0.5.0, while older releases take npm ranges like solc.
+func VyperPragmas(source string) ([]*Constraint, error) {
+	var result []*Constraint
+	for _, match := range vyperPragmaRegexp.FindAllStringSubmatch(source, -1) {
+		parse := ParseConstraint
+		if isPEP440(match[1]) {
+			parse = parsePEP440
+		}
+
+		constraint, err := parse(match[1])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPragma, err)
+		}
+		result = append(result, constraint)
+	}
+	return result, nil
+}
+
+// Resolve returns the newest release which satisfies every constraint and can be installed. With no constraints,
+// that is the latest release. Releases without a checksum are skipped unless they were preloaded, as Install would
+// refuse them.
+func (m *Manager) Resolve(ctx context.Context, constraints []*Constraint) (string, error) {
+	versions, err := m.Versions(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	for _, build := range versions {
+		if build.SHA256 == "" && build.Keccak256 == "" {
+			if _, err := m.preloaded(build); err != nil {
+				continue
+			}
+		}
+
+		ok := true
+		for _, constraint := range constraints {
+			if !constraint.Matches(build.Version) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return build.Version, nil
+		}
+	}
+
+	descriptions := make([]string, 0, len(constraints))
+	for _, constraint := range constraints {
+		descriptions = append(descriptions, constraint.String())
+	}
+	return "", fmt.Errorf("%w: %s", ErrNoMatchingVersion, strings.Join(descriptions, ", "))
+}
@@ -0,0 +1,264 @@
+package compiler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConstraintMatches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matches    []string
+		rejects    []string
+	}{
+		{"^0.8.0", []string{"0.8.0", "0.8.17"}, []string{"0.7.6", "0.9.0"}},
+		{"^0.4.24", []string{"0.4.24", "0.4.26"}, []string{"0.4.23", "0.5.0"}},
+		{"^1.2.3", []string{"1.2.3", "1.9.0"}, []string{"2.0.0", "1.2.2"}},
+		{"^0.0.3", []string{"0.0.3"}, []string{"0.0.4"}},
+		{"~0.4.24", []string{"0.4.24", "0.4.26"}, []string{"0.5.0", "0.4.23"}},
+		{"~0.8", []string{"0.8.0", "0.8.17"}, []string{"0.9.0"}},
+		{">=0.6.2 <0.9.0", []string{"0.6.2", "0.8.17"}, []string{"0.6.1", "0.9.0"}},
+		{">=0.6.2<0.9.0", []string{"0.7.0"}, []string{"0.9.0"}},
+		{">= 0.5.0", []string{"0.5.0", "0.8.17"}, []string{"0.4.26"}},
+		{"0.8.17", []string{"0.8.17"}, []string{"0.8.16", "0.8.18"}},
+		{"=0.8.17", []string{"0.8.17"}, []string{"0.8.16"}},
+		{"0.8", []string{"0.8.0", "0.8.17"}, []string{"0.7.6", "0.9.0"}},
+		{"0.8.x", []string{"0.8.17"}, []string{"0.9.0"}},
+		{">0.8", []string{"0.9.0"}, []string{"0.8.17"}},
+		{"<=0.8", []string{"0.8.17"}, []string{"0.9.0"}},
+		{"<0.8", []string{"0.7.6"}, []string{"0.8.0"}},
+		{"0.6.0 - 0.7", []string{"0.6.0", "0.7.6"}, []string{"0.5.17", "0.8.0"}},
+		{"^0.6.0 || ^0.8.0", []string{"0.6.12", "0.8.17"}, []string{"0.7.6"}},
+		{"*", []string{"0.4.11", "0.8.17"}, nil},
+	}
+
+	for _, test := range tests {
+		constraint, err := ParseConstraint(test.constraint)
+		if err != nil {
+			t.Errorf("%s: %v", test.constraint, err)
+			continue
+		}
+
+		for _, version := range test.matches {
+			if !constraint.Matches(version) {
+				t.Errorf("expected %s to match %s", test.constraint, version)
+			}
+		}
+		for _, version := range test.rejects {
+			if constraint.Matches(version) {
+				t.Errorf("expected %s not to match %s", test.constraint, version)
+			}
+		}
+	}
+}
+
+func TestParseConstraintErrors(t *testing.T) {
+	for _, raw := range []string{"latest", "^0.8.0 foo", ">=0.a", "1.2.3.4"} {
+		if _, err := ParseConstraint(raw); err == nil {
+			t.Errorf("expected %q to be invalid", raw)
+		}
+	}
+}
+
+func TestPEP440Matches(t *testing.T) {
+	tests := []struct {
+		constraint string
+		matches    []string
+		rejects    []string
+	}{
+		{"~=0.4.0", []string{"0.4.0", "0.4.3"}, []string{"0.3.10", "0.5.0"}},
+		{"~=0.4", []string{"0.4.0", "0.9.0"}, []string{"0.3.10", "1.0.0"}},
+		{">=0.4.0,<0.5.0", []string{"0.4.0", "0.4.3"}, []string{"0.3.10", "0.5.0"}},
+		{">=0.4.0, <0.5.0", []string{"0.4.1"}, []string{"0.5.0"}},
+		{"==0.4.1", []string{"0.4.1"}, []string{"0.4.0", "0.4.2"}},
+		{"==0.4", []string{"0.4.0"}, []string{"0.4.1"}},
+		{"==0.4.*", []string{"0.4.0", "0.4.3"}, []string{"0.3.10", "0.5.0"}},
+		{">=0.3.0,!=0.3.8", []string{"0.3.7", "0.3.9"}, []string{"0.3.8", "0.2.16"}},
+		{">=0.3.0,!=0.3.*", []string{"0.4.0"}, []string{"0.3.0", "0.3.10"}},
+		{"<=0.4", []string{"0.4.0"}, []string{"0.4.1"}},
+	}
+
+	for _, test := range tests {
+		constraint, err := parsePEP440(test.constraint)
+		if err != nil {
+			t.Errorf("%s: %v", test.constraint, err)
+			continue
+		}
+
+		for _, version := range test.matches {
+			if !constraint.Matches(version) {
+				t.Errorf("expected %s to match %s", test.constraint, version)
+			}
+		}
+		for _, version := range test.rejects {
+			if constraint.Matches(version) {
+				t.Errorf("expected %s not to match %s", test.constraint, version)
+			}
+		}
+	}
+}
+
+func TestParsePEP440Errors(t *testing.T) {
+	for _, raw := range []string{"~=0", ">=0.4.*", "^0.4.0,<0.5.0", ">=0.4.0,", "==0.4.0rc1", "0.4.0,0.5.0"} {
+		if _, err := parsePEP440(raw); err == nil {
+			t.Errorf("expected %q to be invalid", raw)
+		}
+	}
+}
+
+func TestSolidityPragmas(t *testing.T) {
+	source := `// SPDX-License-Identifier: MIT
+// pragma solidity ^0.4.0;
+/* pragma solidity ^0.5.0;
+   still a comment */
+pragma solidity >=0.6.2 <0.9.0;
+pragma experimental ABIEncoderV2;
+pragma solidity ^0.8.0;
+
+contract A {
+    string s = "pragma solidity ^0.7.0; // not a comment";
+}
+`
+
+	constraints, err := SolidityPragmas(source)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(constraints) != 2 {
+		t.Fatalf("expected 2 pragmas, got %v", constraints)
+	}
+	if constraints[0].String() != ">=0.6.2 <0.9.0" || constraints[1].String() != "^0.8.0" {
+		t.Errorf("unexpected pragmas %v", constraints)
+	}
+}
+
+func TestSolidityPragmasUnterminated(t *testing.T) {
+	for _, source := range []string{`"`, `'abc\`, "/* pragma solidity ^0.8.0;", "pragma solidity ^0.8.0; //"} {
+		if _, err := SolidityPragmas(source); err != nil {
+			t.Errorf("%q: %v", source, err)
+		}
+	}
+}
+
+func TestInvalidPragma(t *testing.T) {
+	if _, err := SolidityPragmas("pragma solidity latest;"); !errors.Is(err, ErrInvalidPragma) {
+		t.Errorf("expected ErrInvalidPragma, got %v", err)
+	}
+	if _, err := VyperPragmas("# @version latest\n"); !errors.Is(err, ErrInvalidPragma) {
+		t.Errorf("expected ErrInvalidPragma, got %v", err)
+	}
+}
+
+func TestVyperPragmas(t *testing.T) {
+	for _, source := range []string{
+		"# @version ^0.3.7\n\n@external\ndef foo():\n    pass\n",
+		"#pragma version ^0.3.7\n",
+		"# pragma version ^0.3.7  \n",
+	} {
+		constraints, err := VyperPragmas(source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(constraints) != 1 || constraints[0].String() != "^0.3.7" {
+			t.Errorf("unexpected pragmas %v in %q", constraints, source)
+		}
+	}
+
+	// vyper 0.4 takes PEP 440 specifiers
+	for _, source := range []string{
+		"#pragma version ~=0.4.0\n",
+		"#pragma version >=0.4.0,<0.5.0\n",
+		"# pragma version ==0.4.*\n",
+	} {
+		constraints, err := VyperPragmas(source)
+		if err != nil {
+			t.Fatalf("%q: %v", source, err)
+		}
+		if len(constraints) != 1 || !constraints[0].Matches("0.4.1") || constraints[0].Matches("0.5.0") {
+			t.Errorf("unexpected pragmas %v in %q", constraints, source)
+		}
+	}
+}
+
+func TestManagerResolve(t *testing.T) {
+	server, _ := testServer(t, testManifest(
+		testBuild("0.6.12", []byte("a")),
+		testBuild("0.7.6", []byte("b")),
+		testBuild("0.8.16", []byte("c")),
+		testBuild("0.8.17", []byte("d")),
+	), nil)
+
+	manager, err := NewManager(LanguageSolidity, &ManagerConfig{Manifest: server.URL + "/list.json", Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resolve := func(raw ...string) (string, error) {
+		var constraints []*Constraint
+		for _, r := range raw {
+			constraint, err := ParseConstraint(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			constraints = append(constraints, constraint)
+		}
+		return manager.Resolve(context.Background(), constraints)
+	}
+
+	if version, err := resolve(); err != nil || version != "0.8.17" {
+		t.Errorf("expected the latest release without pragmas, got %s %v", version, err)
+	}
+	if version, err := resolve("^0.8.0", "<0.8.17"); err != nil || version != "0.8.16" {
+		t.Errorf("expected the pragmas to be intersected, got %s %v", version, err)
+	}
+	if version, err := resolve(">=0.6.2 <0.8.0"); err != nil || version != "0.7.6" {
+		t.Errorf("expected 0.7.6, got %s %v", version, err)
+	}
+	if _, err := resolve("^0.8.0", "^0.7.0"); !errors.Is(err, ErrNoMatchingVersion) {
+		t.Errorf("expected ErrNoMatchingVersion, got %v", err)
+	}
+}
+
+func TestManagerResolveWithoutChecksum(t *testing.T) {
+	// older vyper releases have no published checksums, so they can't be installed unless they're preloaded
+	preloaded := &Build{Path: "vyper.0.3.1+commit.0463ea4c.linux", Version: "0.3.1"}
+	missing := &Build{Path: "vyper.0.3.2+commit.3b6a4117.linux", Version: "0.3.2"}
+	server, _ := testServer(t, testManifest(
+		testBuild("0.2.16", []byte("a")),
+		preloaded,
+		missing,
+	), nil)
+
+	offline := t.TempDir()
+	if err := os.WriteFile(filepath.Join(offline, preloaded.Path), []byte("vyper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	manager, err := NewManager(LanguageVyper, &ManagerConfig{Manifest: server.URL + "/list.json", OfflineDir: offline, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if version, err := manager.Resolve(context.Background(), nil); err != nil || version != "0.3.1" {
+		t.Errorf("expected the newest preloaded release, got %s %v", version, err)
+	}
+
+	constraint, err := ParseConstraint("<0.3.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version, err := manager.Resolve(context.Background(), []*Constraint{constraint}); err != nil || version != "0.2.16" {
+		t.Errorf("expected 0.2.16, got %s %v", version, err)
+	}
+
+	constraint, err = ParseConstraint("0.3.2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Resolve(context.Background(), []*Constraint{constraint}); !errors.Is(err, ErrNoMatchingVersion) {
+		t.Errorf("expected ErrNoMatchingVersion, got %v", err)
+	}
+}
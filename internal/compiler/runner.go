@@ -0,0 +1,245 @@
+package compiler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrOverloaded  = errors.New("too many compilations queued")
+	ErrTimeout     = errors.New("compilation timed out")
+	ErrOutputLimit = errors.New("compiler output too large")
+)
+
+type RunnerConfig struct {
+	// Workers is the number of compilers which may run at once, defaulting to the number of cpus
+	Workers int
+	// QueueSize is the number of runs which may wait for a worker, any more are rejected with ErrOverloaded
+	QueueSize int
+	// Timeout bounds the wall clock time of a run, and CPUTime its cpu time
+	Timeout time.Duration
+	CPUTime time.Duration
+	// MemoryBytes bounds the address space of the compiler
+	MemoryBytes uint64
+	// OutputBytes bounds both the output of the compiler and the size of any file it writes
+	OutputBytes int64
+	// ScratchDir is where each run gets its own working directory, defaulting to the system temporary directory
+	ScratchDir string
+}
+
+// RunnerStats is a snapshot of the counters of a runner
+type RunnerStats struct {
+	Workers   int
+	Running   int64
+	Queued    int64
+	Completed uint64
+	Failed    uint64
+	Timeouts  uint64
+	Rejected  uint64
+}
+
+// Runner runs compiler binaries with bounded concurrency and resources. Each run gets an empty working directory
+// and a minimal environment, and is killed if it exceeds its limits.
+type Runner struct {
+	config RunnerConfig
+	slots  chan struct{}
+
+	running   int64
+	queued    int64
+	completed uint64
+	failed    uint64
+	timeouts  uint64
+	rejected  uint64
+}
+
+func NewRunner(config *RunnerConfig) *Runner {
+	cfg := *config
+	if cfg.Workers <= 0 {
+		cfg.Workers = runtime.NumCPU()
+	}
+	if cfg.Timeout == 0 {
+		cfg.Timeout = time.Minute
+	}
+	if cfg.CPUTime == 0 {
+		cfg.CPUTime = cfg.Timeout
+	}
+	if cfg.MemoryBytes == 0 {
+		cfg.MemoryBytes = 4 << 30
+	}
+	if cfg.OutputBytes == 0 {
+		cfg.OutputBytes = 64 << 20
+	}
+	if cfg.ScratchDir == "" {
+		cfg.ScratchDir = os.TempDir()
+	}
+
+	return &Runner{
+		config: cfg,
+		slots:  make(chan struct{}, cfg.Workers),
+	}
+}
+
+// Stats returns a snapshot of the counters
+func (r *Runner) Stats() RunnerStats {
+	return RunnerStats{
+		Workers:   r.config.Workers,
+		Running:   atomic.LoadInt64(&r.running),
+		Queued:    atomic.LoadInt64(&r.queued),
+		Completed: atomic.LoadUint64(&r.completed),
+		Failed:    atomic.LoadUint64(&r.failed),
+		Timeouts:  atomic.LoadUint64(&r.timeouts),
+		Rejected:  atomic.LoadUint64(&r.rejected),
+	}
+}
+
+// acquire waits for a worker, or fails immediately if the queue is full
+func (r *Runner) acquire(ctx context.Context) error {
+	select {
+	case r.slots <- struct{}{}:
+		return nil
+	default:
+	}
+
+	if atomic.AddInt64(&r.queued, 1) > int64(r.config.QueueSize) {
+		atomic.AddInt64(&r.queued, -1)
+		atomic.AddUint64(&r.rejected, 1)
+		return ErrOverloaded
+	}
+	defer atomic.AddInt64(&r.queued, -1)
+
+	select {
+	case r.slots <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Runner) release() {
+	<-r.slots
+}
+
+// limitedBuffer collects output until the limit is reached, then cancels the run
+type limitedBuffer struct {
+	lock     sync.Mutex
+	buf      bytes.Buffer
+	limit    int64
+	total    *int64
+	exceeded bool
+	cancel   context.CancelFunc
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if atomic.AddInt64(b.total, int64(len(p))) > b.limit {
+		b.exceeded = true
+		b.cancel()
+		return 0, ErrOutputLimit
+	}
+	return b.buf.Write(p)
+}
+
+func (b *limitedBuffer) isExceeded() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.exceeded
+}
+
+// Run runs binary with the given arguments and stdin, returning its stdout and stderr. An error is returned if the
+// binary couldn't be run, was killed, or exited with a non-zero status, in which case the error wraps an
+// *exec.ExitError.
+func (r *Runner) Run(ctx context.Context, binary string, args []string, stdin []byte) ([]byte, []byte, error) {
+	if err := r.acquire(ctx); err != nil {
+		return nil, nil, err
+	}
+	defer r.release()
+
+	atomic.AddInt64(&r.running, 1)
+	defer atomic.AddInt64(&r.running, -1)
+
+	stdout, stderr, err := r.run(ctx, binary, args, stdin)
+	if err != nil {
+		atomic.AddUint64(&r.failed, 1)
+		if errors.Is(err, ErrTimeout) {
+			atomic.AddUint64(&r.timeouts, 1)
+		}
+	} else {
+		atomic.AddUint64(&r.completed, 1)
+	}
+	return stdout, stderr, err
+}
+
+func (r *Runner) run(ctx context.Context, binary string, args []string, stdin []byte) ([]byte, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.config.Timeout)
+	defer cancel()
+
+	scratch, err := os.MkdirTemp(r.config.ScratchDir, "compile-*")
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create scratch dir: %w", err)
+	}
+	defer os.RemoveAll(scratch)
+
+	var total int64
+	stdout := &limitedBuffer{limit: r.config.OutputBytes, total: &total, cancel: cancel}
+	stderr := &limitedBuffer{limit: r.config.OutputBytes, total: &total, cancel: cancel}
+
+	cmd := exec.Command(binary, args...)
+	cmd.Dir = scratch
+	// nothing from our environment is passed on, in particular no credentials
+	cmd.Env = []string{
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+		"HOME=" + scratch,
+		"TMPDIR=" + scratch,
+		"LANG=C.UTF-8",
+	}
+	cmd.Stdin = bytes.NewReader(stdin)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	isolate(cmd)
+
+	if err := cmd.Start(); err != nil {
+		return nil, nil, fmt.Errorf("failed to start compiler: %w", err)
+	}
+
+	// the limits can only be applied once the compiler has started, so anything it forks before then runs without
+	// them. solc and vyper don't fork at startup, and a child would still be in the process group killed on timeout,
+	// and write to the same limited output.
+	if err := limit(cmd.Process.Pid, &r.config); err != nil {
+		kill(cmd)
+		cmd.Wait()
+		return nil, nil, fmt.Errorf("failed to limit compiler: %w", err)
+	}
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			kill(cmd)
+		case <-done:
+		}
+	}()
+
+	err = cmd.Wait()
+
+	switch {
+	case stdout.isExceeded() || stderr.isExceeded():
+		return nil, nil, ErrOutputLimit
+	case errors.Is(ctx.Err(), context.DeadlineExceeded) || cpuLimitExceeded(err):
+		return nil, nil, fmt.Errorf("%w after %s", ErrTimeout, r.config.Timeout)
+	case err != nil && ctx.Err() != nil:
+		return nil, nil, ctx.Err()
+	}
+
+	return stdout.buf.Bytes(), stderr.buf.Bytes(), err
+}
@@ -0,0 +1,59 @@
+//go:build linux
+
+package compiler
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// isolate puts the compiler in its own process group, so that anything it forks is killed along with it
+func isolate(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+}
+
+// limit applies the resource limits to a started process. The limits are inherited by anything it forks from then
+// on, but not by children it forked before.
+func limit(pid int, config *RunnerConfig) error {
+	cpu := uint64((config.CPUTime + 999_999_999) / 1_000_000_000)
+
+	limits := []struct {
+		resource int
+		limit    unix.Rlimit
+	}{
+		// the soft limit sends SIGXCPU, the hard limit a second later SIGKILL
+		{unix.RLIMIT_CPU, unix.Rlimit{Cur: cpu, Max: cpu + 1}},
+		{unix.RLIMIT_AS, unix.Rlimit{Cur: config.MemoryBytes, Max: config.MemoryBytes}},
+		{unix.RLIMIT_FSIZE, unix.Rlimit{Cur: uint64(config.OutputBytes), Max: uint64(config.OutputBytes)}},
+		{unix.RLIMIT_CORE, unix.Rlimit{Cur: 0, Max: 0}},
+	}
+
+	for _, l := range limits {
+		if err := unix.Prlimit(pid, l.resource, &l.limit, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kill kills the process group of the compiler
+func kill(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// cpuLimitExceeded returns whether the process was killed for exceeding its cpu time
+func cpuLimitExceeded(err error) bool {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		return false
+	}
+
+	status, ok := exitErr.Sys().(syscall.WaitStatus)
+	return ok && status.Signaled() && status.Signal() == syscall.SIGXCPU
+}
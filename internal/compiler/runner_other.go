@@ -0,0 +1,23 @@
+//go:build !linux
+
+package compiler
+
+import (
+	"os/exec"
+)
+
+// isolate is a no-op, process groups are only used on linux
+func isolate(cmd *exec.Cmd) {}
+
+// limit is a no-op, resource limits are only applied on linux. The timeout and output limit still apply.
+func limit(pid int, config *RunnerConfig) error {
+	return nil
+}
+
+func kill(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
+
+func cpuLimitExceeded(err error) bool {
+	return false
+}
@@ -0,0 +1,158 @@
+package compiler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func skipWithoutShell(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("resource limits are only applied on linux")
+	}
+	if _, err := exec.LookPath("sh"); err != nil {
+		t.Skip(err)
+	}
+}
+
+func TestRunner(t *testing.T) {
+	skipWithoutShell(t)
+	t.Setenv("RUNNER_TEST_SECRET", "hunter2")
+
+	scratch := t.TempDir()
+	runner := NewRunner(&RunnerConfig{
+		Workers:     2,
+		CPUTime:     10 * time.Second,
+		MemoryBytes: 1 << 30,
+		ScratchDir:  scratch,
+	})
+
+	stdout, _, err := runner.Run(context.Background(), "sh", []string{"-c", "cat"}, []byte("contract A {}"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(stdout) != "contract A {}" {
+		t.Errorf("expected stdin to be passed through, got %q", stdout)
+	}
+
+	stdout, _, err = runner.Run(context.Background(), "sh", []string{"-c", "env; pwd"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(stdout), "RUNNER_TEST_SECRET") {
+		t.Errorf("expected the environment to be scrubbed, got %q", stdout)
+	}
+	lines := strings.Split(strings.TrimSpace(string(stdout)), "\n")
+	if dir := lines[len(lines)-1]; filepath.Dir(dir) != scratch {
+		t.Errorf("expected to run in a scratch dir, got %s", dir)
+	}
+	if entries, _ := os.ReadDir(scratch); len(entries) != 0 {
+		t.Errorf("expected the scratch dir to be removed")
+	}
+
+	// give the limits time to be applied before reading them
+	stdout, _, err = runner.Run(context.Background(), "sh", []string{"-c", "sleep 0.2; ulimit -t; ulimit -v"}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits := strings.Fields(string(stdout)); len(limits) != 2 || limits[0] != "10" || limits[1] != "1048576" {
+		t.Errorf("expected cpu and memory limits, got %q", stdout)
+	}
+
+	_, stderr, err := runner.Run(context.Background(), "sh", []string{"-c", "echo failed >&2; exit 3"}, nil)
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 3 {
+		t.Errorf("expected exit status 3, got %v", err)
+	}
+	if string(stderr) != "failed\n" {
+		t.Errorf("expected stderr to be returned, got %q", stderr)
+	}
+
+	stats := runner.Stats()
+	if stats.Completed != 3 || stats.Failed != 1 || stats.Running != 0 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRunnerLimits(t *testing.T) {
+	skipWithoutShell(t)
+
+	runner := NewRunner(&RunnerConfig{
+		Timeout:     200 * time.Millisecond,
+		OutputBytes: 1024,
+		ScratchDir:  t.TempDir(),
+	})
+
+	start := time.Now()
+	if _, _, err := runner.Run(context.Background(), "sh", []string{"-c", "sleep 10"}, nil); !errors.Is(err, ErrTimeout) {
+		t.Errorf("expected ErrTimeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("expected the compiler to be killed, took %s", elapsed)
+	}
+
+	if _, _, err := runner.Run(context.Background(), "sh", []string{"-c", "while true; do echo aaaaaaaaaaaaaaaa; done"}, nil); !errors.Is(err, ErrOutputLimit) {
+		t.Errorf("expected ErrOutputLimit, got %v", err)
+	}
+
+	if stats := runner.Stats(); stats.Timeouts != 1 || stats.Failed != 2 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+}
+
+func TestRunnerOverloaded(t *testing.T) {
+	skipWithoutShell(t)
+
+	runner := NewRunner(&RunnerConfig{
+		Workers:    1,
+		QueueSize:  1,
+		ScratchDir: t.TempDir(),
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	done := make(chan error, 2)
+	go func() {
+		_, _, err := runner.Run(ctx, "sh", []string{"-c", "sleep 10"}, nil)
+		done <- err
+	}()
+	waitFor(t, func() bool { return runner.Stats().Running == 1 })
+
+	go func() {
+		_, _, err := runner.Run(ctx, "sh", []string{"-c", "true"}, nil)
+		done <- err
+	}()
+	waitFor(t, func() bool { return runner.Stats().Queued == 1 })
+
+	// one running and one queued, so there is no room for another
+	if _, _, err := runner.Run(ctx, "sh", []string{"-c", "true"}, nil); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("expected ErrOverloaded, got %v", err)
+	}
+	if stats := runner.Stats(); stats.Rejected != 1 {
+		t.Errorf("unexpected stats %+v", stats)
+	}
+
+	cancel()
+	for i := 0; i < 2; i++ {
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Errorf("expected the runs to be cancelled, got %v", err)
+		}
+	}
+}
+
+func waitFor(t *testing.T, condition func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
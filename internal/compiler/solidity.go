@@ -18,20 +18,15 @@
 package compiler
 
 import (
-	"archive/zip"
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/ethereum/go-ethereum/accounts/abi"
 	"github.com/ethereum/go-ethereum/common/hexutil"
-	"io/ioutil"
-	"net/http"
-	"os"
 	"os/exec"
-	"path"
 	"regexp"
-	"runtime"
 	"strconv"
 	"strings"
 )
@@ -56,36 +51,48 @@ func RichTypeToType(rich string) string {
 	return rich
 }
 
-func GetSizeOfTypeIdentifier(id string) int {
+var fixedPointRegexp = regexp.MustCompile(`^t_u?fixed([0-9]+)x([0-9]+)$`)
+
+// GetSizeOfTypeIdentifier returns the number of bits a value type takes in storage
+func GetSizeOfTypeIdentifier(id string) (int, error) {
+	// parseBits parses a size in units, which must make a whole number of bytes no larger than 256 bits
+	parseBits := func(size string, unit int) (int, error) {
+		n, err := strconv.Atoi(size)
+		if err != nil || n <= 0 || n*unit > 256 || (n*unit)%8 != 0 {
+			return 0, fmt.Errorf("invalid type %s", id)
+		}
+		return n * unit, nil
+	}
+
 	switch {
-	case id == "t_string_storage_ptr":
-		return 256
-	case id == "t_bytes_storage_ptr":
-		return 256
+	case id == "t_string_storage_ptr", id == "t_string_storage":
+		return 256, nil
+	case id == "t_bytes_storage_ptr", id == "t_bytes_storage":
+		return 256, nil
 	case id == "t_bool":
-		return 8
+		return 8, nil
 	case id == "t_address", id == "t_address_payable":
-		return 160
+		return 160, nil
+	case strings.HasPrefix(id, "t_contract$"):
+		return 160, nil
+	case strings.HasPrefix(id, "t_function_internal"):
+		// the position of the function in the code
+		return 64, nil
+	case strings.HasPrefix(id, "t_function_external"):
+		// the address of the contract and the selector
+		return 192, nil
 	case strings.HasPrefix(id, "t_uint"):
-		bitlen, err := strconv.Atoi(id[len("t_uint"):])
-		if err != nil {
-			panic(err)
-		}
-		return bitlen
+		return parseBits(id[len("t_uint"):], 1)
 	case strings.HasPrefix(id, "t_int"):
-		bitlen, err := strconv.Atoi(id[len("t_int"):])
-		if err != nil {
-			panic(err)
-		}
-		return bitlen
+		return parseBits(id[len("t_int"):], 1)
 	case strings.HasPrefix(id, "t_bytes"):
-		bitlen, err := strconv.Atoi(id[len("t_bytes"):])
-		if err != nil {
-			panic(err)
-		}
-		return bitlen * 8
+		return parseBits(id[len("t_bytes"):], 8)
 	}
-	panic(id)
+
+	if match := fixedPointRegexp.FindStringSubmatch(id); match != nil {
+		return parseBits(match[1], 1)
+	}
+	return 0, fmt.Errorf("unsupported type %s", id)
 }
 
 // Solidity contains information about the solidity compiler.
@@ -143,11 +150,22 @@ func SolidityVersion(solc string) (*Solidity, error) {
 	if err != nil {
 		return nil, err
 	}
-	matches := versionRegexp.FindStringSubmatch(out.String())
+	s, err := parseSolidityVersion(out.String())
+	if err != nil {
+		return nil, err
+	}
+	s.Path = cmd.Path
+	return s, nil
+}
+
+// parseSolidityVersion parses the first version found in the output of solc --version, or a bare version
+func parseSolidityVersion(version string) (*Solidity, error) {
+	matches := versionRegexp.FindStringSubmatch(version)
 	if len(matches) != 4 {
-		return nil, fmt.Errorf("can't parse solc version %q", out.String())
+		return nil, fmt.Errorf("can't parse solc version %q", version)
 	}
-	s := &Solidity{Path: cmd.Path, FullVersion: out.String(), Version: matches[0]}
+	s := &Solidity{FullVersion: version, Version: matches[0]}
+	var err error
 	if s.Major, err = strconv.Atoi(matches[1]); err != nil {
 		return nil, err
 	}
@@ -287,100 +305,50 @@ func parseCombinedJSONV8(combinedJSON []byte, source string, languageVersion str
 type SolidityCompiler struct {
 	version string
 	path    string
+	runner  *Runner
 }
 
-func NewSolidityCompiler(version string) (Compiler, error) {
-	compilerDir := path.Join(os.TempDir(), "solidity", version)
-
-	var compilerPath string
-	if runtime.GOOS == "windows" {
-		compilerPath = path.Join(compilerDir, "solc.exe")
-	} else {
-		compilerPath = path.Join(compilerDir, "solc-static-linux")
+// NewSolidityCompiler returns a compiler for the given version, installing it through the manager if needed.
+// Compilations are run by the runner.
+func NewSolidityCompiler(ctx context.Context, manager *Manager, runner *Runner, version string) (*SolidityCompiler, error) {
+	if manager.Language() != LanguageSolidity {
+		return nil, fmt.Errorf("expected a %s compiler manager, got %s", LanguageSolidity, manager.Language())
 	}
 
-	if _, err := os.Stat(compilerPath); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, fmt.Errorf("failed to check compiler: %w", err)
-		}
-		err = downloadSolidityCompiler(version, compilerDir)
-		if err != nil {
-			return nil, fmt.Errorf("failed to download compiler: %w", err)
-		}
+	compilerPath, err := manager.Install(ctx, version)
+	if err != nil {
+		return nil, err
 	}
 
 	return &SolidityCompiler{
 		version: version,
 		path:    compilerPath,
+		runner:  runner,
 	}, nil
 }
 
-func downloadSolidityCompiler(version string, dest string) error {
-	err := os.MkdirAll(dest, os.FileMode(0755))
-	if err != nil {
-		return fmt.Errorf("failed to create parent dir: %w", err)
-	}
+func (c *SolidityCompiler) CompileFromString(src string) (map[string]*Contract, error) {
+	return c.CompileFromStringContext(context.Background(), src)
+}
 
-	var url string
-	if runtime.GOOS == "linux" {
-		url = fmt.Sprintf("https://github.com/ethereum/solidity/releases/download/v%s/solc-static-linux", version)
-	} else if runtime.GOOS == "windows" {
-		url = fmt.Sprintf("https://github.com/ethereum/solidity/releases/download/v%s/solidity-windows.zip", version)
-	} else {
-		return fmt.Errorf("unsupported os %s", runtime.GOOS)
+// CompileFromStringContext compiles the source, stopping the compiler if the context is cancelled
+func (c *SolidityCompiler) CompileFromStringContext(ctx context.Context, src string) (map[string]*Contract, error) {
+	if len(src) == 0 {
+		return nil, errors.New("solc: empty source string")
 	}
 
-	resp, err := http.Get(url)
+	s, err := parseSolidityVersion(c.version)
 	if err != nil {
-		return fmt.Errorf("failed to download solidity v%s: %w", version, err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	body, err := ioutil.ReadAll(resp.Body)
+	args := s.makeArgs()
+	stdout, stderr, err := c.runner.Run(ctx, c.path, append(args, "--", "-"), []byte(src))
 	if err != nil {
-		return fmt.Errorf("failed to read body: %w", err)
-	}
-
-	if runtime.GOOS == "linux" {
-		err = ioutil.WriteFile(path.Join(dest, path.Base(url)), body, os.FileMode(0755))
-		if err != nil {
-			return fmt.Errorf("failed to write compiler: %w", err)
-		}
-	} else {
-		reader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
-		if err != nil {
-			return fmt.Errorf("failed to read body: %w", err)
-		}
-
-		for _, file := range reader.File {
-			if strings.Contains(file.Name, "..") || strings.HasPrefix(file.Name, "/") {
-				return fmt.Errorf("unsafe path: %s", file.Name)
-			}
-
-			reader, err := file.Open()
-			if err != nil {
-				return fmt.Errorf("failed to unpack %s: %w", file.Name, err)
-			}
-			body, err = ioutil.ReadAll(reader)
-			if err != nil {
-				return fmt.Errorf("failed to read %s: %w", file.Name, err)
-			}
-			err = ioutil.WriteFile(path.Join(dest, file.Name), body, file.FileInfo().Mode())
-			if err != nil {
-				return fmt.Errorf("failed to write %s: %w", file.Name, err)
-			}
-			err = reader.Close()
-			if err != nil {
-				return fmt.Errorf("failed to close %s: %w", file.Name, err)
-			}
-		}
+		return nil, fmt.Errorf("solc: %w\n%s", err, stderr)
 	}
 
-	return nil
-}
-
-func (c *SolidityCompiler) CompileFromString(src string) (map[string]*Contract, error) {
-	contracts, err := CompileSolidityString(c.path, src)
+	contracts, err := ParseCombinedJSON(stdout, src, s.Version, s.Version, strings.Join(args, " "))
 	if err != nil {
 		return nil, err
 	}
@@ -411,7 +379,7 @@ const (
 )
 
 type StorageType struct {
-	Label         string   `json:"string"`
+	Label         string   `json:"label"`
 	NumberOfBytes string   `json:"numberOfBytes"`
 	Encoding      Encoding `json:"encoding"`
 	// only set if is struct
@@ -429,8 +397,34 @@ type StorageLayout struct {
 }
 
 type StandardJsonContract struct {
-	ABI           any            `json:"abi"`
-	StorageLayout *StorageLayout `json:"storageLayout"`
+	ABI           any              `json:"abi"`
+	Metadata      string           `json:"metadata,omitempty"`
+	UserDoc       any              `json:"userdoc,omitempty"`
+	DevDoc        any              `json:"devdoc,omitempty"`
+	StorageLayout *StorageLayout   `json:"storageLayout,omitempty"`
+	EVM           *StandardJsonEVM `json:"evm,omitempty"`
+}
+
+type StandardJsonEVM struct {
+	Bytecode          *StandardJsonBytecode `json:"bytecode,omitempty"`
+	DeployedBytecode  *StandardJsonBytecode `json:"deployedBytecode,omitempty"`
+	MethodIdentifiers map[string]string     `json:"methodIdentifiers,omitempty"`
+}
+
+// StandardJsonBytecode is the bytecode of a contract. Object is hex without a 0x prefix, and has placeholders for
+// the addresses of unlinked libraries at the offsets in LinkReferences.
+type StandardJsonBytecode struct {
+	Object         string                                             `json:"object"`
+	Opcodes        string                                             `json:"opcodes,omitempty"`
+	SourceMap      string                                             `json:"sourceMap,omitempty"`
+	LinkReferences map[string]map[string][]*StandardJsonLinkReference `json:"linkReferences,omitempty"`
+	// ImmutableReferences is only set for deployed bytecode, and is keyed by the AST id of the immutable
+	ImmutableReferences map[string][]*StandardJsonLinkReference `json:"immutableReferences,omitempty"`
+}
+
+type StandardJsonLinkReference struct {
+	Start  int `json:"start"`
+	Length int `json:"length"`
 }
 
 type LegacyASTNode struct {
@@ -466,6 +460,13 @@ type StructDefinitionNode struct {
 	Name          string                     `json:"name"`
 }
 
+type UserDefinedValueTypeDefinitionNode struct {
+	ID             int       `json:"id"`
+	CanonicalName  string    `json:"canonicalName"`
+	Name           string    `json:"name"`
+	UnderlyingType *TypeName `json:"underlyingType"`
+}
+
 func (n *ASTNode) UnmarshalJSON(b []byte) error {
 	getType := struct {
 		ID       int    `json:"id"`
@@ -489,6 +490,8 @@ func (n *ASTNode) UnmarshalJSON(b []byte) error {
 		n.Node = &EnumDefinitionNode{}
 	case "StructDefinition":
 		n.Node = &StructDefinitionNode{}
+	case "UserDefinedValueTypeDefinition":
+		n.Node = &UserDefinedValueTypeDefinitionNode{}
 	case "Literal":
 		n.Node = &LiteralNode{}
 	default:
@@ -498,6 +501,25 @@ func (n *ASTNode) UnmarshalJSON(b []byte) error {
 	return json.Unmarshal(b, &n.Node)
 }
 
+// MarshalJSON encodes the node along with its id and type, so that it can be decoded again. Only the fields of typed
+// nodes are kept.
+func (n *ASTNode) MarshalJSON() ([]byte, error) {
+	fields := make(map[string]any)
+	if n.Node != nil {
+		encoded, err := json.Marshal(n.Node)
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(encoded, &fields); err != nil {
+			return nil, err
+		}
+	}
+
+	fields["id"] = n.ID
+	fields["nodeType"] = n.NodeType
+	return json.Marshal(fields)
+}
+
 type LiteralNode struct {
 	Kind  string `json:"kind"`
 	Value string `json:"value"`
@@ -583,13 +605,47 @@ type StandardJsonSource struct {
 	LegacyAST *LegacyASTNode  `json:"legacyAST"`
 }
 
+// IndexNodes returns the top level nodes of the sources, and the nodes of every contract, by id
+func IndexNodes(sources map[string]*StandardJsonSource) map[int]*ASTNode {
+	result := make(map[int]*ASTNode)
+
+	var index func(nodes []*ASTNode)
+	index = func(nodes []*ASTNode) {
+		for _, node := range nodes {
+			result[node.ID] = node
+			if contract, ok := node.Node.(*ContractDefinitionNode); ok {
+				index(contract.Nodes)
+			}
+		}
+	}
+
+	for _, source := range sources {
+		if source.AST != nil {
+			index(source.AST.Nodes)
+		}
+	}
+
+	return result
+}
+
+// StandardJsonSourceLocation is a byte range within a source file. Start and End are -1 when solc can't tell where
+// the problem is.
+type StandardJsonSourceLocation struct {
+	File    string `json:"file"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Message string `json:"message,omitempty"`
+}
+
 type StandardJsonError struct {
-	SourceLocation   map[string]any `json:"sourceLocation"`
-	Type             string         `json:"type"`
-	Severity         string         `json:"severity"`
-	ErrorCode        string         `json:"errorCode"`
-	Message          string         `json:"message"`
-	FormattedMessage string         `json:"formattedMessage"`
+	SourceLocation           *StandardJsonSourceLocation   `json:"sourceLocation,omitempty"`
+	SecondarySourceLocations []*StandardJsonSourceLocation `json:"secondarySourceLocations,omitempty"`
+	Type                     string                        `json:"type"`
+	Component                string                        `json:"component"`
+	Severity                 string                        `json:"severity"`
+	ErrorCode                string                        `json:"errorCode,omitempty"`
+	Message                  string                        `json:"message"`
+	FormattedMessage         string                        `json:"formattedMessage"`
 }
 
 type StandardJsonOutput struct {
@@ -610,33 +666,24 @@ type StandardJsonInput struct {
 	Settings map[string]any                     `json:"settings"`
 }
 
-func (c *SolidityCompiler) CompileFromStandardJSON(input *StandardJsonInput) (*StandardJsonOutput, error) {
+// CompileFromStandardJSON compiles the input with solc --standard-json. The output is returned as solc wrote it, so
+// that outputs StandardJsonOutput doesn't model, like the AST or gas estimates, aren't lost. Decode it into a
+// StandardJsonOutput to read the typed fields.
+func (c *SolidityCompiler) CompileFromStandardJSON(ctx context.Context, input *StandardJsonInput) (json.RawMessage, error) {
 	b, err := json.Marshal(input)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal settings: %w", err)
 	}
 
-	s, err := SolidityVersion(c.path)
+	stdout, stderr, err := c.runner.Run(ctx, c.path, []string{"--standard-json"}, b)
 	if err != nil {
-		return nil, err
-	}
-	cmd := exec.Command(s.Path, "--standard-json")
-	cmd.Stdin = bytes.NewReader(b)
-	var stderr, stdout bytes.Buffer
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("solc: %v\n%s", err, stderr.Bytes())
+		return nil, fmt.Errorf("solc: %w\n%s", err, stderr)
 	}
-	//fmt.Println(string(stdout.Bytes()))
-
-	os.WriteFile("/tmp/out.json", stdout.Bytes(), os.FileMode(0755))
 
-	var out StandardJsonOutput
-	if err := json.Unmarshal(stdout.Bytes(), &out); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal: %w", err)
+	if !json.Valid(stdout) {
+		return nil, fmt.Errorf("solc returned invalid json\n%s", stderr)
 	}
-	return &out, nil
+	return stdout, nil
 }
 
 func ExtractCodeAndABI(contract *Contract) ([]byte, *abi.ABI, error) {
@@ -17,8 +17,13 @@
 package compiler
 
 import (
+	"context"
+	"errors"
+	"os"
 	"os/exec"
+	"path/filepath"
 	"testing"
+	"time"
 )
 
 const (
@@ -76,3 +81,47 @@ func TestSolidityCompileError(t *testing.T) {
 	}
 	t.Logf("error: %v", err)
 }
+
+func TestSolidityCompilerFromString(t *testing.T) {
+	skipWithoutShell(t)
+
+	// the fake solc checks that it's run in combined json mode on stdin
+	path := filepath.Join(t.TempDir(), "solc")
+	script := `#!/bin/sh
+[ "$1" = --combined-json ] || exit 2
+for last; do :; done
+[ "$last" = - ] || exit 2
+[ "$(cat)" = "contract A {}" ] || exit 2
+[ -z "$SLEEP" ] || sleep "$SLEEP"
+echo '{"contracts":{"<stdin>:A":{"bin":"6000","bin-runtime":"6000","srcmap":"","srcmap-runtime":"","abi":[],"devdoc":{},"userdoc":{},"metadata":"","hashes":{}}},"version":"0.8.17"}'
+`
+	if err := os.WriteFile(path, []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// the runner doesn't pass the environment on, so solc only sleeps if it isn't run through it
+	t.Setenv("SLEEP", "10")
+
+	compiler := &SolidityCompiler{
+		version: "0.8.17",
+		path:    path,
+		runner:  NewRunner(&RunnerConfig{ScratchDir: t.TempDir(), Timeout: 5 * time.Second}),
+	}
+
+	contracts, err := compiler.CompileFromString("contract A {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, ok := contracts["A"]
+	if !ok {
+		t.Fatalf("expected the <stdin> prefix to be stripped, got %v", contracts)
+	}
+	if c.RuntimeCode != "0x6000" || c.Info.CompilerVersion != "0.8.17" {
+		t.Errorf("unexpected contract %+v", c)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := compiler.CompileFromStringContext(ctx, "contract A {}"); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected the compilation to be cancelled, got %v", err)
+	}
+}
@@ -2,10 +2,11 @@ package compiler
 
 import (
 	"fmt"
-	"github.com/ethereum/go-ethereum/common"
-	"math"
 	"math/big"
-	"strconv"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 // https://solidity-ast.netlify.app/
@@ -41,11 +42,77 @@ type ASTStorageLayout struct {
 
 	// stores information about structs
 	AllStructs map[string]*ASTStorageLayout `json:"allStructs"`
+
+	state *layoutState
+}
+
+// layoutState is shared by a layout and the layouts of the structs it uses
+type layoutState struct {
+	// entries is the number of entries in every layout
+	entries int
+	// generating holds the structs whose layouts are being generated, since a struct can refer to itself through a
+	// mapping or dynamic array
+	generating map[string]bool
+}
+
+// maxStorageEntries bounds the number of entries in a layout, since fixed size arrays are laid out element by element
+// and may have any length
+const maxStorageEntries = 1 << 16
+
+var errLayoutTooLarge = fmt.Errorf("storage layout has more than %d entries", maxStorageEntries)
+
+// ContractStorageLayout generates the storage layout of the named contract in file. State variables are laid out in
+// order of inheritance, starting with the most base contract.
+func ContractStorageLayout(sources map[string]*StandardJsonSource, file string, name string) (*ASTStorageLayout, error) {
+	source, ok := sources[file]
+	if !ok || source.AST == nil {
+		return nil, fmt.Errorf("no AST for %s", file)
+	}
+
+	var definition *ContractDefinitionNode
+	for _, node := range source.AST.Nodes {
+		if def, ok := node.Node.(*ContractDefinitionNode); ok && def.Name == name {
+			definition = def
+			break
+		}
+	}
+	if definition == nil {
+		return nil, fmt.Errorf("no definition of %s in %s", name, file)
+	}
+
+	nodesById := IndexNodes(sources)
+
+	var vars []*VariableDeclarationNode
+	for i := len(definition.LinearizedBaseContracts) - 1; i >= 0; i-- {
+		id := definition.LinearizedBaseContracts[i]
+		node, ok := nodesById[id]
+		if !ok {
+			return nil, fmt.Errorf("no definition of base contract %d", id)
+		}
+		base, ok := node.Node.(*ContractDefinitionNode)
+		if !ok {
+			return nil, fmt.Errorf("base contract %d is a %s", id, node.NodeType)
+		}
+
+		for _, child := range base.Nodes {
+			if v, ok := child.Node.(*VariableDeclarationNode); ok {
+				vars = append(vars, v)
+			}
+		}
+	}
+
+	return GenerateStorageLayout(nodesById, vars)
 }
 
-func GenerateStorageLayout(nodesById map[int]*ASTNode, vars []*VariableDeclarationNode) *ASTStorageLayout {
+// GenerateStorageLayout lays out the state variables in the order given. Constants and immutables aren't stored, so
+// they're skipped.
+func GenerateStorageLayout(nodesById map[int]*ASTNode, vars []*VariableDeclarationNode) (*ASTStorageLayout, error) {
 	var astVars []*ASTVariable
 	for _, vdn := range vars {
+		if vdn.Constant || vdn.Mutability == "constant" || vdn.Mutability == "immutable" {
+			continue
+		}
+
 		astVars = append(astVars, &ASTVariable{
 			Name:     vdn.Name,
 			FullName: vdn.Name,
@@ -53,41 +120,96 @@ func GenerateStorageLayout(nodesById map[int]*ASTNode, vars []*VariableDeclarati
 		})
 	}
 
-	return generateStructLayout(nodesById, astVars)
+	return generateStructLayout(nodesById, astVars, &layoutState{generating: make(map[string]bool)})
 }
 
-func generateStructLayout(nodesById map[int]*ASTNode, types []*ASTVariable) *ASTStorageLayout {
+func generateStructLayout(nodesById map[int]*ASTNode, types []*ASTVariable, state *layoutState) (*ASTStorageLayout, error) {
 	result := &ASTStorageLayout{
 		Slots:      make(map[common.Hash]map[int]*ASTVariable),
 		Arrays:     make(map[common.Hash]*ASTVariable),
 		Structs:    make(map[common.Hash]*ASTVariable),
 		AllStructs: make(map[string]*ASTStorageLayout),
+		state:      state,
 	}
 
 	var (
 		currentSlot   int
 		currentOffset int
+		err           error
 	)
 	for _, astVar := range types {
-		currentSlot, currentOffset = result.assignSlot(nodesById, astVar, currentSlot, currentOffset)
+		currentSlot, currentOffset, err = result.assignSlot(nodesById, astVar, currentSlot, currentOffset)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", astVar.FullName, err)
+		}
 	}
 
-	return result
+	return result, nil
 }
 
-func (l *ASTStorageLayout) putInSlot(slot int, offset int, astVar *ASTVariable) {
+func (l *ASTStorageLayout) putInSlot(slot int, offset int, astVar *ASTVariable) error {
+	l.state.entries++
+	if l.state.entries > maxStorageEntries {
+		return errLayoutTooLarge
+	}
+
 	slotHash := common.BigToHash(big.NewInt(int64(slot)))
 	if _, ok := l.Slots[slotHash]; !ok {
 		l.Slots[slotHash] = make(map[int]*ASTVariable)
 	}
 	l.Slots[slotHash][offset] = astVar
+	return nil
 }
 
-func (l *ASTStorageLayout) registerMeta(nodesById map[int]*ASTNode, typeName *TypeName) {
+// putValue packs a value type into the current slot, or the next one if it doesn't fit
+func (l *ASTStorageLayout) putValue(astVar *ASTVariable, bits int, currentSlot int, currentOffset int) (int, int, error) {
+	if currentOffset+bits > 256 {
+		currentSlot += 1
+		currentOffset = 0
+	}
+
+	astVar.Bits = bits
+	if err := l.putInSlot(currentSlot, currentOffset, astVar); err != nil {
+		return 0, 0, err
+	}
+
+	currentOffset += bits
+	if currentOffset == 256 {
+		currentSlot += 1
+		currentOffset = 0
+	}
+	return currentSlot, currentOffset, nil
+}
+
+// putHeader puts the slot holding the length of a dynamic array, string or bytes. The contents are stored at the
+// keccak of the slot.
+func (l *ASTStorageLayout) putHeader(astVar *ASTVariable, header *ASTVariable, currentSlot int, currentOffset int) (int, int, error) {
+	if currentOffset > 0 {
+		currentSlot += 1
+	}
+
+	l.Arrays[common.BigToHash(big.NewInt(int64(currentSlot)))] = astVar
+	if err := l.putInSlot(currentSlot, 0, header); err != nil {
+		return 0, 0, err
+	}
+	return currentSlot + 1, 0, nil
+}
+
+func (l *ASTStorageLayout) registerMeta(nodesById map[int]*ASTNode, typeName *TypeName) error {
+	if typeName == nil {
+		return nil
+	}
+
 	if typeName.IsUserDefinedType() {
-		node := nodesById[*typeName.ReferencedDeclaration]
+		node, err := referencedNode(nodesById, typeName)
+		if err != nil {
+			return err
+		}
 		if structDef, ok := node.Node.(*StructDefinitionNode); ok {
-			if _, ok := l.AllStructs[structDef.CanonicalName]; !ok {
+			if _, ok := l.AllStructs[structDef.CanonicalName]; !ok && !l.state.generating[structDef.CanonicalName] {
+				l.state.generating[structDef.CanonicalName] = true
+				defer delete(l.state.generating, structDef.CanonicalName)
+
 				var astVars []*ASTVariable
 				for _, member := range structDef.Members {
 					astVars = append(astVars, &ASTVariable{
@@ -96,7 +218,10 @@ func (l *ASTStorageLayout) registerMeta(nodesById map[int]*ASTNode, typeName *Ty
 						TypeName: member.TypeName,
 					})
 				}
-				resultingLayout := generateStructLayout(nodesById, astVars)
+				resultingLayout, err := generateStructLayout(nodesById, astVars, l.state)
+				if err != nil {
+					return fmt.Errorf("struct %s: %w", structDef.CanonicalName, err)
+				}
 				for k, v := range resultingLayout.AllStructs {
 					l.AllStructs[k] = v
 				}
@@ -105,36 +230,46 @@ func (l *ASTStorageLayout) registerMeta(nodesById map[int]*ASTNode, typeName *Ty
 			}
 		}
 	} else if typeName.IsMapping() {
-		l.registerMeta(nodesById, typeName.KeyType)
-		l.registerMeta(nodesById, typeName.ValueType)
+		if err := l.registerMeta(nodesById, typeName.KeyType); err != nil {
+			return err
+		}
+		return l.registerMeta(nodesById, typeName.ValueType)
 	} else if typeName.IsArray() {
-		l.registerMeta(nodesById, typeName.BaseType)
+		return l.registerMeta(nodesById, typeName.BaseType)
 	}
+
+	return nil
 }
 
-func (l *ASTStorageLayout) assignSlot(nodesById map[int]*ASTNode, astVar *ASTVariable, currentSlot int, currentOffset int) (int, int) {
+func (l *ASTStorageLayout) assignSlot(nodesById map[int]*ASTNode, astVar *ASTVariable, currentSlot int, currentOffset int) (int, int, error) {
 	typeName := astVar.TypeName
-	l.registerMeta(nodesById, typeName)
-
-	if typeName.IsMapping() {
+	if typeName == nil || typeName.TypeDescriptions == nil {
+		return 0, 0, fmt.Errorf("missing type")
+	}
+	if err := l.registerMeta(nodesById, typeName); err != nil {
+		return 0, 0, err
+	}
 
+	switch {
+	case typeName.IsMapping():
 		if currentOffset > 0 {
 			currentSlot += 1
 			currentOffset = 0
 		}
 
-		l.putInSlot(currentSlot, 0, astVar)
-		currentSlot += 1
-	} else if typeName.IsArray() {
-		if typeName.Length == nil {
-			// dynamic array gets put at the keccak
-			if currentOffset > 0 {
-				currentSlot += 1
-				currentOffset = 0
-			}
+		if err := l.putInSlot(currentSlot, 0, astVar); err != nil {
+			return 0, 0, err
+		}
+		return currentSlot + 1, 0, nil
+	case typeName.IsArray():
+		length, err := arrayLength(typeName)
+		if err != nil {
+			return 0, 0, err
+		}
 
-			l.Arrays[common.BigToHash(big.NewInt(int64(currentSlot)))] = astVar
-			l.putInSlot(currentSlot, 0, &ASTVariable{
+		if length == nil {
+			// dynamic array gets put at the keccak
+			return l.putHeader(astVar, &ASTVariable{
 				Name:     astVar.Name,
 				FullName: fmt.Sprintf("%s.length", astVar.Name),
 				TypeName: &TypeName{
@@ -146,107 +281,79 @@ func (l *ASTStorageLayout) assignSlot(nodesById map[int]*ASTNode, astVar *ASTVar
 					NodeType: "ElementaryTypeName",
 				},
 				Bits: 256,
-			})
-			currentSlot += 1
-		} else {
-			// fixed size array gets inlined
-			if currentOffset > 0 {
-				currentOffset = 0
-				currentSlot += 1
-			}
-
-			lenStr := typeName.Length.Node.(*LiteralNode).Value
-			lenVal, err := strconv.Atoi(lenStr)
-			if err != nil {
-				panic(err)
-			}
+			}, currentSlot, currentOffset)
+		}
 
-			l.Arrays[common.BigToHash(big.NewInt(int64(currentSlot)))] = astVar
+		// fixed size array gets inlined
+		if currentOffset > 0 {
+			currentOffset = 0
+			currentSlot += 1
+		}
+		if !length.IsInt64() || length.Int64() > maxStorageEntries {
+			return 0, 0, errLayoutTooLarge
+		}
 
-			for i := 0; i < lenVal; i++ {
-				currentSlot, currentOffset = l.assignSlot(nodesById, &ASTVariable{
-					Name:     astVar.Name,
-					FullName: fmt.Sprintf("%s[%d]", astVar.FullName, i),
-					TypeName: typeName.BaseType,
-				}, currentSlot, currentOffset)
-			}
+		l.Arrays[common.BigToHash(big.NewInt(int64(currentSlot)))] = astVar
 
-			if currentOffset > 0 {
-				currentSlot += 1
-				currentOffset = 0
+		for i := 0; i < int(length.Int64()); i++ {
+			currentSlot, currentOffset, err = l.assignSlot(nodesById, &ASTVariable{
+				Name:     astVar.Name,
+				FullName: fmt.Sprintf("%s[%d]", astVar.FullName, i),
+				TypeName: typeName.BaseType,
+			}, currentSlot, currentOffset)
+			if err != nil {
+				return 0, 0, err
 			}
 		}
-	} else if typeName.IsUserDefinedType() {
-		node := nodesById[*typeName.ReferencedDeclaration]
-		switch v := node.Node.(type) {
-		case *EnumDefinitionNode:
-			numBits := int(math.Floor(math.Log2(float64(len(v.Members))))) + 1
-			numBytes := int(math.Ceil(float64(numBits) / 8))
-			size := numBytes * 8
-			astVar.Bits = size
-
-			if size+currentOffset <= 256 {
-				l.putInSlot(currentSlot, currentOffset, astVar)
-				currentOffset += size
-			} else {
-				if currentOffset > 0 {
-					currentSlot += 1
-					currentOffset = 0
-				}
 
-				l.putInSlot(currentSlot, 0, astVar)
-				currentOffset = size
-			}
-		case *ContractDefinitionNode:
-			size := 160
-			astVar.Bits = 160
-
-			if size+currentOffset <= 256 {
-				l.putInSlot(currentSlot, currentOffset, astVar)
-				currentOffset += size
-			} else {
-				if currentOffset > 0 {
-					currentSlot += 1
-					currentOffset = 0
-				}
+		if currentOffset > 0 {
+			currentSlot += 1
+			currentOffset = 0
+		}
+		return currentSlot, currentOffset, nil
+	case typeName.IsUserDefinedType():
+		node, err := referencedNode(nodesById, typeName)
+		if err != nil {
+			return 0, 0, err
+		}
 
-				l.putInSlot(currentSlot, 0, astVar)
-				currentOffset = 160
-			}
-		case *StructDefinitionNode:
-			// struct gets inlined
-			if currentOffset > 0 {
-				currentOffset = 0
-				currentSlot += 1
+		v, ok := node.Node.(*StructDefinitionNode)
+		if !ok {
+			bits, err := userDefinedTypeBits(node)
+			if err != nil {
+				return 0, 0, err
 			}
+			return l.putValue(astVar, bits, currentSlot, currentOffset)
+		}
 
-			l.Structs[common.BigToHash(big.NewInt(int64(currentSlot)))] = astVar
+		// struct gets inlined
+		if currentOffset > 0 {
+			currentOffset = 0
+			currentSlot += 1
+		}
 
-			for _, member := range v.Members {
-				currentSlot, currentOffset = l.assignSlot(nodesById, &ASTVariable{
-					Name:     astVar.Name,
-					FullName: fmt.Sprintf("%s.%s", astVar.FullName, member.Name),
-					TypeName: member.TypeName,
-				}, currentSlot, currentOffset)
-			}
+		l.Structs[common.BigToHash(big.NewInt(int64(currentSlot)))] = astVar
 
-			if currentOffset > 0 {
-				currentSlot += 1
-				currentOffset = 0
+		for _, member := range v.Members {
+			currentSlot, currentOffset, err = l.assignSlot(nodesById, &ASTVariable{
+				Name:     astVar.Name,
+				FullName: fmt.Sprintf("%s.%s", astVar.FullName, member.Name),
+				TypeName: member.TypeName,
+			}, currentSlot, currentOffset)
+			if err != nil {
+				return 0, 0, err
 			}
-		default:
-			panic(fmt.Sprintf("unsupported type %+v", node))
 		}
-	} else if typeName.IsElementaryType() {
-		if typeName.TypeDescriptions.TypeIdentifier == "t_string_storage_ptr" {
-			// string pointer maybe gets put at the keccak, maybe not
-			if currentOffset > 0 {
-				currentSlot += 1
-				currentOffset = 0
-			}
 
-			l.Arrays[common.BigToHash(big.NewInt(int64(currentSlot)))] = astVar
-			l.putInSlot(currentSlot, 0, &ASTVariable{
+		if currentOffset > 0 {
+			currentSlot += 1
+			currentOffset = 0
+		}
+		return currentSlot, currentOffset, nil
+	case typeName.IsElementaryType(), typeName.IsFunction():
+		if isDynamicBytes(typeName.TypeDescriptions.TypeIdentifier) {
+			// short strings and bytes are stored in the header, long ones at the keccak
+			return l.putHeader(astVar, &ASTVariable{
 				Name:     astVar.Name,
 				FullName: astVar.Name,
 				TypeName: &TypeName{
@@ -258,31 +365,88 @@ func (l *ASTStorageLayout) assignSlot(nodesById map[int]*ASTNode, astVar *ASTVar
 					NodeType: "ElementaryTypeName",
 				},
 				Bits: 256,
-			})
-			currentSlot += 1
-		} else {
-			size := GetSizeOfTypeIdentifier(typeName.TypeDescriptions.TypeIdentifier)
-			fmt.Printf("assigning %+v to %d %d (%d)\n", typeName, currentSlot, currentOffset, size)
-			astVar.Bits = size
-			if size+currentOffset <= 256 {
-				l.putInSlot(currentSlot, currentOffset, astVar)
-				currentOffset += size
-			} else {
-				if currentOffset > 0 {
-					currentSlot += 1
-					currentOffset = 0
-				}
+			}, currentSlot, currentOffset)
+		}
+
+		bits, err := GetSizeOfTypeIdentifier(typeName.TypeDescriptions.TypeIdentifier)
+		if err != nil {
+			return 0, 0, err
+		}
+		return l.putValue(astVar, bits, currentSlot, currentOffset)
+	default:
+		return 0, 0, fmt.Errorf("unsupported type %s", typeName.NodeType)
+	}
+}
 
-				l.putInSlot(currentSlot, 0, astVar)
+// referencedNode returns the definition a user defined type refers to
+func referencedNode(nodesById map[int]*ASTNode, typeName *TypeName) (*ASTNode, error) {
+	if typeName.ReferencedDeclaration == nil {
+		return nil, fmt.Errorf("%s has no declaration", typeName.TypeDescriptions.TypeString)
+	}
 
-				if size == 256 {
-					currentSlot += 1
-				} else {
-					currentOffset = size
-				}
-			}
+	node, ok := nodesById[*typeName.ReferencedDeclaration]
+	if !ok || node.Node == nil {
+		return nil, fmt.Errorf("no definition of %s (%d)", typeName.TypeDescriptions.TypeString, *typeName.ReferencedDeclaration)
+	}
+	return node, nil
+}
+
+// userDefinedTypeBits returns the size of a user defined value type: an enum, contract or user defined value type
+func userDefinedTypeBits(node *ASTNode) (int, error) {
+	switch v := node.Node.(type) {
+	case *EnumDefinitionNode:
+		// enums take as many bytes as the largest member needs, and can have at most 256 members
+		if len(v.Members) > 256 {
+			return 0, fmt.Errorf("enum %s has %d members", v.CanonicalName, len(v.Members))
+		}
+		return 8, nil
+	case *ContractDefinitionNode:
+		return 160, nil
+	case *UserDefinedValueTypeDefinitionNode:
+		if v.UnderlyingType == nil || v.UnderlyingType.TypeDescriptions == nil {
+			return 0, fmt.Errorf("type %s has no underlying type", v.Name)
 		}
+		return GetSizeOfTypeIdentifier(v.UnderlyingType.TypeDescriptions.TypeIdentifier)
+	default:
+		return 0, fmt.Errorf("unsupported type definition %s", node.NodeType)
+	}
+}
+
+// isDynamicBytes returns whether the type is a string or bytes, which share the same encoding in storage
+func isDynamicBytes(id string) bool {
+	return strings.HasPrefix(id, "t_string_") || strings.HasPrefix(id, "t_bytes_")
+}
+
+var arrayLengthRegexp = regexp.MustCompile(`\[([0-9]*)\]$`)
+
+// arrayLength returns the length of a fixed size array, or nil for a dynamic array. The length in the type string has
+// already been evaluated by solc, so it's preferred over the length expression, which may refer to constants.
+func arrayLength(typeName *TypeName) (*big.Int, error) {
+	if typeName.BaseType == nil {
+		return nil, fmt.Errorf("array %s has no base type", typeName.TypeDescriptions.TypeString)
 	}
 
-	return currentSlot, currentOffset
+	typeString := strings.TrimSuffix(typeName.TypeDescriptions.TypeString, " storage ref")
+	typeString = strings.TrimSuffix(typeString, " storage pointer")
+	if match := arrayLengthRegexp.FindStringSubmatch(typeString); match != nil {
+		if match[1] == "" {
+			return nil, nil
+		}
+		length, ok := new(big.Int).SetString(match[1], 10)
+		if !ok {
+			return nil, fmt.Errorf("invalid array length %s", match[1])
+		}
+		return length, nil
+	}
+
+	if typeName.Length == nil {
+		return nil, nil
+	}
+	if literal, ok := typeName.Length.Node.(*LiteralNode); ok {
+		length, ok := new(big.Int).SetString(strings.ReplaceAll(literal.Value, "_", ""), 0)
+		if ok && length.Sign() >= 0 {
+			return length, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown length of array %s", typeName.TypeDescriptions.TypeString)
 }
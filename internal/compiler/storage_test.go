@@ -0,0 +1,184 @@
+package compiler
+
+import (
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// checkStorageEntries checks that every entry of solc's layout is at the same slot and offset in the generated layout,
+// and that the generated layout has no other variables
+func checkStorageEntries(t *testing.T, layout *ASTStorageLayout, entries []*StorageEntry, types map[string]*StorageType) {
+	t.Helper()
+
+	names := make(map[string]bool)
+	for _, slot := range layout.Slots {
+		for _, astVar := range slot {
+			names[astVar.Name] = true
+		}
+	}
+
+	for _, entry := range entries {
+		delete(names, entry.Label)
+
+		slot, ok := new(big.Int).SetString(entry.Slot, 10)
+		if !ok {
+			t.Fatalf("invalid slot %s", entry.Slot)
+		}
+		hash := common.BigToHash(slot)
+
+		astVar := layout.Slots[hash][entry.Offset*8]
+		if astVar == nil || astVar.Name != entry.Label {
+			t.Errorf("expected %s at slot %s offset %d, got %v", entry.Label, entry.Slot, entry.Offset, astVar)
+			continue
+		}
+
+		storageType := types[entry.Type]
+		switch {
+		case len(storageType.Members) > 0:
+			if layout.Structs[hash] == nil || layout.Structs[hash].Name != entry.Label {
+				t.Errorf("expected struct %s to start at slot %s", entry.Label, entry.Slot)
+			}
+		case storageType.Base != "", storageType.Encoding == EncodingBytes:
+			if layout.Arrays[hash] == nil || layout.Arrays[hash].Name != entry.Label {
+				t.Errorf("expected array %s to start at slot %s", entry.Label, entry.Slot)
+			}
+		case storageType.Encoding == EncodingInplace:
+			if expected := storageType.NumberOfBytes; astVar.Bits/8 != atoi(t, expected) {
+				t.Errorf("expected %s to take %s bytes, got %d bits", entry.Label, expected, astVar.Bits)
+			}
+		}
+	}
+
+	for name := range names {
+		t.Errorf("unexpected variable %s", name)
+	}
+}
+
+func atoi(t *testing.T, s string) int {
+	n, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		t.Fatalf("invalid number %s", s)
+	}
+	return int(n.Int64())
+}
+
+// TestContractStorageLayout compares the generated layouts with the storageLayout output of solc 0.8.17
+func TestContractStorageLayout(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("testdata", "storage", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no test contracts")
+	}
+
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var output StandardJsonOutput
+		if err := json.Unmarshal(data, &output); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+
+		for sourceFile, contracts := range output.Contracts {
+			for name, contract := range contracts {
+				t.Run(filepath.Base(file)+"/"+name, func(t *testing.T) {
+					layout, err := ContractStorageLayout(output.Sources, sourceFile, name)
+					if err != nil {
+						t.Fatal(err)
+					}
+
+					checkStorageEntries(t, layout, contract.StorageLayout.Storage, contract.StorageLayout.Types)
+
+					for _, storageType := range contract.StorageLayout.Types {
+						if len(storageType.Members) == 0 {
+							continue
+						}
+
+						structLayout := layout.AllStructs[strings.TrimPrefix(storageType.Label, "struct ")]
+						if structLayout == nil {
+							t.Errorf("no layout for %s", storageType.Label)
+							continue
+						}
+						checkStorageEntries(t, structLayout, storageType.Members, contract.StorageLayout.Types)
+					}
+				})
+			}
+		}
+	}
+}
+
+func TestGenerateStorageLayoutErrors(t *testing.T) {
+	missing := 7
+
+	for name, typeName := range map[string]*TypeName{
+		"unknown type": {
+			NodeType:         "ElementaryTypeName",
+			TypeDescriptions: &TypeDescriptions{TypeIdentifier: "t_magic_block", TypeString: "block"},
+		},
+		"invalid size": {
+			NodeType:         "ElementaryTypeName",
+			TypeDescriptions: &TypeDescriptions{TypeIdentifier: "t_uint512", TypeString: "uint512"},
+		},
+		"missing declaration": {
+			NodeType:              "UserDefinedTypeName",
+			TypeDescriptions:      &TypeDescriptions{TypeIdentifier: "t_struct$_Missing_$7_storage_ptr", TypeString: "struct Missing"},
+			ReferencedDeclaration: &missing,
+		},
+		"huge array": {
+			NodeType:         "ArrayTypeName",
+			TypeDescriptions: &TypeDescriptions{TypeIdentifier: "t_array$_t_uint256_$18446744073709551616_storage_ptr", TypeString: "uint256[18446744073709551616]"},
+			BaseType: &TypeName{
+				NodeType:         "ElementaryTypeName",
+				TypeDescriptions: &TypeDescriptions{TypeIdentifier: "t_uint256", TypeString: "uint256"},
+			},
+		},
+		"missing type": nil,
+	} {
+		_, err := GenerateStorageLayout(map[int]*ASTNode{}, []*VariableDeclarationNode{{Name: "x", TypeName: typeName}})
+		if err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestGetSizeOfTypeIdentifier(t *testing.T) {
+	for id, expected := range map[string]int{
+		"t_bool":                            8,
+		"t_address_payable":                 160,
+		"t_uint8":                           8,
+		"t_int256":                          256,
+		"t_bytes1":                          8,
+		"t_bytes32":                         256,
+		"t_ufixed128x18":                    128,
+		"t_fixed8x1":                        8,
+		"t_contract$_IERC20_$3":             160,
+		"t_function_internal_view$__$":      64,
+		"t_function_external_payable$__$":   192,
+		"t_string_storage_ptr":              256,
+		"t_uint":                            -1,
+		"t_uint7":                           -1,
+		"t_bytes33":                         -1,
+		"t_fixed264x18":                     -1,
+		"t_tuple$_t_uint256_$":              -1,
+		"t_userDefinedValueType$_Price_$12": -1,
+	} {
+		bits, err := GetSizeOfTypeIdentifier(id)
+		if expected < 0 {
+			if err == nil {
+				t.Errorf("expected %s to be rejected, got %d", id, bits)
+			}
+		} else if err != nil || bits != expected {
+			t.Errorf("expected %s to take %d bits, got %d %v", id, expected, bits, err)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var ErrNotVerified = errors.New("contract hasn't been verified")
+
+// VerifiedContract is a deployed contract whose code was matched to the sources it was compiled from
+type VerifiedContract struct {
+	Chain    string         `json:"chain"`
+	Address  common.Address `json:"address"`
+	CodeHash common.Hash    `json:"codeHash"`
+	Match    MatchType      `json:"match"`
+
+	// Version is the compiler version, and File and Name identify the contract within the sources
+	Version string `json:"version"`
+	File    string `json:"file"`
+	Name    string `json:"name"`
+
+	Input *StandardJsonInput `json:"input"`
+	// Sources holds the AST of every source, from which the storage layout can be reconstructed
+	Sources       map[string]*StandardJsonSource `json:"sources"`
+	StorageLayout *StorageLayout                 `json:"storageLayout,omitempty"`
+
+	Libraries  map[string]common.Address `json:"libraries,omitempty"`
+	Immutables map[string]hexutil.Bytes  `json:"immutables,omitempty"`
+
+	VerifiedAt time.Time `json:"verifiedAt"`
+}
+
+// VerifiedStore keeps verified contracts on disk, one file per contract, so that other services can look them up
+type VerifiedStore struct {
+	dir string
+}
+
+// NewVerifiedStore creates a store in dir, defaulting to a directory in the system temporary directory
+func NewVerifiedStore(dir string) (*VerifiedStore, error) {
+	if dir == "" {
+		dir = filepath.Join(os.TempDir(), "verified")
+	}
+
+	if err := os.MkdirAll(dir, os.FileMode(0755)); err != nil {
+		return nil, fmt.Errorf("failed to create verified dir: %w", err)
+	}
+
+	return &VerifiedStore{
+		dir: dir,
+	}, nil
+}
+
+var chainRegexp = regexp.MustCompile(`^[a-z0-9_-]+$`)
+
+func (s *VerifiedStore) path(chain string, address common.Address) (string, error) {
+	// the chain becomes part of the path, so it mustn't be able to escape the store
+	if !chainRegexp.MatchString(chain) {
+		return "", fmt.Errorf("invalid chain %q", chain)
+	}
+
+	return filepath.Join(s.dir, chain, strings.ToLower(address.Hex())+".json"), nil
+}
+
+// Get returns the contract verified at the address, or ErrNotVerified
+func (s *VerifiedStore) Get(chain string, address common.Address) (*VerifiedContract, error) {
+	file, err := s.path(chain, address)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotVerified
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read verified contract: %w", err)
+	}
+
+	var result VerifiedContract
+	if err := json.Unmarshal(data, &result); err != nil {
+		return nil, fmt.Errorf("failed to decode verified contract: %w", err)
+	}
+	return &result, nil
+}
+
+// Put stores the verified contract, replacing any previous one at the same address unless that was an exact match
+// of the same code and this one is only partial
+func (s *VerifiedStore) Put(contract *VerifiedContract) error {
+	file, err := s.path(contract.Chain, contract.Address)
+	if err != nil {
+		return err
+	}
+
+	if contract.Match != MatchExact {
+		previous, err := s.Get(contract.Chain, contract.Address)
+		if err == nil && previous.CodeHash == contract.CodeHash && previous.Match == MatchExact {
+			return nil
+		}
+	}
+
+	data, err := json.Marshal(contract)
+	if err != nil {
+		return fmt.Errorf("failed to encode verified contract: %w", err)
+	}
+
+	return writeFileAtomic(file, data)
+}
@@ -0,0 +1,114 @@
+package compiler
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const testAST = `{
+	"absolutePath": "contracts/Token.sol",
+	"id": 10,
+	"nodeType": "SourceUnit",
+	"nodes": [
+		{"id": 1, "nodeType": "PragmaDirective", "literals": ["solidity", "^", "0.8", ".0"]},
+		{
+			"id": 9,
+			"nodeType": "ContractDefinition",
+			"name": "Token",
+			"linearizedBaseContracts": [9],
+			"nodes": [
+				{
+					"id": 3,
+					"nodeType": "VariableDeclaration",
+					"name": "totalSupply",
+					"constant": false,
+					"mutability": "mutable",
+					"typeName": {
+						"id": 2,
+						"nodeType": "ElementaryTypeName",
+						"typeDescriptions": {"typeIdentifier": "t_uint256", "typeString": "uint256"}
+					}
+				},
+				{"id": 8, "nodeType": "FunctionDefinition", "name": "mint", "visibility": "external"}
+			]
+		}
+	]
+}`
+
+func TestVerifiedStore(t *testing.T) {
+	store, err := NewVerifiedStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ast SourceUnitNode
+	if err := json.Unmarshal([]byte(testAST), &ast); err != nil {
+		t.Fatal(err)
+	}
+
+	address := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	if _, err := store.Get("ethereum", address); !errors.Is(err, ErrNotVerified) {
+		t.Errorf("expected ErrNotVerified, got %v", err)
+	}
+
+	contract := &VerifiedContract{
+		Chain:    "ethereum",
+		Address:  address,
+		CodeHash: common.HexToHash("0x01"),
+		Match:    MatchExact,
+		Version:  "0.8.17",
+		File:     "contracts/Token.sol",
+		Name:     "Token",
+		Sources: map[string]*StandardJsonSource{
+			"contracts/Token.sol": {ID: 0, AST: &ast},
+		},
+	}
+	if err := store.Put(contract); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.Get("ethereum", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Match != MatchExact || stored.Name != "Token" {
+		t.Errorf("unexpected contract %+v", stored)
+	}
+
+	// the AST survives being stored, including nodes which aren't parsed
+	nodes := IndexNodes(stored.Sources)
+	variable, ok := nodes[3].Node.(*VariableDeclarationNode)
+	if !ok || variable.Name != "totalSupply" || variable.TypeName.TypeDescriptions.TypeIdentifier != "t_uint256" {
+		t.Errorf("unexpected variable %+v", nodes[3])
+	}
+	if function, ok := nodes[8].Node.(map[string]any); !ok || function["name"] != "mint" || nodes[8].NodeType != "FunctionDefinition" {
+		t.Errorf("unexpected function %+v", nodes[8])
+	}
+
+	// a partial match doesn't replace an exact match of the same code
+	partial := *contract
+	partial.Match = MatchPartial
+	partial.Name = "Other"
+	if err := store.Put(&partial); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.Get("ethereum", address); err != nil || stored.Name != "Token" {
+		t.Errorf("expected the exact match to be kept, got %+v %v", stored, err)
+	}
+
+	// unless the code has changed
+	partial.CodeHash = common.HexToHash("0x02")
+	if err := store.Put(&partial); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.Get("ethereum", address); err != nil || stored.Name != "Other" {
+		t.Errorf("expected the partial match to replace the old code, got %+v %v", stored, err)
+	}
+
+	if _, err := store.Get("../ethereum", address); err == nil {
+		t.Errorf("expected an invalid chain to be rejected")
+	}
+}
@@ -0,0 +1,147 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+var ErrBytecodeMismatch = errors.New("deployed code doesn't match the compiled code")
+
+type MatchType string
+
+const (
+	// MatchExact means the deployed code is identical to the compiled code, metadata included, so the sources are
+	// exactly those the contract was compiled from
+	MatchExact MatchType = "exact"
+	// MatchPartial means the deployed code only differs from the compiled code in its metadata, so the sources
+	// compile to the same code but may differ in comments, whitespace or file names
+	MatchPartial MatchType = "partial"
+)
+
+// StripMetadata returns the code without its trailing CBOR metadata
+func StripMetadata(code []byte) []byte {
+	metadata, err := DecodeMetadata(code)
+	if err != nil {
+		return code
+	}
+	return code[:len(code)-metadata.Length]
+}
+
+var placeholderRegexp = regexp.MustCompile(`__[$_A-Za-z0-9:./-]{36}__`)
+
+// decodeBytecode decodes the hex of compiled code, replacing the placeholders of unlinked libraries with zeroes
+func decodeBytecode(object string) ([]byte, error) {
+	object = strings.TrimPrefix(object, "0x")
+	object = placeholderRegexp.ReplaceAllString(object, strings.Repeat("0", 40))
+
+	code, err := hex.DecodeString(object)
+	if err != nil {
+		return nil, fmt.Errorf("invalid bytecode: %w", err)
+	}
+	return code, nil
+}
+
+// BytecodeMatch describes how deployed code matched compiled code
+type BytecodeMatch struct {
+	Match MatchType
+	// Libraries holds the address each library was linked to, keyed by fully qualified library name
+	Libraries map[string]common.Address
+	// Immutables holds the value of each immutable, keyed by its AST id
+	Immutables map[string]hexutil.Bytes
+}
+
+// fill copies the deployed code over the compiled code in the given range. This is how the parts which are only
+// known after deployment, such as library addresses and immutables, are made to match.
+func fill(compiled []byte, deployed []byte, ref *StandardJsonLinkReference) ([]byte, error) {
+	if ref.Start < 0 || ref.Length < 0 || ref.Start+ref.Length > len(compiled) {
+		return nil, fmt.Errorf("reference %d+%d is out of bounds", ref.Start, ref.Length)
+	}
+
+	copy(compiled[ref.Start:ref.Start+ref.Length], deployed[ref.Start:ref.Start+ref.Length])
+	return deployed[ref.Start : ref.Start+ref.Length], nil
+}
+
+// isLibrary returns whether the code starts with the call protection of a library, which pushes the address the
+// library is deployed at. The address is zero in the compiled code and filled in by the constructor.
+func isLibrary(code []byte) bool {
+	return len(code) >= 23 && code[0] == 0x73 && bytes.Equal(code[1:21], make([]byte, 20)) && code[21] == 0x30 && code[22] == 0x14
+}
+
+// MatchDeployedBytecode compares the code of a deployed contract with the deployed bytecode from its compilation.
+// Linked libraries and immutables are taken from the deployed code, and the metadata is only compared if the rest
+// of the code matches. ErrBytecodeMismatch is returned if the code doesn't match at all.
+func MatchDeployedBytecode(deployed []byte, compiled *StandardJsonBytecode) (*BytecodeMatch, error) {
+	if compiled == nil || compiled.Object == "" {
+		return nil, fmt.Errorf("%w: no code was compiled", ErrBytecodeMismatch)
+	}
+
+	code, err := decodeBytecode(compiled.Object)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(code) != len(deployed) {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", ErrBytecodeMismatch, len(code), len(deployed))
+	}
+
+	result := &BytecodeMatch{
+		Libraries:  make(map[string]common.Address),
+		Immutables: make(map[string]hexutil.Bytes),
+	}
+
+	for file, libraries := range compiled.LinkReferences {
+		for name, refs := range libraries {
+			library := file + ":" + name
+			for _, ref := range refs {
+				value, err := fill(code, deployed, ref)
+				if err != nil {
+					return nil, fmt.Errorf("library %s: %w", library, err)
+				}
+
+				address := common.BytesToAddress(value)
+				if previous, ok := result.Libraries[library]; ok && previous != address {
+					return nil, fmt.Errorf("%w: library %s is linked to both %s and %s", ErrBytecodeMismatch, library, previous, address)
+				}
+				result.Libraries[library] = address
+			}
+		}
+	}
+
+	for id, refs := range compiled.ImmutableReferences {
+		for _, ref := range refs {
+			value, err := fill(code, deployed, ref)
+			if err != nil {
+				return nil, fmt.Errorf("immutable %s: %w", id, err)
+			}
+
+			if previous, ok := result.Immutables[id]; ok && !bytes.Equal(previous, value) {
+				return nil, fmt.Errorf("%w: immutable %s has different values", ErrBytecodeMismatch, id)
+			}
+			result.Immutables[id] = value
+		}
+	}
+
+	if isLibrary(code) {
+		copy(code[1:21], deployed[1:21])
+	}
+
+	if bytes.Equal(code, deployed) {
+		result.Match = MatchExact
+		return result, nil
+	}
+
+	stripped, deployedStripped := StripMetadata(code), StripMetadata(deployed)
+	if len(stripped) < len(code) && bytes.Equal(stripped, deployedStripped) {
+		result.Match = MatchPartial
+		return result, nil
+	}
+
+	return nil, ErrBytecodeMismatch
+}
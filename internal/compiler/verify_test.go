@@ -0,0 +1,120 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// testMetadata is the CBOR metadata solc 0.8.17 appends, with an ipfs hash made of b
+func testMetadata(b byte) []byte {
+	result := []byte{0xa2, 0x64, 'i', 'p', 'f', 's', 0x58, 0x22}
+	result = append(result, bytes.Repeat([]byte{b}, 34)...)
+	result = append(result, 0x64, 's', 'o', 'l', 'c', 0x43, 0x00, 0x08, 0x11)
+	return append(result, 0x00, 0x33)
+}
+
+func TestStripMetadata(t *testing.T) {
+	code := []byte{0x60, 0x80, 0x60, 0x40, 0x52}
+
+	if stripped := StripMetadata(append(code, testMetadata(1)...)); !bytes.Equal(stripped, code) {
+		t.Errorf("expected the metadata to be stripped, got %x", stripped)
+	}
+
+	// code without metadata is left alone, even if its last bytes look like a length
+	for _, code := range [][]byte{nil, {0x00}, {0x60, 0x80, 0x00, 0x02}, {0x60, 0x80, 0x60, 0x00, 0x02}} {
+		if stripped := StripMetadata(code); !bytes.Equal(stripped, code) {
+			t.Errorf("expected %x to be left alone, got %x", code, stripped)
+		}
+	}
+}
+
+func TestMatchDeployedBytecode(t *testing.T) {
+	code := []byte{0x60, 0x80, 0x60, 0x40, 0x52, 0x00}
+	compiled := &StandardJsonBytecode{Object: hex.EncodeToString(append(code, testMetadata(1)...))}
+
+	match, err := MatchDeployedBytecode(append(code, testMetadata(1)...), compiled)
+	if err != nil || match.Match != MatchExact {
+		t.Errorf("expected an exact match, got %+v %v", match, err)
+	}
+
+	match, err = MatchDeployedBytecode(append(code, testMetadata(2)...), compiled)
+	if err != nil || match.Match != MatchPartial {
+		t.Errorf("expected a partial match, got %+v %v", match, err)
+	}
+
+	for _, deployed := range [][]byte{
+		append([]byte{0x60, 0x81, 0x60, 0x40, 0x52, 0x00}, testMetadata(1)...),
+		append(code[:5], testMetadata(1)...),
+	} {
+		if _, err := MatchDeployedBytecode(deployed, compiled); !errors.Is(err, ErrBytecodeMismatch) {
+			t.Errorf("expected ErrBytecodeMismatch, got %v", err)
+		}
+	}
+
+	// without metadata, any difference is a mismatch
+	if _, err := MatchDeployedBytecode([]byte{0x60, 0x81}, &StandardJsonBytecode{Object: "6080"}); !errors.Is(err, ErrBytecodeMismatch) {
+		t.Errorf("expected ErrBytecodeMismatch, got %v", err)
+	}
+}
+
+func TestMatchDeployedBytecodeLinked(t *testing.T) {
+	library := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	immutable := common.HexToHash("0x2a")
+
+	// PUSH20 <library> PUSH32 <immutable> PUSH32 <immutable>
+	deployed := append([]byte{0x73}, library.Bytes()...)
+	deployed = append(deployed, 0x7f)
+	deployed = append(deployed, immutable.Bytes()...)
+	deployed = append(deployed, 0x7f)
+	deployed = append(deployed, immutable.Bytes()...)
+	deployed = append(deployed, testMetadata(1)...)
+
+	object := "73" + "__$" + strings.Repeat("ab", 17) + "$__" + "7f" + strings.Repeat("00", 32) + "7f" + strings.Repeat("00", 32) + hex.EncodeToString(testMetadata(1))
+	compiled := &StandardJsonBytecode{
+		Object: object,
+		LinkReferences: map[string]map[string][]*StandardJsonLinkReference{
+			"contracts/Math.sol": {"Math": {{Start: 1, Length: 20}}},
+		},
+		ImmutableReferences: map[string][]*StandardJsonLinkReference{
+			"7": {{Start: 22, Length: 32}, {Start: 55, Length: 32}},
+		},
+	}
+
+	match, err := MatchDeployedBytecode(deployed, compiled)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if match.Match != MatchExact {
+		t.Errorf("expected an exact match, got %s", match.Match)
+	}
+	if match.Libraries["contracts/Math.sol:Math"] != library {
+		t.Errorf("unexpected libraries %v", match.Libraries)
+	}
+	if !bytes.Equal(match.Immutables["7"], immutable.Bytes()) {
+		t.Errorf("unexpected immutables %v", match.Immutables)
+	}
+
+	// every reference to an immutable must hold the same value
+	deployed[86] = 0x2b
+	if _, err := MatchDeployedBytecode(deployed, compiled); !errors.Is(err, ErrBytecodeMismatch) {
+		t.Errorf("expected ErrBytecodeMismatch, got %v", err)
+	}
+}
+
+func TestMatchDeployedBytecodeLibrary(t *testing.T) {
+	address := common.HexToAddress("0x1111111111111111111111111111111111111111")
+
+	// libraries start by pushing their own address, which is only known once deployed
+	deployed := append(append([]byte{0x73}, address.Bytes()...), 0x30, 0x14, 0x60, 0x80)
+	compiled := &StandardJsonBytecode{Object: "73" + strings.Repeat("00", 20) + "30146080"}
+
+	match, err := MatchDeployedBytecode(deployed, compiled)
+	if err != nil || match.Match != MatchExact {
+		t.Errorf("expected an exact match, got %+v %v", match, err)
+	}
+}
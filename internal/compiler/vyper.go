@@ -19,15 +19,12 @@ package compiler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
-	"net/http"
-	"os"
 	"os/exec"
-	"path"
-	"runtime"
+	"regexp"
 	"strconv"
 	"strings"
 )
@@ -97,12 +94,69 @@ func (s *Vyper) run(cmd *exec.Cmd, source string) (map[string]*Contract, error)
 	cmd.Stderr = &stderr
 	cmd.Stdout = &stdout
 	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("vyper: %v\n%s", err, stderr.Bytes())
+		return nil, vyperRunError(err, stderr.String())
 	}
 
 	return ParseVyperJSON(stdout.Bytes(), source, s.Version, s.Version, strings.Join(s.makeArgs(), " "))
 }
 
+// VyperError is returned when vyper rejects the source. Vyper stops at the first problem it finds, so there is only
+// ever one.
+type VyperError struct {
+	// Type is the name of the exception raised, e.g. StructureException
+	Type    string
+	Message string
+	// Line and Column are zero if vyper didn't report a location
+	Line   int
+	Column int
+	// Output is everything vyper wrote to stderr
+	Output string
+}
+
+func (e *VyperError) Error() string {
+	return fmt.Sprintf("vyper: %s", e.Output)
+}
+
+var (
+	vyperExceptionRegexp = regexp.MustCompile(`(?m)^(?:vyper\.exceptions\.)?([A-Za-z]+(?:Exception|Error)): (.*)$`)
+	vyperLocationRegexp  = regexp.MustCompile(`line (\d+):(\d+)`)
+)
+
+// ParseVyperError extracts the exception raised by vyper from its stderr output
+func ParseVyperError(output string) *VyperError {
+	output = strings.TrimSpace(output)
+
+	result := &VyperError{
+		Output: output,
+	}
+
+	if matches := vyperExceptionRegexp.FindStringSubmatch(output); matches != nil {
+		result.Type = matches[1]
+		result.Message = strings.TrimSpace(matches[2])
+	} else if lines := strings.Split(output, "\n"); len(lines) > 0 {
+		// not an exception we recognize (e.g. an internal error), the last line is usually the most useful
+		result.Message = strings.TrimSpace(lines[len(lines)-1])
+	}
+
+	if matches := vyperLocationRegexp.FindStringSubmatch(output); matches != nil {
+		result.Line, _ = strconv.Atoi(matches[1])
+		result.Column, _ = strconv.Atoi(matches[2])
+	}
+
+	return result
+}
+
+// vyperRunError converts a failed vyper run into an error. If vyper ran and rejected the source, the error is a
+// *VyperError.
+func vyperRunError(err error, stderr string) error {
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || strings.TrimSpace(stderr) == "" {
+		return fmt.Errorf("vyper: %w\n%s", err, stderr)
+	}
+
+	return ParseVyperError(stderr)
+}
+
 // ParseVyperJSON takes the direct output of a vyper --f combined_json run and
 // parses it into a map of string contract name to Contract structs. The
 // provided source, language and compiler version, and compiler options are all
@@ -151,109 +205,129 @@ func ParseVyperJSON(combinedJSON []byte, source string, languageVersion string,
 type VyperCompiler struct {
 	version string
 	path    string
+	runner  *Runner
 }
 
-func NewVyperCompiler(version string) (Compiler, error) {
-	compilerDir := path.Join(os.TempDir(), "vyper", version)
-
-	var compilerPath string
-	if runtime.GOOS == "windows" {
-		compilerPath = path.Join(compilerDir, "vyper.exe")
-	} else {
-		compilerPath = path.Join(compilerDir, "vyper")
+// NewVyperCompiler returns a compiler for the given version, installing it through the manager if needed.
+// Compilations are run by the runner.
+func NewVyperCompiler(ctx context.Context, manager *Manager, runner *Runner, version string) (*VyperCompiler, error) {
+	if manager.Language() != LanguageVyper {
+		return nil, fmt.Errorf("expected a %s compiler manager, got %s", LanguageVyper, manager.Language())
 	}
 
-	if _, err := os.Stat(compilerPath); err != nil {
-		if !os.IsNotExist(err) {
-			return nil, fmt.Errorf("failed to check compiler: %w", err)
-		}
-		err = downloadVyperCompiler(version, compilerDir)
-		if err != nil {
-			return nil, fmt.Errorf("failed to download compiler: %w", err)
-		}
+	compilerPath, err := manager.Install(ctx, version)
+	if err != nil {
+		return nil, err
 	}
 
 	return &VyperCompiler{
 		version: version,
 		path:    compilerPath,
+		runner:  runner,
 	}, nil
 }
 
-func downloadVyperCompiler(version string, dest string) error {
-	err := os.MkdirAll(dest, os.FileMode(0755))
-	if err != nil {
-		return fmt.Errorf("failed to create parent dir: %w", err)
-	}
+func (c *VyperCompiler) CompileFromString(src string) (map[string]*Contract, error) {
+	return c.CompileFromStringContext(context.Background(), src)
+}
 
-	resp, err := http.Get(fmt.Sprintf(`https://api.github.com/repos/vyperlang/vyper/releases/tags/v%s`, version))
+// CompileFromStringContext compiles the source, stopping the compiler if the context is cancelled
+func (c *VyperCompiler) CompileFromStringContext(ctx context.Context, src string) (map[string]*Contract, error) {
+	args := (&Vyper{}).makeArgs()
+
+	stdout, stderr, err := c.runner.Run(ctx, c.path, append(args, "/dev/stdin"), []byte(src))
 	if err != nil {
-		return fmt.Errorf("failed to get release manifest: %w", err)
+		return nil, vyperRunError(err, string(stderr))
 	}
 
-	var release struct {
-		Assets []struct {
-			Name               string `json:"name"`
-			BrowserDownloadURL string `json:"browser_download_url"`
-		} `json:"assets"`
-	}
-	if err := json.NewDecoder(resp.Body).Decode(&release); err != nil {
-		return fmt.Errorf("failed to decode manifest: %w", err)
-	}
+	return ParseVyperJSON(stdout, src, c.version, c.version, strings.Join(args, " "))
+}
 
-	var url string
-	var name string
+// VyperStandardJsonInput is vyper's standard JSON input. Unlike solc, vyper takes the interfaces a source imports
+// separately from the sources to compile, see https://docs.vyperlang.org/en/stable/compiling-a-contract.html
+type VyperStandardJsonInput struct {
+	Language   string                             `json:"language"`
+	Sources    map[string]*StandardJsonSourceFile `json:"sources"`
+	Interfaces map[string]*VyperInterface         `json:"interfaces,omitempty"`
+	Settings   map[string]any                     `json:"settings"`
+}
 
-	for _, asset := range release.Assets {
-		if runtime.GOOS == "linux" && strings.Contains(asset.Name, "linux") {
-			url = asset.BrowserDownloadURL
-			name = "vyper"
-		} else if runtime.GOOS == "windows" && strings.Contains(asset.Name, "windows") {
-			url = asset.BrowserDownloadURL
-			name = "vyper.exe"
-		}
-	}
+// VyperInterface is either vyper source, for .vy interfaces, or an ABI, for .json interfaces
+type VyperInterface struct {
+	Content string `json:"content,omitempty"`
+	ABI     any    `json:"abi,omitempty"`
+}
 
-	if url == "" {
-		return fmt.Errorf("unsupported os %s", runtime.GOOS)
-	}
+type VyperStandardJsonOutput struct {
+	Compiler  string                                           `json:"compiler"`
+	Errors    []*VyperStandardJsonError                        `json:"errors,omitempty"`
+	Contracts map[string]map[string]*VyperStandardJsonContract `json:"contracts,omitempty"`
+	Sources   map[string]*VyperStandardJsonSource              `json:"sources,omitempty"`
+}
 
-	resp, err = http.Get(url)
-	if err != nil {
-		return fmt.Errorf("failed to download solidity v%s: %w", version, err)
-	}
-	defer resp.Body.Close()
+type VyperStandardJsonError struct {
+	SourceLocation   *VyperSourceLocation `json:"sourceLocation,omitempty"`
+	Type             string               `json:"type"`
+	Component        string               `json:"component"`
+	Severity         string               `json:"severity"`
+	Message          string               `json:"message"`
+	FormattedMessage string               `json:"formattedMessage,omitempty"`
+}
 
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("failed to read body: %w", err)
-	}
+// VyperSourceLocation is a position within a source. Lines start at 1 and columns at 0.
+type VyperSourceLocation struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"lineno"`
+	Column int    `json:"col_offset"`
+}
 
-	err = ioutil.WriteFile(path.Join(dest, name), body, os.FileMode(0755))
-	if err != nil {
-		return fmt.Errorf("failed to write compiler: %w", err)
-	}
+type VyperStandardJsonSource struct {
+	ID  int `json:"id"`
+	AST any `json:"ast,omitempty"`
+}
 
-	return nil
+type VyperStandardJsonContract struct {
+	ABI     any `json:"abi,omitempty"`
+	DevDoc  any `json:"devdoc,omitempty"`
+	UserDoc any `json:"userdoc,omitempty"`
+	// Layout is the storage layout, whose shape has changed between vyper versions
+	Layout any                   `json:"layout,omitempty"`
+	EVM    *VyperStandardJsonEVM `json:"evm,omitempty"`
 }
 
-func (c *VyperCompiler) CompileFromString(src string) (map[string]*Contract, error) {
-	s, err := VyperVersion(c.path)
+type VyperStandardJsonEVM struct {
+	Bytecode          *VyperStandardJsonBytecode `json:"bytecode,omitempty"`
+	DeployedBytecode  *VyperStandardJsonBytecode `json:"deployedBytecode,omitempty"`
+	MethodIdentifiers map[string]string          `json:"methodIdentifiers,omitempty"`
+}
+
+type VyperStandardJsonBytecode struct {
+	Object  string `json:"object"`
+	Opcodes string `json:"opcodes,omitempty"`
+	// SourceMap is a compressed string like solc's in most versions, but not all
+	SourceMap any `json:"sourceMap,omitempty"`
+}
+
+// CompileFromStandardJSON compiles the input with vyper --standard-json. Problems with the sources are reported in
+// the output's errors, an error is only returned if vyper couldn't produce any output. The output is returned as
+// vyper wrote it, so that outputs VyperStandardJsonOutput doesn't model, like the IR or the AST, aren't lost.
+func (c *VyperCompiler) CompileFromStandardJSON(ctx context.Context, input *VyperStandardJsonInput) (json.RawMessage, error) {
+	b, err := json.Marshal(input)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to marshal settings: %w", err)
 	}
-	args := s.makeArgs()
-	cmd := exec.Command(s.Path, append(args, "/dev/stdin")...)
-	return c.run(s, cmd, src)
-}
 
-func (c *VyperCompiler) run(s *Vyper, cmd *exec.Cmd, source string) (map[string]*Contract, error) {
-	var stderr, stdout bytes.Buffer
-	cmd.Stdin = strings.NewReader(source)
-	cmd.Stderr = &stderr
-	cmd.Stdout = &stdout
-	if err := cmd.Run(); err != nil {
-		return nil, fmt.Errorf("vyper: %v\n%s", err, stderr.Bytes())
+	stdout, stderr, runErr := c.runner.Run(ctx, c.path, []string{"--standard-json"}, b)
+
+	// some versions exit with an error after writing their diagnostics, which are more useful than stderr
+	var diagnostics struct {
+		Errors []*VyperStandardJsonError `json:"errors"`
+	}
+	if err := json.Unmarshal(stdout, &diagnostics); err == nil && (runErr == nil || len(diagnostics.Errors) > 0) {
+		return stdout, nil
+	} else if runErr == nil {
+		return nil, fmt.Errorf("failed to unmarshal: %w", err)
 	}
 
-	return ParseVyperJSON(stdout.Bytes(), source, s.Version, s.Version, strings.Join(s.makeArgs(), " "))
+	return nil, vyperRunError(runErr, string(stderr))
 }
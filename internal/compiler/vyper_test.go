@@ -17,7 +17,13 @@
 package compiler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -68,4 +74,126 @@ func TestVyperCompileError(t *testing.T) {
 		t.Errorf("error expected compiling test_bad.v.py. got none. result %v", contracts)
 	}
 	t.Logf("error: %v", err)
+
+	var vyperErr *VyperError
+	if !errors.As(err, &vyperErr) {
+		t.Fatalf("expected a *VyperError, got %T", err)
+	}
+	if vyperErr.Message == "" {
+		t.Error("empty error message")
+	}
+}
+
+func TestParseVyperError(t *testing.T) {
+	tests := []struct {
+		output  string
+		typ     string
+		message string
+		line    int
+		column  int
+	}{
+		{
+			output: "Error compiling: /dev/stdin\n" +
+				"vyper.exceptions.StructureException: Invalid top-level statement\n" +
+				"  contract \"/dev/stdin:1\", line 1:0 \n" +
+				"---> 1 lic\n" +
+				"-------^\n",
+			typ:     "StructureException",
+			message: "Invalid top-level statement",
+			line:    1,
+			column:  0,
+		},
+		{
+			output:  "Error compiling: test_bad.v.py\nvyper.exceptions.SyntaxException: line 3:9 invalid syntax\n",
+			typ:     "SyntaxException",
+			message: "line 3:9 invalid syntax",
+			line:    3,
+			column:  9,
+		},
+		{
+			output:  "Traceback (most recent call last):\n  File \"vyper\", line 8\nKeyboardInterrupt\n",
+			message: "KeyboardInterrupt",
+		},
+	}
+
+	for _, test := range tests {
+		err := ParseVyperError(test.output)
+		if err.Type != test.typ {
+			t.Errorf("wrong type: expected %q, got %q", test.typ, err.Type)
+		}
+		if err.Message != test.message {
+			t.Errorf("wrong message: expected %q, got %q", test.message, err.Message)
+		}
+		if err.Line != test.line || err.Column != test.column {
+			t.Errorf("wrong location: expected %d:%d, got %d:%d", test.line, test.column, err.Line, err.Column)
+		}
+	}
+}
+
+// fakeVyper writes a script which stands in for vyper, checking that it's run in standard JSON mode
+func fakeVyper(t *testing.T, script string) *VyperCompiler {
+	path := filepath.Join(t.TempDir(), "vyper")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n[ \"$1\" = --standard-json ] || exit 2\ncat >/dev/null\n"+script), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	return &VyperCompiler{
+		version: "0.3.7",
+		path:    path,
+		runner:  NewRunner(&RunnerConfig{ScratchDir: t.TempDir()}),
+	}
+}
+
+func TestVyperCompileFromStandardJSON(t *testing.T) {
+	skipWithoutShell(t)
+
+	input := &VyperStandardJsonInput{
+		Language: "Vyper",
+		Sources: map[string]*StandardJsonSourceFile{
+			"contracts/foo.vy": {Content: "import interfaces.Bar as Bar\n"},
+		},
+		Interfaces: map[string]*VyperInterface{
+			"interfaces/Bar.json": {ABI: []any{}},
+		},
+		Settings: map[string]any{"evmVersion": "paris"},
+	}
+
+	compiler := fakeVyper(t, `echo '{"compiler":"vyper-0.3.7","contracts":{"contracts/foo.vy":{"foo":{"abi":[],"ir":"seq","evm":{"deployedBytecode":{"object":"0x6000","sourceMap":"0:1:0:-;"}}}}},"sources":{"contracts/foo.vy":{"id":0}}}'`)
+	raw, err := compiler.CompileFromStandardJSON(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// outputs which aren't modeled, like the IR, are kept
+	if !strings.Contains(string(raw), `"ir":"seq"`) {
+		t.Errorf("expected the output to be returned as it is, got %s", raw)
+	}
+	var output VyperStandardJsonOutput
+	if err := json.Unmarshal(raw, &output); err != nil {
+		t.Fatal(err)
+	}
+	contract := output.Contracts["contracts/foo.vy"]["foo"]
+	if contract == nil || contract.EVM.DeployedBytecode.Object != "0x6000" || contract.EVM.DeployedBytecode.SourceMap != "0:1:0:-;" {
+		t.Errorf("unexpected output %+v", output)
+	}
+
+	// diagnostics are returned in the output, even if vyper exits with an error
+	compiler = fakeVyper(t, `echo '{"compiler":"vyper-0.3.7","errors":[{"type":"StructureException","component":"compiler","severity":"error","message":"Invalid top-level statement","sourceLocation":{"file":"contracts/foo.vy","lineno":1,"col_offset":0}}]}'; exit 1`)
+	raw, err = compiler.CompileFromStandardJSON(context.Background(), input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	output = VyperStandardJsonOutput{}
+	if err := json.Unmarshal(raw, &output); err != nil {
+		t.Fatal(err)
+	}
+	if len(output.Errors) != 1 || output.Errors[0].Type != "StructureException" || output.Errors[0].SourceLocation.Line != 1 {
+		t.Errorf("unexpected errors %+v", output.Errors)
+	}
+
+	compiler = fakeVyper(t, `echo 'vyper.exceptions.JSONError: Unsupported language' >&2; exit 1`)
+	_, err = compiler.CompileFromStandardJSON(context.Background(), input)
+	var vyperErr *VyperError
+	if !errors.As(err, &vyperErr) || vyperErr.Type != "JSONError" {
+		t.Errorf("expected a VyperError, got %v", err)
+	}
 }
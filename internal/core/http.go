@@ -1,8 +1,10 @@
 package core
 
 import (
+	"fmt"
 	"net"
 	"net/http"
+	"strings"
 )
 
 func GetRemoteIP(req *http.Request) string {
@@ -22,6 +24,79 @@ func GetRemoteIP(req *http.Request) string {
 	return host
 }
 
+// ParseNetworks parses a list of CIDRs or single ips
+func ParseNetworks(raw []string) ([]*net.IPNet, error) {
+	var result []*net.IPNet
+	for _, entry := range raw {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid ip %q", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			result = append(result, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, fmt.Errorf("invalid network %q: %w", entry, err)
+		}
+		result = append(result, network)
+	}
+	return result, nil
+}
+
+func containsIP(networks []*net.IPNet, raw string) bool {
+	ip := net.ParseIP(strings.TrimSpace(raw))
+	if ip == nil {
+		return false
+	}
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// GetTrustedRemoteIP returns the ip of the client. Anyone can set the forwarding headers, so they're only used when
+// the request comes from one of the trusted proxies, and X-Forwarded-For is read from the right, skipping the
+// addresses of trusted proxies.
+func GetTrustedRemoteIP(req *http.Request, trusted []*net.IPNet) string {
+	peer, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		peer = req.RemoteAddr
+	}
+	if !containsIP(trusted, peer) {
+		return peer
+	}
+
+	if ip := req.Header.Get("CF-Connecting-IP"); len(ip) != 0 {
+		return ip
+	}
+	if forwarded := req.Header.Get("X-Forwarded-For"); len(forwarded) != 0 {
+		hops := strings.Split(forwarded, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			if hop := strings.TrimSpace(hops[i]); !containsIP(trusted, hop) || i == 0 {
+				return hop
+			}
+		}
+	}
+	if ip := req.Header.Get("X-Real-IP"); len(ip) != 0 {
+		return ip
+	}
+	return peer
+}
+
 func GetUserAgent(req *http.Request) string {
 	return req.Header.Get("User-Agent")
 }
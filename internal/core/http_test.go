@@ -0,0 +1,44 @@
+package core
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetTrustedRemoteIP(t *testing.T) {
+	trusted, err := ParseNetworks([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name       string
+		remoteAddr string
+		headers    map[string]string
+		expected   string
+	}{
+		{"direct", "1.2.3.4:5678", nil, "1.2.3.4"},
+		{"spoofed headers", "1.2.3.4:5678", map[string]string{"X-Forwarded-For": "5.6.7.8", "CF-Connecting-IP": "5.6.7.8"}, "1.2.3.4"},
+		{"cloudflare", "10.0.0.1:5678", map[string]string{"CF-Connecting-IP": "5.6.7.8"}, "5.6.7.8"},
+		{"forwarded", "10.0.0.1:5678", map[string]string{"X-Forwarded-For": "9.9.9.9, 5.6.7.8, 192.168.1.1"}, "5.6.7.8"},
+		{"forwarded by proxies only", "10.0.0.1:5678", map[string]string{"X-Forwarded-For": "10.0.0.2, 10.0.0.3"}, "10.0.0.2"},
+		{"real ip", "192.168.1.1:5678", map[string]string{"X-Real-IP": "5.6.7.8"}, "5.6.7.8"},
+		{"proxy without headers", "10.0.0.1:5678", nil, "10.0.0.1"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = test.remoteAddr
+			for k, v := range test.headers {
+				r.Header.Set(k, v)
+			}
+
+			if ip := GetTrustedRemoteIP(r, trusted); ip != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, ip)
+			}
+		})
+	}
+
+	if _, err := ParseNetworks([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("expected an invalid network to be rejected")
+	}
+}
@@ -71,3 +71,8 @@ func (t *Tx) QuerySimple(apply RowsScanner, query string, args ...any) error {
 func (t *Tx) QueryRowSimple(apply RowScanner, query string, args ...any) error {
 	return apply(t.Tx.QueryRow(context.Background(), query, args...))
 }
+
+// CopySimple bulk loads rows into table using the COPY protocol, returning the number of rows copied
+func (t *Tx) CopySimple(table string, columns []string, rows [][]any) (int64, error) {
+	return t.CopyFrom(context.Background(), pgx.Identifier{table}, columns, pgx.CopyFromRows(rows))
+}
@@ -0,0 +1,57 @@
+// Package evm contains helpers for statically analyzing EVM bytecode.
+package evm
+
+import (
+	"fmt"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// Instruction is a single disassembled opcode, along with its immediate argument if it is a PUSH
+type Instruction struct {
+	PC  uint64
+	Op  vm.OpCode
+	Arg []byte
+}
+
+func (i *Instruction) String() string {
+	if len(i.Arg) > 0 {
+		return fmt.Sprintf("%04x: %s 0x%x", i.PC, i.Op, i.Arg)
+	}
+	return fmt.Sprintf("%04x: %s", i.PC, i.Op)
+}
+
+// PushSize returns the number of immediate bytes which follow op
+func PushSize(op vm.OpCode) int {
+	if op.IsPush() {
+		return int(op-vm.PUSH1) + 1
+	}
+	return 0
+}
+
+// Disassemble linearly decodes the given code. Data which is embedded in the code, like the metadata, is decoded
+// as if it were code. A PUSH which is truncated by the end of the code has its argument zero-padded, just like
+// the EVM would.
+func Disassemble(code []byte) []*Instruction {
+	var result []*Instruction
+	for pc := 0; pc < len(code); pc++ {
+		op := vm.OpCode(code[pc])
+		instr := &Instruction{
+			PC: uint64(pc),
+			Op: op,
+		}
+
+		if size := PushSize(op); size > 0 {
+			instr.Arg = make([]byte, size)
+			end := pc + 1 + size
+			if end > len(code) {
+				end = len(code)
+			}
+			copy(instr.Arg, code[pc+1:end])
+			pc += size
+		}
+
+		result = append(result, instr)
+	}
+	return result
+}
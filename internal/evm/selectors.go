@@ -0,0 +1,229 @@
+package evm
+
+import (
+	"encoding/hex"
+	"sort"
+
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+func isDupOrSwap(op vm.OpCode) bool {
+	return (op >= vm.DUP1 && op <= vm.DUP16) || (op >= vm.SWAP1 && op <= vm.SWAP16)
+}
+
+// endsBlock returns whether op is the last instruction of a basic block
+func endsBlock(op vm.OpCode) bool {
+	switch op {
+	case vm.JUMP, vm.JUMPI, vm.STOP, vm.RETURN, vm.REVERT, vm.INVALID, vm.SELFDESTRUCT:
+		return true
+	}
+	return false
+}
+
+// selectorComparison is a comparison of the selector which is used for a conditional jump
+type selectorComparison struct {
+	// jumpi is the index of the JUMPI the comparison ends in
+	jumpi int
+	// jumpsOnMatch is set if the JUMPI is taken when the selector matches, in which case it jumps to the function.
+	// Otherwise it's taken when the selector doesn't match, and jumps to the next comparison.
+	jumpsOnMatch bool
+}
+
+// matchSelectorComparison checks whether the PUSH at instrs[i] is compared against the selector and used for a
+// conditional jump. It recognizes the following shapes, where the selector may have been pushed with fewer than
+// four bytes if it has leading zeros:
+//
+//	PUSH4 sel (DUPn | SWAPn)* EQ PUSH dest JUMPI        solc, jumps to the function
+//	PUSH4 sel (DUPn | SWAPn)* XOR PUSH dest JUMPI       vyper 0.3, jumps to the next comparison
+//	PUSH4 sel PUSH1 x MLOAD EQ ISZERO PUSH dest JUMPI   vyper 0.2, jumps to the next comparison
+func matchSelectorComparison(instrs []*Instruction, i int) (*selectorComparison, bool) {
+	at := func(j int) *Instruction {
+		if j < len(instrs) {
+			return instrs[j]
+		}
+		return &Instruction{Op: vm.STOP}
+	}
+
+	j := i + 1
+	for glue := 0; glue < 2; glue++ {
+		if isDupOrSwap(at(j).Op) {
+			j++
+		} else if at(j).Op.IsPush() && (at(j+1).Op == vm.MLOAD || at(j+1).Op == vm.CALLDATALOAD) {
+			j += 2
+		}
+	}
+
+	op := at(j).Op
+	if op != vm.EQ && op != vm.XOR {
+		return nil, false
+	}
+	jumpsOnMatch := op == vm.EQ
+	j++
+
+	for at(j).Op == vm.ISZERO {
+		jumpsOnMatch = !jumpsOnMatch
+		j++
+	}
+
+	size := PushSize(at(j).Op)
+	if size == 0 || size > 4 || at(j+1).Op != vm.JUMPI {
+		return nil, false
+	}
+	return &selectorComparison{jumpi: j + 1, jumpsOnMatch: jumpsOnMatch}, true
+}
+
+// isPivot returns whether the block ending in the JUMPI at instrs[end] is one of the PUSH4 ... GT/LT pivots that solc
+// emits for binary-search dispatchers
+func isPivot(instrs []*Instruction, start int, end int) bool {
+	if end < 2 || instrs[end].Op != vm.JUMPI || !instrs[end-1].Op.IsPush() {
+		return false
+	}
+	if op := instrs[end-2].Op; op != vm.GT && op != vm.LT {
+		return false
+	}
+	for i := start; i < end; i++ {
+		if instrs[i].Op == vm.PUSH4 {
+			return true
+		}
+	}
+	return false
+}
+
+// maxPreambleBlocks limits how far the code before the first comparison is followed, which is enough for the
+// callvalue and calldatasize checks compilers emit
+const maxPreambleBlocks = 16
+
+// ExtractSelectors returns the function selectors that the dispatcher in the given runtime code compares the
+// calldata against, as sorted 0x-prefixed hex strings.
+//
+// The dispatcher is found by following the jumps from the start of the code, through the comparisons to the next
+// comparison, but never into the functions they dispatch to. This handles linear and binary-search solc dispatchers
+// as well as vyper's linear selector tables, and ignores constants which functions compare against, like ERC165
+// interface ids. Vyper's bucketed selector tables are reached through a jump table, so when the code before the
+// dispatcher jumps dynamically, every block which compares the selector is treated as part of the dispatcher.
+// Vyper's dense selector tables, which keep the selectors in a data section rather than in PUSH instructions, are
+// not supported.
+func ExtractSelectors(code []byte) []string {
+	instrs := Disassemble(code)
+
+	jumpdests := make(map[uint64]int)
+	for i, instr := range instrs {
+		if instr.Op == vm.JUMPDEST {
+			jumpdests[instr.PC] = i
+		}
+	}
+
+	// jumpTarget returns the index of the JUMPDEST that the jump at instrs[i] goes to, if it's pushed right before
+	jumpTarget := func(i int) (int, bool) {
+		if i == 0 || !instrs[i-1].Op.IsPush() || len(instrs[i-1].Arg) > 8 {
+			return 0, false
+		}
+		var pc uint64
+		for _, b := range instrs[i-1].Arg {
+			pc = pc<<8 | uint64(b)
+		}
+		target, ok := jumpdests[pc]
+		return target, ok
+	}
+
+	type block struct {
+		start int
+		// dispatcher is set once a comparison has been passed, before then the preamble is followed
+		dispatcher bool
+		depth      int
+	}
+
+	var (
+		selectors = make(map[[4]byte]bool)
+		visited   = make(map[int]bool)
+		queue     = []block{{start: 0}}
+		dynamic   bool
+	)
+
+	for len(queue) > 0 {
+		b := queue[0]
+		queue = queue[1:]
+		if b.start >= len(instrs) || visited[b.start] {
+			continue
+		}
+		visited[b.start] = true
+
+		end := b.start
+		for end < len(instrs)-1 && !endsBlock(instrs[end].Op) && instrs[end+1].Op != vm.JUMPDEST {
+			end++
+		}
+		last := instrs[end].Op
+
+		var comparison *selectorComparison
+		for i := b.start; i < end; i++ {
+			size := PushSize(instrs[i].Op)
+			if size == 0 || size > 4 {
+				continue
+			}
+
+			c, ok := matchSelectorComparison(instrs, i)
+			if !ok || c.jumpi != end {
+				continue
+			}
+
+			var selector [4]byte
+			copy(selector[4-size:], instrs[i].Arg)
+			// shorter pushes are only selectors with leading zeros, a zero is much more likely to be something else
+			if size < 4 && selector == [4]byte{} {
+				continue
+			}
+
+			selectors[selector] = true
+			comparison = c
+		}
+
+		next := block{dispatcher: true, depth: b.depth + 1}
+		switch {
+		case comparison != nil:
+			if comparison.jumpsOnMatch {
+				next.start = end + 1
+				queue = append(queue, next)
+			} else if target, ok := jumpTarget(end); ok {
+				next.start = target
+				queue = append(queue, next)
+			}
+
+		case isPivot(instrs, b.start, end):
+			next.start = end + 1
+			queue = append(queue, next)
+			if target, ok := jumpTarget(end); ok {
+				next.start = target
+				queue = append(queue, next)
+			}
+
+		case !b.dispatcher && b.depth < maxPreambleBlocks:
+			next.dispatcher = false
+			if last == vm.JUMP || last == vm.JUMPI {
+				if target, ok := jumpTarget(end); ok {
+					next.start = target
+					queue = append(queue, next)
+				} else if last == vm.JUMP {
+					dynamic = true
+				}
+			}
+			if last == vm.JUMPI || !endsBlock(last) {
+				next.start = end + 1
+				queue = append(queue, next)
+			}
+		}
+
+		if dynamic {
+			dynamic = false
+			for _, target := range jumpdests {
+				queue = append(queue, block{start: target, dispatcher: true})
+			}
+		}
+	}
+
+	var result []string
+	for sel := range selectors {
+		result = append(result, "0x"+hex.EncodeToString(sel[:]))
+	}
+	sort.Strings(result)
+	return result
+}
@@ -0,0 +1,180 @@
+package evm
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// asm concatenates hex-encoded fragments, ignoring whitespace, so that test bytecode can be written one
+// instruction per fragment. A word ending in a colon labels the next byte, and "@label" is replaced by its two byte
+// offset, so that jumps can be written as "61 @label 57".
+func asm(t *testing.T, parts ...string) []byte {
+	words := strings.Fields(strings.Join(parts, " "))
+
+	labels := make(map[string]int)
+	offset := 0
+	for _, word := range words {
+		switch {
+		case strings.HasSuffix(word, ":"):
+			labels[strings.TrimSuffix(word, ":")] = offset
+		case strings.HasPrefix(word, "@"):
+			offset += 2
+		default:
+			offset += len(word) / 2
+		}
+	}
+
+	var code []byte
+	for _, word := range words {
+		switch {
+		case strings.HasSuffix(word, ":"):
+		case strings.HasPrefix(word, "@"):
+			target, ok := labels[word[1:]]
+			if !ok {
+				t.Fatalf("unknown label %s", word)
+			}
+			code = append(code, byte(target>>8), byte(target))
+		default:
+			b, err := hex.DecodeString(word)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code = append(code, b...)
+		}
+	}
+	return code
+}
+
+const (
+	selectorLoad = "6000 35 60e0 1c"           // PUSH1 0 CALLDATALOAD PUSH1 0xe0 SHR
+	revert       = "5b 6000 80 fd"             // JUMPDEST PUSH1 0 DUP1 REVERT
+	body         = "6001 6000 52 6020 6000 f3" // PUSH1 1 PUSH1 0 MSTORE PUSH1 32 PUSH1 0 RETURN
+)
+
+func TestDisassemble(t *testing.T) {
+	instrs := Disassemble(asm(t, "6080 6040 52 63aabbcc"))
+
+	assert.Len(t, instrs, 4)
+	assert.Equal(t, "0000: PUSH1 0x80", instrs[0].String())
+	assert.Equal(t, "0004: MSTORE", instrs[2].String())
+	// truncated push arguments are zero padded
+	assert.Equal(t, []byte{0xaa, 0xbb, 0xcc, 0x00}, instrs[3].Arg)
+}
+
+func TestExtractSelectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		code     []byte
+		expected []string
+	}{
+		{
+			name: "solc linear dispatcher",
+			code: asm(t, selectorLoad,
+				"80 63a9059cbb 14 610100 57",
+				"80 63095ea7b3 14 610110 57",
+				revert,
+			),
+			expected: []string{"0x095ea7b3", "0xa9059cbb"},
+		},
+		{
+			name: "solc binary search dispatcher",
+			code: asm(t, selectorLoad,
+				"80 6370a08231 11 61 @high 57",
+				"80 63095ea7b3 14 610100 57",
+				"80 6318160ddd 14 610110 57",
+				"80 6370a08231 14 610120 57",
+				"61 @fallback 56",
+				"high: 5b 80 63a9059cbb 14 610130 57",
+				"80 63dd62ed3e 14 610140 57",
+				"fallback:", revert,
+			),
+			expected: []string{"0x095ea7b3", "0x18160ddd", "0x70a08231", "0xa9059cbb", "0xdd62ed3e"},
+		},
+		{
+			name: "solc optimized dispatcher with leading zero selector",
+			code: asm(t, selectorLoad,
+				"62fdd58e 81 14 610100 57",
+				"63a22cb465 81 14 610110 57",
+				revert,
+			),
+			expected: []string{"0x00fdd58e", "0xa22cb465"},
+		},
+		{
+			name: "solc dispatcher after callvalue and calldatasize checks",
+			code: asm(t,
+				"6080 6040 52 34 80 15 61 @payable 57 6000 80 fd",
+				"payable: 5b 50 6004 36 10 61 @fallback 57",
+				selectorLoad,
+				"80 63a9059cbb 14 610100 57",
+				"fallback:", revert,
+			),
+			expected: []string{"0xa9059cbb"},
+		},
+		{
+			name: "vyper 0.3 dispatcher",
+			code: asm(t, selectorLoad,
+				"63a9059cbb 81 18 61 @next 57", body,
+				"next: 5b 6318160ddd 81 18 61 @fallback 57", body,
+				"fallback:", revert,
+			),
+			expected: []string{"0x18160ddd", "0xa9059cbb"},
+		},
+		{
+			name: "vyper 0.2 dispatcher",
+			code: asm(t,
+				"63a9059cbb 6000 51 14 15 61 @next 57", body,
+				"next: 5b 6318160ddd 6000 51 14 15 61 @fallback 57", body,
+				"fallback:", revert,
+			),
+			expected: []string{"0x18160ddd", "0xa9059cbb"},
+		},
+		{
+			name: "vyper bucketed dispatcher",
+			code: asm(t, selectorLoad,
+				// the bucket's jump destination is loaded from a table
+				"6002 81 06 6001 1b 6000 51 56",
+				"bucket0: 5b 63a9059cbb 81 18 61 @fallback 57", body,
+				"bucket1: 5b 6318160ddd 81 18 61 @fallback 57", body,
+				"fallback:", revert,
+			),
+			expected: []string{"0x18160ddd", "0xa9059cbb"},
+		},
+		{
+			name: "constants outside of the dispatcher are ignored",
+			code: asm(t, selectorLoad,
+				"80 63a9059cbb 14 610100 57",
+				revert,
+				// a small constant compared after the dispatcher
+				"5b 6002 81 14 610200 57",
+				// a four-byte constant which is not compared
+				"63deadbeef 01",
+			),
+			expected: []string{"0xa9059cbb"},
+		},
+		{
+			name: "interface ids compared by supportsInterface are ignored",
+			code: asm(t, selectorLoad,
+				"80 6301ffc9a7 14 61 @supportsInterface 57",
+				"80 6370a08231 14 610100 57",
+				revert,
+				// supportsInterface(bytes4 id) { return id == 0x80ac58cd || id == 0x5b5e139f || id == 0x01ffc9a7; }
+				"supportsInterface: 5b 6004 35 60e0 1c",
+				"80 6380ac58cd 14 61 @yes 57",
+				"80 635b5e139f 14 61 @yes 57",
+				"80 6301ffc9a7 14 61 @yes 57",
+				"6000 6000 52 6020 6000 f3",
+				"yes:", "5b", body,
+			),
+			expected: []string{"0x01ffc9a7", "0x70a08231"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, ExtractSelectors(test.code))
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Package notify delivers service events to chat channels, webhooks and files.
+package notify
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+type EventKind string
+
+const (
+	EventNewSignatures    EventKind = "new_signatures"
+	EventNewCollisions    EventKind = "new_collisions"
+	EventCanonicalChanged EventKind = "canonical_changed"
+)
+
+func EventKinds() []EventKind {
+	return []EventKind{EventNewSignatures, EventNewCollisions, EventCanonicalChanged}
+}
+
+// ParseEventKind returns the event kind with the given name, or an error if there is none
+func ParseEventKind(name string) (EventKind, error) {
+	for _, kind := range EventKinds() {
+		if string(kind) == name {
+			return kind, nil
+		}
+	}
+	return "", fmt.Errorf("unknown event kind: %s", name)
+}
+
+type Event struct {
+	Kind  EventKind `json:"kind"`
+	Time  time.Time `json:"time"`
+	Title string    `json:"title"`
+	// Lines is the human readable body of the event, one item per line
+	Lines []string `json:"lines"`
+	// Data is the machine readable body of the event, only delivered by sinks which send JSON
+	Data any `json:"data,omitempty"`
+}
+
+func NewEvent(kind EventKind, title string, lines []string, data any) *Event {
+	return &Event{
+		Kind:  kind,
+		Time:  time.Now().UTC(),
+		Title: title,
+		Lines: lines,
+		Data:  data,
+	}
+}
+
+// Text renders the event as plain text, truncated to at most limit bytes if limit is positive. Text is only cut
+// between runes, so the result is always valid UTF-8.
+func (e *Event) Text(limit int) string {
+	text := e.Title
+	if len(e.Lines) > 0 {
+		text += "\n" + strings.Join(e.Lines, "\n")
+	}
+
+	const ellipsis = "\n…"
+	if limit > len(ellipsis) && len(text) > limit {
+		end := limit - len(ellipsis)
+		for end > 0 && !utf8.RuneStart(text[end]) {
+			end--
+		}
+		text = text[:end] + ellipsis
+	}
+	return text
+}
+
+type Notifier interface {
+	Notify(ctx context.Context, event *Event) error
+}
+
+// Multi delivers each event to every notifier, continuing past failures
+type Multi []Notifier
+
+func (m Multi) Notify(ctx context.Context, event *Event) error {
+	var errs []string
+	for _, n := range m {
+		if err := n.Notify(ctx, event); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to notify: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+type filtered struct {
+	kinds    map[EventKind]bool
+	notifier Notifier
+}
+
+// WithKinds only delivers events of the given kinds to the notifier
+func WithKinds(notifier Notifier, kinds ...EventKind) Notifier {
+	f := &filtered{
+		kinds:    make(map[EventKind]bool),
+		notifier: notifier,
+	}
+	for _, kind := range kinds {
+		f.kinds[kind] = true
+	}
+	return f
+}
+
+func (f *filtered) Notify(ctx context.Context, event *Event) error {
+	if !f.kinds[event.Kind] {
+		return nil
+	}
+	return f.notifier.Notify(ctx, event)
+}
@@ -0,0 +1,115 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedRequest struct {
+	header http.Header
+	body   []byte
+}
+
+// newStandIn starts a local HTTP server which records every request and responds with the given status
+func newStandIn(t *testing.T, status int) (*httptest.Server, *[]*recordedRequest) {
+	var requests []*recordedRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		requests = append(requests, &recordedRequest{header: r.Header, body: body})
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func testEvent() *Event {
+	return NewEvent(EventNewCollisions, "Imported the following duplicate signatures:", []string{"`0xa9059cbb`: `a`, `b`"}, map[string]any{"function": map[string][]string{"0xa9059cbb": {"a", "b"}}})
+}
+
+func TestSlack(t *testing.T) {
+	server, requests := newStandIn(t, http.StatusOK)
+
+	require.NoError(t, NewSlack(server.URL).Notify(context.Background(), testEvent()))
+	require.Len(t, *requests, 1)
+
+	var body map[string]string
+	require.NoError(t, json.Unmarshal((*requests)[0].body, &body))
+	assert.Equal(t, "Imported the following duplicate signatures:\n`0xa9059cbb`: `a`, `b`", body["text"])
+}
+
+func TestWebhookSignature(t *testing.T) {
+	server, requests := newStandIn(t, http.StatusNoContent)
+
+	require.NoError(t, NewWebhook(server.URL, "secret").Notify(context.Background(), testEvent()))
+	require.Len(t, *requests, 1)
+
+	req := (*requests)[0]
+	assert.Equal(t, string(EventNewCollisions), req.header.Get(WebhookEventHeader))
+	assert.Equal(t, Sign([]byte("secret"), req.body), req.header.Get(WebhookSignatureHeader))
+	assert.NotEqual(t, Sign([]byte("other"), req.body), req.header.Get(WebhookSignatureHeader))
+
+	var event Event
+	require.NoError(t, json.Unmarshal(req.body, &event))
+	assert.Equal(t, EventNewCollisions, event.Kind)
+}
+
+func TestWebhookUnsigned(t *testing.T) {
+	server, requests := newStandIn(t, http.StatusOK)
+
+	require.NoError(t, NewWebhook(server.URL, "").Notify(context.Background(), testEvent()))
+	require.Len(t, *requests, 1)
+	assert.Empty(t, (*requests)[0].header.Get(WebhookSignatureHeader))
+}
+
+func TestWebhookFailure(t *testing.T) {
+	server, _ := newStandIn(t, http.StatusInternalServerError)
+
+	assert.Error(t, NewWebhook(server.URL, "secret").Notify(context.Background(), testEvent()))
+}
+
+func TestRouting(t *testing.T) {
+	var collisions, everything bytes.Buffer
+
+	notifier := Multi{
+		WithKinds(NewWriter(&collisions), EventNewCollisions),
+		NewWriter(&everything),
+	}
+
+	require.NoError(t, notifier.Notify(context.Background(), testEvent()))
+	require.NoError(t, notifier.Notify(context.Background(), NewEvent(EventNewSignatures, "Imported 1 new signature", nil, nil)))
+
+	assert.Equal(t, 1, bytes.Count(collisions.Bytes(), []byte("\n")))
+	assert.Equal(t, 2, bytes.Count(everything.Bytes(), []byte("\n")))
+}
+
+func TestText(t *testing.T) {
+	event := NewEvent(EventNewSignatures, "title", []string{"aaaaaaaaaa", "bbbbbbbbbb"}, nil)
+
+	assert.Equal(t, "title\naaaaaaaaaa\nbbbbbbbbbb", event.Text(0))
+	assert.Equal(t, "title\naaaa\n…", event.Text(14))
+
+	// multi-byte runes aren't split
+	event = NewEvent(EventNewSignatures, "title", []string{"ééééé"}, nil)
+	assert.Equal(t, "title\néé\n…", event.Text(15))
+	assert.Equal(t, "title\néé\n…", event.Text(14))
+}
+
+func TestParseEventKind(t *testing.T) {
+	for _, kind := range EventKinds() {
+		parsed, err := ParseEventKind(string(kind))
+		require.NoError(t, err)
+		assert.Equal(t, kind, parsed)
+	}
+
+	_, err := ParseEventKind("new_collision")
+	assert.Error(t, err)
+}
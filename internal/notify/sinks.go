@@ -0,0 +1,169 @@
+package notify
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/bwmarrin/discordgo"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/discord"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	discordMessageLimit = 2000
+	slackMessageLimit   = 4000
+)
+
+type Discord struct {
+	client  *discord.Client
+	channel string
+}
+
+func NewDiscord(client *discord.Client, channel string) *Discord {
+	return &Discord{
+		client:  client,
+		channel: channel,
+	}
+}
+
+func (d *Discord) Notify(ctx context.Context, event *Event) error {
+	_, err := d.client.Session.ChannelMessageSendComplex(d.channel, &discordgo.MessageSend{
+		Content: event.Text(discordMessageLimit),
+	}, discordgo.WithContext(ctx))
+	return err
+}
+
+func postJSON(ctx context.Context, client *http.Client, url string, body []byte, headers map[string]string) error {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to construct request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to do request: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("expected http 2xx but got %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Slack posts to a Slack-compatible incoming webhook, which Mattermost and Rocket.Chat also accept
+type Slack struct {
+	url    string
+	client *http.Client
+}
+
+func NewSlack(url string) *Slack {
+	return &Slack{
+		url:    url,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+func (s *Slack) Notify(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(map[string]string{
+		"text": event.Text(slackMessageLimit),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal body: %w", err)
+	}
+
+	return postJSON(ctx, s.client, s.url, body, nil)
+}
+
+const (
+	WebhookEventHeader     = "X-Openchain-Event"
+	WebhookSignatureHeader = "X-Openchain-Signature"
+)
+
+// Webhook posts the event as JSON. If a secret is configured, the body is signed with HMAC-SHA256 and the
+// signature is sent as "sha256=<hex>" in the X-Openchain-Signature header.
+type Webhook struct {
+	url    string
+	secret []byte
+	client *http.Client
+}
+
+func NewWebhook(url string, secret string) *Webhook {
+	return &Webhook{
+		url:    url,
+		secret: []byte(secret),
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Sign computes the value of the signature header for the given body
+func Sign(secret []byte, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (w *Webhook) Notify(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal body: %w", err)
+	}
+
+	headers := map[string]string{
+		WebhookEventHeader: string(event.Kind),
+	}
+	if len(w.secret) > 0 {
+		headers[WebhookSignatureHeader] = Sign(w.secret, body)
+	}
+
+	return postJSON(ctx, w.client, w.url, body, headers)
+}
+
+// Writer writes each event as a line of JSON
+type Writer struct {
+	lock sync.Mutex
+	w    io.Writer
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: w}
+}
+
+// NewFile appends events to the file at the given path, or writes them to stdout if the path is "-"
+func NewFile(path string) (*Writer, error) {
+	if path == "-" {
+		return NewWriter(os.Stdout), nil
+	}
+
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, os.FileMode(0644))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", path, err)
+	}
+	return NewWriter(f), nil
+}
+
+func (w *Writer) Notify(ctx context.Context, event *Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	_, err = w.w.Write(append(body, '\n'))
+	return err
+}
@@ -0,0 +1,103 @@
+// Package ratelimit implements token bucket rate limiting keyed by an arbitrary string, like a remote ip.
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter keeps an independent token bucket for every key. Each bucket holds up to burst tokens and refills at
+// rate tokens per second.
+type Limiter struct {
+	rate  float64
+	burst float64
+
+	lock    sync.Mutex
+	buckets map[string]*bucket
+
+	now func() time.Time
+}
+
+// New creates a limiter, a rate of zero or less disables limiting entirely
+func New(rate float64, burst int) *Limiter {
+	return &Limiter{
+		rate:    rate,
+		burst:   math.Max(float64(burst), 1),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+// refill brings the bucket up to date, must be called with the lock held
+func (l *Limiter) refill(b *bucket, now time.Time) {
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+}
+
+// Allow takes a token from the bucket for key, returning false if the bucket is empty
+func (l *Limiter) Allow(key string) bool {
+	if l.rate <= 0 {
+		return true
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	l.refill(b, now)
+	if b.tokens < 1 {
+		return false
+	}
+
+	b.tokens--
+	return true
+}
+
+// RetryAfter returns how long until the bucket for key has a token available
+func (l *Limiter) RetryAfter(key string) time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	b, ok := l.buckets[key]
+	if !ok {
+		return 0
+	}
+
+	l.refill(b, l.now())
+	if b.tokens >= 1 {
+		return 0
+	}
+
+	return time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// Cleanup forgets every bucket which has refilled completely, as it is indistinguishable from a new one
+func (l *Limiter) Cleanup() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	now := l.now()
+	for key, b := range l.buckets {
+		l.refill(b, now)
+		if b.tokens >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestLimiter(rate float64, burst int) (*Limiter, *time.Time) {
+	now := time.Unix(0, 0)
+	l := New(rate, burst)
+	l.now = func() time.Time {
+		return now
+	}
+	return l, &now
+}
+
+func TestLimiter_Burst(t *testing.T) {
+	l, _ := newTestLimiter(1, 3)
+
+	for i := 0; i < 3; i++ {
+		assert.True(t, l.Allow("a"))
+	}
+	assert.False(t, l.Allow("a"))
+
+	// buckets are independent
+	assert.True(t, l.Allow("b"))
+}
+
+func TestLimiter_Refill(t *testing.T) {
+	l, now := newTestLimiter(2, 2)
+
+	assert.True(t, l.Allow("a"))
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+	assert.Equal(t, 500*time.Millisecond, l.RetryAfter("a"))
+
+	*now = now.Add(500 * time.Millisecond)
+	assert.Equal(t, time.Duration(0), l.RetryAfter("a"))
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+
+	// the bucket never holds more than the burst
+	*now = now.Add(time.Hour)
+	assert.True(t, l.Allow("a"))
+	assert.True(t, l.Allow("a"))
+	assert.False(t, l.Allow("a"))
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	l, _ := newTestLimiter(0, 1)
+
+	for i := 0; i < 100; i++ {
+		assert.True(t, l.Allow("a"))
+	}
+}
+
+func TestLimiter_Cleanup(t *testing.T) {
+	l, now := newTestLimiter(1, 2)
+
+	l.Allow("a")
+	l.Allow("b")
+	l.Allow("b")
+
+	*now = now.Add(time.Second)
+	l.Cleanup()
+
+	assert.NotContains(t, l.buckets, "a")
+	assert.Contains(t, l.buckets, "b")
+}
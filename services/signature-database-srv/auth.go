@@ -0,0 +1,316 @@
+package signature_database_srv
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/core"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	log "github.com/sirupsen/logrus"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiKeyCacheTTL is how long a valid key is remembered before it is looked up again. Revoked keys keep working for
+// at most this long.
+const apiKeyCacheTTL = time.Minute
+
+var (
+	errInvalidAPIKey     = errors.New("invalid api key")
+	errKeyLookupsLimited = errors.New("too many api key lookups")
+)
+
+// bootstrapAPIKey is the key which the configured admin token authenticates as, it is never stored
+var bootstrapAPIKey = &client.APIKey{
+	Name:   "bootstrap",
+	Scopes: []client.APIKeyScope{client.APIKeyScopeAdmin},
+}
+
+type apiKeyCacheEntry struct {
+	key     *client.APIKey
+	expires time.Time
+}
+
+func hashAPIKey(secret string) []byte {
+	hash := sha256.Sum256([]byte(secret))
+	return hash[:]
+}
+
+func generateAPIKey() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "oc_" + hex.EncodeToString(b), nil
+}
+
+// requestAPIKey returns the secret sent with the request, either as a bearer token or in the X-API-Key header
+func requestAPIKey(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		return strings.TrimPrefix(auth, "Bearer ")
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// authenticate returns the api key the request was made with, or nil if it was made without one. Keys which aren't
+// cached cost a database lookup, so those lookups are limited per ip, and invalid keys are never cached since the
+// caller chooses them.
+func (s *Service) authenticate(r *http.Request, ip string) (*client.APIKey, error) {
+	secret := requestAPIKey(r)
+	if secret == "" {
+		return nil, nil
+	}
+
+	if s.config.AdminToken != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(s.config.AdminToken)) == 1 {
+		return bootstrapAPIKey, nil
+	}
+
+	hash := hashAPIKey(secret)
+	cacheKey := hex.EncodeToString(hash)
+
+	s.apiKeysLock.Lock()
+	entry, ok := s.apiKeys[cacheKey]
+	s.apiKeysLock.Unlock()
+
+	if ok && time.Now().Before(entry.expires) {
+		return entry.key, nil
+	}
+
+	if !s.keyLookupLimiter.Allow(ip) {
+		return nil, errKeyLookupsLimited
+	}
+
+	key, err := s.db.LoadAPIKey(hash)
+	if err != nil {
+		return nil, err
+	}
+	if key == nil {
+		return nil, errInvalidAPIKey
+	}
+
+	s.apiKeysLock.Lock()
+	s.apiKeys[cacheKey] = &apiKeyCacheEntry{key: key, expires: time.Now().Add(apiKeyCacheTTL)}
+	s.apiKeysLock.Unlock()
+
+	return key, nil
+}
+
+func (s *Service) recordAPIKeyUsage(key *client.APIKey, rateLimited bool) {
+	if key == bootstrapAPIKey {
+		return
+	}
+
+	s.apiKeyUsageLock.Lock()
+	defer s.apiKeyUsageLock.Unlock()
+
+	usage, ok := s.apiKeyUsage[key.ID]
+	if !ok {
+		usage = &database.APIKeyUsage{}
+		s.apiKeyUsage[key.ID] = usage
+	}
+
+	usage.Requests++
+	if rateLimited {
+		usage.RateLimited++
+	}
+	usage.LastUsedAt = time.Now()
+}
+
+func (s *Service) flushAPIKeyUsage() error {
+	s.apiKeyUsageLock.Lock()
+	usage := s.apiKeyUsage
+	s.apiKeyUsage = make(map[int]*database.APIKeyUsage)
+	s.apiKeyUsageLock.Unlock()
+
+	if len(usage) == 0 {
+		return nil
+	}
+
+	return s.db.RecordAPIKeyUsage(usage)
+}
+
+func (s *Service) runAuthTasks() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		if err := s.flushAPIKeyUsage(); err != nil {
+			log.WithError(err).Errorf("failed to record api key usage")
+		}
+
+		s.ipLimiter.Cleanup()
+		s.keyLimiter.Cleanup()
+		s.keyLookupLimiter.Cleanup()
+
+		s.apiKeysLock.Lock()
+		for cacheKey, entry := range s.apiKeys {
+			if time.Now().After(entry.expires) {
+				delete(s.apiKeys, cacheKey)
+			}
+		}
+		s.apiKeysLock.Unlock()
+	}
+}
+
+func rateLimited(w http.ResponseWriter, retryAfter time.Duration) {
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	fail(w, http.StatusTooManyRequests, nil, "rate limited")
+}
+
+// remoteIP returns the ip of the client, trusting the forwarding headers of the configured proxies only
+func (s *Service) remoteIP(r *http.Request) string {
+	return core.GetTrustedRemoteIP(r, s.trustedProxies)
+}
+
+// guard authenticates and rate limits requests before passing them to next. Requests made with a key must have
+// the given scope and are limited per key, requests made without one are limited per ip and are only allowed if
+// required is false.
+func (s *Service) guard(scope client.APIKeyScope, required bool, next http.HandlerFunc) http.HandlerFunc {
+	return s.guardWith(scope, required, true, next)
+}
+
+// guardLookup guards a lookup, which anyone may make. Lookups made without a key are only limited per ip if
+// configured, since many honest clients can share an ip.
+func (s *Service) guardLookup(next http.HandlerFunc) http.HandlerFunc {
+	return s.guardWith(client.APIKeyScopeRead, false, s.config.RateLimitLookups, next)
+}
+
+func (s *Service) guardWith(scope client.APIKeyScope, required bool, limitIP bool, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ip := s.remoteIP(r)
+
+		key, err := s.authenticate(r, ip)
+		if errors.Is(err, errInvalidAPIKey) {
+			fail(w, http.StatusUnauthorized, nil, "invalid api key")
+			return
+		} else if errors.Is(err, errKeyLookupsLimited) {
+			rateLimited(w, s.keyLookupLimiter.RetryAfter(ip))
+			return
+		} else if err != nil {
+			fail(w, http.StatusInternalServerError, err, "failed to authenticate")
+			return
+		}
+
+		if key == nil {
+			if required {
+				fail(w, http.StatusUnauthorized, nil, "api key required")
+				return
+			}
+
+			if limitIP && !s.ipLimiter.Allow(ip) {
+				rateLimited(w, s.ipLimiter.RetryAfter(ip))
+				return
+			}
+
+			next(w, r)
+			return
+		}
+
+		if !key.HasScope(scope) {
+			fail(w, http.StatusForbidden, nil, fmt.Sprintf("api key lacks the %s scope", scope))
+			return
+		}
+
+		limiterKey := strconv.Itoa(key.ID)
+		if key != bootstrapAPIKey && !s.keyLimiter.Allow(limiterKey) {
+			s.recordAPIKeyUsage(key, true)
+			rateLimited(w, s.keyLimiter.RetryAfter(limiterKey))
+			return
+		}
+
+		s.recordAPIKeyUsage(key, false)
+		next(w, r)
+	}
+}
+
+func (s *Service) serveListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := s.db.ListAPIKeys()
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err, "failed to list api keys")
+		return
+	}
+
+	succeed(w, keys)
+}
+
+func (s *Service) serveCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req client.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, err, "failed to decode body")
+		return
+	}
+
+	if req.Name == "" {
+		fail(w, http.StatusBadRequest, nil, "missing name")
+		return
+	}
+
+	if len(req.Scopes) == 0 {
+		fail(w, http.StatusBadRequest, nil, "missing scopes")
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !scope.Valid() {
+			fail(w, http.StatusBadRequest, nil, fmt.Sprintf("invalid scope: %s", scope))
+			return
+		}
+	}
+
+	secret, err := generateAPIKey()
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err, "failed to generate api key")
+		return
+	}
+
+	key, err := s.db.CreateAPIKey(req.Name, hashAPIKey(secret), req.Scopes)
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err, "failed to create api key")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"ip":     s.remoteIP(r),
+		"id":     key.ID,
+		"name":   key.Name,
+		"scopes": key.Scopes,
+	}).Infof("created api key")
+
+	succeed(w, &client.CreateAPIKeyResponse{
+		Key:    secret,
+		APIKey: key,
+	})
+}
+
+func (s *Service) serveDeleteAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		fail(w, http.StatusBadRequest, err, "invalid id")
+		return
+	}
+
+	deleted, err := s.db.DeleteAPIKey(id)
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err, "failed to delete api key")
+		return
+	}
+
+	if !deleted {
+		fail(w, http.StatusNotFound, nil, "no such api key")
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"ip": s.remoteIP(r),
+		"id": id,
+	}).Infof("deleted api key")
+
+	succeed(w, nil)
+}
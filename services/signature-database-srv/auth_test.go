@@ -0,0 +1,67 @@
+package signature_database_srv
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/ratelimit"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuardInvalidKeys(t *testing.T) {
+	db, err := database.NewBolt(filepath.Join(t.TempDir(), "signatures.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	s := &Service{
+		config:           &Config{},
+		db:               db,
+		apiKeys:          make(map[string]*apiKeyCacheEntry),
+		apiKeyUsage:      make(map[int]*database.APIKeyUsage),
+		ipLimiter:        ratelimit.New(0, 0),
+		keyLimiter:       ratelimit.New(0, 0),
+		keyLookupLimiter: ratelimit.New(1, 3),
+	}
+
+	secret, err := generateAPIKey()
+	require.NoError(t, err)
+	_, err = db.CreateAPIKey("test", hashAPIKey(secret), []client.APIKeyScope{client.APIKeyScopeRead})
+	require.NoError(t, err)
+
+	handler := s.guard(client.APIKeyScopeRead, true, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	request := func(key string, remoteAddr string) int {
+		r := httptest.NewRequest("GET", "/v1/lookup", nil)
+		r.RemoteAddr = remoteAddr
+		r.Header.Set("X-API-Key", key)
+
+		w := httptest.NewRecorder()
+		handler(w, r)
+		return w.Code
+	}
+
+	// the valid key is cached, so using it again doesn't cost a lookup
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, http.StatusOK, request(secret, "10.0.0.1:1234"))
+	}
+
+	// invalid keys aren't cached, and each one counts against the ip until it's limited
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusUnauthorized, request(fmt.Sprintf("oc_guess%d", i), "10.0.0.1:1234"))
+	}
+	assert.Equal(t, http.StatusTooManyRequests, request("oc_guess2", "10.0.0.1:1234"))
+	assert.Len(t, s.apiKeys, 1)
+
+	// other ips aren't affected
+	assert.Equal(t, http.StatusUnauthorized, request("oc_guess3", "10.0.0.2:1234"))
+
+	// and neither are keys which are already cached
+	assert.Equal(t, http.StatusOK, request(secret, "10.0.0.1:1234"))
+}
@@ -0,0 +1,190 @@
+package signature_database_srv
+
+import (
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/cache"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// cachedStorage keeps the results of LoadSignatures in memory, including hashes which have no signatures at all.
+// Every write which goes through it invalidates the hashes it touches, but writes made by other instances of the
+// service are only picked up once the entries expire.
+type cachedStorage struct {
+	database.Storage
+
+	cache       *cache.LRU[string, []*client.SignatureData]
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	// generation is bumped on every invalidation, so that a load which raced with a write doesn't cache stale data
+	generation   atomic.Uint64
+	negativeHits atomic.Uint64
+}
+
+func newCachedStorage(storage database.Storage, size int, ttl time.Duration, negativeTTL time.Duration) *cachedStorage {
+	return &cachedStorage{
+		Storage:     storage,
+		cache:       cache.New[string, []*client.SignatureData](size),
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+	}
+}
+
+// cacheKey identifies a hash in the cache, errors are stored alongside functions so they share entries
+func cacheKey(typ client.SignatureType, hash string) string {
+	if typ == client.SignatureTypeError {
+		typ = client.SignatureTypeFunction
+	}
+	return string(typ) + ":" + hash
+}
+
+// copySignatures copies the signatures so that callers are free to modify what they're given, which the
+// response filtering does
+func copySignatures(sigs []*client.SignatureData) []*client.SignatureData {
+	result := make([]*client.SignatureData, 0, len(sigs))
+	for _, sig := range sigs {
+		copied := *sig
+		result = append(result, &copied)
+	}
+	return result
+}
+
+func (c *cachedStorage) LoadSignatures(typ client.SignatureType, sels []string) (map[string][]*client.SignatureData, error) {
+	result := make(map[string][]*client.SignatureData)
+
+	var misses []string
+	for _, sel := range sels {
+		// the database only matches lowercase hashes, anything else is passed through untouched
+		if sel == strings.ToLower(sel) {
+			if sigs, ok := c.cache.Get(cacheKey(typ, sel)); ok {
+				if len(sigs) == 0 {
+					c.negativeHits.Add(1)
+				}
+				result[sel] = copySignatures(sigs)
+				continue
+			}
+		}
+		misses = append(misses, sel)
+	}
+
+	if len(misses) == 0 {
+		return result, nil
+	}
+
+	generation := c.generation.Load()
+
+	loaded, err := c.Storage.LoadSignatures(typ, misses)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.generation.Load() == generation {
+		for _, sel := range misses {
+			if sel != strings.ToLower(sel) {
+				continue
+			}
+
+			sigs := loaded[sel]
+			ttl := c.ttl
+			if len(sigs) == 0 {
+				ttl = c.negativeTTL
+			}
+			c.cache.Set(cacheKey(typ, sel), copySignatures(sigs), ttl)
+		}
+	}
+
+	for k, v := range loaded {
+		result[k] = v
+	}
+
+	return result, nil
+}
+
+func (c *cachedStorage) invalidate(typ client.SignatureType, hashes []string) {
+	c.generation.Add(1)
+	for _, hash := range hashes {
+		c.cache.Delete(cacheKey(typ, hash))
+	}
+}
+
+// invalidateNames invalidates the hashes of the given signatures
+func (c *cachedStorage) invalidateNames(typ client.SignatureType, names []string) {
+	var hashes []string
+	for _, name := range names {
+		hashes = append(hashes, hexutil.Encode(crypto.Keccak256([]byte(name))[:signatureLens[typ]]))
+	}
+	c.invalidate(typ, hashes)
+}
+
+func (c *cachedStorage) SaveSignatures(typ client.SignatureType, names []string) (*client.ImportResponseDetails, error) {
+	return c.SaveSignaturesWithSource(typ, names, "")
+}
+
+func (c *cachedStorage) SaveSignaturesWithSource(typ client.SignatureType, names []string, source string) (*client.ImportResponseDetails, error) {
+	resp, err := c.Storage.SaveSignaturesWithSource(typ, names, source)
+	if err != nil {
+		// some of the signatures may have been saved before the error
+		c.invalidateNames(typ, names)
+		return nil, err
+	}
+
+	var hashes []string
+	for _, hash := range resp.Imported {
+		hashes = append(hashes, hash)
+	}
+	c.invalidate(typ, hashes)
+
+	return resp, nil
+}
+
+func (c *cachedStorage) BulkImportSignatures(typ client.SignatureType, names []string, hashes [][]byte) (int64, error) {
+	imported, err := c.Storage.BulkImportSignatures(typ, names, hashes)
+
+	var encoded []string
+	for _, hash := range hashes {
+		encoded = append(encoded, hexutil.Encode(hash))
+	}
+	c.invalidate(typ, encoded)
+
+	return imported, err
+}
+
+func (c *cachedStorage) DeleteSignatures(typ client.SignatureType, names []string) ([]string, error) {
+	deleted, err := c.Storage.DeleteSignatures(typ, names)
+	if err != nil {
+		c.invalidateNames(typ, names)
+		return nil, err
+	}
+
+	c.invalidateNames(typ, deleted)
+	return deleted, nil
+}
+
+func (c *cachedStorage) SetQuarantined(typ client.SignatureType, names []string, quarantined bool, reason string) ([]string, error) {
+	affected, err := c.Storage.SetQuarantined(typ, names, quarantined, reason)
+	if err != nil {
+		c.invalidateNames(typ, names)
+		return nil, err
+	}
+
+	c.invalidateNames(typ, affected)
+	return affected, nil
+}
+
+func (c *cachedStorage) Stats() *client.CacheStats {
+	stats := c.cache.Stats()
+	return &client.CacheStats{
+		Entries:      stats.Entries,
+		Capacity:     stats.Capacity,
+		Hits:         stats.Hits,
+		NegativeHits: c.negativeHits.Load(),
+		Misses:       stats.Misses,
+		Evictions:    stats.Evictions,
+		HitRate:      stats.HitRate(),
+	}
+}
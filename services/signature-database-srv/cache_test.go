@@ -0,0 +1,69 @@
+package signature_database_srv
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCachedStorage(t *testing.T) {
+	db, err := database.NewBolt(filepath.Join(t.TempDir(), "signatures.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	c := newCachedStorage(db, 100, time.Hour, time.Hour)
+
+	name := "cachedStorageTest(uint256)"
+	hash := hexutil.Encode(crypto.Keccak256([]byte(name))[:4])
+
+	// an unknown hash is cached as well
+	result, err := c.LoadSignatures(client.SignatureTypeFunction, []string{hash})
+	require.NoError(t, err)
+	assert.Empty(t, result[hash])
+
+	result, err = c.LoadSignatures(client.SignatureTypeFunction, []string{hash})
+	require.NoError(t, err)
+	assert.Empty(t, result[hash])
+	assert.Equal(t, uint64(1), c.Stats().NegativeHits)
+
+	// importing invalidates the negative entry, for errors too since they share the hash space
+	_, err = c.SaveSignatures(client.SignatureTypeFunction, []string{name})
+	require.NoError(t, err)
+
+	result, err = c.LoadSignatures(client.SignatureTypeError, []string{hash})
+	require.NoError(t, err)
+	require.Len(t, result[hash], 1)
+
+	// callers get their own copies
+	result[hash][0].Filtered = true
+	result, err = c.LoadSignatures(client.SignatureTypeFunction, []string{hash})
+	require.NoError(t, err)
+	require.Len(t, result[hash], 1)
+	assert.False(t, result[hash][0].Filtered)
+
+	_, err = c.SetQuarantined(client.SignatureTypeFunction, []string{name}, true, "spam")
+	require.NoError(t, err)
+
+	result, err = c.LoadSignatures(client.SignatureTypeFunction, []string{hash})
+	require.NoError(t, err)
+	require.Len(t, result[hash], 1)
+	assert.True(t, result[hash][0].Quarantined)
+
+	_, err = c.DeleteSignatures(client.SignatureTypeFunction, []string{name})
+	require.NoError(t, err)
+
+	result, err = c.LoadSignatures(client.SignatureTypeFunction, []string{hash})
+	require.NoError(t, err)
+	assert.Empty(t, result[hash])
+
+	stats := c.Stats()
+	assert.Equal(t, uint64(2), stats.Hits)
+	assert.Equal(t, uint64(4), stats.Misses)
+}
@@ -0,0 +1,270 @@
+package signature_database_srv
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/notify"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/solidity"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type canonicalSignature struct {
+	Signature string `yaml:"signature"`
+	Source    string `yaml:"source"`
+}
+
+// canonicalSource provides the list of canonical function signatures, keyed by selector
+type canonicalSource interface {
+	Load(ctx context.Context) (map[string]*canonicalSignature, error)
+}
+
+// newCanonicalSource picks the source based on the configured value, which is either "database", an http(s) URL,
+// or the path to a local YAML file optionally prefixed with file://
+func newCanonicalSource(spec string, db database.Storage) canonicalSource {
+	switch {
+	case spec == "database":
+		return &databaseCanonicalSource{db: db}
+	case strings.HasPrefix(spec, "http://"), strings.HasPrefix(spec, "https://"):
+		return &httpCanonicalSource{url: spec, client: &http.Client{Timeout: 30 * time.Second}}
+	default:
+		return &fileCanonicalSource{path: strings.TrimPrefix(spec, "file://")}
+	}
+}
+
+func decodeCanonicalSignatures(r io.Reader) (map[string]*canonicalSignature, error) {
+	var output map[string]*canonicalSignature
+	if err := yaml.NewDecoder(r).Decode(&output); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("failed to unmarshal yaml: %w", err)
+	}
+	return output, nil
+}
+
+type fileCanonicalSource struct {
+	path string
+}
+
+func (s *fileCanonicalSource) Load(ctx context.Context) (map[string]*canonicalSignature, error) {
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open canonical signatures: %w", err)
+	}
+	defer f.Close()
+
+	return decodeCanonicalSignatures(f)
+}
+
+type httpCanonicalSource struct {
+	url    string
+	client *http.Client
+}
+
+func (s *httpCanonicalSource) Load(ctx context.Context) (map[string]*canonicalSignature, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", s.url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct request: %w", err)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch canonical signatures: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch canonical signatures: expected http 200 but got %d", resp.StatusCode)
+	}
+
+	return decodeCanonicalSignatures(resp.Body)
+}
+
+// databaseCanonicalSource uses the function signatures pinned through /v1/collisions/resolve
+type databaseCanonicalSource struct {
+	db database.Storage
+}
+
+func (s *databaseCanonicalSource) Load(ctx context.Context) (map[string]*canonicalSignature, error) {
+	preferred, err := s.db.LoadPreferredSignatures(client.SignatureTypeFunction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load preferred signatures: %w", err)
+	}
+
+	result := make(map[string]*canonicalSignature)
+	for hash, name := range preferred {
+		result[hash] = &canonicalSignature{
+			Signature: name,
+			Source:    "database",
+		}
+	}
+	return result, nil
+}
+
+// validateCanonicalSignatures checks that every signature is well formed and hashes to its selector. Selectors may
+// be written in any case, so entries for the same selector with different signatures are all rejected rather than
+// picking one at random.
+func validateCanonicalSignatures(input map[string]*canonicalSignature) (map[string]string, []*client.CanonicalSignatureError) {
+	valid := make(map[string]string)
+	invalid := []*client.CanonicalSignatureError{}
+	// keys holds the keys of the input which were valid for each selector
+	keys := make(map[string][]string)
+
+	for hash, entry := range input {
+		if entry == nil {
+			entry = &canonicalSignature{}
+		}
+
+		reject := func(reason string) {
+			invalid = append(invalid, &client.CanonicalSignatureError{
+				Hash:      hash,
+				Signature: entry.Signature,
+				Error:     reason,
+			})
+		}
+
+		sel, err := hexutil.Decode(hash)
+		if err != nil || len(sel) != signatureLens[client.SignatureTypeFunction] {
+			reject("invalid selector")
+			continue
+		}
+
+		if !solidity.VerifySignature(entry.Signature) {
+			reject("invalid signature")
+			continue
+		}
+
+		actual := hexutil.Encode(crypto.Keccak256([]byte(entry.Signature))[:len(sel)])
+		if actual != strings.ToLower(hash) {
+			reject(fmt.Sprintf("signature hashes to %s", actual))
+			continue
+		}
+
+		keys[actual] = append(keys[actual], hash)
+		valid[actual] = entry.Signature
+	}
+
+	for sel, hashes := range keys {
+		conflict := false
+		for _, hash := range hashes {
+			if input[hash].Signature != valid[sel] {
+				conflict = true
+			}
+		}
+		if !conflict {
+			continue
+		}
+
+		delete(valid, sel)
+		for _, hash := range hashes {
+			invalid = append(invalid, &client.CanonicalSignatureError{
+				Hash:      hash,
+				Signature: input[hash].Signature,
+				Error:     fmt.Sprintf("conflicting signatures for %s", sel),
+			})
+		}
+	}
+
+	sort.Slice(invalid, func(i, j int) bool {
+		return invalid[i].Hash < invalid[j].Hash
+	})
+
+	return valid, invalid
+}
+
+func diffCanonicalSignatures(result *client.RefreshCanonicalSignaturesResponse, previous map[string]string, next map[string]string) {
+	for hash, sig := range next {
+		old, ok := previous[hash]
+		if !ok {
+			result.Added[hash] = sig
+		} else if old != sig {
+			result.Changed[hash] = &client.CanonicalSignatureChange{
+				Old: old,
+				New: sig,
+			}
+		}
+	}
+	for hash, sig := range previous {
+		if _, ok := next[hash]; !ok {
+			result.Removed[hash] = sig
+		}
+	}
+}
+
+func (s *Service) loadCanonicalSignatures() (*client.RefreshCanonicalSignaturesResponse, error) {
+	s.canonicalSignaturesLock.Lock()
+	lastRefresh := s.lastCanonicalSignaturesRefresh
+	s.canonicalSignaturesLock.Unlock()
+
+	if time.Since(lastRefresh) < 1*time.Hour {
+		return nil, fmt.Errorf("refreshing too soon")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+
+	output, err := s.canonicalSource.Load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	newCanonicalSignatures, invalid := validateCanonicalSignatures(output)
+
+	result := client.NewRefreshCanonicalSignaturesResponse()
+	result.Count = len(newCanonicalSignatures)
+	result.Invalid = invalid
+
+	s.canonicalSignaturesLock.Lock()
+	hadCanonicalSignatures := len(s.canonicalSignatures) > 0
+	diffCanonicalSignatures(result, s.canonicalSignatures, newCanonicalSignatures)
+	s.canonicalSignatures = newCanonicalSignatures
+	s.lastCanonicalSignaturesRefresh = time.Now()
+	s.canonicalSignaturesLock.Unlock()
+
+	// the first load reports every signature as added, which isn't worth notifying anyone about
+	if hadCanonicalSignatures {
+		s.notifyCanonicalChanged(ctx, result)
+	}
+
+	return result, nil
+}
+
+func (s *Service) notifyCanonicalChanged(ctx context.Context, result *client.RefreshCanonicalSignaturesResponse) {
+	if s.notifier == nil {
+		return
+	}
+
+	var lines []string
+	for hash, sig := range result.Added {
+		lines = append(lines, fmt.Sprintf("added `%s`: `%s`", hash, sig))
+	}
+	for hash, sig := range result.Removed {
+		lines = append(lines, fmt.Sprintf("removed `%s`: `%s`", hash, sig))
+	}
+	for hash, change := range result.Changed {
+		lines = append(lines, fmt.Sprintf("changed `%s`: `%s` -> `%s`", hash, change.Old, change.New))
+	}
+
+	if len(lines) == 0 {
+		return
+	}
+
+	sort.Strings(lines)
+
+	if err := s.notifier.Notify(ctx, notify.NewEvent(
+		notify.EventCanonicalChanged,
+		"The canonical signatures changed:",
+		lines,
+		result,
+	)); err != nil {
+		log.WithError(err).Errorf("failed to notify of canonical signature changes")
+	}
+}
@@ -0,0 +1,136 @@
+package signature_database_srv
+
+import (
+	"testing"
+
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateCanonicalSignatures(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   map[string]*canonicalSignature
+		valid   map[string]string
+		invalid []*client.CanonicalSignatureError
+	}{
+		{
+			name: "valid",
+			input: map[string]*canonicalSignature{
+				"0xa9059cbb": {Signature: "transfer(address,uint256)"},
+				"0x70A08231": {Signature: "balanceOf(address)"},
+			},
+			valid: map[string]string{
+				"0xa9059cbb": "transfer(address,uint256)",
+				"0x70a08231": "balanceOf(address)",
+			},
+		},
+		{
+			name: "invalid entries",
+			input: map[string]*canonicalSignature{
+				"0xa9059cbb":   {Signature: "transfer(address,uint256)"},
+				"0x1234":       {Signature: "foo()"},
+				"a9059cbb":     {Signature: "transfer(address,uint256)"},
+				"0x095ea7b3":   {Signature: "approve(address,uint256"},
+				"0x70a08231":   {Signature: "balanceOf(uint256)"},
+				"0x18160ddd":   nil,
+				"0xa9059cbb00": {Signature: "transfer(address,uint256)"},
+			},
+			valid: map[string]string{
+				"0xa9059cbb": "transfer(address,uint256)",
+			},
+			invalid: []*client.CanonicalSignatureError{
+				{Hash: "0x095ea7b3", Signature: "approve(address,uint256", Error: "invalid signature"},
+				{Hash: "0x1234", Signature: "foo()", Error: "invalid selector"},
+				{Hash: "0x18160ddd", Error: "invalid signature"},
+				{Hash: "0x70a08231", Signature: "balanceOf(uint256)", Error: "signature hashes to 0x9cc7f708"},
+				{Hash: "0xa9059cbb00", Signature: "transfer(address,uint256)", Error: "invalid selector"},
+				{Hash: "a9059cbb", Signature: "transfer(address,uint256)", Error: "invalid selector"},
+			},
+		},
+		{
+			name: "conflicting hashes",
+			input: map[string]*canonicalSignature{
+				"0xa9059cbb": {Signature: "transfer(address,uint256)"},
+				"0xA9059CBB": {Signature: "many_msg_babbage(bytes1)"},
+				"0x70a08231": {Signature: "balanceOf(address)"},
+				"0x70A08231": {Signature: "balanceOf(address)"},
+			},
+			valid: map[string]string{
+				"0x70a08231": "balanceOf(address)",
+			},
+			invalid: []*client.CanonicalSignatureError{
+				{Hash: "0xA9059CBB", Signature: "many_msg_babbage(bytes1)", Error: "conflicting signatures for 0xa9059cbb"},
+				{Hash: "0xa9059cbb", Signature: "transfer(address,uint256)", Error: "conflicting signatures for 0xa9059cbb"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			valid, invalid := validateCanonicalSignatures(test.input)
+			assert.Equal(t, test.valid, valid)
+			if test.invalid == nil {
+				test.invalid = []*client.CanonicalSignatureError{}
+			}
+			assert.Equal(t, test.invalid, invalid)
+		})
+	}
+}
+
+func TestDiffCanonicalSignatures(t *testing.T) {
+	tests := []struct {
+		name     string
+		previous map[string]string
+		next     map[string]string
+		added    map[string]string
+		removed  map[string]string
+		changed  map[string]*client.CanonicalSignatureChange
+	}{
+		{
+			name:  "first load",
+			next:  map[string]string{"0xa9059cbb": "transfer(address,uint256)"},
+			added: map[string]string{"0xa9059cbb": "transfer(address,uint256)"},
+		},
+		{
+			name:     "unchanged",
+			previous: map[string]string{"0xa9059cbb": "transfer(address,uint256)"},
+			next:     map[string]string{"0xa9059cbb": "transfer(address,uint256)"},
+		},
+		{
+			name: "added, removed and changed",
+			previous: map[string]string{
+				"0xa9059cbb": "transfer(address,uint256)",
+				"0x70a08231": "balanceOf(address)",
+			},
+			next: map[string]string{
+				"0xa9059cbb": "many_msg_babbage(bytes1)",
+				"0x095ea7b3": "approve(address,uint256)",
+			},
+			added:   map[string]string{"0x095ea7b3": "approve(address,uint256)"},
+			removed: map[string]string{"0x70a08231": "balanceOf(address)"},
+			changed: map[string]*client.CanonicalSignatureChange{
+				"0xa9059cbb": {Old: "transfer(address,uint256)", New: "many_msg_babbage(bytes1)"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			result := client.NewRefreshCanonicalSignaturesResponse()
+			diffCanonicalSignatures(result, test.previous, test.next)
+
+			expected := client.NewRefreshCanonicalSignaturesResponse()
+			for hash, sig := range test.added {
+				expected.Added[hash] = sig
+			}
+			for hash, sig := range test.removed {
+				expected.Removed[hash] = sig
+			}
+			for hash, change := range test.changed {
+				expected.Changed[hash] = change
+			}
+			assert.Equal(t, expected, result)
+		})
+	}
+}
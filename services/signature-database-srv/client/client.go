@@ -2,68 +2,441 @@ package client
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 )
 
+// MaxLookupQueryLength is the maximum length of the selector list sent in a single lookup, chosen to keep the
+// request URL well below the limits of common proxies and servers
+const MaxLookupQueryLength = 4096
+
+// Error is returned when the service responds with a non-ok response
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("signature database returned %d: %s", e.StatusCode, e.Message)
+}
+
 type Client struct {
 	client *http.Client
 	host   string
+	apiKey string
 }
 
 func New() *Client {
+	return NewWithHost(`https://api.openchain.xyz/signature-database`)
+}
+
+func NewWithHost(host string) *Client {
 	return &Client{
 		client: &http.Client{},
-		host:   `https://api.openchain.xyz/signature-database`,
+		host:   strings.TrimSuffix(host, "/"),
 	}
 }
 
-func (c *Client) do(method string, path string, in any, out any) error {
+// WithAPIKey makes every request with the given api key, which is needed for the admin endpoints and raises the
+// rate limit of the others
+func (c *Client) WithAPIKey(key string) *Client {
+	c.apiKey = key
+	return c
+}
+
+func (c *Client) newRequest(ctx context.Context, method string, path string, query url.Values, in any) (*http.Request, error) {
 	var bodyReader io.Reader
 	if in != nil {
 		b, err := json.Marshal(in)
 		if err != nil {
-			return fmt.Errorf("failed to marshal body: %w", err)
+			return nil, fmt.Errorf("failed to marshal body: %w", err)
 		}
 		bodyReader = bytes.NewReader(b)
 	}
-	req, err := http.NewRequest(method, fmt.Sprintf("%s%s", c.host, path), bodyReader)
+
+	u := c.host + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, bodyReader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to construct request: %w", err)
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+	return req, nil
+}
+
+type responseWrapper struct {
+	Ok     bool            `json:"ok"`
+	Error  string          `json:"error"`
+	Result json.RawMessage `json:"result"`
+}
+
+// readError builds an *Error from a failed response, using the error message from the response envelope if
+// there is one
+func readError(resp *http.Response) error {
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 4096))
 	if err != nil {
-		return fmt.Errorf("failed to construct request: %w", err)
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+
+	var wrapper responseWrapper
+	if err := json.Unmarshal(body, &wrapper); err == nil && wrapper.Error != "" {
+		return &Error{StatusCode: resp.StatusCode, Message: wrapper.Error}
+	}
+
+	return &Error{StatusCode: resp.StatusCode, Message: strings.TrimSpace(string(body))}
+}
+
+func (c *Client) do(ctx context.Context, method string, path string, query url.Values, in any, out any) error {
+	req, err := c.newRequest(ctx, method, path, query, in)
+	if err != nil {
+		return err
 	}
 
 	resp, err := c.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("failed to do request: %w", err)
 	}
+	defer resp.Body.Close()
 
-	var responseWrapper struct {
-		Ok     bool            `json:"ok"`
-		Error  string          `json:"error"`
-		Result json.RawMessage `json:"result"`
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&responseWrapper); err != nil {
+
+	var wrapper responseWrapper
+	if err := json.NewDecoder(resp.Body).Decode(&wrapper); err != nil {
 		return fmt.Errorf("failed to read body: %w", err)
 	}
 
-	if !responseWrapper.Ok {
-		return errors.New(responseWrapper.Error)
+	if !wrapper.Ok {
+		return &Error{StatusCode: resp.StatusCode, Message: wrapper.Error}
 	}
 
-	if err := json.Unmarshal(responseWrapper.Result, out); err != nil {
+	if out == nil {
+		return nil
+	}
+
+	if err := json.Unmarshal(wrapper.Result, out); err != nil {
 		return fmt.Errorf("failed to decode body: %w", err)
 	}
 
 	return nil
 }
 
-func (c *Client) Import(data AllTypes[[]string]) (ImportResponse, error) {
+func (c *Client) Import(ctx context.Context, data AllTypes[[]string]) (ImportResponse, error) {
 	var resp ImportResponse
 
-	err := c.do("POST", "/v1/import", ImportRequest(data), &resp)
+	err := c.do(ctx, "POST", "/v1/import", nil, ImportRequest(data), &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Lookup resolves the given function and event selectors. Selectors which are unknown are present in the
+// response with no signatures.
+func (c *Client) Lookup(ctx context.Context, functions []string, events []string) (SignatureResponse, error) {
+	query := url.Values{}
+	if len(functions) > 0 {
+		query.Set(string(SignatureTypeFunction), strings.Join(functions, ","))
+	}
+	if len(events) > 0 {
+		query.Set(string(SignatureTypeEvent), strings.Join(events, ","))
+	}
+
+	var resp SignatureResponse
+
+	err := c.do(ctx, "GET", "/v1/lookup", query, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// LookupBulk resolves any number of function, event and error selectors, up to the server's batch limit, in a
+// single request
+func (c *Client) LookupBulk(ctx context.Context, req LookupRequest) (SignatureResponse, error) {
+	var resp SignatureResponse
+
+	err := c.do(ctx, "POST", "/v1/lookup", nil, req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// LookupBatched behaves like Lookup, but splits the selectors over as many requests as needed to stay within
+// MaxLookupQueryLength
+func (c *Client) LookupBatched(ctx context.Context, functions []string, events []string) (SignatureResponse, error) {
+	result := NewSignatureResponse()
+
+	merge := func(resp SignatureResponse) {
+		for typ, sigs := range resp {
+			if _, ok := result[typ]; !ok {
+				result[typ] = make(map[string][]*SignatureData)
+			}
+			for hash, data := range sigs {
+				result[typ][hash] = data
+			}
+		}
+	}
+
+	for _, batch := range BatchSelectors(functions, MaxLookupQueryLength) {
+		resp, err := c.Lookup(ctx, batch, nil)
+		if err != nil {
+			return nil, err
+		}
+		merge(resp)
+	}
+
+	for _, batch := range BatchSelectors(events, MaxLookupQueryLength) {
+		resp, err := c.Lookup(ctx, nil, batch)
+		if err != nil {
+			return nil, err
+		}
+		merge(resp)
+	}
+
+	return result, nil
+}
+
+// BatchSelectors splits selectors into batches whose comma-joined length, once url-encoded, does not exceed
+// maxLength. A single selector longer than maxLength is placed in a batch of its own.
+func BatchSelectors(selectors []string, maxLength int) [][]string {
+	var (
+		batches [][]string
+		current []string
+		length  int
+	)
+	for _, selector := range selectors {
+		extra := len(selector)
+		if len(current) > 0 {
+			// the comma is encoded as %2C
+			extra += 3
+		}
+
+		if len(current) > 0 && length+extra > maxLength {
+			batches = append(batches, current)
+			current = nil
+			length = 0
+			extra = len(selector)
+		}
+
+		current = append(current, selector)
+		length += extra
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+	return batches
+}
+
+// ContractSelectors extracts the function selectors from the code deployed at address on the given chain, and
+// resolves them to their signatures
+func (c *Client) ContractSelectors(ctx context.Context, chain string, address string) (*ContractSelectorsResponse, error) {
+	var resp ContractSelectorsResponse
+
+	err := c.do(ctx, "GET", fmt.Sprintf("/v1/contract/%s/%s/selectors", url.PathEscape(chain), url.PathEscape(address)), nil, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// Search finds signatures matching the query, which may contain '*' and '?' wildcards
+func (c *Client) Search(ctx context.Context, query string, filter bool) (SignatureResponse, error) {
+	params := url.Values{}
+	params.Set("query", query)
+	if !filter {
+		params.Set("filter", "false")
+	}
+
+	var resp SignatureResponse
+
+	err := c.do(ctx, "GET", "/v1/search", params, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+func (c *Client) Stats(ctx context.Context) (*StatsResponse, error) {
+	var resp StatsResponse
+
+	err := c.do(ctx, "GET", "/v1/stats", nil, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// SelectorStats returns the most looked up hashes of the given type over the server's stats window. If unknown is
+// set, only hashes which still have no signatures are returned, ordered by the number of misses.
+func (c *Client) SelectorStats(ctx context.Context, typ SignatureType, unknown bool, limit int) (*SelectorStatsResponse, error) {
+	query := url.Values{}
+	query.Set("type", string(typ))
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	path := "/v1/stats/popular"
+	if unknown {
+		path = "/v1/stats/unknown"
+	}
+
+	var resp SelectorStatsResponse
+
+	err := c.do(ctx, "GET", path, query, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// Export writes the latest full export of the database to w
+func (c *Client) Export(ctx context.Context, w io.Writer) error {
+	req, err := c.newRequest(ctx, "GET", "/v1/export", nil, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to do request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return readError(resp)
+	}
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return fmt.Errorf("failed to read body: %w", err)
+	}
+
+	return nil
+}
+
+func (c *Client) RefreshCanonicalSignatures(ctx context.Context) (*RefreshCanonicalSignaturesResponse, error) {
+	var resp RefreshCanonicalSignaturesResponse
+
+	err := c.do(ctx, "POST", "/v1/refresh_canonical_signatures", nil, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) ListAPIKeys(ctx context.Context) ([]*APIKey, error) {
+	var resp []*APIKey
+
+	err := c.do(ctx, "GET", "/v1/keys", nil, nil, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// CreateAPIKey creates a new api key, the returned secret can't be retrieved again
+func (c *Client) CreateAPIKey(ctx context.Context, name string, scopes []APIKeyScope) (*CreateAPIKeyResponse, error) {
+	var resp CreateAPIKeyResponse
+
+	err := c.do(ctx, "POST", "/v1/keys", nil, &CreateAPIKeyRequest{Name: name, Scopes: scopes}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+func (c *Client) DeleteAPIKey(ctx context.Context, id int) error {
+	return c.do(ctx, "DELETE", fmt.Sprintf("/v1/keys/%d", id), nil, nil, nil)
+}
+
+// DeleteSignatures permanently removes the given signatures
+func (c *Client) DeleteSignatures(ctx context.Context, typ SignatureType, signatures []string) (*ModerationResponse, error) {
+	var resp ModerationResponse
+
+	err := c.do(ctx, "POST", "/v1/signatures/delete", nil, &ModerationRequest{Type: typ, Signatures: signatures}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// QuarantineSignatures hides the given signatures from filtered results without deleting them
+func (c *Client) QuarantineSignatures(ctx context.Context, typ SignatureType, signatures []string, reason string) (*ModerationResponse, error) {
+	var resp ModerationResponse
+
+	err := c.do(ctx, "POST", "/v1/signatures/quarantine", nil, &ModerationRequest{Type: typ, Signatures: signatures, Reason: reason}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// ReleaseSignatures undoes QuarantineSignatures
+func (c *Client) ReleaseSignatures(ctx context.Context, typ SignatureType, signatures []string) (*ModerationResponse, error) {
+	var resp ModerationResponse
+
+	err := c.do(ctx, "POST", "/v1/signatures/release", nil, &ModerationRequest{Type: typ, Signatures: signatures}, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return &resp, nil
+}
+
+// QueueGuesses queues unknown hashes for the guesser. Hashes which already have signatures aren't queued, and are
+// returned with GuessStatusKnown.
+func (c *Client) QueueGuesses(ctx context.Context, req GuessRequest) (GuessResponse, error) {
+	var resp GuessResponse
+
+	err := c.do(ctx, "POST", "/v1/guess", nil, req, &resp)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// Guesses returns the progress of the given hashes which have been queued for the guesser
+func (c *Client) Guesses(ctx context.Context, functions []string, events []string) (GuessResponse, error) {
+	query := url.Values{}
+	if len(functions) > 0 {
+		query.Set(string(SignatureTypeFunction), strings.Join(functions, ","))
+	}
+	if len(events) > 0 {
+		query.Set(string(SignatureTypeEvent), strings.Join(events, ","))
+	}
+
+	var resp GuessResponse
+
+	err := c.do(ctx, "GET", "/v1/guess", query, nil, &resp)
 	if err != nil {
 		return nil, err
 	}
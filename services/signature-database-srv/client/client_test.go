@@ -0,0 +1,260 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestClient returns a client for a server which runs handler
+func newTestClient(t *testing.T, handler http.HandlerFunc) *Client {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return NewWithHost(server.URL + "/")
+}
+
+func writeResult(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"ok":     true,
+		"result": result,
+	})
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/stats":
+			// ok:false is an error even if the status isn't
+			json.NewEncoder(w).Encode(map[string]any{"ok": false, "error": "stats unavailable"})
+		case "/v1/keys":
+			w.WriteHeader(http.StatusUnauthorized)
+			json.NewEncoder(w).Encode(map[string]any{"ok": false, "error": "invalid api key"})
+		default:
+			http.Error(w, "bad gateway", http.StatusBadGateway)
+		}
+	})
+
+	_, err := c.Stats(ctx)
+	var clientErr *Error
+	require.ErrorAs(t, err, &clientErr)
+	assert.Equal(t, &Error{StatusCode: http.StatusOK, Message: "stats unavailable"}, clientErr)
+
+	_, err = c.ListAPIKeys(ctx)
+	require.ErrorAs(t, err, &clientErr)
+	assert.Equal(t, &Error{StatusCode: http.StatusUnauthorized, Message: "invalid api key"}, clientErr)
+
+	// responses which aren't from the service are returned as they are
+	err = c.Export(ctx, new(bytes.Buffer))
+	require.ErrorAs(t, err, &clientErr)
+	assert.Equal(t, &Error{StatusCode: http.StatusBadGateway, Message: "bad gateway"}, clientErr)
+}
+
+func TestWithAPIKey(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "DELETE", r.Method)
+		assert.Equal(t, "/v1/keys/3", r.URL.Path)
+		writeResult(w, nil)
+	}).WithAPIKey("secret")
+
+	require.NoError(t, c.DeleteAPIKey(context.Background(), 3))
+}
+
+func TestBatchSelectors(t *testing.T) {
+	assert.Nil(t, BatchSelectors(nil, 32))
+
+	selectors := []string{"0xa9059cbb", "0x095ea7b3", "0x23b872dd"}
+	assert.Equal(t, [][]string{selectors}, BatchSelectors(selectors, 36))
+	assert.Equal(t, [][]string{selectors[:2], selectors[2:]}, BatchSelectors(selectors, 35))
+
+	// a selector which is too long on its own gets a batch of its own
+	long := strings.Repeat("a", 40)
+	assert.Equal(t, [][]string{{"0xa9059cbb"}, {long}, {"0x095ea7b3"}}, BatchSelectors([]string{"0xa9059cbb", long, "0x095ea7b3"}, 32))
+}
+
+func TestLookupBatched(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		requests int
+	)
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		requests++
+		lock.Unlock()
+
+		assert.Equal(t, "/v1/lookup", r.URL.Path)
+		assert.LessOrEqual(t, len(r.URL.RawQuery), MaxLookupQueryLength+len("function="))
+
+		result := NewSignatureResponse()
+		for _, typ := range []SignatureType{SignatureTypeFunction, SignatureTypeEvent} {
+			if !r.URL.Query().Has(string(typ)) {
+				continue
+			}
+			for _, hash := range strings.Split(r.URL.Query().Get(string(typ)), ",") {
+				result[typ][hash] = []*SignatureData{{Name: fmt.Sprintf("%s_%s()", typ, hash)}}
+			}
+		}
+		writeResult(w, result)
+	})
+
+	var functions []string
+	for i := 0; i < 1000; i++ {
+		functions = append(functions, fmt.Sprintf("0x%08x", i))
+	}
+	events := []string{"0x" + strings.Repeat("dd", 32)}
+
+	resp, err := c.LookupBatched(context.Background(), functions, events)
+	require.NoError(t, err)
+
+	// 1000 selectors take 13 bytes each with the separator, so the functions need 4 requests
+	assert.Equal(t, 5, requests)
+	require.Len(t, resp[SignatureTypeFunction], len(functions))
+	for _, hash := range functions {
+		require.Len(t, resp[SignatureTypeFunction][hash], 1)
+		assert.Equal(t, fmt.Sprintf("function_%s()", hash), resp[SignatureTypeFunction][hash][0].Name)
+	}
+	require.Len(t, resp[SignatureTypeEvent][events[0]], 1)
+}
+
+func TestLookupBulk(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/v1/lookup", r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		var req LookupRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, LookupRequest{SignatureTypeFunction: {"0xa9059cbb"}, SignatureTypeError: {"0x08c379a0"}}, req)
+
+		writeResult(w, SignatureResponse{
+			SignatureTypeFunction: {"0xa9059cbb": {{Name: "transfer(address,uint256)"}}},
+			SignatureTypeError:    {"0x08c379a0": {{Name: "Error(string)"}}},
+		})
+	})
+
+	resp, err := c.LookupBulk(context.Background(), LookupRequest{
+		SignatureTypeFunction: {"0xa9059cbb"},
+		SignatureTypeError:    {"0x08c379a0"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "transfer(address,uint256)", resp[SignatureTypeFunction]["0xa9059cbb"][0].Name)
+	assert.Equal(t, "Error(string)", resp[SignatureTypeError]["0x08c379a0"][0].Name)
+}
+
+func TestSearch(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/search", r.URL.Path)
+		assert.Equal(t, "transfer*", r.URL.Query().Get("query"))
+		assert.Equal(t, "false", r.URL.Query().Get("filter"))
+
+		result := NewSignatureResponse()
+		result[SignatureTypeFunction]["0xa9059cbb"] = []*SignatureData{{Name: "transfer(address,uint256)"}}
+		writeResult(w, result)
+	})
+
+	resp, err := c.Search(context.Background(), "transfer*", false)
+	require.NoError(t, err)
+	assert.Len(t, resp[SignatureTypeFunction], 1)
+}
+
+func TestContractSelectors(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/contract/ethereum/0x6b175474e89094c44da98b954eedeac495271d0f/selectors", r.URL.Path)
+		writeResult(w, &ContractSelectorsResponse{
+			Chain:   "ethereum",
+			Address: "0x6b175474e89094c44da98b954eedeac495271d0f",
+			Selectors: map[string][]*SignatureData{
+				"0xa9059cbb": {{Name: "transfer(address,uint256)"}},
+				"0x12345678": nil,
+			},
+		})
+	})
+
+	resp, err := c.ContractSelectors(context.Background(), "ethereum", "0x6b175474e89094c44da98b954eedeac495271d0f")
+	require.NoError(t, err)
+	assert.Len(t, resp.Selectors, 2)
+	assert.Equal(t, "transfer(address,uint256)", resp.Selectors["0xa9059cbb"][0].Name)
+}
+
+func TestSelectorStats(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/stats/unknown", r.URL.Path)
+		assert.Equal(t, "event", r.URL.Query().Get("type"))
+		assert.Equal(t, "10", r.URL.Query().Get("limit"))
+		writeResult(w, &SelectorStatsResponse{
+			Type:      SignatureTypeEvent,
+			Selectors: []*SelectorStat{{Hash: "0x1234", Lookups: 3, Misses: 3}},
+		})
+	})
+
+	resp, err := c.SelectorStats(context.Background(), SignatureTypeEvent, true, 10)
+	require.NoError(t, err)
+	assert.Equal(t, []*SelectorStat{{Hash: "0x1234", Lookups: 3, Misses: 3}}, resp.Selectors)
+}
+
+func TestModeration(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/signatures/quarantine", r.URL.Path)
+
+		var req ModerationRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, ModerationRequest{Type: SignatureTypeFunction, Signatures: []string{"spam()"}, Reason: "spam"}, req)
+
+		writeResult(w, &ModerationResponse{Affected: req.Signatures})
+	})
+
+	resp, err := c.QuarantineSignatures(context.Background(), SignatureTypeFunction, []string{"spam()"}, "spam")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"spam()"}, resp.Affected)
+}
+
+func TestGuesses(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/guess", r.URL.Path)
+
+		var hash string
+		switch r.Method {
+		case "POST":
+			var req GuessRequest
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+			hash = req[SignatureTypeFunction][0]
+		case "GET":
+			hash = r.URL.Query().Get(string(SignatureTypeFunction))
+		}
+
+		writeResult(w, GuessResponse{
+			SignatureTypeFunction: {hash: {Status: GuessStatusKnown}},
+		})
+	})
+
+	resp, err := c.QueueGuesses(context.Background(), GuessRequest{SignatureTypeFunction: {"0xa9059cbb"}})
+	require.NoError(t, err)
+	assert.Equal(t, GuessStatusKnown, resp[SignatureTypeFunction]["0xa9059cbb"].Status)
+
+	resp, err = c.Guesses(context.Background(), []string{"0x095ea7b3"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, GuessStatusKnown, resp[SignatureTypeFunction]["0x095ea7b3"].Status)
+}
+
+func TestExport(t *testing.T) {
+	c := newTestClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/export", r.URL.Path)
+		w.Write([]byte("function,0xa9059cbb,transfer(address,uint256)\n"))
+	})
+
+	var buf bytes.Buffer
+	require.NoError(t, c.Export(context.Background(), &buf))
+	assert.Equal(t, "function,0xa9059cbb,transfer(address,uint256)\n", buf.String())
+}
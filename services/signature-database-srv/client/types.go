@@ -1,16 +1,26 @@
 package client
 
+import "time"
+
 type SignatureType string
 
 const (
 	SignatureTypeFunction SignatureType = "function"
 	SignatureTypeEvent                  = "event"
+	// SignatureTypeError can only be looked up. Errors share the 4-byte selector space with functions, so they're
+	// resolved against the function signatures.
+	SignatureTypeError SignatureType = "error"
 )
 
 func SignatureTypes() []SignatureType {
 	return []SignatureType{SignatureTypeFunction, SignatureTypeEvent}
 }
 
+// LookupTypes returns every signature type which can be looked up by hash
+func LookupTypes() []SignatureType {
+	return []SignatureType{SignatureTypeFunction, SignatureTypeEvent, SignatureTypeError}
+}
+
 func (t SignatureType) Valid() bool {
 	return t == SignatureTypeFunction || t == SignatureTypeEvent
 }
@@ -19,12 +29,16 @@ type AllTypes[T any] map[SignatureType]T
 
 type ImportRequest AllTypes[[]string]
 
+type LookupRequest AllTypes[[]string]
+
 type ImportResponse AllTypes[*ImportResponseDetails]
 
 type ImportResponseDetails struct {
 	Imported   map[string]string `json:"imported"`
 	Duplicated map[string]string `json:"duplicated"`
 	Invalid    []string          `json:"invalid"`
+	// Quarantined maps the imported signatures which were flagged as likely spam to the reason they were flagged
+	Quarantined map[string]string `json:"quarantined,omitempty"`
 }
 
 func NewImportResponse() ImportResponse {
@@ -46,8 +60,15 @@ func NewImportResponseDetails() *ImportResponseDetails {
 type SignatureData struct {
 	Name     string `json:"name"`
 	Filtered bool   `json:"filtered"`
+	// Quarantined signatures are always filtered, FlagReason explains why they were quarantined
+	Quarantined bool   `json:"quarantined,omitempty"`
+	FlagReason  string `json:"flag_reason,omitempty"`
+	// Source is empty for imported signatures, or SignatureSourceGuessed for those recovered by the guesser
+	Source string `json:"source,omitempty"`
 }
 
+const SignatureSourceGuessed = "guessed"
+
 type SignatureResponse AllTypes[map[string][]*SignatureData]
 
 func NewSignatureResponse() SignatureResponse {
@@ -60,6 +81,20 @@ func NewSignatureResponse() SignatureResponse {
 
 type StatsResponse struct {
 	Count AllTypes[int] `json:"count"`
+	// Cache is only present when the lookup cache is enabled
+	Cache *CacheStats `json:"cache,omitempty"`
+}
+
+// CacheStats describes the lookup cache since the service started. NegativeHits counts the hits which were for
+// hashes without any signatures, and are included in Hits.
+type CacheStats struct {
+	Entries      int     `json:"entries"`
+	Capacity     int     `json:"capacity"`
+	Hits         uint64  `json:"hits"`
+	NegativeHits uint64  `json:"negative_hits"`
+	Misses       uint64  `json:"misses"`
+	Evictions    uint64  `json:"evictions"`
+	HitRate      float64 `json:"hit_rate"`
 }
 
 func NewStatsResponse() *StatsResponse {
@@ -67,3 +102,184 @@ func NewStatsResponse() *StatsResponse {
 		Count: make(AllTypes[int]),
 	}
 }
+
+type Collision struct {
+	Hash       string           `json:"hash"`
+	Signatures []*SignatureData `json:"signatures"`
+	Canonical  string           `json:"canonical,omitempty"`
+	Preferred  string           `json:"preferred,omitempty"`
+	Resolved   bool             `json:"resolved"`
+}
+
+type CollisionsResponse struct {
+	Collisions []*Collision `json:"collisions"`
+	Next       string       `json:"next,omitempty"`
+}
+
+type ResolveCollisionRequest struct {
+	Type SignatureType `json:"type"`
+	Hash string        `json:"hash"`
+	// Name is the signature to pin for the hash, or empty to remove the pin
+	Name string `json:"name"`
+}
+
+// ExportEntry is a single signature in the csv, ndjson and parquet exports. Incremental exports also contain
+// signatures which were removed, in which case CreatedAt is when they were removed.
+type ExportEntry struct {
+	Type      SignatureType `json:"type"`
+	Hash      string        `json:"hash"`
+	Name      string        `json:"name"`
+	CreatedAt time.Time     `json:"created_at"`
+	Removed   bool          `json:"removed,omitempty"`
+}
+
+type ContractSelectorsResponse struct {
+	Chain   string `json:"chain"`
+	Address string `json:"address"`
+	// Selectors maps every selector found in the contract's dispatcher to its known signatures
+	Selectors map[string][]*SignatureData `json:"selectors"`
+}
+
+type CanonicalSignatureError struct {
+	Hash      string `json:"hash"`
+	Signature string `json:"signature"`
+	Error     string `json:"error"`
+}
+
+type CanonicalSignatureChange struct {
+	Old string `json:"old"`
+	New string `json:"new"`
+}
+
+type RefreshCanonicalSignaturesResponse struct {
+	// Count is the number of valid canonical signatures now loaded
+	Count int `json:"count"`
+	// Invalid lists the entries which were rejected, these are not loaded
+	Invalid []*CanonicalSignatureError           `json:"invalid"`
+	Added   map[string]string                    `json:"added"`
+	Removed map[string]string                    `json:"removed"`
+	Changed map[string]*CanonicalSignatureChange `json:"changed"`
+}
+
+func NewRefreshCanonicalSignaturesResponse() *RefreshCanonicalSignaturesResponse {
+	return &RefreshCanonicalSignaturesResponse{
+		Invalid: []*CanonicalSignatureError{},
+		Added:   make(map[string]string),
+		Removed: make(map[string]string),
+		Changed: make(map[string]*CanonicalSignatureChange),
+	}
+}
+
+// APIKeyScope grants an api key access to a group of endpoints
+type APIKeyScope string
+
+const (
+	APIKeyScopeRead   APIKeyScope = "read"
+	APIKeyScopeImport APIKeyScope = "import"
+	APIKeyScopeAdmin  APIKeyScope = "admin"
+)
+
+func APIKeyScopes() []APIKeyScope {
+	return []APIKeyScope{APIKeyScopeRead, APIKeyScopeImport, APIKeyScopeAdmin}
+}
+
+func (s APIKeyScope) Valid() bool {
+	return s == APIKeyScopeRead || s == APIKeyScopeImport || s == APIKeyScopeAdmin
+}
+
+type APIKey struct {
+	ID         int           `json:"id"`
+	Name       string        `json:"name"`
+	Scopes     []APIKeyScope `json:"scopes"`
+	CreatedAt  time.Time     `json:"created_at"`
+	LastUsedAt *time.Time    `json:"last_used_at"`
+	// Requests and RateLimited count the requests made with the key, and how many of them were rejected
+	Requests    int64 `json:"requests"`
+	RateLimited int64 `json:"rate_limited"`
+}
+
+// HasScope reports whether the key grants scope, the admin scope grants every other scope
+func (k *APIKey) HasScope(scope APIKeyScope) bool {
+	for _, s := range k.Scopes {
+		if s == scope || s == APIKeyScopeAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string        `json:"name"`
+	Scopes []APIKeyScope `json:"scopes"`
+}
+
+type CreateAPIKeyResponse struct {
+	// Key is the secret to send in the Authorization header, it is only ever returned here
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
+
+type ModerationRequest struct {
+	Type       SignatureType `json:"type"`
+	Signatures []string      `json:"signatures"`
+	// Reason is recorded against quarantined signatures
+	Reason string `json:"reason,omitempty"`
+}
+
+type ModerationResponse struct {
+	// Affected lists the signatures which were changed, signatures which don't exist are ignored
+	Affected []string `json:"affected"`
+}
+
+type QuarantinedSignature struct {
+	Hash       string `json:"hash"`
+	Name       string `json:"name"`
+	FlagReason string `json:"flag_reason"`
+}
+
+type QuarantinedSignaturesResponse struct {
+	Signatures []*QuarantinedSignature `json:"signatures"`
+	Next       string                  `json:"next,omitempty"`
+}
+
+type GuessStatus string
+
+const (
+	// GuessStatusPending tasks are waiting for, or being worked on by, the guesser
+	GuessStatusPending GuessStatus = "pending"
+	// GuessStatusFound tasks have a signature, Name is the one the guesser found
+	GuessStatusFound GuessStatus = "found"
+	// GuessStatusExhausted tasks had every candidate tried without a match
+	GuessStatusExhausted GuessStatus = "exhausted"
+	// GuessStatusKnown hashes already had signatures, so they weren't queued
+	GuessStatusKnown GuessStatus = "known"
+)
+
+type GuessRequest AllTypes[[]string]
+
+type GuessTask struct {
+	Status GuessStatus `json:"status"`
+	Name   string      `json:"name,omitempty"`
+	// Tried is the number of candidates which have been checked so far
+	Tried    int64      `json:"tried"`
+	QueuedAt *time.Time `json:"queued_at,omitempty"`
+}
+
+// GuessResponse has the task of every requested hash, keyed by type and then hash
+type GuessResponse AllTypes[map[string]*GuessTask]
+
+type SelectorStat struct {
+	Hash    string `json:"hash"`
+	Lookups int64  `json:"lookups"`
+	// Misses is the number of lookups which found no signatures
+	Misses int64 `json:"misses"`
+	// Signatures are the current signatures of the hash, filtered like a lookup
+	Signatures []*SignatureData `json:"signatures,omitempty"`
+}
+
+type SelectorStatsResponse struct {
+	Type SignatureType `json:"type"`
+	// Since is the start of the window the stats cover
+	Since     time.Time       `json:"since"`
+	Selectors []*SelectorStat `json:"selectors"`
+}
@@ -0,0 +1,222 @@
+package signature_database_srv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/core"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/solidity"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultCollisionsLimit = 100
+	maxCollisionsLimit     = 1000
+)
+
+func (s *Service) loadPreferredSignatures() error {
+	newPreferredSignatures := make(client.AllTypes[map[string]string])
+	for _, typ := range client.SignatureTypes() {
+		preferred, err := s.db.LoadPreferredSignatures(typ)
+		if err != nil {
+			return err
+		}
+		newPreferredSignatures[typ] = preferred
+	}
+
+	s.preferredSignaturesLock.Lock()
+	s.preferredSignatures = newPreferredSignatures
+	s.preferredSignaturesLock.Unlock()
+
+	return nil
+}
+
+// expectedSignature returns the signature which should be shown for a hash, if one is known. Signatures pinned
+// in the database take precedence over the canonical list.
+func (s *Service) expectedSignature(typ client.SignatureType, hash string) (string, bool) {
+	s.preferredSignaturesLock.RLock()
+	preferred, ok := s.preferredSignatures[typ][hash]
+	s.preferredSignaturesLock.RUnlock()
+	if ok {
+		return preferred, true
+	}
+
+	if typ != client.SignatureTypeFunction {
+		return "", false
+	}
+
+	s.canonicalSignaturesLock.RLock()
+	canonical, ok := s.canonicalSignatures[hash]
+	s.canonicalSignaturesLock.RUnlock()
+	return canonical, ok
+}
+
+// expectedSignatures returns the expected signature of every hash which has one, see expectedSignature
+func (s *Service) expectedSignatures(typ client.SignatureType) map[string]string {
+	result := make(map[string]string)
+
+	if typ == client.SignatureTypeFunction {
+		s.canonicalSignaturesLock.RLock()
+		for hash, name := range s.canonicalSignatures {
+			result[hash] = name
+		}
+		s.canonicalSignaturesLock.RUnlock()
+	}
+
+	// preferred signatures take precedence over canonical ones
+	s.preferredSignaturesLock.RLock()
+	for hash, name := range s.preferredSignatures[typ] {
+		result[hash] = name
+	}
+	s.preferredSignaturesLock.RUnlock()
+
+	return result
+}
+
+func (s *Service) serveCollisions(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	typ := client.SignatureTypeFunction
+	if params.Has("type") {
+		typ = client.SignatureType(params.Get("type"))
+		if !typ.Valid() {
+			fail(w, http.StatusBadRequest, nil, "invalid signature type")
+			return
+		}
+	}
+
+	limit := defaultCollisionsLimit
+	if params.Has("limit") {
+		v, err := strconv.Atoi(params.Get("limit"))
+		if err != nil || v <= 0 || v > maxCollisionsLimit {
+			fail(w, http.StatusBadRequest, err, "invalid limit")
+			return
+		}
+		limit = v
+	}
+
+	after := params.Get("after")
+	if after != "" {
+		sel, err := hexutil.Decode(after)
+		if err != nil || len(sel) != signatureLens[typ] {
+			fail(w, http.StatusBadRequest, err, "invalid after")
+			return
+		}
+		after = hexutil.Encode(sel)
+	}
+
+	collisions, order, err := s.db.ListCollisions(typ, after, limit)
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err, "failed to list collisions")
+		return
+	}
+
+	response := &client.CollisionsResponse{
+		Collisions: []*client.Collision{},
+	}
+
+	s.canonicalSignaturesLock.RLock()
+	canonicalSignatures := s.canonicalSignatures
+	s.canonicalSignaturesLock.RUnlock()
+
+	s.preferredSignaturesLock.RLock()
+	preferredSignatures := s.preferredSignatures[typ]
+	s.preferredSignaturesLock.RUnlock()
+
+	for _, hash := range order {
+		collision := &client.Collision{
+			Hash:       hash,
+			Signatures: collisions[hash],
+			Preferred:  preferredSignatures[hash],
+		}
+		if typ == client.SignatureTypeFunction {
+			collision.Canonical = canonicalSignatures[hash]
+		}
+
+		expected := collision.Preferred
+		if expected == "" {
+			expected = collision.Canonical
+		}
+		if expected != "" {
+			collision.Resolved = true
+		}
+		for _, sig := range collision.Signatures {
+			sig.Filtered = sig.Quarantined || (expected != "" && sig.Name != expected)
+		}
+
+		response.Collisions = append(response.Collisions, collision)
+	}
+
+	if len(order) == limit {
+		response.Next = order[len(order)-1]
+	}
+
+	succeed(w, response)
+}
+
+func (s *Service) serveResolveCollision(w http.ResponseWriter, r *http.Request) {
+	var req client.ResolveCollisionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, err, "failed to decode body")
+		return
+	}
+
+	if err := s.resolveCollision(req); err != nil {
+		fail(w, http.StatusBadRequest, err, err.Error())
+		return
+	}
+
+	log.WithFields(log.Fields{
+		"ip":   s.remoteIP(r),
+		"ua":   core.GetUserAgent(r),
+		"type": req.Type,
+		"hash": req.Hash,
+		"name": req.Name,
+	}).Infof("resolved collision")
+
+	succeed(w, nil)
+}
+
+func (s *Service) resolveCollision(req client.ResolveCollisionRequest) error {
+	if !req.Type.Valid() {
+		return errors.New("invalid signature type")
+	}
+
+	hash := strings.ToLower(req.Hash)
+	sel, err := hexutil.Decode(hash)
+	if err != nil || len(sel) != signatureLens[req.Type] {
+		return errors.New("invalid hash")
+	}
+
+	if req.Name == "" {
+		if err := s.db.DeletePreferredSignature(req.Type, hash); err != nil {
+			return fmt.Errorf("failed to delete preferred signature: %w", err)
+		}
+	} else {
+		if !solidity.VerifySignature(req.Name) {
+			return errors.New("invalid signature")
+		}
+
+		actual := hexutil.Encode(crypto.Keccak256([]byte(req.Name))[:len(sel)])
+		if actual != hash {
+			return fmt.Errorf("signature hashes to %s, not %s", actual, hash)
+		}
+
+		// make sure the pinned signature is also one of the known signatures
+		if _, err := s.db.SaveSignatures(req.Type, []string{req.Name}); err != nil {
+			return fmt.Errorf("failed to save signature: %w", err)
+		}
+
+		if err := s.db.SetPreferredSignature(req.Type, req.Name); err != nil {
+			return fmt.Errorf("failed to save preferred signature: %w", err)
+		}
+	}
+
+	return s.loadPreferredSignatures()
+}
@@ -0,0 +1,64 @@
+package signature_database_srv
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeCollisions(t *testing.T) {
+	db, err := database.NewBolt(filepath.Join(t.TempDir(), "signatures.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.BulkImportSignatures(client.SignatureTypeFunction,
+		[]string{"a()", "b()", "c()", "d()"},
+		[][]byte{{0x00, 0x00, 0x00, 0x01}, {0x00, 0x00, 0x00, 0x01}, {0x00, 0x00, 0x00, 0x02}, {0x00, 0x00, 0x00, 0x02}},
+	)
+	require.NoError(t, err)
+
+	s := &Service{
+		config:              &Config{},
+		db:                  db,
+		preferredSignatures: make(client.AllTypes[map[string]string]),
+		canonicalSignatures: make(map[string]string),
+	}
+
+	serve := func(query string) (int, *client.CollisionsResponse) {
+		w := httptest.NewRecorder()
+		s.serveCollisions(w, httptest.NewRequest("GET", "/v1/collisions?"+query, nil))
+
+		var resp struct {
+			Ok     bool                       `json:"ok"`
+			Result *client.CollisionsResponse `json:"result"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		return w.Code, resp.Result
+	}
+
+	code, resp := serve("limit=1")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Collisions, 1)
+	assert.Equal(t, "0x00000001", resp.Collisions[0].Hash)
+	assert.Equal(t, "0x00000001", resp.Next)
+
+	code, resp = serve("limit=1&after=0x00000001")
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, resp.Collisions, 1)
+	assert.Equal(t, "0x00000002", resp.Collisions[0].Hash)
+
+	// a cursor which isn't a hash of the type is the client's mistake
+	for _, after := range []string{"nothex", "0x0000000", "0x00000001ff", "00000001"} {
+		code, _ = serve("after=" + after)
+		assert.Equal(t, http.StatusBadRequest, code, after)
+	}
+	code, _ = serve("type=event&after=0x00000001")
+	assert.Equal(t, http.StatusBadRequest, code)
+}
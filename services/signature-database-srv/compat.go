@@ -0,0 +1,347 @@
+package signature_database_srv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/mux"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// compatPageSize matches the page size of 4byte.directory and Etherface
+const compatPageSize = 100
+
+// maxCompatPage bounds how deep clients can page, as every page before it has to be scanned and thrown away
+const maxCompatPage = 1000
+
+var errCompatPageTooLarge = fmt.Errorf("page must be at most %d", maxCompatPage)
+
+// The 4byte.directory api, see https://www.4byte.directory/docs/
+
+type fourByteSignature struct {
+	ID             int64  `json:"id"`
+	CreatedAt      string `json:"created_at"`
+	TextSignature  string `json:"text_signature"`
+	HexSignature   string `json:"hex_signature"`
+	BytesSignature string `json:"bytes_signature"`
+}
+
+type fourBytePage struct {
+	Count    int                  `json:"count"`
+	Next     *string              `json:"next"`
+	Previous *string              `json:"previous"`
+	Results  []*fourByteSignature `json:"results"`
+}
+
+// The Etherface api, see https://www.etherface.io/api-documentation
+
+type etherfaceSignature struct {
+	ID      int64  `json:"id"`
+	Text    string `json:"text"`
+	Hash    string `json:"hash"`
+	Kind    string `json:"kind"`
+	IsValid bool   `json:"is_valid"`
+}
+
+type etherfacePage struct {
+	TotalPages int                   `json:"total_pages"`
+	Items      []*etherfaceSignature `json:"items"`
+}
+
+// compatFail writes an error in the shape django rest framework, and so 4byte.directory, uses
+func compatFail(w http.ResponseWriter, status int, err error, msg string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	log.WithError(err).Errorf(msg)
+	json.NewEncoder(w).Encode(map[string]any{
+		"detail": msg,
+	})
+}
+
+func compatSucceed(w http.ResponseWriter, result any) {
+	w.Header().Set("Content-Type", "application/json")
+
+	json.NewEncoder(w).Encode(result)
+}
+
+// filterEntries applies the same filtering as filterResponse, dropping quarantined entries and entries which
+// aren't the expected signature for their hash
+func (s *Service) filterEntries(typ client.SignatureType, entries []*database.SignatureEntry, shouldFilter bool) []*database.SignatureEntry {
+	if !shouldFilter {
+		return entries
+	}
+
+	result := []*database.SignatureEntry{}
+	for _, entry := range entries {
+		if entry.Quarantined {
+			continue
+		}
+
+		if expected, ok := s.expectedSignature(typ, hexutil.Encode(entry.Hash)); ok && expected != entry.Name {
+			continue
+		}
+
+		result = append(result, entry)
+	}
+	return result
+}
+
+func parseCompatPage(page string) (int, error) {
+	if page == "" {
+		return 1, nil
+	}
+
+	v, err := strconv.Atoi(page)
+	if err != nil || v <= 0 {
+		return 0, fmt.Errorf("invalid page")
+	}
+	if v > maxCompatPage {
+		return 0, errCompatPageTooLarge
+	}
+	return v, nil
+}
+
+// decodeCompatHash decodes a hash which may or may not be 0x-prefixed, checking it has the length of typ
+func decodeCompatHash(typ client.SignatureType, hash string) ([]byte, error) {
+	b, err := hexutil.Decode("0x" + strings.TrimPrefix(strings.ToLower(hash), "0x"))
+	if err != nil || len(b) != signatureLens[typ] {
+		return nil, fmt.Errorf("invalid hash")
+	}
+	return b, nil
+}
+
+// findCompatEntries looks up a page of signatures either by hash or, if hash is empty, by query. It returns the
+// entries on the page, along with the total number of matches if it is known or the number of matches up to and
+// including the next page if it isn't.
+func (s *Service) findCompatEntries(typ client.SignatureType, hash string, query string, page int, shouldFilter bool) ([]*database.SignatureEntry, int, error) {
+	offset := (page - 1) * compatPageSize
+
+	if hash != "" {
+		b, err := decodeCompatHash(typ, hash)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		entries, err := s.db.LoadSignatureEntries(typ, b)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		entries = s.filterEntries(typ, entries, shouldFilter)
+		total := len(entries)
+
+		if offset >= len(entries) {
+			return []*database.SignatureEntry{}, total, nil
+		}
+		entries = entries[offset:]
+		if len(entries) > compatPageSize {
+			entries = entries[:compatPageSize]
+		}
+		return entries, total, nil
+	}
+
+	// the signatures which aren't expected for their hash are filtered by the query, so that pages stay full
+	var expected map[string]string
+	if shouldFilter {
+		expected = s.expectedSignatures(typ)
+	}
+
+	// fetch one extra entry to find out whether there is another page, counting every match would mean scanning
+	// the whole table
+	entries, err := s.db.SearchSignatureEntries(typ, query, expected, offset, compatPageSize+1)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	total := offset + len(entries)
+	if len(entries) > compatPageSize {
+		entries = entries[:compatPageSize]
+	}
+
+	return entries, total, nil
+}
+
+// compatPageURL returns the absolute url of the given page of the current request
+func compatPageURL(r *http.Request, page int) *string {
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+
+	query := r.URL.Query()
+	if page == 1 {
+		query.Del("page")
+	} else {
+		query.Set("page", strconv.Itoa(page))
+	}
+
+	u := url.URL{
+		Scheme:   scheme,
+		Host:     r.Host,
+		Path:     r.URL.Path,
+		RawQuery: query.Encode(),
+	}
+	result := u.String()
+	return &result
+}
+
+// bytesSignature renders the raw hash as a string with one code point per byte, the way 4byte.directory does
+func bytesSignature(hash []byte) string {
+	runes := make([]rune, len(hash))
+	for i, b := range hash {
+		runes[i] = rune(b)
+	}
+	return string(runes)
+}
+
+func (s *Service) serveFourByte(typ client.SignatureType) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		shouldFilter := !params.Has("filter") || params.Get("filter") != "false"
+
+		page, err := parseCompatPage(params.Get("page"))
+		if errors.Is(err, errCompatPageTooLarge) {
+			compatFail(w, http.StatusBadRequest, err, err.Error())
+			return
+		} else if err != nil {
+			compatFail(w, http.StatusNotFound, err, "Invalid page.")
+			return
+		}
+
+		// text_signature is an exact match unless it contains wildcards, the icontains variant is case-sensitive
+		// here as names are matched with LIKE
+		query := params.Get("text_signature")
+		if contains := params.Get("text_signature__icontains"); contains != "" {
+			query = "*" + contains + "*"
+		}
+
+		entries, total, err := s.findCompatEntries(typ, params.Get("hex_signature"), query, page, shouldFilter)
+		if err != nil {
+			compatFail(w, http.StatusBadRequest, err, err.Error())
+			return
+		}
+
+		response := &fourBytePage{
+			Count:   total,
+			Results: []*fourByteSignature{},
+		}
+		if total > page*compatPageSize {
+			response.Next = compatPageURL(r, page+1)
+		}
+		if page > 1 {
+			response.Previous = compatPageURL(r, page-1)
+		}
+
+		for _, entry := range entries {
+			response.Results = append(response.Results, &fourByteSignature{
+				ID:             entry.ID,
+				CreatedAt:      entry.CreatedAt.UTC().Format(time.RFC3339Nano),
+				TextSignature:  entry.Name,
+				HexSignature:   hexutil.Encode(entry.Hash),
+				BytesSignature: bytesSignature(entry.Hash),
+			})
+		}
+
+		compatSucceed(w, response)
+	}
+}
+
+// etherfaceTypes maps each Etherface kind to the signature types it covers
+var etherfaceTypes = map[string][]client.SignatureType{
+	"all":      {client.SignatureTypeFunction, client.SignatureTypeEvent},
+	"function": {client.SignatureTypeFunction},
+	"event":    {client.SignatureTypeEvent},
+	"error":    {client.SignatureTypeError},
+}
+
+func (s *Service) serveEtherface(byHash bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		params := r.URL.Query()
+		shouldFilter := !params.Has("filter") || params.Get("filter") != "false"
+
+		types, ok := etherfaceTypes[vars["kind"]]
+		if !ok {
+			compatFail(w, http.StatusBadRequest, nil, "invalid kind")
+			return
+		}
+
+		page, err := parseCompatPage(vars["page"])
+		if err != nil {
+			compatFail(w, http.StatusBadRequest, err, err.Error())
+			return
+		}
+
+		response := &etherfacePage{
+			Items: []*etherfaceSignature{},
+		}
+
+		for _, typ := range types {
+			var entries []*database.SignatureEntry
+			var total int
+			if byHash {
+				hash := strings.TrimPrefix(strings.ToLower(vars["query"]), "0x")
+				// a hash can only belong to the types of its length
+				if len(hash) != signatureLens[typ]*2 {
+					continue
+				}
+				entries, total, err = s.findCompatEntries(typ, hash, "", page, shouldFilter)
+			} else {
+				entries, total, err = s.findCompatEntries(typ, "", "*"+vars["query"]+"*", page, shouldFilter)
+			}
+			if err != nil {
+				compatFail(w, http.StatusBadRequest, err, err.Error())
+				return
+			}
+
+			if pages := (total + compatPageSize - 1) / compatPageSize; pages > response.TotalPages {
+				response.TotalPages = pages
+			}
+
+			kind := string(typ)
+			for _, entry := range entries {
+				response.Items = append(response.Items, &etherfaceSignature{
+					ID:      entry.ID,
+					Text:    entry.Name,
+					Hash:    hexutil.Encode(crypto.Keccak256([]byte(entry.Name)))[2:],
+					Kind:    kind,
+					IsValid: true,
+				})
+			}
+		}
+
+		compatSucceed(w, response)
+	}
+}
+
+// registerCompatRoutes mounts the 4byte.directory and Etherface compatible apis, so that existing tools can be
+// pointed at this service
+func (s *Service) registerCompatRoutes(m *mux.Router) {
+	for _, route := range []struct {
+		path string
+		typ  client.SignatureType
+	}{
+		{"/api/v1/signatures/", client.SignatureTypeFunction},
+		{"/api/v1/event-signatures/", client.SignatureTypeEvent},
+	} {
+		handler := s.guard(client.APIKeyScopeRead, false, s.serveFourByte(route.typ))
+		m.HandleFunc(route.path, handler).Methods("GET")
+		m.HandleFunc(strings.TrimSuffix(route.path, "/"), handler).Methods("GET")
+	}
+
+	m.HandleFunc("/etherface/v1/signatures/hash/{kind}/{query}/{page}", s.guardLookup(s.serveEtherface(true))).Methods("GET")
+	m.HandleFunc("/etherface/v1/signatures/text/{kind}/{query}/{page}", s.guard(client.APIKeyScopeRead, false, s.serveEtherface(false))).Methods("GET")
+}
@@ -0,0 +1,107 @@
+package signature_database_srv
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBytesSignature(t *testing.T) {
+	assert.Equal(t, "©\u0005\u009c»", bytesSignature([]byte{0xa9, 0x05, 0x9c, 0xbb}))
+}
+
+func TestCompatPageURL(t *testing.T) {
+	r := httptest.NewRequest("GET", "http://example.com/api/v1/signatures/?hex_signature=0xa9059cbb&page=2", nil)
+
+	assert.Equal(t, "http://example.com/api/v1/signatures/?hex_signature=0xa9059cbb&page=3", *compatPageURL(r, 3))
+	assert.Equal(t, "http://example.com/api/v1/signatures/?hex_signature=0xa9059cbb", *compatPageURL(r, 1))
+
+	r.Header.Set("X-Forwarded-Proto", "https")
+	assert.Equal(t, "https://example.com/api/v1/signatures/?hex_signature=0xa9059cbb&page=3", *compatPageURL(r, 3))
+}
+
+func TestParseCompatPage(t *testing.T) {
+	page, err := parseCompatPage("")
+	require.NoError(t, err)
+	assert.Equal(t, 1, page)
+
+	page, err = parseCompatPage(fmt.Sprint(maxCompatPage))
+	require.NoError(t, err)
+	assert.Equal(t, maxCompatPage, page)
+
+	for _, page := range []string{"0", "-1", "a"} {
+		_, err = parseCompatPage(page)
+		assert.Error(t, err)
+	}
+
+	// huge pages would overflow the offset
+	_, err = parseCompatPage("9223372036854775807")
+	assert.ErrorIs(t, err, errCompatPageTooLarge)
+}
+
+func TestDecodeCompatHash(t *testing.T) {
+	for _, hash := range []string{"0xa9059cbb", "a9059cbb", "0xA9059CBB"} {
+		b, err := decodeCompatHash("function", hash)
+		assert.NoError(t, err)
+		assert.Equal(t, []byte{0xa9, 0x05, 0x9c, 0xbb}, b)
+	}
+
+	_, err := decodeCompatHash("event", "0xa9059cbb")
+	assert.Error(t, err)
+}
+
+func TestFindCompatEntriesFiltered(t *testing.T) {
+	db, err := database.NewBolt(filepath.Join(t.TempDir(), "signatures.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// a page worth of collisions comes first, all but one of which is filtered out
+	collision := []byte{0x12, 0x34, 0x56, 0x78}
+	var collisions []string
+	var hashes [][]byte
+	for i := 0; i < 150; i++ {
+		collisions = append(collisions, fmt.Sprintf("a%03d()", i))
+		hashes = append(hashes, collision)
+	}
+	_, err = db.BulkImportSignatures(client.SignatureTypeFunction, collisions, hashes)
+	require.NoError(t, err)
+
+	var names []string
+	for i := 0; i < 150; i++ {
+		names = append(names, fmt.Sprintf("b%03d()", i))
+	}
+	_, err = db.SaveSignatures(client.SignatureTypeFunction, names)
+	require.NoError(t, err)
+
+	s := &Service{
+		config:              &Config{},
+		db:                  db,
+		preferredSignatures: make(client.AllTypes[map[string]string]),
+		canonicalSignatures: map[string]string{hexutil.Encode(collision): "a000()"},
+	}
+
+	entries, total, err := s.findCompatEntries(client.SignatureTypeFunction, "", "", 1, true)
+	require.NoError(t, err)
+	require.Len(t, entries, compatPageSize)
+	assert.Equal(t, "a000()", entries[0].Name)
+	assert.Equal(t, "b000()", entries[1].Name)
+	assert.Equal(t, compatPageSize+1, total)
+
+	entries, total, err = s.findCompatEntries(client.SignatureTypeFunction, "", "", 2, true)
+	require.NoError(t, err)
+	require.Len(t, entries, 51)
+	assert.Equal(t, "b099()", entries[0].Name)
+	assert.Equal(t, 151, total)
+
+	// without filtering the collisions are returned too
+	entries, _, err = s.findCompatEntries(client.SignatureTypeFunction, "", "", 1, false)
+	require.NoError(t, err)
+	assert.Equal(t, "a001()", entries[1].Name)
+}
@@ -0,0 +1,83 @@
+package signature_database_srv
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/ethclient"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/evm"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"net/http"
+	"time"
+)
+
+func (s *Service) getEthClient(chain string) (*ethclient.Client, error) {
+	s.ethClientsLock.Lock()
+	defer s.ethClientsLock.Unlock()
+
+	if c, ok := s.ethClients[chain]; ok {
+		return c, nil
+	}
+
+	url, ok := s.config.RPCEndpoints[chain]
+	if !ok {
+		return nil, fmt.Errorf("unsupported chain: %s", chain)
+	}
+
+	c, err := ethclient.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", chain, err)
+	}
+
+	s.ethClients[chain] = c
+	return c, nil
+}
+
+func (s *Service) serveContractSelectors(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	chain := vars["chain"]
+	address := vars["address"]
+
+	params := r.URL.Query()
+	shouldFilter := !params.Has("filter") || params.Get("filter") != "false"
+
+	if !common.IsHexAddress(address) {
+		fail(w, http.StatusBadRequest, nil, "invalid address")
+		return
+	}
+
+	c, err := s.getEthClient(chain)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err, "unsupported chain")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+	defer cancel()
+
+	code, err := c.CodeAt(ctx, common.HexToAddress(address), nil)
+	if err != nil {
+		fail(w, http.StatusBadGateway, err, "failed to fetch code")
+		return
+	}
+
+	response := client.NewSignatureResponse()
+
+	selectors := evm.ExtractSelectors(code)
+	if len(selectors) > 0 {
+		response[client.SignatureTypeFunction], err = s.db.LoadSignatures(client.SignatureTypeFunction, selectors)
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err, "failed to load signatures")
+			return
+		}
+	}
+
+	s.filterResponse(response, shouldFilter)
+
+	succeed(w, &client.ContractSelectorsResponse{
+		Chain:     chain,
+		Address:   common.HexToAddress(address).Hex(),
+		Selectors: response[client.SignatureTypeFunction],
+	})
+}
@@ -0,0 +1,119 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/jackc/pgx/v5"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/database"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"time"
+)
+
+const apiKeyColumns = `id, name, scopes, created_at, last_used_at, requests, rate_limited`
+
+func scanAPIKey(rows pgx.Rows) (*client.APIKey, error) {
+	var (
+		key    client.APIKey
+		scopes []string
+	)
+	if err := rows.Scan(&key.ID, &key.Name, &scopes, &key.CreatedAt, &key.LastUsedAt, &key.Requests, &key.RateLimited); err != nil {
+		return nil, fmt.Errorf("failed to scan: %w", err)
+	}
+
+	for _, scope := range scopes {
+		key.Scopes = append(key.Scopes, client.APIKeyScope(scope))
+	}
+
+	return &key, nil
+}
+
+// CreateAPIKey stores a new key, identified by the sha256 of its secret
+func (d *Database) CreateAPIKey(name string, keyHash []byte, scopes []client.APIKeyScope) (*client.APIKey, error) {
+	var scopeNames []string
+	for _, scope := range scopes {
+		scopeNames = append(scopeNames, string(scope))
+	}
+
+	var result *client.APIKey
+	if err := d.db.QuerySimpleOne(func(rows pgx.Rows) error {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return err
+		}
+		result = key
+		return nil
+	}, `INSERT INTO api_keys (key_hash, name, scopes) VALUES ($1, $2, $3) RETURNING `+apiKeyColumns, keyHash, name, scopeNames); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// LoadAPIKey finds the key with the given hash, returning nil if there is none
+func (d *Database) LoadAPIKey(keyHash []byte) (*client.APIKey, error) {
+	var result *client.APIKey
+	if err := d.db.QuerySimpleOne(func(rows pgx.Rows) error {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return err
+		}
+		result = key
+		return nil
+	}, `SELECT `+apiKeyColumns+` FROM api_keys WHERE key_hash = $1`, keyHash); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *Database) ListAPIKeys() ([]*client.APIKey, error) {
+	result := []*client.APIKey{}
+	if err := d.db.QuerySimple(func(rows pgx.Rows) error {
+		for rows.Next() {
+			key, err := scanAPIKey(rows)
+			if err != nil {
+				return err
+			}
+			result = append(result, key)
+		}
+		return nil
+	}, `SELECT `+apiKeyColumns+` FROM api_keys ORDER BY id`); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// DeleteAPIKey revokes the key with the given id, returning false if there was no such key
+func (d *Database) DeleteAPIKey(id int) (bool, error) {
+	res, err := d.db.Exec(context.Background(), `DELETE FROM api_keys WHERE id = $1`, id)
+	if err != nil {
+		return false, err
+	}
+	return res.RowsAffected() > 0, nil
+}
+
+// APIKeyUsage is the usage of a single key accumulated since it was last recorded
+type APIKeyUsage struct {
+	Requests    int64
+	RateLimited int64
+	LastUsedAt  time.Time
+}
+
+// RecordAPIKeyUsage adds the given usage, keyed by key id, to the stored counters
+func (d *Database) RecordAPIKeyUsage(usage map[int]*APIKeyUsage) error {
+	return d.db.ExecTx(func(tx *database.Tx) error {
+		return tx.ExecBatch(func(stmt *database.Stmt) error {
+			for id, u := range usage {
+				if _, err := stmt.Exec(context.Background(), id, u.Requests, u.RateLimited, u.LastUsedAt); err != nil {
+					return fmt.Errorf("failed to update: %w", err)
+				}
+			}
+			return nil
+		}, `UPDATE api_keys SET requests = requests + $2, rate_limited = rate_limited + $3, last_used_at = GREATEST(last_used_at, $4) WHERE id = $1`)
+	})
+}
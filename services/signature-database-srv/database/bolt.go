@@ -0,0 +1,1358 @@
+package database
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	bolt "go.etcd.io/bbolt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// The layout of the bolt file. Every signature type has its own set of buckets:
+//
+//	signatures/<type>  hash || name -> boltSignature
+//	names/<type>       name -> hash
+//	ids/<type>         id -> hash || name
+//	preferred/<type>   hash -> name
+//	guesses/<type>     hash -> boltGuessTask
+//	stats/<type>       bucket || hash -> SelectorCounts
+//	popularity/<type>  hash -> the lookups of all stats of the hash
+//
+// and api keys and changes are kept in:
+//
+//	api_keys           key hash -> client.APIKey
+//	api_key_ids        id -> key hash
+//	changes            sequence -> boltChange
+const (
+	boltSignatures = "signatures"
+	boltNames      = "names"
+	boltIDs        = "ids"
+	boltPreferred  = "preferred"
+	boltGuesses    = "guesses"
+	boltStats      = "stats"
+	boltPopularity = "popularity"
+	boltAPIKeys    = "api_keys"
+	boltAPIKeyIDs  = "api_key_ids"
+	boltChanges    = "changes"
+)
+
+type boltSignature struct {
+	ID          uint64    `json:"id"`
+	CreatedAt   time.Time `json:"created_at"`
+	Quarantined bool      `json:"quarantined,omitempty"`
+	FlagReason  string    `json:"flag_reason,omitempty"`
+	Source      string    `json:"source,omitempty"`
+}
+
+type boltChange struct {
+	Type      client.SignatureType `json:"type"`
+	Name      string               `json:"name"`
+	Hash      []byte               `json:"hash"`
+	Removed   bool                 `json:"removed,omitempty"`
+	ChangedAt time.Time            `json:"changed_at"`
+}
+
+// BoltDatabase stores signatures in a single local file, so the service can be run without Postgres. Searches
+// scan signatures until they've found enough matches, which is fine for the amount of data kept locally but not for
+// a public deployment.
+type BoltDatabase struct {
+	db *bolt.DB
+}
+
+func NewBolt(path string) (*BoltDatabase, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database: %w", err)
+	}
+
+	if err := db.Update(func(tx *bolt.Tx) error {
+		for _, typ := range client.SignatureTypes() {
+			// files written before popularity was rolled up need it computed from the stats they already have
+			rollUp := tx.Bucket(boltBucketName(boltPopularity, typ)) == nil
+
+			for _, kind := range []string{boltSignatures, boltNames, boltIDs, boltPreferred, boltGuesses, boltStats, boltPopularity} {
+				if _, err := tx.CreateBucketIfNotExists(boltBucketName(kind, typ)); err != nil {
+					return err
+				}
+			}
+
+			if rollUp {
+				if err := rollUpPopularity(tx, typ); err != nil {
+					return err
+				}
+			}
+		}
+		for _, name := range []string{boltAPIKeys, boltAPIKeyIDs, boltChanges} {
+			if _, err := tx.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create buckets: %w", err)
+	}
+
+	return &BoltDatabase{db: db}, nil
+}
+
+func (d *BoltDatabase) Close() error {
+	return d.db.Close()
+}
+
+// storageType returns the type whose buckets hold signatures of typ, errors share the buckets of functions
+func storageType(typ client.SignatureType) client.SignatureType {
+	if typ == client.SignatureTypeError {
+		return client.SignatureTypeFunction
+	}
+	return typ
+}
+
+func boltBucketName(kind string, typ client.SignatureType) []byte {
+	return []byte(fmt.Sprintf("%s/%s", kind, typ))
+}
+
+// boltBucket returns the bucket of the given kind for typ, or nil if typ isn't stored
+func boltBucket(tx *bolt.Tx, kind string, typ client.SignatureType) *bolt.Bucket {
+	return tx.Bucket(boltBucketName(kind, typ))
+}
+
+func itob(v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return b
+}
+
+func signatureKey(hash []byte, name string) []byte {
+	key := make([]byte, 0, len(hash)+len(name))
+	key = append(key, hash...)
+	return append(key, name...)
+}
+
+// splitSignatureKey splits a key of the signatures bucket into its hash and name
+func splitSignatureKey(typ client.SignatureType, key []byte) ([]byte, string) {
+	length := signatureLens[storageType(typ)]
+	return append([]byte{}, key[:length]...), string(key[length:])
+}
+
+func getSignature(b *bolt.Bucket, key []byte) (*boltSignature, error) {
+	value := b.Get(key)
+	if value == nil {
+		return nil, nil
+	}
+
+	var sig boltSignature
+	if err := json.Unmarshal(value, &sig); err != nil {
+		return nil, fmt.Errorf("failed to decode signature: %w", err)
+	}
+	return &sig, nil
+}
+
+func putSignature(b *bolt.Bucket, key []byte, sig *boltSignature) error {
+	value, err := json.Marshal(sig)
+	if err != nil {
+		return err
+	}
+	return b.Put(key, value)
+}
+
+// queryRegexp converts a query with '*' and '?' wildcards into the equivalent regular expression
+func queryRegexp(query string) (*regexp.Regexp, error) {
+	if !isValidQuery(query) {
+		return nil, fmt.Errorf("invalid query: %s", query)
+	}
+
+	var pattern strings.Builder
+	pattern.WriteString("^")
+	for _, r := range query {
+		switch r {
+		case '*':
+			pattern.WriteString(".*")
+		case '?':
+			pattern.WriteString(".")
+		default:
+			pattern.WriteString(regexp.QuoteMeta(string(r)))
+		}
+	}
+	pattern.WriteString("$")
+
+	return regexp.Compile(pattern.String())
+}
+
+// recordChange records a change to the exported signatures. Bolt only allows one writer at a time, so the changes
+// are in the order they were committed.
+func recordChange(tx *bolt.Tx, typ client.SignatureType, name string, hash []byte, removed bool) error {
+	changes := tx.Bucket([]byte(boltChanges))
+	seq, err := changes.NextSequence()
+	if err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(&boltChange{
+		Type:      typ,
+		Name:      name,
+		Hash:      hash,
+		Removed:   removed,
+		ChangedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return err
+	}
+	return changes.Put(itob(seq), value)
+}
+
+// insertSignature stores the signature unless it already exists, returning whether it was stored
+func insertSignature(tx *bolt.Tx, typ client.SignatureType, name string, hash []byte, source string) (bool, error) {
+	names := boltBucket(tx, boltNames, typ)
+	if names.Get([]byte(name)) != nil {
+		return false, nil
+	}
+
+	ids := boltBucket(tx, boltIDs, typ)
+	id, err := ids.NextSequence()
+	if err != nil {
+		return false, err
+	}
+
+	key := signatureKey(hash, name)
+	if err := putSignature(boltBucket(tx, boltSignatures, typ), key, &boltSignature{
+		ID:        id,
+		CreatedAt: time.Now().UTC(),
+		Source:    source,
+	}); err != nil {
+		return false, err
+	}
+	if err := names.Put([]byte(name), hash); err != nil {
+		return false, err
+	}
+	if err := ids.Put(itob(id), key); err != nil {
+		return false, err
+	}
+	if err := recordChange(tx, typ, name, hash, false); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (d *BoltDatabase) SaveSignatures(typ client.SignatureType, names []string) (*client.ImportResponseDetails, error) {
+	return d.SaveSignaturesWithSource(typ, names, "")
+}
+
+func (d *BoltDatabase) SaveSignaturesWithSource(typ client.SignatureType, names []string, source string) (*client.ImportResponseDetails, error) {
+	result := client.NewImportResponseDetails()
+
+	if err := d.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range names {
+			sig := crypto.Keccak256([]byte(name))[:signatureLens[typ]]
+
+			inserted, err := insertSignature(tx, typ, name, sig, source)
+			if err != nil {
+				return fmt.Errorf("failed to insert: %w", err)
+			}
+
+			if inserted {
+				result.Imported[name] = hexutil.Encode(sig)
+			} else {
+				result.Duplicated[name] = hexutil.Encode(sig)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *BoltDatabase) BulkImportSignatures(typ client.SignatureType, names []string, hashes [][]byte) (int64, error) {
+	if len(names) != len(hashes) {
+		return 0, fmt.Errorf("got %d names but %d hashes", len(names), len(hashes))
+	}
+
+	var imported int64
+	if err := d.db.Update(func(tx *bolt.Tx) error {
+		for i := range names {
+			inserted, err := insertSignature(tx, typ, names[i], hashes[i], "")
+			if err != nil {
+				return fmt.Errorf("failed to insert: %w", err)
+			}
+			if inserted {
+				imported++
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+
+	return imported, nil
+}
+
+func (d *BoltDatabase) LoadSignatures(typ client.SignatureType, sels []string) (map[string][]*client.SignatureData, error) {
+	result := make(map[string][]*client.SignatureData)
+
+	var arr [][]byte
+	for _, sel := range sels {
+		b, err := hexutil.Decode(sel)
+		if err != nil {
+			return nil, err
+		}
+		arr = append(arr, b)
+	}
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		c := boltBucket(tx, boltSignatures, storageType(typ)).Cursor()
+		for _, sel := range arr {
+			for k, v := c.Seek(sel); k != nil && bytes.HasPrefix(k, sel); k, v = c.Next() {
+				hash, name := splitSignatureKey(typ, k)
+				if !bytes.Equal(hash, sel) {
+					continue
+				}
+
+				var sig boltSignature
+				if err := json.Unmarshal(v, &sig); err != nil {
+					return fmt.Errorf("failed to decode signature: %w", err)
+				}
+
+				h := hexutil.Encode(hash)
+				result[h] = append(result[h], &client.SignatureData{
+					Name:        name,
+					Quarantined: sig.Quarantined,
+					FlagReason:  sig.FlagReason,
+					Source:      sig.Source,
+				})
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	for _, v := range sels {
+		if _, ok := result[v]; !ok {
+			result[v] = []*client.SignatureData{}
+		}
+	}
+
+	return result, nil
+}
+
+func (d *BoltDatabase) QuerySignatures(query string) (map[client.SignatureType]map[string][]*client.SignatureData, error) {
+	re, err := queryRegexp(query)
+	if err != nil {
+		return nil, err
+	}
+
+	type match struct {
+		hash    []byte
+		lookups int64
+		data    *client.SignatureData
+	}
+
+	result := make(map[client.SignatureType]map[string][]*client.SignatureData)
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		for _, typ := range client.SignatureTypes() {
+			result[typ] = make(map[string][]*client.SignatureData)
+
+			sigs := boltBucket(tx, boltSignatures, typ)
+			popularity := boltBucket(tx, boltPopularity, storageType(typ))
+
+			var matches []*match
+			c := boltBucket(tx, boltNames, typ).Cursor()
+			for k, v := c.First(); k != nil && len(matches) < searchCandidates; k, v = c.Next() {
+				if !re.Match(k) {
+					continue
+				}
+
+				sig, err := getSignature(sigs, signatureKey(v, string(k)))
+				if err != nil {
+					return err
+				}
+				if sig == nil {
+					continue
+				}
+
+				matches = append(matches, &match{
+					hash:    append([]byte{}, v...),
+					lookups: getPopularity(popularity, v),
+					data: &client.SignatureData{
+						Name:        string(k),
+						Quarantined: sig.Quarantined,
+						FlagReason:  sig.FlagReason,
+						Source:      sig.Source,
+					},
+				})
+			}
+
+			// the most looked up matches come first, like the postgres backend
+			sort.SliceStable(matches, func(i, j int) bool {
+				return matches[i].lookups > matches[j].lookups
+			})
+
+			if len(matches) > searchLimit {
+				matches = matches[:searchLimit]
+			}
+			for _, m := range matches {
+				h := hexutil.Encode(m.hash)
+				result[typ][h] = append(result[typ][h], m.data)
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *BoltDatabase) CountSignatures(typ client.SignatureType) (int, error) {
+	var count int
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		count = boltBucket(tx, boltNames, typ).Stats().KeyN
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (d *BoltDatabase) ExportData(w io.Writer) error {
+	return exportData(d, w)
+}
+
+func (d *BoltDatabase) ExportSignatures(typ client.SignatureType, apply func(name string, hash []byte, createdAt time.Time) error) error {
+	type entry struct {
+		name      string
+		hash      []byte
+		createdAt time.Time
+	}
+
+	var entries []*entry
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		return boltBucket(tx, boltSignatures, typ).ForEach(func(k, v []byte) error {
+			var sig boltSignature
+			if err := json.Unmarshal(v, &sig); err != nil {
+				return fmt.Errorf("failed to decode signature: %w", err)
+			}
+
+			if sig.Quarantined {
+				return nil
+			}
+
+			hash, name := splitSignatureKey(typ, k)
+			entries = append(entries, &entry{name: name, hash: hash, createdAt: sig.CreatedAt})
+			return nil
+		})
+	}); err != nil {
+		return err
+	}
+
+	// the buckets are already ordered by hash
+	for _, e := range entries {
+		if err := apply(e.name, e.hash, e.createdAt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExportCursor returns the sequence of the last change
+func (d *BoltDatabase) ExportCursor() (uint64, error) {
+	var cursor uint64
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		cursor = tx.Bucket([]byte(boltChanges)).Sequence()
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return cursor, nil
+}
+
+// ExportCursorAt returns the sequence of the last change made before t
+func (d *BoltDatabase) ExportCursorAt(t time.Time) (uint64, error) {
+	var cursor uint64
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		// changes are appended as they're made, so the most recent ones are at the end
+		c := tx.Bucket([]byte(boltChanges)).Cursor()
+		for k, v := c.Last(); k != nil; k, v = c.Prev() {
+			var change boltChange
+			if err := json.Unmarshal(v, &change); err != nil {
+				return fmt.Errorf("failed to decode change: %w", err)
+			}
+			if change.ChangedAt.Before(t) {
+				cursor = binary.BigEndian.Uint64(k)
+				return nil
+			}
+		}
+		return nil
+	}); err != nil {
+		return 0, err
+	}
+	return cursor, nil
+}
+
+// ExportChanges calls apply for every change after since, up to and including until
+func (d *BoltDatabase) ExportChanges(typ client.SignatureType, since uint64, until uint64, apply func(change *SignatureChange) error) error {
+	var changes []*SignatureChange
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket([]byte(boltChanges)).Cursor()
+		for k, v := c.Seek(itob(since + 1)); k != nil && binary.BigEndian.Uint64(k) <= until; k, v = c.Next() {
+			var change boltChange
+			if err := json.Unmarshal(v, &change); err != nil {
+				return fmt.Errorf("failed to decode change: %w", err)
+			}
+			if change.Type != typ {
+				continue
+			}
+
+			changes = append(changes, &SignatureChange{
+				Name:      change.Name,
+				Hash:      change.Hash,
+				Removed:   change.Removed,
+				ChangedAt: change.ChangedAt,
+			})
+		}
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	for _, change := range changes {
+		if err := apply(change); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (d *BoltDatabase) ListCollisions(typ client.SignatureType, after string, limit int) (map[string][]*client.SignatureData, []string, error) {
+	afterBytes := []byte{}
+	if after != "" {
+		b, err := hexutil.Decode(after)
+		if err != nil {
+			return nil, nil, err
+		}
+		afterBytes = b
+	}
+
+	result := make(map[string][]*client.SignatureData)
+	var order []string
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		var (
+			current []byte
+			group   []*client.SignatureData
+		)
+		flush := func() {
+			if len(group) > 1 {
+				h := hexutil.Encode(current)
+				order = append(order, h)
+				result[h] = group
+			}
+			group = nil
+		}
+
+		c := boltBucket(tx, boltSignatures, typ).Cursor()
+		for k, v := c.Seek(afterBytes); k != nil && len(order) < limit; k, v = c.Next() {
+			hash, name := splitSignatureKey(typ, k)
+			if after != "" && bytes.Equal(hash, afterBytes) {
+				continue
+			}
+
+			if !bytes.Equal(hash, current) {
+				flush()
+				current = hash
+			}
+
+			var sig boltSignature
+			if err := json.Unmarshal(v, &sig); err != nil {
+				return fmt.Errorf("failed to decode signature: %w", err)
+			}
+
+			group = append(group, &client.SignatureData{
+				Name:        name,
+				Quarantined: sig.Quarantined,
+			})
+		}
+		if len(order) < limit {
+			flush()
+		}
+		return nil
+	}); err != nil {
+		return nil, nil, err
+	}
+
+	return result, order, nil
+}
+
+func (d *BoltDatabase) LoadPreferredSignatures(typ client.SignatureType) (map[string]string, error) {
+	result := make(map[string]string)
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		b := boltBucket(tx, boltPreferred, typ)
+		if b == nil {
+			return nil
+		}
+		return b.ForEach(func(k, v []byte) error {
+			result[hexutil.Encode(k)] = string(v)
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *BoltDatabase) SetPreferredSignature(typ client.SignatureType, name string) error {
+	sig := crypto.Keccak256([]byte(name))[:signatureLens[typ]]
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return boltBucket(tx, boltPreferred, typ).Put(sig, []byte(name))
+	})
+}
+
+func (d *BoltDatabase) DeletePreferredSignature(typ client.SignatureType, hash string) error {
+	sel, err := hexutil.Decode(hash)
+	if err != nil {
+		return err
+	}
+
+	return d.db.Update(func(tx *bolt.Tx) error {
+		return boltBucket(tx, boltPreferred, typ).Delete(sel)
+	})
+}
+
+func (d *BoltDatabase) DeleteSignatures(typ client.SignatureType, names []string) ([]string, error) {
+	deleted := []string{}
+
+	if err := d.db.Update(func(tx *bolt.Tx) error {
+		sigs := boltBucket(tx, boltSignatures, typ)
+		namesBucket := boltBucket(tx, boltNames, typ)
+		ids := boltBucket(tx, boltIDs, typ)
+		preferred := boltBucket(tx, boltPreferred, typ)
+
+		for _, name := range names {
+			hash := namesBucket.Get([]byte(name))
+			if hash == nil {
+				continue
+			}
+			hash = append([]byte{}, hash...)
+
+			key := signatureKey(hash, name)
+			sig, err := getSignature(sigs, key)
+			if err != nil {
+				return err
+			}
+
+			if sig != nil {
+				if err := ids.Delete(itob(sig.ID)); err != nil {
+					return err
+				}
+				if !sig.Quarantined {
+					if err := recordChange(tx, typ, name, hash, true); err != nil {
+						return err
+					}
+				}
+			}
+			if err := sigs.Delete(key); err != nil {
+				return err
+			}
+			if err := namesBucket.Delete([]byte(name)); err != nil {
+				return err
+			}
+			if string(preferred.Get(hash)) == name {
+				if err := preferred.Delete(hash); err != nil {
+					return err
+				}
+			}
+
+			deleted = append(deleted, name)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+func (d *BoltDatabase) SetQuarantined(typ client.SignatureType, names []string, quarantined bool, reason string) ([]string, error) {
+	affected := []string{}
+	if !quarantined {
+		reason = ""
+	}
+
+	if err := d.db.Update(func(tx *bolt.Tx) error {
+		sigs := boltBucket(tx, boltSignatures, typ)
+		namesBucket := boltBucket(tx, boltNames, typ)
+
+		for _, name := range names {
+			hash := namesBucket.Get([]byte(name))
+			if hash == nil {
+				continue
+			}
+
+			key := signatureKey(hash, name)
+			sig, err := getSignature(sigs, key)
+			if err != nil {
+				return err
+			}
+			if sig == nil {
+				continue
+			}
+
+			if sig.Quarantined != quarantined {
+				if err := recordChange(tx, typ, name, hash, quarantined); err != nil {
+					return err
+				}
+			}
+
+			sig.Quarantined = quarantined
+			sig.FlagReason = reason
+			if err := putSignature(sigs, key, sig); err != nil {
+				return err
+			}
+
+			affected = append(affected, name)
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return affected, nil
+}
+
+func (d *BoltDatabase) ListQuarantinedSignatures(typ client.SignatureType, after string, limit int) ([]*client.QuarantinedSignature, error) {
+	result := []*client.QuarantinedSignature{}
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		sigs := boltBucket(tx, boltSignatures, typ)
+
+		c := boltBucket(tx, boltNames, typ).Cursor()
+		for k, v := c.Seek([]byte(after)); k != nil && len(result) < limit; k, v = c.Next() {
+			if string(k) == after {
+				continue
+			}
+
+			sig, err := getSignature(sigs, signatureKey(v, string(k)))
+			if err != nil {
+				return err
+			}
+			if sig == nil || !sig.Quarantined {
+				continue
+			}
+
+			result = append(result, &client.QuarantinedSignature{
+				Hash:       hexutil.Encode(v),
+				Name:       string(k),
+				FlagReason: sig.FlagReason,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *BoltDatabase) LoadSignatureEntries(typ client.SignatureType, hash []byte) ([]*SignatureEntry, error) {
+	var result []*SignatureEntry
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		c := boltBucket(tx, boltSignatures, storageType(typ)).Cursor()
+		for k, v := c.Seek(hash); k != nil && bytes.HasPrefix(k, hash); k, v = c.Next() {
+			entryHash, name := splitSignatureKey(typ, k)
+			if !bytes.Equal(entryHash, hash) {
+				continue
+			}
+
+			var sig boltSignature
+			if err := json.Unmarshal(v, &sig); err != nil {
+				return fmt.Errorf("failed to decode signature: %w", err)
+			}
+
+			result = append(result, &SignatureEntry{
+				ID:          int64(sig.ID),
+				Name:        name,
+				Hash:        entryHash,
+				CreatedAt:   sig.CreatedAt,
+				Quarantined: sig.Quarantined,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].ID < result[j].ID
+	})
+
+	return result, nil
+}
+
+func (d *BoltDatabase) SearchSignatureEntries(typ client.SignatureType, query string, expected map[string]string, offset int, limit int) ([]*SignatureEntry, error) {
+	var re *regexp.Regexp
+	if query != "" {
+		var err error
+		re, err = queryRegexp(query)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var result []*SignatureEntry
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		sigs := boltBucket(tx, boltSignatures, storageType(typ))
+
+		c := boltBucket(tx, boltIDs, storageType(typ)).Cursor()
+		for k, v := c.First(); k != nil && len(result) < limit; k, v = c.Next() {
+			hash, name := splitSignatureKey(typ, v)
+			if re != nil && !re.MatchString(name) {
+				continue
+			}
+
+			sig, err := getSignature(sigs, v)
+			if err != nil {
+				return err
+			}
+			if sig == nil || sig.Quarantined {
+				continue
+			}
+			if want, ok := expected[hexutil.Encode(hash)]; ok && want != name {
+				continue
+			}
+
+			if offset > 0 {
+				offset--
+				continue
+			}
+
+			result = append(result, &SignatureEntry{
+				ID:        int64(sig.ID),
+				Name:      name,
+				Hash:      hash,
+				CreatedAt: sig.CreatedAt,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+type boltGuessTask struct {
+	Status    client.GuessStatus `json:"status"`
+	Name      string             `json:"name,omitempty"`
+	Space     string             `json:"space,omitempty"`
+	Position  int64              `json:"position"`
+	QueuedAt  time.Time          `json:"queued_at"`
+	UpdatedAt time.Time          `json:"updated_at"`
+}
+
+func decodeGuessTask(typ client.SignatureType, hash []byte, value []byte) (*GuessTask, error) {
+	var task boltGuessTask
+	if err := json.Unmarshal(value, &task); err != nil {
+		return nil, fmt.Errorf("failed to decode guess task: %w", err)
+	}
+
+	return &GuessTask{
+		Type:      typ,
+		Hash:      append([]byte{}, hash...),
+		Status:    task.Status,
+		Name:      task.Name,
+		Space:     task.Space,
+		Position:  task.Position,
+		QueuedAt:  task.QueuedAt,
+		UpdatedAt: task.UpdatedAt,
+	}, nil
+}
+
+func (d *BoltDatabase) QueueGuessTasks(typ client.SignatureType, hashes [][]byte) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b := boltBucket(tx, boltGuesses, typ)
+
+		now := time.Now().UTC()
+		for _, hash := range hashes {
+			if b.Get(hash) != nil {
+				continue
+			}
+
+			value, err := json.Marshal(&boltGuessTask{
+				Status:    client.GuessStatusPending,
+				QueuedAt:  now,
+				UpdatedAt: now,
+			})
+			if err != nil {
+				return err
+			}
+			if err := b.Put(hash, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (d *BoltDatabase) LoadGuessTasks(typ client.SignatureType, hashes [][]byte) (map[string]*GuessTask, error) {
+	result := make(map[string]*GuessTask)
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		b := boltBucket(tx, boltGuesses, typ)
+		for _, hash := range hashes {
+			value := b.Get(hash)
+			if value == nil {
+				continue
+			}
+
+			task, err := decodeGuessTask(typ, hash, value)
+			if err != nil {
+				return err
+			}
+			result[hexutil.Encode(hash)] = task
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *BoltDatabase) NextGuessTask() (*GuessTask, error) {
+	var result *GuessTask
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		for _, typ := range []client.SignatureType{client.SignatureTypeFunction, client.SignatureTypeEvent} {
+			if err := boltBucket(tx, boltGuesses, typ).ForEach(func(k, v []byte) error {
+				task, err := decodeGuessTask(typ, k, v)
+				if err != nil {
+					return err
+				}
+
+				if task.Status == client.GuessStatusPending && (result == nil || task.QueuedAt.Before(result.QueuedAt)) {
+					result = task
+				}
+				return nil
+			}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *BoltDatabase) UpdateGuessTask(task *GuessTask) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		b := boltBucket(tx, boltGuesses, task.Type)
+
+		value := b.Get(task.Hash)
+		if value == nil {
+			return nil
+		}
+
+		existing, err := decodeGuessTask(task.Type, task.Hash, value)
+		if err != nil {
+			return err
+		}
+
+		value, err = json.Marshal(&boltGuessTask{
+			Status:    task.Status,
+			Name:      task.Name,
+			Space:     task.Space,
+			Position:  task.Position,
+			QueuedAt:  existing.QueuedAt,
+			UpdatedAt: time.Now().UTC(),
+		})
+		if err != nil {
+			return err
+		}
+		return b.Put(task.Hash, value)
+	})
+}
+
+func (d *BoltDatabase) ListArgumentLists(typ client.SignatureType, limit int) ([]string, error) {
+	counts := make(map[string]int)
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		sigs := boltBucket(tx, boltSignatures, storageType(typ))
+		return sigs.ForEach(func(k, v []byte) error {
+			var sig boltSignature
+			if err := json.Unmarshal(v, &sig); err != nil {
+				return fmt.Errorf("failed to decode signature: %w", err)
+			}
+			if sig.Quarantined {
+				return nil
+			}
+
+			_, name := splitSignatureKey(typ, k)
+			if idx := strings.IndexByte(name, '('); idx >= 0 {
+				counts[name[idx:]]++
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	var result []string
+	for args := range counts {
+		result = append(result, args)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if counts[result[i]] != counts[result[j]] {
+			return counts[result[i]] > counts[result[j]]
+		}
+		return result[i] < result[j]
+	})
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+// statsBucket encodes the time of a stats bucket, times before the epoch like the zero time are clamped to it
+func statsBucket(bucket time.Time) []byte {
+	if bucket.Unix() < 0 {
+		return itob(0)
+	}
+	return itob(uint64(bucket.Unix()))
+}
+
+func statsKey(bucket time.Time, hash []byte) []byte {
+	return append(statsBucket(bucket), hash...)
+}
+
+// rollUpPopularity sums the lookups of every hash of typ into its popularity bucket
+func rollUpPopularity(tx *bolt.Tx, typ client.SignatureType) error {
+	popularity := boltBucket(tx, boltPopularity, typ)
+
+	return boltBucket(tx, boltStats, typ).ForEach(func(k, v []byte) error {
+		var counts SelectorCounts
+		if err := json.Unmarshal(v, &counts); err != nil {
+			return fmt.Errorf("failed to decode stats: %w", err)
+		}
+		return addPopularity(popularity, k[8:], counts.Lookups)
+	})
+}
+
+// addPopularity adds delta to the lookups of hash, dropping hashes which have none left
+func addPopularity(b *bolt.Bucket, hash []byte, delta int64) error {
+	lookups := getPopularity(b, hash) + delta
+	if lookups <= 0 {
+		return b.Delete(hash)
+	}
+	return b.Put(hash, itob(uint64(lookups)))
+}
+
+func getPopularity(b *bolt.Bucket, hash []byte) int64 {
+	value := b.Get(hash)
+	if value == nil {
+		return 0
+	}
+	return int64(binary.BigEndian.Uint64(value))
+}
+
+func (d *BoltDatabase) RecordSelectorStats(bucket time.Time, stats map[client.SignatureType]map[string]*SelectorCounts) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		for typ, counts := range stats {
+			b := boltBucket(tx, boltStats, storageType(typ))
+			popularity := boltBucket(tx, boltPopularity, storageType(typ))
+
+			for hash, c := range counts {
+				sel, err := hexutil.Decode(hash)
+				if err != nil {
+					return err
+				}
+
+				key := statsKey(bucket, sel)
+
+				var existing SelectorCounts
+				if value := b.Get(key); value != nil {
+					if err := json.Unmarshal(value, &existing); err != nil {
+						return fmt.Errorf("failed to decode stats: %w", err)
+					}
+				}
+				existing.Lookups += c.Lookups
+				existing.Misses += c.Misses
+
+				value, err := json.Marshal(&existing)
+				if err != nil {
+					return err
+				}
+				if err := b.Put(key, value); err != nil {
+					return err
+				}
+				if err := addPopularity(popularity, sel, c.Lookups); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func (d *BoltDatabase) ListSelectorStats(typ client.SignatureType, since time.Time, unknown bool, limit int) ([]*client.SelectorStat, error) {
+	typ = storageType(typ)
+
+	totals := make(map[string]*client.SelectorStat)
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		sigs := boltBucket(tx, boltSignatures, typ).Cursor()
+
+		c := boltBucket(tx, boltStats, typ).Cursor()
+		for k, v := c.Seek(statsBucket(since)); k != nil; k, v = c.Next() {
+			hash := k[8:]
+
+			if unknown {
+				if key, _ := sigs.Seek(hash); key != nil && bytes.HasPrefix(key, hash) {
+					continue
+				}
+			}
+
+			var counts SelectorCounts
+			if err := json.Unmarshal(v, &counts); err != nil {
+				return fmt.Errorf("failed to decode stats: %w", err)
+			}
+
+			stat, ok := totals[string(hash)]
+			if !ok {
+				stat = &client.SelectorStat{Hash: hexutil.Encode(hash)}
+				totals[string(hash)] = stat
+			}
+			stat.Lookups += counts.Lookups
+			stat.Misses += counts.Misses
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	result := []*client.SelectorStat{}
+	for _, stat := range totals {
+		if unknown && stat.Misses == 0 {
+			continue
+		}
+		result = append(result, stat)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i].Lookups, result[j].Lookups
+		if unknown {
+			a, b = result[i].Misses, result[j].Misses
+		}
+		if a != b {
+			return a > b
+		}
+		return result[i].Hash < result[j].Hash
+	})
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (d *BoltDatabase) PruneSelectorStats(before time.Time) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		for _, typ := range []client.SignatureType{client.SignatureTypeFunction, client.SignatureTypeEvent} {
+			b := boltBucket(tx, boltStats, typ)
+			popularity := boltBucket(tx, boltPopularity, typ)
+
+			// deleting while iterating with a cursor skips keys, so collect them first
+			pruned := make(map[string]int64)
+			var keys [][]byte
+			c := b.Cursor()
+			for k, v := c.First(); k != nil && bytes.Compare(k[:8], statsBucket(before)) < 0; k, v = c.Next() {
+				var counts SelectorCounts
+				if err := json.Unmarshal(v, &counts); err != nil {
+					return fmt.Errorf("failed to decode stats: %w", err)
+				}
+				pruned[string(k[8:])] += counts.Lookups
+				keys = append(keys, append([]byte{}, k...))
+			}
+
+			for _, k := range keys {
+				if err := b.Delete(k); err != nil {
+					return err
+				}
+			}
+			for hash, lookups := range pruned {
+				if err := addPopularity(popularity, []byte(hash), -lookups); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func getAPIKey(b *bolt.Bucket, keyHash []byte) (*client.APIKey, error) {
+	value := b.Get(keyHash)
+	if value == nil {
+		return nil, nil
+	}
+
+	var key client.APIKey
+	if err := json.Unmarshal(value, &key); err != nil {
+		return nil, fmt.Errorf("failed to decode api key: %w", err)
+	}
+	return &key, nil
+}
+
+func putAPIKey(b *bolt.Bucket, keyHash []byte, key *client.APIKey) error {
+	value, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	return b.Put(keyHash, value)
+}
+
+func (d *BoltDatabase) CreateAPIKey(name string, keyHash []byte, scopes []client.APIKeyScope) (*client.APIKey, error) {
+	var result *client.APIKey
+
+	if err := d.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket([]byte(boltAPIKeys))
+		ids := tx.Bucket([]byte(boltAPIKeyIDs))
+
+		if keys.Get(keyHash) != nil {
+			return fmt.Errorf("api key already exists")
+		}
+
+		id, err := ids.NextSequence()
+		if err != nil {
+			return err
+		}
+
+		result = &client.APIKey{
+			ID:        int(id),
+			Name:      name,
+			Scopes:    scopes,
+			CreatedAt: time.Now().UTC(),
+		}
+		if err := putAPIKey(keys, keyHash, result); err != nil {
+			return err
+		}
+		return ids.Put(itob(id), keyHash)
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *BoltDatabase) LoadAPIKey(keyHash []byte) (*client.APIKey, error) {
+	var result *client.APIKey
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		key, err := getAPIKey(tx.Bucket([]byte(boltAPIKeys)), keyHash)
+		result = key
+		return err
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *BoltDatabase) ListAPIKeys() ([]*client.APIKey, error) {
+	result := []*client.APIKey{}
+
+	if err := d.db.View(func(tx *bolt.Tx) error {
+		keys := tx.Bucket([]byte(boltAPIKeys))
+		return tx.Bucket([]byte(boltAPIKeyIDs)).ForEach(func(k, v []byte) error {
+			key, err := getAPIKey(keys, v)
+			if err != nil {
+				return err
+			}
+			if key != nil {
+				result = append(result, key)
+			}
+			return nil
+		})
+	}); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (d *BoltDatabase) DeleteAPIKey(id int) (bool, error) {
+	var deleted bool
+
+	if err := d.db.Update(func(tx *bolt.Tx) error {
+		ids := tx.Bucket([]byte(boltAPIKeyIDs))
+
+		keyHash := ids.Get(itob(uint64(id)))
+		if keyHash == nil {
+			return nil
+		}
+
+		if err := tx.Bucket([]byte(boltAPIKeys)).Delete(keyHash); err != nil {
+			return err
+		}
+		deleted = true
+		return ids.Delete(itob(uint64(id)))
+	}); err != nil {
+		return false, err
+	}
+
+	return deleted, nil
+}
+
+func (d *BoltDatabase) RecordAPIKeyUsage(usage map[int]*APIKeyUsage) error {
+	return d.db.Update(func(tx *bolt.Tx) error {
+		keys := tx.Bucket([]byte(boltAPIKeys))
+		ids := tx.Bucket([]byte(boltAPIKeyIDs))
+
+		for id, u := range usage {
+			keyHash := ids.Get(itob(uint64(id)))
+			if keyHash == nil {
+				continue
+			}
+
+			key, err := getAPIKey(keys, keyHash)
+			if err != nil {
+				return err
+			}
+			if key == nil {
+				continue
+			}
+
+			key.Requests += u.Requests
+			key.RateLimited += u.RateLimited
+			if key.LastUsedAt == nil || u.LastUsedAt.After(*key.LastUsedAt) {
+				lastUsedAt := u.LastUsedAt
+				key.LastUsedAt = &lastUsedAt
+			}
+
+			if err := putAPIKey(keys, keyHash, key); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,85 @@
+package database
+
+import (
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"time"
+)
+
+// SignatureEntry is a signature along with the bookkeeping which the compatibility apis expose
+type SignatureEntry struct {
+	ID          int64
+	Name        string
+	Hash        []byte
+	CreatedAt   time.Time
+	Quarantined bool
+}
+
+var loadSignatureEntryQueries = map[client.SignatureType]string{
+	client.SignatureTypeFunction: `SELECT id, name, hash, created_at, quarantined FROM fourbyte WHERE hash = $1 ORDER BY id`,
+	client.SignatureTypeEvent:    `SELECT id, name, hash, created_at, quarantined FROM thirtytwobyte WHERE hash = $1 ORDER BY id`,
+	client.SignatureTypeError:    `SELECT id, name, hash, created_at, quarantined FROM fourbyte WHERE hash = $1 ORDER BY id`,
+}
+
+// searchSignatureEntryQueries skip the signatures which aren't the expected one for their hash, given as parallel
+// arrays in $4 and $5, before the page is cut out
+var searchSignatureEntryQueries = map[client.SignatureType]string{
+	client.SignatureTypeFunction: `SELECT id, name, hash, created_at, quarantined FROM fourbyte f WHERE name LIKE $1 AND NOT quarantined AND NOT EXISTS (SELECT 1 FROM unnest($4::bytea[], $5::varchar[]) AS e(hash, name) WHERE e.hash = f.hash AND e.name <> f.name) ORDER BY id LIMIT $2 OFFSET $3`,
+	client.SignatureTypeEvent:    `SELECT id, name, hash, created_at, quarantined FROM thirtytwobyte f WHERE name LIKE $1 AND NOT quarantined AND NOT EXISTS (SELECT 1 FROM unnest($4::bytea[], $5::varchar[]) AS e(hash, name) WHERE e.hash = f.hash AND e.name <> f.name) ORDER BY id LIMIT $2 OFFSET $3`,
+	client.SignatureTypeError:    `SELECT id, name, hash, created_at, quarantined FROM fourbyte f WHERE name LIKE $1 AND NOT quarantined AND NOT EXISTS (SELECT 1 FROM unnest($4::bytea[], $5::varchar[]) AS e(hash, name) WHERE e.hash = f.hash AND e.name <> f.name) ORDER BY id LIMIT $2 OFFSET $3`,
+}
+
+func scanSignatureEntries(result *[]*SignatureEntry) func(rows pgx.Rows) error {
+	return func(rows pgx.Rows) error {
+		for rows.Next() {
+			var entry SignatureEntry
+			if err := rows.Scan(&entry.ID, &entry.Name, &entry.Hash, &entry.CreatedAt, &entry.Quarantined); err != nil {
+				return fmt.Errorf("failed to scan: %w", err)
+			}
+			*result = append(*result, &entry)
+		}
+		return nil
+	}
+}
+
+// LoadSignatureEntries returns every signature with the given hash, including quarantined ones, ordered by id
+func (d *Database) LoadSignatureEntries(typ client.SignatureType, hash []byte) ([]*SignatureEntry, error) {
+	var result []*SignatureEntry
+	if err := d.db.QuerySimple(scanSignatureEntries(&result), loadSignatureEntryQueries[typ], hash); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// SearchSignatureEntries returns a page of the signatures which match the query, excluding quarantined ones and
+// ordered by id. The query may contain '*' and '?' wildcards, an empty query matches everything. Expected maps hashes
+// to the only signature which should be returned for them, the other signatures of those hashes are excluded.
+func (d *Database) SearchSignatureEntries(typ client.SignatureType, query string, expected map[string]string, offset int, limit int) ([]*SignatureEntry, error) {
+	pattern := "%"
+	if query != "" {
+		sanitizedQuery, err := d.sanitizeQuery(query)
+		if err != nil {
+			return nil, err
+		}
+		pattern = sanitizedQuery
+	}
+
+	expectedHashes := make([][]byte, 0, len(expected))
+	expectedNames := make([]string, 0, len(expected))
+	for hash, name := range expected {
+		b, err := hexutil.Decode(hash)
+		if err != nil {
+			return nil, err
+		}
+		expectedHashes = append(expectedHashes, b)
+		expectedNames = append(expectedNames, name)
+	}
+
+	var result []*SignatureEntry
+	if err := d.db.QuerySimple(scanSignatureEntries(&result), searchSignatureEntryQueries[typ], pattern, limit, offset, expectedHashes, expectedNames); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
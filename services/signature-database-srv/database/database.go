@@ -12,7 +12,9 @@ import (
 	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
 	"io"
 	"regexp"
+	"strconv"
 	"strings"
+	"time"
 )
 
 var signatureLens = map[client.SignatureType]int{
@@ -21,18 +23,29 @@ var signatureLens = map[client.SignatureType]int{
 }
 
 var saveSignatureQueries = map[client.SignatureType]string{
-	client.SignatureTypeFunction: `INSERT INTO fourbyte (name, hash) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
-	client.SignatureTypeEvent:    `INSERT INTO thirtytwobyte (name, hash) VALUES ($1, $2) ON CONFLICT DO NOTHING`,
+	client.SignatureTypeFunction: `INSERT INTO fourbyte (name, hash, source) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
+	client.SignatureTypeEvent:    `INSERT INTO thirtytwobyte (name, hash, source) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`,
 }
 
 var loadSignatureQueries = map[client.SignatureType]string{
-	client.SignatureTypeFunction: `SELECT name, hash FROM fourbyte where hash = ANY($1)`,
-	client.SignatureTypeEvent:    `SELECT name, hash FROM thirtytwobyte where hash = ANY($1)`,
+	client.SignatureTypeFunction: `SELECT name, hash, quarantined, coalesce(flag_reason, ''), coalesce(source, '') FROM fourbyte where hash = ANY($1)`,
+	client.SignatureTypeEvent:    `SELECT name, hash, quarantined, coalesce(flag_reason, ''), coalesce(source, '') FROM thirtytwobyte where hash = ANY($1)`,
+	client.SignatureTypeError:    `SELECT name, hash, quarantined, coalesce(flag_reason, ''), coalesce(source, '') FROM fourbyte where hash = ANY($1)`,
 }
 
+const (
+	// searchLimit is the number of matches a search returns
+	searchLimit = 100
+	// searchCandidates is the number of matches a search ranks by popularity. Bounding it keeps a broad query from
+	// sorting the whole table, at the cost of only ranking a sample of its matches.
+	searchCandidates = 10000
+)
+
+// querySignatureQueries return the most looked up of the first $3 matches first, so that a broad query isn't cut
+// off before the signatures people are actually looking for
 var querySignatureQueries = map[client.SignatureType]string{
-	client.SignatureTypeFunction: `SELECT name, hash FROM fourbyte WHERE name LIKE $1 LIMIT $2`,
-	client.SignatureTypeEvent:    `SELECT name, hash FROM thirtytwobyte WHERE name LIKE $1 LIMIT $2`,
+	client.SignatureTypeFunction: `SELECT f.name, f.hash, f.quarantined, coalesce(f.flag_reason, ''), coalesce(f.source, '') FROM (SELECT name, hash, quarantined, flag_reason, source FROM fourbyte WHERE name LIKE $1 LIMIT $3) f LEFT JOIN selector_popularity p ON p.type = 'function' AND p.hash = f.hash ORDER BY coalesce(p.lookups, 0) DESC LIMIT $2`,
+	client.SignatureTypeEvent:    `SELECT f.name, f.hash, f.quarantined, coalesce(f.flag_reason, ''), coalesce(f.source, '') FROM (SELECT name, hash, quarantined, flag_reason, source FROM thirtytwobyte WHERE name LIKE $1 LIMIT $3) f LEFT JOIN selector_popularity p ON p.type = 'event' AND p.hash = f.hash ORDER BY coalesce(p.lookups, 0) DESC LIMIT $2`,
 }
 
 var countSignatureQueries = map[client.SignatureType]string{
@@ -40,16 +53,32 @@ var countSignatureQueries = map[client.SignatureType]string{
 	client.SignatureTypeEvent:    `SELECT COUNT(*) FROM thirtytwobyte`,
 }
 
+var listCollisionQueries = map[client.SignatureType]string{
+	client.SignatureTypeFunction: `SELECT hash, array_agg(name ORDER BY name), array_agg(quarantined ORDER BY name) FROM fourbyte WHERE hash > $1 GROUP BY hash HAVING COUNT(*) > 1 ORDER BY hash LIMIT $2`,
+	client.SignatureTypeEvent:    `SELECT hash, array_agg(name ORDER BY name), array_agg(quarantined ORDER BY name) FROM thirtytwobyte WHERE hash > $1 GROUP BY hash HAVING COUNT(*) > 1 ORDER BY hash LIMIT $2`,
+}
+
 func (d *Database) SaveSignatures(typ client.SignatureType, names []string) (*client.ImportResponseDetails, error) {
+	return d.SaveSignaturesWithSource(typ, names, "")
+}
+
+// SaveSignaturesWithSource saves the signatures like SaveSignatures, recording where they came from. An empty
+// source is stored as null, which is what every imported signature has.
+func (d *Database) SaveSignaturesWithSource(typ client.SignatureType, names []string, source string) (*client.ImportResponseDetails, error) {
 	result := client.NewImportResponseDetails()
 
+	var sourceArg any
+	if source != "" {
+		sourceArg = source
+	}
+
 	if err := d.db.ExecTx(func(tx *database.Tx) error {
 		return tx.ExecBatch(func(stmt *database.Stmt) error {
 			for _, name := range names {
 				sig := crypto.Keccak256([]byte(name))[:signatureLens[typ]]
 				hexSig := "0x" + hex.EncodeToString(sig)
 
-				res, err := stmt.Exec(context.Background(), name, sig)
+				res, err := stmt.Exec(context.Background(), name, sig, sourceArg)
 				if err != nil {
 					return fmt.Errorf("failed to insert: %w", err)
 				}
@@ -71,43 +100,76 @@ func (d *Database) SaveSignatures(typ client.SignatureType, names []string) (*cl
 	return result, nil
 }
 
+var exportSignatureQueries = map[client.SignatureType]string{
+	client.SignatureTypeFunction: `SELECT name, hash, created_at FROM fourbyte WHERE NOT quarantined ORDER BY hash`,
+	client.SignatureTypeEvent:    `SELECT name, hash, created_at FROM thirtytwobyte WHERE NOT quarantined ORDER BY hash`,
+}
+
+var exportChangesQuery = `SELECT name, hash, removed, changed_at FROM signature_changes WHERE type = $1 AND xid >= $2::text::xid8 AND xid < $3::text::xid8 ORDER BY xid, seq`
+
 func (d *Database) ExportData(w io.Writer) error {
-	if err := d.db.QuerySimple(func(r pgx.Rows) error {
+	return exportData(d, w)
+}
+
+// ExportSignatures calls apply for every signature of the given type which isn't quarantined, in order of hash
+func (d *Database) ExportSignatures(typ client.SignatureType, apply func(name string, hash []byte, createdAt time.Time) error) error {
+	return d.db.QuerySimple(func(r pgx.Rows) error {
 		var (
-			name string
-			hash []byte
+			name      string
+			hash      []byte
+			createdAt time.Time
 		)
 		for r.Next() {
-			if err := r.Scan(&name, &hash); err != nil {
+			if err := r.Scan(&name, &hash, &createdAt); err != nil {
 				return err
 			}
-			if _, err := io.WriteString(w, fmt.Sprintf("0x%x,%s\n", hash, name)); err != nil {
+			if err := apply(name, hash, createdAt); err != nil {
 				return err
 			}
 		}
-		return nil
-	}, `SELECT * FROM fourbyte ORDER BY hash`); err != nil {
-		return err
+		return r.Err()
+	}, exportSignatureQueries[typ])
+}
+
+// ExportCursor returns the oldest transaction which may still be running. Every transaction before it has either
+// committed or rolled back, so its changes can't appear later.
+func (d *Database) ExportCursor() (uint64, error) {
+	var xmin string
+	if err := d.db.QuerySimpleOne(func(r pgx.Rows) error {
+		return r.Scan(&xmin)
+	}, `SELECT pg_snapshot_xmin(pg_current_snapshot())::text`); err != nil {
+		return 0, err
 	}
-	if err := d.db.QuerySimple(func(r pgx.Rows) error {
-		var (
-			name string
-			hash []byte
-		)
+	return strconv.ParseUint(xmin, 10, 64)
+}
+
+// ExportCursorAt returns the oldest transaction which made a change at or after t, or may still make one. A
+// transaction's changes are timestamped when it starts, so this may include transactions which committed before t.
+func (d *Database) ExportCursorAt(t time.Time) (uint64, error) {
+	var xid string
+	if err := d.db.QuerySimpleOne(func(r pgx.Rows) error {
+		return r.Scan(&xid)
+	}, `SELECT least((SELECT xid FROM signature_changes WHERE changed_at >= $1 ORDER BY xid LIMIT 1), pg_snapshot_xmin(pg_current_snapshot()))::text`, t); err != nil {
+		return 0, err
+	}
+	return strconv.ParseUint(xid, 10, 64)
+}
+
+// ExportChanges calls apply for every change made by the transactions from since up to until. Transactions which
+// were still running when since was taken are included again, which is harmless since the changes are idempotent.
+func (d *Database) ExportChanges(typ client.SignatureType, since uint64, until uint64, apply func(change *SignatureChange) error) error {
+	return d.db.QuerySimple(func(r pgx.Rows) error {
 		for r.Next() {
-			if err := r.Scan(&name, &hash); err != nil {
+			var change SignatureChange
+			if err := r.Scan(&change.Name, &change.Hash, &change.Removed, &change.ChangedAt); err != nil {
 				return err
 			}
-			if _, err := io.WriteString(w, fmt.Sprintf("0x%x,%s\n", hash, name)); err != nil {
+			if err := apply(&change); err != nil {
 				return err
 			}
 		}
-		return nil
-	}, `SELECT * FROM thirtytwobyte ORDER BY hash`); err != nil {
-		return err
-	}
-
-	return nil
+		return r.Err()
+	}, exportChangesQuery, string(typ), strconv.FormatUint(since, 10), strconv.FormatUint(until, 10))
 }
 
 var isValidQuery = regexp.MustCompile(`^[a-zA-Z0-9$_()\[\],*?]+$`).MatchString
@@ -138,21 +200,27 @@ func (d *Database) QuerySignatures(query string) (map[client.SignatureType]map[s
 			if err := tx.QuerySimple(func(r pgx.Rows) error {
 				for r.Next() {
 					var (
-						name string
-						hash []byte
+						name        string
+						hash        []byte
+						quarantined bool
+						flagReason  string
+						source      string
 					)
-					if err := r.Scan(&name, &hash); err != nil {
+					if err := r.Scan(&name, &hash, &quarantined, &flagReason, &source); err != nil {
 						return fmt.Errorf("failed to scan: %w", err)
 					}
 
 					sel := "0x" + hex.EncodeToString(hash)
 					result[typ][sel] = append(result[typ][sel], &client.SignatureData{
-						Name: name,
+						Name:        name,
+						Quarantined: quarantined,
+						FlagReason:  flagReason,
+						Source:      source,
 					})
 				}
 
 				return nil
-			}, querySignatureQueries[typ], sanitizedQuery, 100); err != nil {
+			}, querySignatureQueries[typ], sanitizedQuery, searchLimit, searchCandidates); err != nil {
 				return err
 			}
 		}
@@ -180,17 +248,23 @@ func (d *Database) LoadSignatures(typ client.SignatureType, sels []string) (map[
 	if err := d.db.QuerySimple(func(rows pgx.Rows) error {
 		for rows.Next() {
 			var (
-				name string
-				sel  []byte
+				name        string
+				sel         []byte
+				quarantined bool
+				flagReason  string
+				source      string
 			)
-			if err := rows.Scan(&name, &sel); err != nil {
+			if err := rows.Scan(&name, &sel, &quarantined, &flagReason, &source); err != nil {
 				return fmt.Errorf("failed to scan: %w", err)
 			}
 
 			h := hexutil.Encode(sel)
 
 			result[h] = append(result[h], &client.SignatureData{
-				Name: name,
+				Name:        name,
+				Quarantined: quarantined,
+				FlagReason:  flagReason,
+				Source:      source,
 			})
 		}
 		return nil
@@ -216,3 +290,89 @@ func (d *Database) CountSignatures(typ client.SignatureType) (int, error) {
 	}
 	return count, nil
 }
+
+// ListCollisions returns up to limit hashes which have more than one signature, ordered by hash and starting
+// strictly after the given hash. An empty after starts from the beginning.
+func (d *Database) ListCollisions(typ client.SignatureType, after string, limit int) (map[string][]*client.SignatureData, []string, error) {
+	afterBytes := []byte{}
+	if after != "" {
+		b, err := hexutil.Decode(after)
+		if err != nil {
+			return nil, nil, err
+		}
+		afterBytes = b
+	}
+
+	result := make(map[string][]*client.SignatureData)
+	var order []string
+
+	if err := d.db.QuerySimple(func(rows pgx.Rows) error {
+		for rows.Next() {
+			var (
+				sel         []byte
+				names       []string
+				quarantined []bool
+			)
+			if err := rows.Scan(&sel, &names, &quarantined); err != nil {
+				return fmt.Errorf("failed to scan: %w", err)
+			}
+
+			h := hexutil.Encode(sel)
+			order = append(order, h)
+			for i, name := range names {
+				result[h] = append(result[h], &client.SignatureData{
+					Name:        name,
+					Quarantined: quarantined[i],
+				})
+			}
+		}
+		return nil
+	}, listCollisionQueries[typ], afterBytes, limit); err != nil {
+		return nil, nil, err
+	}
+
+	return result, order, nil
+}
+
+// LoadPreferredSignatures returns every signature which has been pinned by a maintainer, keyed by hash
+func (d *Database) LoadPreferredSignatures(typ client.SignatureType) (map[string]string, error) {
+	result := make(map[string]string)
+
+	if err := d.db.QuerySimple(func(rows pgx.Rows) error {
+		for rows.Next() {
+			var (
+				name string
+				sel  []byte
+			)
+			if err := rows.Scan(&name, &sel); err != nil {
+				return fmt.Errorf("failed to scan: %w", err)
+			}
+
+			result[hexutil.Encode(sel)] = name
+		}
+		return nil
+	}, `SELECT name, hash FROM preferred_signatures WHERE type = $1`, string(typ)); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// SetPreferredSignature pins the given signature for its hash, replacing any existing pin
+func (d *Database) SetPreferredSignature(typ client.SignatureType, name string) error {
+	sig := crypto.Keccak256([]byte(name))[:signatureLens[typ]]
+
+	_, err := d.db.Exec(context.Background(), `INSERT INTO preferred_signatures (type, hash, name) VALUES ($1, $2, $3) ON CONFLICT (type, hash) DO UPDATE SET name = excluded.name`, string(typ), sig, name)
+	return err
+}
+
+// DeletePreferredSignature removes the pin for the given hash, if any
+func (d *Database) DeletePreferredSignature(typ client.SignatureType, hash string) error {
+	sel, err := hexutil.Decode(hash)
+	if err != nil {
+		return err
+	}
+
+	_, err = d.db.Exec(context.Background(), `DELETE FROM preferred_signatures WHERE type = $1 AND hash = $2`, string(typ), sel)
+	return err
+}
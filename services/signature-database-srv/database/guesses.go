@@ -0,0 +1,128 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/lib/pq"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/database"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"time"
+)
+
+// GuessTask is a hash which has been queued for the guesser. Position is how many candidates of the candidate
+// space identified by Space have been tried.
+type GuessTask struct {
+	Type      client.SignatureType
+	Hash      []byte
+	Status    client.GuessStatus
+	Name      string
+	Space     string
+	Position  int64
+	QueuedAt  time.Time
+	UpdatedAt time.Time
+}
+
+const guessTaskColumns = `type, hash, status, coalesce(name, ''), space, position, queued_at, updated_at`
+
+func scanGuessTask(rows pgx.Rows) (*GuessTask, error) {
+	var (
+		task GuessTask
+		typ  string
+	)
+	if err := rows.Scan(&typ, &task.Hash, &task.Status, &task.Name, &task.Space, &task.Position, &task.QueuedAt, &task.UpdatedAt); err != nil {
+		return nil, fmt.Errorf("failed to scan: %w", err)
+	}
+	task.Type = client.SignatureType(typ)
+	return &task, nil
+}
+
+// QueueGuessTasks queues the hashes for the guesser, hashes which were already queued are left as they are
+func (d *Database) QueueGuessTasks(typ client.SignatureType, hashes [][]byte) error {
+	return d.db.ExecTx(func(tx *database.Tx) error {
+		return tx.ExecBatch(func(stmt *database.Stmt) error {
+			for _, hash := range hashes {
+				if _, err := stmt.Exec(context.Background(), string(typ), hash); err != nil {
+					return fmt.Errorf("failed to insert: %w", err)
+				}
+			}
+			return nil
+		}, `INSERT INTO guess_tasks (type, hash) VALUES ($1, $2) ON CONFLICT DO NOTHING`)
+	})
+}
+
+// LoadGuessTasks returns the tasks for the given hashes which have been queued, keyed by hash
+func (d *Database) LoadGuessTasks(typ client.SignatureType, hashes [][]byte) (map[string]*GuessTask, error) {
+	result := make(map[string]*GuessTask)
+
+	if err := d.db.QuerySimple(func(rows pgx.Rows) error {
+		for rows.Next() {
+			task, err := scanGuessTask(rows)
+			if err != nil {
+				return err
+			}
+			result[hexutil.Encode(task.Hash)] = task
+		}
+		return nil
+	}, `SELECT `+guessTaskColumns+` FROM guess_tasks WHERE type = $1 AND hash = ANY($2)`, string(typ), pq.ByteaArray(hashes)); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// NextGuessTask returns the pending task which was queued first, or nil if there are none
+func (d *Database) NextGuessTask() (*GuessTask, error) {
+	var result *GuessTask
+	if err := d.db.QuerySimpleOne(func(rows pgx.Rows) error {
+		task, err := scanGuessTask(rows)
+		result = task
+		return err
+	}, `SELECT `+guessTaskColumns+` FROM guess_tasks WHERE status = 'pending' ORDER BY queued_at, hash LIMIT 1`); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// UpdateGuessTask saves the status, name and progress of the task
+func (d *Database) UpdateGuessTask(task *GuessTask) error {
+	var name any
+	if task.Name != "" {
+		name = task.Name
+	}
+
+	_, err := d.db.Exec(context.Background(), `UPDATE guess_tasks SET status = $3, name = $4, space = $5, position = $6, updated_at = now() WHERE type = $1 AND hash = $2`, string(task.Type), task.Hash, string(task.Status), name, task.Space, task.Position)
+	return err
+}
+
+var listArgumentListQueries = map[client.SignatureType]string{
+	client.SignatureTypeFunction: `SELECT substring(name from position('(' in name)) AS args FROM fourbyte WHERE NOT quarantined GROUP BY args ORDER BY count(*) DESC, args LIMIT $1`,
+	client.SignatureTypeEvent:    `SELECT substring(name from position('(' in name)) AS args FROM thirtytwobyte WHERE NOT quarantined GROUP BY args ORDER BY count(*) DESC, args LIMIT $1`,
+}
+
+// ListArgumentLists returns the most common argument lists, like "(address,uint256)", in order of popularity.
+// This scans every signature of the type, so it shouldn't be called often.
+func (d *Database) ListArgumentLists(typ client.SignatureType, limit int) ([]string, error) {
+	var result []string
+
+	if err := d.db.QuerySimple(func(rows pgx.Rows) error {
+		for rows.Next() {
+			var args string
+			if err := rows.Scan(&args); err != nil {
+				return fmt.Errorf("failed to scan: %w", err)
+			}
+			result = append(result, args)
+		}
+		return nil
+	}, listArgumentListQueries[storageType(typ)], limit); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1 @@
+DROP TABLE preferred_signatures;
\ No newline at end of file
@@ -0,0 +1,7 @@
+CREATE TABLE preferred_signatures
+(
+    type varchar NOT NULL,
+    hash bytea   NOT NULL,
+    name varchar NOT NULL,
+    PRIMARY KEY (type, hash)
+);
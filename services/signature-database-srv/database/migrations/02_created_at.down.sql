@@ -0,0 +1,5 @@
+DROP INDEX thirtytwobyte_created_at;
+ALTER TABLE thirtytwobyte DROP COLUMN created_at;
+
+DROP INDEX fourbyte_created_at;
+ALTER TABLE fourbyte DROP COLUMN created_at;
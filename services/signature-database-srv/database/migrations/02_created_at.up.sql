@@ -0,0 +1,10 @@
+-- signatures which existed before this migration are treated as having been created at the epoch
+ALTER TABLE fourbyte ADD COLUMN created_at timestamptz NOT NULL DEFAULT 'epoch';
+ALTER TABLE fourbyte ALTER COLUMN created_at SET DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS fourbyte_created_at ON fourbyte USING btree (created_at);
+
+ALTER TABLE thirtytwobyte ADD COLUMN created_at timestamptz NOT NULL DEFAULT 'epoch';
+ALTER TABLE thirtytwobyte ALTER COLUMN created_at SET DEFAULT now();
+
+CREATE INDEX IF NOT EXISTS thirtytwobyte_created_at ON thirtytwobyte USING btree (created_at);
@@ -0,0 +1,12 @@
+-- only the sha256 of each key is stored, the key itself is shown once when it is created
+CREATE TABLE api_keys
+(
+    id           serial      NOT NULL PRIMARY KEY,
+    key_hash     bytea       NOT NULL UNIQUE,
+    name         varchar     NOT NULL,
+    scopes       varchar[]   NOT NULL,
+    created_at   timestamptz NOT NULL DEFAULT now(),
+    last_used_at timestamptz,
+    requests     bigint      NOT NULL DEFAULT 0,
+    rate_limited bigint      NOT NULL DEFAULT 0
+);
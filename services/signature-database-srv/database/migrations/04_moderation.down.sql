@@ -0,0 +1,5 @@
+ALTER TABLE fourbyte DROP COLUMN quarantined;
+ALTER TABLE fourbyte DROP COLUMN flag_reason;
+
+ALTER TABLE thirtytwobyte DROP COLUMN quarantined;
+ALTER TABLE thirtytwobyte DROP COLUMN flag_reason;
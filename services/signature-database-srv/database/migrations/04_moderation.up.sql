@@ -0,0 +1,6 @@
+-- quarantined signatures are kept so that they aren't imported again, but are hidden from filtered results
+ALTER TABLE fourbyte ADD COLUMN quarantined boolean NOT NULL DEFAULT false;
+ALTER TABLE fourbyte ADD COLUMN flag_reason varchar;
+
+ALTER TABLE thirtytwobyte ADD COLUMN quarantined boolean NOT NULL DEFAULT false;
+ALTER TABLE thirtytwobyte ADD COLUMN flag_reason varchar;
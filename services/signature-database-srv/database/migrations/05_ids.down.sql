@@ -0,0 +1,3 @@
+ALTER TABLE fourbyte DROP COLUMN id;
+
+ALTER TABLE thirtytwobyte DROP COLUMN id;
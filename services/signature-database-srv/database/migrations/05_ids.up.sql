@@ -0,0 +1,7 @@
+-- sequential ids are only used by the 4byte.directory compatible api, existing signatures are numbered in
+-- storage order
+ALTER TABLE fourbyte ADD COLUMN id bigserial NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS fourbyte_id ON fourbyte USING btree (id);
+
+ALTER TABLE thirtytwobyte ADD COLUMN id bigserial NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS thirtytwobyte_id ON thirtytwobyte USING btree (id);
@@ -0,0 +1,4 @@
+DROP TABLE guess_tasks;
+
+ALTER TABLE fourbyte DROP COLUMN source;
+ALTER TABLE thirtytwobyte DROP COLUMN source;
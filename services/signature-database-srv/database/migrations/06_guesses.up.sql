@@ -0,0 +1,19 @@
+-- source is null for signatures which were imported, and 'guessed' for those recovered by the guesser
+ALTER TABLE fourbyte ADD COLUMN source varchar;
+ALTER TABLE thirtytwobyte ADD COLUMN source varchar;
+
+-- position is how far into the candidate space identified by space the guesser got, so it can resume
+CREATE TABLE guess_tasks
+(
+    type       varchar     NOT NULL,
+    hash       bytea       NOT NULL,
+    status     varchar     NOT NULL DEFAULT 'pending',
+    name       varchar,
+    space      varchar     NOT NULL DEFAULT '',
+    position   bigint      NOT NULL DEFAULT 0,
+    queued_at  timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (type, hash)
+);
+
+CREATE INDEX IF NOT EXISTS guess_tasks_pending ON guess_tasks USING btree (queued_at) WHERE status = 'pending';
@@ -0,0 +1,12 @@
+-- lookups are counted per hour, rows older than the stats window are pruned by the service
+CREATE TABLE selector_stats
+(
+    type    varchar     NOT NULL,
+    hash    bytea       NOT NULL,
+    bucket  timestamptz NOT NULL,
+    lookups bigint      NOT NULL DEFAULT 0,
+    misses  bigint      NOT NULL DEFAULT 0,
+    PRIMARY KEY (type, hash, bucket)
+);
+
+CREATE INDEX IF NOT EXISTS selector_stats_bucket ON selector_stats USING btree (bucket);
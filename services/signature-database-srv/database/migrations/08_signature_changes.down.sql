@@ -0,0 +1,6 @@
+DROP TRIGGER thirtytwobyte_changes ON thirtytwobyte;
+DROP TRIGGER fourbyte_changes ON fourbyte;
+
+DROP FUNCTION record_signature_change();
+
+DROP TABLE signature_changes;
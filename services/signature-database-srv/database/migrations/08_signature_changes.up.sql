@@ -0,0 +1,46 @@
+-- every change to the exported signatures is recorded so that incremental exports can include removals. sequence
+-- values and timestamps are assigned before a transaction commits and so can become visible out of order, which is
+-- why changes are exported by the id of the transaction which made them instead
+CREATE TABLE signature_changes
+(
+    seq        bigserial   PRIMARY KEY,
+    xid        xid8        NOT NULL DEFAULT pg_current_xact_id(),
+    type       varchar     NOT NULL,
+    name       varchar     NOT NULL,
+    hash       bytea       NOT NULL,
+    removed    boolean     NOT NULL,
+    changed_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS signature_changes_xid ON signature_changes USING btree (xid, seq);
+
+-- quarantined signatures are never exported, so they're recorded as removed
+CREATE FUNCTION record_signature_change() RETURNS trigger AS
+$$
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        IF NOT NEW.quarantined THEN
+            INSERT INTO signature_changes (type, name, hash, removed) VALUES (TG_ARGV[0], NEW.name, NEW.hash, false);
+        END IF;
+    ELSIF TG_OP = 'UPDATE' THEN
+        IF NEW.quarantined IS DISTINCT FROM OLD.quarantined THEN
+            INSERT INTO signature_changes (type, name, hash, removed) VALUES (TG_ARGV[0], NEW.name, NEW.hash, NEW.quarantined);
+        END IF;
+    ELSIF NOT OLD.quarantined THEN
+        INSERT INTO signature_changes (type, name, hash, removed) VALUES (TG_ARGV[0], OLD.name, OLD.hash, true);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER fourbyte_changes
+    AFTER INSERT OR UPDATE OF quarantined OR DELETE
+    ON fourbyte
+    FOR EACH ROW
+EXECUTE FUNCTION record_signature_change('function');
+
+CREATE TRIGGER thirtytwobyte_changes
+    AFTER INSERT OR UPDATE OF quarantined OR DELETE
+    ON thirtytwobyte
+    FOR EACH ROW
+EXECUTE FUNCTION record_signature_change('event');
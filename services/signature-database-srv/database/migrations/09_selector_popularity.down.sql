@@ -0,0 +1 @@
+DROP TABLE selector_popularity;
@@ -0,0 +1,14 @@
+-- the lookups of every hash summed over all of selector_stats, kept up to date when stats are recorded and pruned so
+-- that searches can order by popularity without aggregating the stats
+CREATE TABLE selector_popularity
+(
+    type    varchar NOT NULL,
+    hash    bytea   NOT NULL,
+    lookups bigint  NOT NULL DEFAULT 0,
+    PRIMARY KEY (type, hash)
+);
+
+INSERT INTO selector_popularity (type, hash, lookups)
+SELECT type, hash, sum(lookups)
+FROM selector_stats
+GROUP BY type, hash;
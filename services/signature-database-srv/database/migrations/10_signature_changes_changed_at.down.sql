@@ -0,0 +1 @@
+DROP INDEX signature_changes_changed_at;
@@ -0,0 +1,2 @@
+-- incremental exports can start from a timestamp, which is resolved to a cursor by the changes made since
+CREATE INDEX IF NOT EXISTS signature_changes_changed_at ON signature_changes USING btree (changed_at);
@@ -0,0 +1,102 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/database"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+)
+
+var deleteSignatureQueries = map[client.SignatureType]string{
+	client.SignatureTypeFunction: `DELETE FROM fourbyte WHERE name = ANY($1) RETURNING name`,
+	client.SignatureTypeEvent:    `DELETE FROM thirtytwobyte WHERE name = ANY($1) RETURNING name`,
+}
+
+var quarantineSignatureQueries = map[client.SignatureType]string{
+	client.SignatureTypeFunction: `UPDATE fourbyte SET quarantined = $2, flag_reason = $3 WHERE name = ANY($1) RETURNING name`,
+	client.SignatureTypeEvent:    `UPDATE thirtytwobyte SET quarantined = $2, flag_reason = $3 WHERE name = ANY($1) RETURNING name`,
+}
+
+var listQuarantinedQueries = map[client.SignatureType]string{
+	client.SignatureTypeFunction: `SELECT name, hash, coalesce(flag_reason, '') FROM fourbyte WHERE quarantined AND name > $1 ORDER BY name LIMIT $2`,
+	client.SignatureTypeEvent:    `SELECT name, hash, coalesce(flag_reason, '') FROM thirtytwobyte WHERE quarantined AND name > $1 ORDER BY name LIMIT $2`,
+}
+
+func scanNames(result *[]string) func(rows pgx.Rows) error {
+	return func(rows pgx.Rows) error {
+		for rows.Next() {
+			var name string
+			if err := rows.Scan(&name); err != nil {
+				return fmt.Errorf("failed to scan: %w", err)
+			}
+			*result = append(*result, name)
+		}
+		return nil
+	}
+}
+
+// DeleteSignatures permanently removes the given signatures, along with any pins on them, returning the ones
+// which existed
+func (d *Database) DeleteSignatures(typ client.SignatureType, names []string) ([]string, error) {
+	deleted := []string{}
+
+	if err := d.db.ExecTx(func(tx *database.Tx) error {
+		if err := tx.QuerySimple(scanNames(&deleted), deleteSignatureQueries[typ], names); err != nil {
+			return err
+		}
+
+		if _, err := tx.Exec(context.Background(), `DELETE FROM preferred_signatures WHERE type = $1 AND name = ANY($2)`, string(typ), names); err != nil {
+			return fmt.Errorf("failed to delete pins: %w", err)
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	return deleted, nil
+}
+
+// SetQuarantined quarantines or releases the given signatures, returning the ones which existed. The reason is
+// only recorded when quarantining.
+func (d *Database) SetQuarantined(typ client.SignatureType, names []string, quarantined bool, reason string) ([]string, error) {
+	var flagReason *string
+	if quarantined {
+		flagReason = &reason
+	}
+
+	affected := []string{}
+	if err := d.db.QuerySimple(scanNames(&affected), quarantineSignatureQueries[typ], names, quarantined, flagReason); err != nil {
+		return nil, err
+	}
+
+	return affected, nil
+}
+
+// ListQuarantinedSignatures returns up to limit quarantined signatures, ordered by name and starting strictly
+// after the given name
+func (d *Database) ListQuarantinedSignatures(typ client.SignatureType, after string, limit int) ([]*client.QuarantinedSignature, error) {
+	result := []*client.QuarantinedSignature{}
+
+	if err := d.db.QuerySimple(func(rows pgx.Rows) error {
+		for rows.Next() {
+			var (
+				entry client.QuarantinedSignature
+				hash  []byte
+			)
+			if err := rows.Scan(&entry.Name, &hash, &entry.FlagReason); err != nil {
+				return fmt.Errorf("failed to scan: %w", err)
+			}
+
+			entry.Hash = hexutil.Encode(hash)
+			result = append(result, &entry)
+		}
+		return nil
+	}, listQuarantinedQueries[typ], after, limit); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
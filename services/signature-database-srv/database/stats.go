@@ -0,0 +1,112 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/jackc/pgx/v5"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/database"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"time"
+)
+
+// SelectorCounts are the lookups of a single hash, Misses counts the lookups which found no signatures
+type SelectorCounts struct {
+	Lookups int64
+	Misses  int64
+}
+
+// RecordSelectorStats adds the counts to the given bucket and to the popularity searches are ordered by. Errors share
+// the hashes of functions, so their stats should be recorded as functions.
+func (d *Database) RecordSelectorStats(bucket time.Time, stats map[client.SignatureType]map[string]*SelectorCounts) error {
+	return d.db.ExecTx(func(tx *database.Tx) error {
+		if err := tx.ExecBatch(func(stmt *database.Stmt) error {
+			for typ, counts := range stats {
+				for hash, c := range counts {
+					sel, err := hexutil.Decode(hash)
+					if err != nil {
+						return err
+					}
+
+					if _, err := stmt.Exec(context.Background(), string(typ), sel, bucket, c.Lookups, c.Misses); err != nil {
+						return fmt.Errorf("failed to record stats: %w", err)
+					}
+				}
+			}
+			return nil
+		}, `INSERT INTO selector_stats (type, hash, bucket, lookups, misses) VALUES ($1, $2, $3, $4, $5) ON CONFLICT (type, hash, bucket) DO UPDATE SET lookups = selector_stats.lookups + excluded.lookups, misses = selector_stats.misses + excluded.misses`); err != nil {
+			return err
+		}
+
+		return tx.ExecBatch(func(stmt *database.Stmt) error {
+			for typ, counts := range stats {
+				for hash, c := range counts {
+					if c.Lookups == 0 {
+						continue
+					}
+
+					sel, err := hexutil.Decode(hash)
+					if err != nil {
+						return err
+					}
+
+					if _, err := stmt.Exec(context.Background(), string(typ), sel, c.Lookups); err != nil {
+						return fmt.Errorf("failed to record popularity: %w", err)
+					}
+				}
+			}
+			return nil
+		}, `INSERT INTO selector_popularity (type, hash, lookups) VALUES ($1, $2, $3) ON CONFLICT (type, hash) DO UPDATE SET lookups = selector_popularity.lookups + excluded.lookups`)
+	})
+}
+
+var listPopularSelectorsQuery = `SELECT hash, sum(lookups), sum(misses) FROM selector_stats WHERE type = $1 AND bucket >= $2 GROUP BY hash ORDER BY sum(lookups) DESC, hash LIMIT $3`
+
+var listUnknownSelectorsQueries = map[client.SignatureType]string{
+	client.SignatureTypeFunction: `SELECT s.hash, sum(s.lookups), sum(s.misses) FROM selector_stats s WHERE s.type = $1 AND s.bucket >= $2 AND NOT EXISTS (SELECT 1 FROM fourbyte f WHERE f.hash = s.hash) GROUP BY s.hash HAVING sum(s.misses) > 0 ORDER BY sum(s.misses) DESC, s.hash LIMIT $3`,
+	client.SignatureTypeEvent:    `SELECT s.hash, sum(s.lookups), sum(s.misses) FROM selector_stats s WHERE s.type = $1 AND s.bucket >= $2 AND NOT EXISTS (SELECT 1 FROM thirtytwobyte f WHERE f.hash = s.hash) GROUP BY s.hash HAVING sum(s.misses) > 0 ORDER BY sum(s.misses) DESC, s.hash LIMIT $3`,
+}
+
+// ListSelectorStats returns the most looked up hashes since the given time. If unknown is set, only hashes which
+// still have no signatures are returned, ordered by the number of misses instead.
+func (d *Database) ListSelectorStats(typ client.SignatureType, since time.Time, unknown bool, limit int) ([]*client.SelectorStat, error) {
+	typ = storageType(typ)
+
+	query := listPopularSelectorsQuery
+	if unknown {
+		query = listUnknownSelectorsQueries[typ]
+	}
+
+	result := []*client.SelectorStat{}
+	if err := d.db.QuerySimple(func(rows pgx.Rows) error {
+		for rows.Next() {
+			var (
+				hash []byte
+				stat client.SelectorStat
+			)
+			if err := rows.Scan(&hash, &stat.Lookups, &stat.Misses); err != nil {
+				return fmt.Errorf("failed to scan: %w", err)
+			}
+			stat.Hash = hexutil.Encode(hash)
+			result = append(result, &stat)
+		}
+		return nil
+	}, query, string(typ), since, limit); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// PruneSelectorStats deletes the stats of every bucket before the given time, and takes their lookups off the
+// popularity of their hashes
+func (d *Database) PruneSelectorStats(before time.Time) error {
+	return d.db.ExecTx(func(tx *database.Tx) error {
+		if _, err := tx.Exec(context.Background(), `WITH pruned AS (DELETE FROM selector_stats WHERE bucket < $1 RETURNING type, hash, lookups) UPDATE selector_popularity p SET lookups = p.lookups - d.lookups FROM (SELECT type, hash, sum(lookups) AS lookups FROM pruned GROUP BY type, hash) d WHERE p.type = d.type AND p.hash = d.hash`, before); err != nil {
+			return fmt.Errorf("failed to prune stats: %w", err)
+		}
+
+		_, err := tx.Exec(context.Background(), `DELETE FROM selector_popularity WHERE lookups <= 0`)
+		return err
+	})
+}
@@ -0,0 +1,82 @@
+package database
+
+import (
+	"fmt"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"io"
+	"time"
+)
+
+// Storage is implemented by every backend the service can store signatures in
+type Storage interface {
+	SaveSignatures(typ client.SignatureType, names []string) (*client.ImportResponseDetails, error)
+	SaveSignaturesWithSource(typ client.SignatureType, names []string, source string) (*client.ImportResponseDetails, error)
+	LoadSignatures(typ client.SignatureType, sels []string) (map[string][]*client.SignatureData, error)
+	QuerySignatures(query string) (map[client.SignatureType]map[string][]*client.SignatureData, error)
+	CountSignatures(typ client.SignatureType) (int, error)
+	ExportData(w io.Writer) error
+	ExportSignatures(typ client.SignatureType, apply func(name string, hash []byte, createdAt time.Time) error) error
+	// ExportCursor returns a cursor for ExportChanges, which calls apply for every change made between two cursors.
+	// Changes may be repeated across consecutive ranges, but are never missed.
+	ExportCursor() (uint64, error)
+	// ExportCursorAt returns a cursor for ExportChanges which includes every change made at or after t
+	ExportCursorAt(t time.Time) (uint64, error)
+	ExportChanges(typ client.SignatureType, since uint64, until uint64, apply func(change *SignatureChange) error) error
+	BulkImportSignatures(typ client.SignatureType, names []string, hashes [][]byte) (int64, error)
+
+	ListCollisions(typ client.SignatureType, after string, limit int) (map[string][]*client.SignatureData, []string, error)
+	LoadPreferredSignatures(typ client.SignatureType) (map[string]string, error)
+	SetPreferredSignature(typ client.SignatureType, name string) error
+	DeletePreferredSignature(typ client.SignatureType, hash string) error
+
+	DeleteSignatures(typ client.SignatureType, names []string) ([]string, error)
+	SetQuarantined(typ client.SignatureType, names []string, quarantined bool, reason string) ([]string, error)
+	ListQuarantinedSignatures(typ client.SignatureType, after string, limit int) ([]*client.QuarantinedSignature, error)
+
+	LoadSignatureEntries(typ client.SignatureType, hash []byte) ([]*SignatureEntry, error)
+	SearchSignatureEntries(typ client.SignatureType, query string, expected map[string]string, offset int, limit int) ([]*SignatureEntry, error)
+
+	QueueGuessTasks(typ client.SignatureType, hashes [][]byte) error
+	LoadGuessTasks(typ client.SignatureType, hashes [][]byte) (map[string]*GuessTask, error)
+	NextGuessTask() (*GuessTask, error)
+	UpdateGuessTask(task *GuessTask) error
+	ListArgumentLists(typ client.SignatureType, limit int) ([]string, error)
+
+	RecordSelectorStats(bucket time.Time, stats map[client.SignatureType]map[string]*SelectorCounts) error
+	ListSelectorStats(typ client.SignatureType, since time.Time, unknown bool, limit int) ([]*client.SelectorStat, error)
+	PruneSelectorStats(before time.Time) error
+
+	CreateAPIKey(name string, keyHash []byte, scopes []client.APIKeyScope) (*client.APIKey, error)
+	LoadAPIKey(keyHash []byte) (*client.APIKey, error)
+	ListAPIKeys() ([]*client.APIKey, error)
+	DeleteAPIKey(id int) (bool, error)
+	RecordAPIKeyUsage(usage map[int]*APIKeyUsage) error
+}
+
+// SignatureChange is a signature which was added to or removed from the exported signatures. Deleted and
+// quarantined signatures are removed, and released signatures are added again.
+type SignatureChange struct {
+	Name      string
+	Hash      []byte
+	Removed   bool
+	ChangedAt time.Time
+}
+
+var (
+	_ Storage = (*Database)(nil)
+	_ Storage = (*BoltDatabase)(nil)
+)
+
+// exportData writes every signature in the original export format of one "0xhash,name" pair per line
+func exportData(storage Storage, w io.Writer) error {
+	for _, typ := range client.SignatureTypes() {
+		if err := storage.ExportSignatures(typ, func(name string, hash []byte, createdAt time.Time) error {
+			_, err := io.WriteString(w, fmt.Sprintf("0x%x,%s\n", hash, name))
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,468 @@
+package database
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBoltStorage(t *testing.T) {
+	db, err := NewBolt(filepath.Join(t.TempDir(), "signatures.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	testStorage(t, db)
+}
+
+// TestPostgresStorage runs against the database given by the TEST_POSTGRES_* environment variables. The tests
+// only touch signatures they create themselves, but should still be pointed at a throwaway database.
+func TestPostgresStorage(t *testing.T) {
+	host := os.Getenv("TEST_POSTGRES_HOST")
+	if host == "" {
+		t.Skip("TEST_POSTGRES_HOST is not set")
+	}
+
+	getenv := func(key string, def string) string {
+		if v := os.Getenv(key); v != "" {
+			return v
+		}
+		return def
+	}
+
+	port, err := strconv.Atoi(getenv("TEST_POSTGRES_PORT", "5432"))
+	require.NoError(t, err)
+
+	db, err := New(host, port, getenv("TEST_POSTGRES_DB", "postgres"), getenv("TEST_POSTGRES_USER", "ethereum"), getenv("TEST_POSTGRES_PASS", "ethereum"))
+	require.NoError(t, err)
+
+	testStorage(t, db)
+}
+
+func randomBytes(t *testing.T, n int) []byte {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	require.NoError(t, err)
+	return b
+}
+
+func testStorage(t *testing.T, db Storage) {
+	// every name is unique to this run, so the suite can run against a database which already has data
+	prefix := "test" + hex.EncodeToString(randomBytes(t, 8))
+	name := func(suffix string) string {
+		return prefix + suffix + "(uint256)"
+	}
+	hash := func(name string) string {
+		return hexutil.Encode(crypto.Keccak256([]byte(name))[:4])
+	}
+
+	// every change made by the suite is after this cursor, and this time
+	startTime := time.Now().Add(-time.Minute)
+	start, err := db.ExportCursor()
+	require.NoError(t, err)
+
+	t.Run("SaveSignatures", func(t *testing.T) {
+		before, err := db.CountSignatures(client.SignatureTypeFunction)
+		require.NoError(t, err)
+
+		resp, err := db.SaveSignatures(client.SignatureTypeFunction, []string{name("a"), name("b")})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{name("a"): hash(name("a")), name("b"): hash(name("b"))}, resp.Imported)
+		assert.Empty(t, resp.Duplicated)
+
+		resp, err = db.SaveSignatures(client.SignatureTypeFunction, []string{name("a")})
+		require.NoError(t, err)
+		assert.Empty(t, resp.Imported)
+		assert.Equal(t, map[string]string{name("a"): hash(name("a"))}, resp.Duplicated)
+
+		after, err := db.CountSignatures(client.SignatureTypeFunction)
+		require.NoError(t, err)
+		assert.Equal(t, before+2, after)
+	})
+
+	t.Run("LoadSignatures", func(t *testing.T) {
+		unknown := hexutil.Encode(randomBytes(t, 4))
+
+		result, err := db.LoadSignatures(client.SignatureTypeFunction, []string{hash(name("a")), unknown})
+		require.NoError(t, err)
+		require.Len(t, result[hash(name("a"))], 1)
+		assert.Equal(t, name("a"), result[hash(name("a"))][0].Name)
+		assert.Empty(t, result[unknown])
+
+		// errors share the storage of functions
+		result, err = db.LoadSignatures(client.SignatureTypeError, []string{hash(name("b"))})
+		require.NoError(t, err)
+		assert.Len(t, result[hash(name("b"))], 1)
+	})
+
+	t.Run("QuerySignatures", func(t *testing.T) {
+		result, err := db.QuerySignatures(prefix + "?(*")
+		require.NoError(t, err)
+		assert.Len(t, result[client.SignatureTypeFunction], 2)
+		assert.Empty(t, result[client.SignatureTypeEvent])
+
+		_, err = db.QuerySignatures("invalid query")
+		assert.Error(t, err)
+	})
+
+	t.Run("Export", func(t *testing.T) {
+		var names []string
+		require.NoError(t, db.ExportSignatures(client.SignatureTypeFunction, func(n string, h []byte, createdAt time.Time) error {
+			if strings.HasPrefix(n, prefix) {
+				names = append(names, n)
+				assert.Equal(t, hash(n), hexutil.Encode(h))
+			}
+			return nil
+		}))
+		assert.ElementsMatch(t, []string{name("a"), name("b")}, names)
+
+		var buf bytes.Buffer
+		require.NoError(t, db.ExportData(&buf))
+		assert.Contains(t, buf.String(), hash(name("a"))+","+name("a")+"\n")
+	})
+
+	// the database trusts the hashes given to bulk imports, which makes it possible to fake collisions
+	collision := randomBytes(t, 4)
+	collision[0] |= 1
+
+	t.Run("BulkImportSignatures", func(t *testing.T) {
+		imported, err := db.BulkImportSignatures(client.SignatureTypeFunction, []string{name("c"), name("d"), name("a")}, [][]byte{collision, collision, crypto.Keccak256([]byte(name("a")))[:4]})
+		require.NoError(t, err)
+		assert.Equal(t, int64(2), imported)
+	})
+
+	t.Run("ListCollisions", func(t *testing.T) {
+		after := make([]byte, 4)
+		binary.BigEndian.PutUint32(after, binary.BigEndian.Uint32(collision)-1)
+
+		result, order, err := db.ListCollisions(client.SignatureTypeFunction, hexutil.Encode(after), 1)
+		require.NoError(t, err)
+		require.Equal(t, []string{hexutil.Encode(collision)}, order)
+		require.Len(t, result[order[0]], 2)
+		assert.Equal(t, name("c"), result[order[0]][0].Name)
+		assert.Equal(t, name("d"), result[order[0]][1].Name)
+	})
+
+	t.Run("PreferredSignatures", func(t *testing.T) {
+		require.NoError(t, db.SetPreferredSignature(client.SignatureTypeFunction, name("a")))
+
+		preferred, err := db.LoadPreferredSignatures(client.SignatureTypeFunction)
+		require.NoError(t, err)
+		assert.Equal(t, name("a"), preferred[hash(name("a"))])
+
+		require.NoError(t, db.DeletePreferredSignature(client.SignatureTypeFunction, hash(name("a"))))
+
+		preferred, err = db.LoadPreferredSignatures(client.SignatureTypeFunction)
+		require.NoError(t, err)
+		assert.NotContains(t, preferred, hash(name("a")))
+	})
+
+	t.Run("SignatureEntries", func(t *testing.T) {
+		entries, err := db.LoadSignatureEntries(client.SignatureTypeFunction, collision)
+		require.NoError(t, err)
+		require.Len(t, entries, 2)
+		assert.Less(t, entries[0].ID, entries[1].ID)
+		assert.Equal(t, name("c"), entries[0].Name)
+
+		entries, err = db.SearchSignatureEntries(client.SignatureTypeFunction, prefix+"*", nil, 1, 10)
+		require.NoError(t, err)
+		require.Len(t, entries, 3)
+		assert.Equal(t, name("b"), entries[0].Name)
+
+		// unexpected signatures are skipped before the page is cut out
+		expected := map[string]string{hexutil.Encode(collision): name("d")}
+		entries, err = db.SearchSignatureEntries(client.SignatureTypeFunction, prefix+"*", expected, 2, 10)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, name("d"), entries[0].Name)
+	})
+
+	t.Run("Moderation", func(t *testing.T) {
+		affected, err := db.SetQuarantined(client.SignatureTypeFunction, []string{name("c"), name("missing")}, true, "spam")
+		require.NoError(t, err)
+		assert.Equal(t, []string{name("c")}, affected)
+
+		result, err := db.LoadSignatures(client.SignatureTypeFunction, []string{hexutil.Encode(collision)})
+		require.NoError(t, err)
+		for _, sig := range result[hexutil.Encode(collision)] {
+			assert.Equal(t, sig.Name == name("c"), sig.Quarantined)
+			if sig.Quarantined {
+				assert.Equal(t, "spam", sig.FlagReason)
+			}
+		}
+
+		quarantined, err := db.ListQuarantinedSignatures(client.SignatureTypeFunction, prefix, 10)
+		require.NoError(t, err)
+		require.NotEmpty(t, quarantined)
+		assert.Equal(t, name("c"), quarantined[0].Name)
+
+		entries, err := db.SearchSignatureEntries(client.SignatureTypeFunction, prefix+"*", nil, 0, 10)
+		require.NoError(t, err)
+		assert.Len(t, entries, 3)
+
+		affected, err = db.SetQuarantined(client.SignatureTypeFunction, []string{name("c")}, false, "")
+		require.NoError(t, err)
+		assert.Equal(t, []string{name("c")}, affected)
+
+		deleted, err := db.DeleteSignatures(client.SignatureTypeFunction, []string{name("c"), name("d")})
+		require.NoError(t, err)
+		assert.ElementsMatch(t, []string{name("c"), name("d")}, deleted)
+
+		result, err = db.LoadSignatures(client.SignatureTypeFunction, []string{hexutil.Encode(collision)})
+		require.NoError(t, err)
+		assert.Empty(t, result[hexutil.Encode(collision)])
+	})
+
+	t.Run("ExportChanges", func(t *testing.T) {
+		until, err := db.ExportCursor()
+		require.NoError(t, err)
+
+		// replaying the changes in order leaves the signatures which are still exported
+		exported := make(map[string]bool)
+		removed := make(map[string]bool)
+		require.NoError(t, db.ExportChanges(client.SignatureTypeFunction, start, until, func(change *SignatureChange) error {
+			if strings.HasPrefix(change.Name, prefix) {
+				exported[change.Name] = !change.Removed
+				if change.Removed {
+					removed[change.Name] = true
+				}
+			}
+			return nil
+		}))
+		assert.Equal(t, map[string]bool{name("a"): true, name("b"): true, name("c"): false, name("d"): false}, exported)
+		assert.Equal(t, map[string]bool{name("c"): true, name("d"): true}, removed)
+
+		require.NoError(t, db.ExportChanges(client.SignatureTypeEvent, start, until, func(change *SignatureChange) error {
+			assert.False(t, strings.HasPrefix(change.Name, prefix))
+			return nil
+		}))
+
+		// a cursor for a time includes every change made since
+		changes := func(since uint64) []string {
+			var names []string
+			require.NoError(t, db.ExportChanges(client.SignatureTypeFunction, since, until, func(change *SignatureChange) error {
+				if strings.HasPrefix(change.Name, prefix) {
+					names = append(names, change.Name)
+				}
+				return nil
+			}))
+			return names
+		}
+
+		since, err := db.ExportCursorAt(startTime)
+		require.NoError(t, err)
+		assert.Equal(t, changes(start), changes(since))
+
+		since, err = db.ExportCursorAt(time.Now().Add(time.Hour))
+		require.NoError(t, err)
+		assert.Empty(t, changes(since))
+	})
+
+	t.Run("GuessTasks", func(t *testing.T) {
+		guessed := prefix + "Guessed(" + prefix + ")"
+		guessedHash := crypto.Keccak256([]byte(guessed))[:4]
+
+		require.NoError(t, db.QueueGuessTasks(client.SignatureTypeFunction, [][]byte{guessedHash}))
+		require.NoError(t, db.QueueGuessTasks(client.SignatureTypeFunction, [][]byte{guessedHash}))
+
+		tasks, err := db.LoadGuessTasks(client.SignatureTypeFunction, [][]byte{guessedHash, randomBytes(t, 4)})
+		require.NoError(t, err)
+		require.Len(t, tasks, 1)
+
+		task := tasks[hexutil.Encode(guessedHash)]
+		require.NotNil(t, task)
+		assert.Equal(t, client.GuessStatusPending, task.Status)
+		assert.Equal(t, int64(0), task.Position)
+
+		next, err := db.NextGuessTask()
+		require.NoError(t, err)
+		require.NotNil(t, next)
+
+		task.Space = "space"
+		task.Position = 1000
+		require.NoError(t, db.UpdateGuessTask(task))
+
+		tasks, err = db.LoadGuessTasks(client.SignatureTypeFunction, [][]byte{guessedHash})
+		require.NoError(t, err)
+		assert.Equal(t, "space", tasks[hexutil.Encode(guessedHash)].Space)
+		assert.Equal(t, int64(1000), tasks[hexutil.Encode(guessedHash)].Position)
+
+		resp, err := db.SaveSignaturesWithSource(client.SignatureTypeFunction, []string{guessed}, client.SignatureSourceGuessed)
+		require.NoError(t, err)
+		assert.Contains(t, resp.Imported, guessed)
+
+		task.Status = client.GuessStatusFound
+		task.Name = guessed
+		require.NoError(t, db.UpdateGuessTask(task))
+
+		tasks, err = db.LoadGuessTasks(client.SignatureTypeFunction, [][]byte{guessedHash})
+		require.NoError(t, err)
+		assert.Equal(t, client.GuessStatusFound, tasks[hexutil.Encode(guessedHash)].Status)
+		assert.Equal(t, guessed, tasks[hexutil.Encode(guessedHash)].Name)
+
+		result, err := db.LoadSignatures(client.SignatureTypeFunction, []string{hexutil.Encode(guessedHash)})
+		require.NoError(t, err)
+		require.Len(t, result[hexutil.Encode(guessedHash)], 1)
+		assert.Equal(t, client.SignatureSourceGuessed, result[hexutil.Encode(guessedHash)][0].Source)
+
+		args, err := db.ListArgumentLists(client.SignatureTypeFunction, 1000000)
+		require.NoError(t, err)
+		assert.Contains(t, args, "("+prefix+")")
+		assert.Contains(t, args, "(uint256)")
+	})
+
+	t.Run("SelectorStats", func(t *testing.T) {
+		unknown := hexutil.Encode(randomBytes(t, 4))
+		bucket := time.Now().UTC().Truncate(time.Hour)
+
+		for i := 0; i < 2; i++ {
+			require.NoError(t, db.RecordSelectorStats(bucket, map[client.SignatureType]map[string]*SelectorCounts{
+				client.SignatureTypeFunction: {
+					hash(name("a")): {Lookups: 5},
+					unknown:         {Lookups: 2, Misses: 2},
+				},
+			}))
+		}
+
+		find := func(stats []*client.SelectorStat, hash string) *client.SelectorStat {
+			for _, stat := range stats {
+				if stat.Hash == hash {
+					return stat
+				}
+			}
+			return nil
+		}
+
+		popular, err := db.ListSelectorStats(client.SignatureTypeFunction, bucket, false, 1000000)
+		require.NoError(t, err)
+		require.NotNil(t, find(popular, hash(name("a"))))
+		assert.Equal(t, int64(10), find(popular, hash(name("a"))).Lookups)
+		assert.NotNil(t, find(popular, unknown))
+
+		unknowns, err := db.ListSelectorStats(client.SignatureTypeFunction, bucket, true, 1000000)
+		require.NoError(t, err)
+		assert.Nil(t, find(unknowns, hash(name("a"))))
+		require.NotNil(t, find(unknowns, unknown))
+		assert.Equal(t, int64(4), find(unknowns, unknown).Misses)
+
+		// errors share the stats of functions
+		unknowns, err = db.ListSelectorStats(client.SignatureTypeError, bucket, true, 1000000)
+		require.NoError(t, err)
+		assert.NotNil(t, find(unknowns, unknown))
+
+		// stats outside of the window are ignored, and pruned
+		old := time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC)
+		require.NoError(t, db.RecordSelectorStats(old, map[client.SignatureType]map[string]*SelectorCounts{
+			client.SignatureTypeFunction: {unknown: {Lookups: 1, Misses: 1}},
+		}))
+
+		unknowns, err = db.ListSelectorStats(client.SignatureTypeFunction, bucket, true, 1000000)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), find(unknowns, unknown).Misses)
+
+		require.NoError(t, db.PruneSelectorStats(old.Add(time.Hour)))
+
+		unknowns, err = db.ListSelectorStats(client.SignatureTypeFunction, time.Time{}, true, 1000000)
+		require.NoError(t, err)
+		assert.Equal(t, int64(4), find(unknowns, unknown).Misses)
+	})
+
+	t.Run("SearchPopularity", func(t *testing.T) {
+		// searches return the 100 most looked up matches, so only popular signatures survive the cut
+		var names []string
+		for i := 0; i < 150; i++ {
+			names = append(names, name(fmt.Sprintf("p%d", i)))
+		}
+		_, err := db.SaveSignatures(client.SignatureTypeFunction, names)
+		require.NoError(t, err)
+
+		record := func(bucket time.Time, names []string, lookups int64) {
+			counts := make(map[string]*SelectorCounts)
+			for _, name := range names {
+				counts[hash(name)] = &SelectorCounts{Lookups: lookups}
+			}
+			require.NoError(t, db.RecordSelectorStats(bucket, map[client.SignatureType]map[string]*SelectorCounts{
+				client.SignatureTypeFunction: counts,
+			}))
+		}
+		assertFound := func(names []string) {
+			result, err := db.QuerySignatures(prefix + "p*")
+			require.NoError(t, err)
+
+			var missing []string
+			for _, name := range names {
+				if _, ok := result[client.SignatureTypeFunction][hash(name)]; !ok {
+					missing = append(missing, name)
+				}
+			}
+			assert.Empty(t, missing)
+		}
+
+		old := time.Now().UTC().Truncate(time.Hour).Add(-24 * time.Hour)
+		record(old, names[:60], 10)
+		assertFound(names[:60])
+
+		// once the old stats are pruned they no longer count towards popularity
+		record(time.Now().UTC().Truncate(time.Hour), names[90:], 5)
+		require.NoError(t, db.PruneSelectorStats(old.Add(time.Hour)))
+		assertFound(names[90:])
+	})
+
+	t.Run("APIKeys", func(t *testing.T) {
+		keyHash := randomBytes(t, 32)
+
+		key, err := db.CreateAPIKey(prefix, keyHash, []client.APIKeyScope{client.APIKeyScopeImport})
+		require.NoError(t, err)
+		assert.Equal(t, prefix, key.Name)
+		assert.Nil(t, key.LastUsedAt)
+
+		loaded, err := db.LoadAPIKey(keyHash)
+		require.NoError(t, err)
+		require.NotNil(t, loaded)
+		assert.Equal(t, key.ID, loaded.ID)
+		assert.True(t, loaded.HasScope(client.APIKeyScopeImport))
+		assert.False(t, loaded.HasScope(client.APIKeyScopeAdmin))
+
+		missing, err := db.LoadAPIKey(randomBytes(t, 32))
+		require.NoError(t, err)
+		assert.Nil(t, missing)
+
+		require.NoError(t, db.RecordAPIKeyUsage(map[int]*APIKeyUsage{
+			key.ID: {Requests: 3, RateLimited: 1, LastUsedAt: time.Now()},
+		}))
+
+		keys, err := db.ListAPIKeys()
+		require.NoError(t, err)
+		var found *client.APIKey
+		for _, k := range keys {
+			if k.ID == key.ID {
+				found = k
+			}
+		}
+		require.NotNil(t, found)
+		assert.Equal(t, int64(3), found.Requests)
+		assert.Equal(t, int64(1), found.RateLimited)
+		assert.NotNil(t, found.LastUsedAt)
+
+		deleted, err := db.DeleteAPIKey(key.ID)
+		require.NoError(t, err)
+		assert.True(t, deleted)
+
+		deleted, err = db.DeleteAPIKey(key.ID)
+		require.NoError(t, err)
+		assert.False(t, deleted)
+	})
+}
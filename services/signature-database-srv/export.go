@@ -0,0 +1,334 @@
+package signature_database_srv
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/klauspost/compress/zstd"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"time"
+)
+
+type exportFormat string
+
+const (
+	exportFormatText    exportFormat = "txt"
+	exportFormatCSV     exportFormat = "csv"
+	exportFormatNDJSON  exportFormat = "ndjson"
+	exportFormatParquet exportFormat = "parquet"
+)
+
+func exportFormats() []exportFormat {
+	return []exportFormat{exportFormatText, exportFormatCSV, exportFormatNDJSON, exportFormatParquet}
+}
+
+func (f exportFormat) Valid() bool {
+	return f == exportFormatText || f == exportFormatCSV || f == exportFormatNDJSON || f == exportFormatParquet
+}
+
+// Incremental returns whether the format can hold incremental exports, which need to record removed signatures
+func (f exportFormat) Incremental() bool {
+	return f != exportFormatText
+}
+
+func (f exportFormat) ContentType() string {
+	switch f {
+	case exportFormatCSV:
+		return "text/csv"
+	case exportFormatNDJSON:
+		return "application/x-ndjson"
+	case exportFormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "text/plain"
+	}
+}
+
+type exportCompression string
+
+const (
+	exportCompressionNone exportCompression = ""
+	exportCompressionGzip exportCompression = "gzip"
+	exportCompressionZstd exportCompression = "zstd"
+)
+
+func exportCompressions() []exportCompression {
+	return []exportCompression{exportCompressionNone, exportCompressionGzip, exportCompressionZstd}
+}
+
+func (c exportCompression) Valid() bool {
+	return c == exportCompressionNone || c == exportCompressionGzip || c == exportCompressionZstd
+}
+
+func (c exportCompression) Extension() string {
+	switch c {
+	case exportCompressionGzip:
+		return ".gz"
+	case exportCompressionZstd:
+		return ".zst"
+	default:
+		return ""
+	}
+}
+
+func (c exportCompression) ContentType() string {
+	switch c {
+	case exportCompressionGzip:
+		return "application/gzip"
+	case exportCompressionZstd:
+		return "application/zstd"
+	default:
+		return ""
+	}
+}
+
+// exportScopeAll is used in place of a signature type for exports which contain every type
+const exportScopeAll = "all"
+
+func exportFileName(scope string, format exportFormat, compression exportCompression) string {
+	return fmt.Sprintf("%s.%s%s", scope, format, compression.Extension())
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+func newCompressor(compression exportCompression, w io.Writer) (io.WriteCloser, error) {
+	switch compression {
+	case exportCompressionGzip:
+		return gzip.NewWriter(w), nil
+	case exportCompressionZstd:
+		return zstd.NewWriter(w)
+	default:
+		return nopWriteCloser{w}, nil
+	}
+}
+
+type signatureEncoder interface {
+	Encode(entry *client.ExportEntry) error
+	// Flush writes any buffered data to the underlying writer, after which nothing else can be encoded
+	Flush() error
+}
+
+func newSignatureEncoder(format exportFormat, w io.Writer) (signatureEncoder, error) {
+	switch format {
+	case exportFormatCSV:
+		csvWriter := csv.NewWriter(w)
+		if err := csvWriter.Write([]string{"type", "hash", "name", "created_at", "removed"}); err != nil {
+			return nil, err
+		}
+		return &csvEncoder{w: csvWriter}, nil
+	case exportFormatNDJSON:
+		return &ndjsonEncoder{enc: json.NewEncoder(w)}, nil
+	case exportFormatParquet:
+		return newParquetEncoder(w)
+	default:
+		return &textEncoder{w: w}, nil
+	}
+}
+
+// textEncoder writes the original export format of one "0xhash,name" pair per line, which can't record removals
+type textEncoder struct {
+	w io.Writer
+}
+
+func (e *textEncoder) Encode(entry *client.ExportEntry) error {
+	_, err := fmt.Fprintf(e.w, "%s,%s\n", entry.Hash, entry.Name)
+	return err
+}
+
+func (e *textEncoder) Flush() error {
+	return nil
+}
+
+type csvEncoder struct {
+	w *csv.Writer
+}
+
+func (e *csvEncoder) Encode(entry *client.ExportEntry) error {
+	return e.w.Write([]string{string(entry.Type), entry.Hash, entry.Name, entry.CreatedAt.UTC().Format(time.RFC3339), strconv.FormatBool(entry.Removed)})
+}
+
+func (e *csvEncoder) Flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
+
+type ndjsonEncoder struct {
+	enc *json.Encoder
+}
+
+func (e *ndjsonEncoder) Encode(entry *client.ExportEntry) error {
+	return e.enc.Encode(entry)
+}
+
+func (e *ndjsonEncoder) Flush() error {
+	return nil
+}
+
+// exportTarget is a single file being written as part of a full export
+type exportTarget struct {
+	scope      string
+	file       *os.File
+	buffer     *bufio.Writer
+	compressor io.WriteCloser
+	encoder    signatureEncoder
+}
+
+func newExportTarget(dir string, scope string, format exportFormat, compression exportCompression) (*exportTarget, error) {
+	f, err := os.Create(path.Join(dir, exportFileName(scope, format, compression)))
+	if err != nil {
+		return nil, err
+	}
+
+	target := &exportTarget{
+		scope:  scope,
+		file:   f,
+		buffer: bufio.NewWriter(f),
+	}
+
+	target.compressor, err = newCompressor(compression, target.buffer)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	target.encoder, err = newSignatureEncoder(format, target.compressor)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+
+	return target, nil
+}
+
+func (t *exportTarget) Close() error {
+	if err := t.encoder.Flush(); err != nil {
+		t.file.Close()
+		return err
+	}
+	if err := t.compressor.Close(); err != nil {
+		t.file.Close()
+		return err
+	}
+	if err := t.buffer.Flush(); err != nil {
+		t.file.Close()
+		return err
+	}
+	return t.file.Close()
+}
+
+// writeFullExport writes every combination of signature type, format and compression into dir, reading each
+// signature type from the database exactly once. It returns the cursor to pass to incremental exports to get every
+// change made after the export.
+func (s *Service) writeFullExport(dir string) (uint64, error) {
+	var targets []*exportTarget
+	closeTargets := func() error {
+		var firstErr error
+		for _, target := range targets {
+			if err := target.Close(); err != nil && firstErr == nil {
+				firstErr = err
+			}
+		}
+		targets = nil
+		return firstErr
+	}
+	defer closeTargets()
+
+	// taking the cursor first means changes made during the export are repeated by the next incremental export
+	// instead of being lost
+	cursor, err := s.db.ExportCursor()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get export cursor: %w", err)
+	}
+
+	scopes := []string{exportScopeAll}
+	for _, typ := range client.SignatureTypes() {
+		scopes = append(scopes, string(typ))
+	}
+
+	for _, scope := range scopes {
+		for _, format := range exportFormats() {
+			for _, compression := range exportCompressions() {
+				target, err := newExportTarget(dir, scope, format, compression)
+				if err != nil {
+					return 0, fmt.Errorf("failed to create export file: %w", err)
+				}
+				targets = append(targets, target)
+			}
+		}
+	}
+
+	for _, typ := range client.SignatureTypes() {
+		var typeTargets []*exportTarget
+		for _, target := range targets {
+			if target.scope == exportScopeAll || target.scope == string(typ) {
+				typeTargets = append(typeTargets, target)
+			}
+		}
+
+		if err := s.db.ExportSignatures(typ, func(name string, hash []byte, createdAt time.Time) error {
+			entry := &client.ExportEntry{
+				Type:      typ,
+				Hash:      hexutil.Encode(hash),
+				Name:      name,
+				CreatedAt: createdAt.UTC(),
+			}
+			for _, target := range typeTargets {
+				if err := target.encoder.Encode(entry); err != nil {
+					return err
+				}
+			}
+			return nil
+		}); err != nil {
+			return 0, fmt.Errorf("failed to export %s signatures: %w", typ, err)
+		}
+	}
+
+	return cursor, closeTargets()
+}
+
+// writeIncrementalExport streams every change to the given types between the since and until cursors directly to w
+func (s *Service) writeIncrementalExport(w io.Writer, types []client.SignatureType, since uint64, until uint64, format exportFormat, compression exportCompression) error {
+	compressor, err := newCompressor(compression, w)
+	if err != nil {
+		return err
+	}
+
+	encoder, err := newSignatureEncoder(format, compressor)
+	if err != nil {
+		return err
+	}
+
+	for _, typ := range types {
+		if err := s.db.ExportChanges(typ, since, until, func(change *database.SignatureChange) error {
+			return encoder.Encode(&client.ExportEntry{
+				Type:      typ,
+				Hash:      hexutil.Encode(change.Hash),
+				Name:      change.Name,
+				CreatedAt: change.ChangedAt.UTC(),
+				Removed:   change.Removed,
+			})
+		}); err != nil {
+			return err
+		}
+	}
+
+	if err := encoder.Flush(); err != nil {
+		return err
+	}
+
+	return compressor.Close()
+}
@@ -0,0 +1,121 @@
+package signature_database_srv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/importer"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncrementalExport(t *testing.T) {
+	db, err := database.NewBolt(filepath.Join(t.TempDir(), "signatures.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	s := &Service{config: &Config{}, db: db}
+
+	_, err = db.SaveSignatures(client.SignatureTypeFunction, []string{"a()", "b()"})
+	require.NoError(t, err)
+
+	since, err := s.writeFullExport(t.TempDir())
+	require.NoError(t, err)
+
+	_, err = db.SaveSignatures(client.SignatureTypeFunction, []string{"c()"})
+	require.NoError(t, err)
+	_, err = db.SetQuarantined(client.SignatureTypeFunction, []string{"a()"}, true, "spam")
+	require.NoError(t, err)
+	_, err = db.DeleteSignatures(client.SignatureTypeFunction, []string{"b()"})
+	require.NoError(t, err)
+
+	until, err := db.ExportCursor()
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	require.NoError(t, s.writeIncrementalExport(&buf, client.SignatureTypes(), since, until, exportFormatNDJSON, exportCompressionNone))
+
+	var changes []string
+	dec := json.NewDecoder(&buf)
+	for dec.More() {
+		var entry client.ExportEntry
+		require.NoError(t, dec.Decode(&entry))
+		if entry.Removed {
+			changes = append(changes, "-"+entry.Name)
+		} else {
+			changes = append(changes, "+"+entry.Name)
+		}
+	}
+	assert.Equal(t, []string{"+c()", "-a()", "-b()"}, changes)
+
+	// the csv export can be imported again, without the removed signatures
+	for _, format := range []exportFormat{exportFormatCSV, exportFormatNDJSON} {
+		path := filepath.Join(t.TempDir(), exportFileName("functions", format, exportCompressionNone))
+		f, err := os.Create(path)
+		require.NoError(t, err)
+		require.NoError(t, s.writeIncrementalExport(f, client.SignatureTypes(), since, until, format, exportCompressionNone))
+		require.NoError(t, f.Close())
+
+		reader, closer, err := importer.Open(path, importer.FormatAuto)
+		require.NoError(t, err)
+
+		var imported []string
+		for {
+			record, err := reader.Next()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(t, err)
+			imported = append(imported, record.Name)
+		}
+		closer.Close()
+		assert.Equal(t, []string{"c()"}, imported, format)
+	}
+
+	// nothing changed after until
+	buf.Reset()
+	require.NoError(t, s.writeIncrementalExport(&buf, client.SignatureTypes(), until, until, exportFormatNDJSON, exportCompressionNone))
+	assert.Empty(t, buf.String())
+}
+
+func TestParquetEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	e, err := newParquetEncoder(&buf)
+	require.NoError(t, err)
+
+	for _, name := range []string{"a()", "b()", "c()"} {
+		require.NoError(t, e.Encode(&client.ExportEntry{
+			Type:      client.SignatureTypeFunction,
+			Hash:      "0x0dbe671f",
+			Name:      name,
+			CreatedAt: time.Unix(1700000000, 0),
+			Removed:   name == "b()",
+		}))
+	}
+	require.NoError(t, e.Flush())
+
+	data := buf.Bytes()
+	require.Greater(t, len(data), 12)
+	assert.Equal(t, parquetMagic, string(data[:4]))
+	assert.Equal(t, parquetMagic, string(data[len(data)-4:]))
+
+	// the footer is the metadata followed by its length
+	footerLength := int(binary.LittleEndian.Uint32(data[len(data)-8:]))
+	require.Less(t, footerLength, len(data)-12)
+	footer := data[len(data)-8-footerLength : len(data)-8]
+	for _, column := range parquetColumns {
+		assert.Contains(t, string(footer), column.name)
+	}
+
+	// the removed column is bit packed, so only the second row is set
+	removed := data[len(data)-8-footerLength-1]
+	assert.Equal(t, byte(0b010), removed)
+}
@@ -0,0 +1,498 @@
+package signature_database_srv
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// guessIdleInterval is how long the guesser waits before checking for new tasks when the queue is empty
+	guessIdleInterval = 10 * time.Second
+
+	// guessSpaceRefreshInterval is how often the common argument lists are reloaded. Reloading changes the
+	// candidate space, which restarts any task which is in progress, so it shouldn't happen often.
+	guessSpaceRefreshInterval = 24 * time.Hour
+)
+
+// defaultGuessVerbs and defaultGuessNouns are the tokens names are built from when no dictionary is configured.
+// Past tense verbs are included for events, like OwnershipTransferred.
+var defaultGuessVerbs = []string{
+	"get", "set", "add", "remove", "update", "create", "delete", "transfer", "approve", "mint", "burn", "swap",
+	"deposit", "withdraw", "claim", "stake", "unstake", "lock", "unlock", "pause", "unpause", "enable", "disable",
+	"register", "execute", "cancel", "redeem", "borrow", "repay", "liquidate", "harvest", "compound", "buy", "sell",
+	"bid", "accept", "reject", "propose", "vote", "queue", "initialize", "upgrade", "emergency", "migrate", "sync",
+	"skim", "exit", "join", "is", "has", "can", "calculate", "preview", "max", "min", "total", "pending", "last",
+	"transferred", "approved", "minted", "burned", "updated", "changed", "added", "removed", "created", "deleted",
+	"paused", "unpaused", "deposited", "withdrawn", "claimed", "staked", "unstaked", "executed", "cancelled",
+	"registered", "set", "granted", "revoked", "initialized", "upgraded", "locked", "unlocked", "swapped",
+}
+
+var defaultGuessNouns = []string{
+	"owner", "ownership", "admin", "operator", "manager", "governance", "treasury", "fee", "fees", "rate", "price",
+	"amount", "balance", "supply", "token", "tokens", "asset", "assets", "share", "shares", "reward", "rewards",
+	"pool", "pair", "router", "factory", "vault", "strategy", "oracle", "liquidity", "collateral", "debt", "loan",
+	"position", "order", "orders", "auction", "proposal", "role", "roles", "whitelist", "blacklist", "allowance",
+	"nonce", "deadline", "period", "duration", "time", "timestamp", "block", "epoch", "round", "config", "params",
+	"limit", "threshold", "ratio", "index", "id", "uri", "name", "symbol", "decimals", "account", "accounts",
+	"user", "users", "receiver", "recipient", "sender", "spender", "delegate", "signer", "implementation", "proxy",
+	"bridge", "relayer", "keeper", "minter", "burner", "pauser", "guardian", "beneficiary", "wallet", "funds",
+	"eth", "ether", "weth", "stake", "lock", "unlock", "claim", "deposit", "withdrawal", "swap", "trade", "market",
+}
+
+// isValidGuessToken matches the tokens which can be used in an identifier
+var isValidGuessToken = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*$`).MatchString
+
+type guessDictionary struct {
+	Verbs []string `yaml:"verbs"`
+	Nouns []string `yaml:"nouns"`
+}
+
+// loadGuessDictionary returns the default dictionary, extended with the tokens in the YAML file at path if one is
+// given
+func loadGuessDictionary(path string) (*guessDictionary, error) {
+	dict := &guessDictionary{
+		Verbs: append([]string{}, defaultGuessVerbs...),
+		Nouns: append([]string{}, defaultGuessNouns...),
+	}
+	if path == "" {
+		return dict, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read guesser dictionary: %w", err)
+	}
+
+	var extra guessDictionary
+	if err := yaml.Unmarshal(data, &extra); err != nil {
+		return nil, fmt.Errorf("failed to parse guesser dictionary: %w", err)
+	}
+
+	for _, token := range append(append([]string{}, extra.Verbs...), extra.Nouns...) {
+		if !isValidGuessToken(token) {
+			return nil, fmt.Errorf("invalid token in guesser dictionary: %s", token)
+		}
+	}
+
+	dict.Verbs = append(dict.Verbs, extra.Verbs...)
+	dict.Nouns = append(dict.Nouns, extra.Nouns...)
+	return dict, nil
+}
+
+func capitalize(token string) string {
+	if token == "" {
+		return token
+	}
+	return strings.ToUpper(token[:1]) + token[1:]
+}
+
+// guessNames builds every name to try from the dictionary. Functions are camelCase, like transferOwnership, and
+// events are PascalCase, like OwnershipTransferred.
+func guessNames(typ client.SignatureType, dict *guessDictionary) []string {
+	seen := make(map[string]bool)
+
+	var names []string
+	add := func(name string) {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	if typ == client.SignatureTypeEvent {
+		for _, verb := range dict.Verbs {
+			add(capitalize(verb))
+		}
+		for _, noun := range dict.Nouns {
+			add(capitalize(noun))
+			for _, verb := range dict.Verbs {
+				add(capitalize(noun) + capitalize(verb))
+				add(capitalize(verb) + capitalize(noun))
+			}
+		}
+		return names
+	}
+
+	for _, verb := range dict.Verbs {
+		add(verb)
+		for _, noun := range dict.Nouns {
+			add(verb + capitalize(noun))
+		}
+	}
+	for _, noun := range dict.Nouns {
+		add(noun)
+	}
+	return names
+}
+
+// guessSpace is every combination of a name and an argument list. Candidates are numbered so that a task can
+// record how far it got, and the fingerprint identifies the space so a task can tell when it has changed.
+type guessSpace struct {
+	names       []string
+	args        []string
+	fingerprint string
+	loadedAt    time.Time
+}
+
+func newGuessSpace(names []string, args []string) *guessSpace {
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name))
+		h.Write([]byte{0})
+	}
+	h.Write([]byte{0})
+	for _, arg := range args {
+		h.Write([]byte(arg))
+		h.Write([]byte{0})
+	}
+
+	return &guessSpace{
+		names:       names,
+		args:        args,
+		fingerprint: hex.EncodeToString(h.Sum(nil)[:8]),
+		loadedAt:    time.Now(),
+	}
+}
+
+func (g *guessSpace) size() int64 {
+	return int64(len(g.names)) * int64(len(g.args))
+}
+
+func (g *guessSpace) candidate(i int64) string {
+	return g.names[i/int64(len(g.args))] + g.args[i%int64(len(g.args))]
+}
+
+// search tries the candidates from start up to but not including end, returning the first one which hashes to hash
+func (g *guessSpace) search(hash []byte, start int64, end int64) (string, bool) {
+	hasher := crypto.NewKeccakState()
+	buf := make([]byte, 32)
+
+	for i := start; i < end; i++ {
+		candidate := g.candidate(i)
+
+		hasher.Reset()
+		hasher.Write([]byte(candidate))
+		hasher.Read(buf)
+
+		if bytes.Equal(buf[:len(hash)], hash) {
+			return candidate, true
+		}
+	}
+
+	return "", false
+}
+
+// guessSpaceFor returns the candidate space for typ, reloading the argument lists when they're stale. It is only
+// called by the guesser, so it doesn't need a lock.
+func (s *Service) guessSpaceFor(typ client.SignatureType) (*guessSpace, error) {
+	if space, ok := s.guessSpaces[typ]; ok && time.Since(space.loadedAt) < guessSpaceRefreshInterval {
+		return space, nil
+	}
+
+	args, err := s.db.ListArgumentLists(typ, s.config.GuesserArgumentLists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list argument lists: %w", err)
+	}
+	if len(args) == 0 {
+		// there's nothing to learn from yet, so at least try functions without arguments
+		args = []string{"()"}
+	}
+
+	space := newGuessSpace(guessNames(typ, s.guessDictionary), args)
+	s.guessSpaces[typ] = space
+	return space, nil
+}
+
+func (s *Service) runGuesser() {
+	for {
+		worked, err := s.guessNext()
+		if err != nil {
+			log.WithError(err).Errorf("failed to guess signature")
+		}
+		if !worked || err != nil {
+			time.Sleep(guessIdleInterval)
+		}
+	}
+}
+
+// guessNext works on the oldest pending task until it is found or exhausted, returning false if there was no task.
+// Progress is saved after every batch, so a restart resumes where it left off as long as the candidate space is
+// unchanged.
+func (s *Service) guessNext() (bool, error) {
+	task, err := s.db.NextGuessTask()
+	if err != nil {
+		return false, err
+	}
+	if task == nil {
+		return false, nil
+	}
+
+	hash := hexutil.Encode(task.Hash)
+
+	// the hash may have been imported since it was queued
+	existing, err := s.db.LoadSignatures(task.Type, []string{hash})
+	if err != nil {
+		return false, err
+	}
+	if sigs := existing[hash]; len(sigs) > 0 {
+		task.Status = client.GuessStatusFound
+		task.Name = sigs[0].Name
+		return true, s.db.UpdateGuessTask(task)
+	}
+
+	space, err := s.guessSpaceFor(task.Type)
+	if err != nil {
+		return false, err
+	}
+	if task.Space != space.fingerprint {
+		task.Space = space.fingerprint
+		task.Position = 0
+	}
+
+	batch := int64(s.config.GuesserRate)
+	if batch < 1 {
+		batch = 1
+	}
+
+	for task.Position < space.size() {
+		start := time.Now()
+
+		end := task.Position + batch
+		if end > space.size() {
+			end = space.size()
+		}
+
+		name, ok := space.search(task.Hash, task.Position, end)
+		if ok {
+			return true, s.saveGuess(task, name)
+		}
+
+		task.Position = end
+		if err := s.db.UpdateGuessTask(task); err != nil {
+			return false, err
+		}
+
+		// each batch is a second's worth of candidates at the configured rate
+		time.Sleep(time.Second - time.Since(start))
+	}
+
+	log.WithFields(log.Fields{
+		"type":       task.Type,
+		"hash":       hash,
+		"candidates": space.size(),
+	}).Infof("exhausted guesses")
+
+	task.Status = client.GuessStatusExhausted
+	return true, s.db.UpdateGuessTask(task)
+}
+
+// unconfirmedGuessReason is why guessed functions are quarantined. Their hashes are only 32 bits, so across the whole
+// guess space the first match is about as likely to be a collision as the real signature.
+const unconfirmedGuessReason = "unconfirmed guess"
+
+// guessFlagReason returns why a guessed signature should be quarantined until a moderator confirms it, or an empty
+// string if the guess can be trusted. Guesses go through the same checks as imports, and function guesses are only
+// trusted if they are the expected signature for their hash.
+func (s *Service) guessFlagReason(typ client.SignatureType, name string, hash string) string {
+	expected, ok := s.expectedSignature(typ, hash)
+	if ok && expected == name {
+		return ""
+	}
+	if ok {
+		if reason := flagSignature(name, expected); reason != "" {
+			return reason
+		}
+	}
+
+	// events are matched on the full 32 byte hash, so a match is the real signature
+	if typ == client.SignatureTypeEvent {
+		return ""
+	}
+	return unconfirmedGuessReason
+}
+
+func (s *Service) saveGuess(task *database.GuessTask, name string) error {
+	resp, err := s.db.SaveSignaturesWithSource(task.Type, []string{name}, client.SignatureSourceGuessed)
+	if err != nil {
+		return fmt.Errorf("failed to save guessed signature: %w", err)
+	}
+
+	hash := hexutil.Encode(task.Hash)
+	if _, ok := resp.Imported[name]; ok {
+		if reason := s.guessFlagReason(task.Type, name, hash); reason != "" {
+			quarantined, err := s.db.SetQuarantined(task.Type, []string{name}, true, reason)
+			if err != nil {
+				return fmt.Errorf("failed to quarantine guessed signature: %w", err)
+			}
+			for _, name := range quarantined {
+				if resp.Quarantined == nil {
+					resp.Quarantined = make(map[string]string)
+				}
+				resp.Quarantined[name] = reason
+			}
+		}
+	}
+
+	log.WithFields(log.Fields{
+		"type":        task.Type,
+		"hash":        hash,
+		"name":        name,
+		"quarantined": resp.Quarantined[name],
+	}).Infof("guessed signature")
+
+	s.notifyImport(task.Type, resp)
+
+	task.Status = client.GuessStatusFound
+	task.Name = name
+	return s.db.UpdateGuessTask(task)
+}
+
+// guessTypes are the types which can be guessed, errors share the hashes of functions so are queued as functions
+var guessTypes = []client.SignatureType{client.SignatureTypeFunction, client.SignatureTypeEvent}
+
+func toGuessTask(task *database.GuessTask) *client.GuessTask {
+	queuedAt := task.QueuedAt
+	return &client.GuessTask{
+		Status:   task.Status,
+		Name:     task.Name,
+		Tried:    task.Position,
+		QueuedAt: &queuedAt,
+	}
+}
+
+// decodeGuessSelectors validates and normalizes the selectors of every type, failing the request if any are invalid
+func (s *Service) decodeGuessSelectors(w http.ResponseWriter, req client.GuessRequest) (map[client.SignatureType][]string, bool) {
+	total := 0
+	for typ, sels := range req {
+		if typ != client.SignatureTypeFunction && typ != client.SignatureTypeEvent {
+			fail(w, http.StatusBadRequest, nil, fmt.Sprintf("invalid signature type: %s", typ))
+			return nil, false
+		}
+		total += len(sels)
+	}
+	if total > s.config.MaxLookupBatchSize {
+		fail(w, http.StatusRequestEntityTooLarge, nil, fmt.Sprintf("too many selectors, the maximum is %d", s.config.MaxLookupBatchSize))
+		return nil, false
+	}
+
+	result := make(map[client.SignatureType][]string)
+	for _, typ := range guessTypes {
+		sels, err := normalizeSelectors(req[typ], signatureLens[typ])
+		if err != nil {
+			fail(w, http.StatusBadRequest, err, err.Error())
+			return nil, false
+		}
+		if len(sels) > 0 {
+			result[typ] = sels
+		}
+	}
+	return result, true
+}
+
+func decodeHashes(sels []string) [][]byte {
+	var hashes [][]byte
+	for _, sel := range sels {
+		// the selectors have already been validated
+		hashes = append(hashes, hexutil.MustDecode(sel))
+	}
+	return hashes
+}
+
+func (s *Service) serveQueueGuesses(w http.ResponseWriter, r *http.Request) {
+	var req client.GuessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, err, "failed to decode body")
+		return
+	}
+
+	selectors, ok := s.decodeGuessSelectors(w, req)
+	if !ok {
+		return
+	}
+
+	response := make(client.GuessResponse)
+	for typ, sels := range selectors {
+		response[typ] = make(map[string]*client.GuessTask)
+
+		existing, err := s.db.LoadSignatures(typ, sels)
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err, "failed to load signatures")
+			return
+		}
+
+		var unknown []string
+		for _, sel := range sels {
+			if sigs := existing[sel]; len(sigs) > 0 {
+				response[typ][sel] = &client.GuessTask{Status: client.GuessStatusKnown, Name: sigs[0].Name}
+			} else {
+				unknown = append(unknown, sel)
+			}
+		}
+		if len(unknown) == 0 {
+			continue
+		}
+
+		hashes := decodeHashes(unknown)
+		if err := s.db.QueueGuessTasks(typ, hashes); err != nil {
+			fail(w, http.StatusInternalServerError, err, "failed to queue guesses")
+			return
+		}
+
+		tasks, err := s.db.LoadGuessTasks(typ, hashes)
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err, "failed to load guesses")
+			return
+		}
+		for sel, task := range tasks {
+			response[typ][sel] = toGuessTask(task)
+		}
+	}
+
+	succeed(w, response)
+}
+
+func (s *Service) serveGuesses(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	req := make(client.GuessRequest)
+	for _, typ := range guessTypes {
+		if data := params.Get(string(typ)); data != "" {
+			req[typ] = strings.Split(data, ",")
+		}
+	}
+
+	selectors, ok := s.decodeGuessSelectors(w, req)
+	if !ok {
+		return
+	}
+
+	response := make(client.GuessResponse)
+	for typ, sels := range selectors {
+		tasks, err := s.db.LoadGuessTasks(typ, decodeHashes(sels))
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err, "failed to load guesses")
+			return
+		}
+
+		response[typ] = make(map[string]*client.GuessTask)
+		for sel, task := range tasks {
+			response[typ][sel] = toGuessTask(task)
+		}
+	}
+
+	succeed(w, response)
+}
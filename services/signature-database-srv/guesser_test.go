@@ -0,0 +1,106 @@
+package signature_database_srv
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGuessNames(t *testing.T) {
+	dict := &guessDictionary{Verbs: []string{"transfer", "transferred"}, Nouns: []string{"ownership"}}
+
+	assert.Equal(t, []string{"transfer", "transferOwnership", "transferred", "transferredOwnership", "ownership"}, guessNames(client.SignatureTypeFunction, dict))
+	assert.Contains(t, guessNames(client.SignatureTypeEvent, dict), "OwnershipTransferred")
+}
+
+func TestGuessSpace(t *testing.T) {
+	space := newGuessSpace([]string{"approve", "transferOwnership"}, []string{"()", "(address)", "(address,uint256)"})
+
+	assert.Equal(t, int64(6), space.size())
+	assert.Equal(t, "approve(address,uint256)", space.candidate(2))
+	assert.Equal(t, "transferOwnership(address)", space.candidate(4))
+
+	hash := crypto.Keccak256([]byte("transferOwnership(address)"))[:4]
+
+	name, ok := space.search(hash, 0, space.size())
+	assert.True(t, ok)
+	assert.Equal(t, "transferOwnership(address)", name)
+
+	// the search only covers the given range
+	_, ok = space.search(hash, 5, space.size())
+	assert.False(t, ok)
+
+	// the fingerprint changes with the space
+	assert.Equal(t, space.fingerprint, newGuessSpace([]string{"approve", "transferOwnership"}, []string{"()", "(address)", "(address,uint256)"}).fingerprint)
+	assert.NotEqual(t, space.fingerprint, newGuessSpace([]string{"approve"}, []string{"()", "(address)", "(address,uint256)"}).fingerprint)
+}
+
+func TestGuessNext(t *testing.T) {
+	db, err := database.NewBolt(filepath.Join(t.TempDir(), "signatures.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	// the argument lists are learned from existing signatures
+	_, err = db.SaveSignatures(client.SignatureTypeFunction, []string{"balanceOf(address)"})
+	require.NoError(t, err)
+
+	dict, err := loadGuessDictionary("")
+	require.NoError(t, err)
+
+	s := &Service{
+		config:          &Config{GuesserRate: 1000000, GuesserArgumentLists: 10},
+		db:              db,
+		guessDictionary: dict,
+		guessSpaces:     make(map[client.SignatureType]*guessSpace),
+	}
+
+	worked, err := s.guessNext()
+	require.NoError(t, err)
+	assert.False(t, worked)
+
+	hash := crypto.Keccak256([]byte("transferOwnership(address)"))[:4]
+	require.NoError(t, db.QueueGuessTasks(client.SignatureTypeFunction, [][]byte{hash}))
+
+	worked, err = s.guessNext()
+	require.NoError(t, err)
+	assert.True(t, worked)
+
+	tasks, err := db.LoadGuessTasks(client.SignatureTypeFunction, [][]byte{hash})
+	require.NoError(t, err)
+	assert.Equal(t, client.GuessStatusFound, tasks[hexutil.Encode(hash)].Status)
+	assert.Equal(t, "transferOwnership(address)", tasks[hexutil.Encode(hash)].Name)
+
+	// a guessed function could be a collision, so it's held back until a moderator confirms it
+	result, err := db.LoadSignatures(client.SignatureTypeFunction, []string{hexutil.Encode(hash)})
+	require.NoError(t, err)
+	require.Len(t, result[hexutil.Encode(hash)], 1)
+	assert.Equal(t, client.SignatureSourceGuessed, result[hexutil.Encode(hash)][0].Source)
+	assert.True(t, result[hexutil.Encode(hash)][0].Quarantined)
+	assert.Equal(t, unconfirmedGuessReason, result[hexutil.Encode(hash)][0].FlagReason)
+}
+
+func TestGuessFlagReason(t *testing.T) {
+	hash := hexutil.Encode(crypto.Keccak256([]byte("transferOwnership(address)"))[:4])
+
+	s := &Service{
+		preferredSignatures: make(client.AllTypes[map[string]string]),
+		canonicalSignatures: make(map[string]string),
+	}
+
+	assert.Equal(t, unconfirmedGuessReason, s.guessFlagReason(client.SignatureTypeFunction, "transferOwnership(address)", hash))
+	assert.Empty(t, s.guessFlagReason(client.SignatureTypeEvent, "OwnershipTransferred(address,address)", hash))
+
+	// guesses which are the expected signature are trusted
+	s.canonicalSignatures[hash] = "transferOwnership(address)"
+	assert.Empty(t, s.guessFlagReason(client.SignatureTypeFunction, "transferOwnership(address)", hash))
+
+	// guesses which collide with the expected signature are flagged like imports
+	s.canonicalSignatures[hash] = "renounce(address)"
+	assert.Equal(t, "impersonates renounce(address)", s.guessFlagReason(client.SignatureTypeFunction, "transferOwnership(address)", hash))
+}
@@ -3,6 +3,7 @@ package signature_database_srv
 import (
 	"encoding/json"
 	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
 	"github.com/openchainxyz/openchainxyz-monorepo/internal/core"
@@ -11,7 +12,10 @@ import (
 	"io"
 	"net/http"
 	"os"
+	"path"
+	"strconv"
 	"strings"
+	"time"
 )
 
 func fail(w http.ResponseWriter, status int, err error, msg string) {
@@ -42,7 +46,7 @@ func (s *Service) serveLookup(w http.ResponseWriter, r *http.Request) {
 	params := r.URL.Query()
 	shouldFilter := !params.Has("filter") || params.Get("filter") != "false"
 
-	for _, typ := range client.SignatureTypes() {
+	for _, typ := range client.LookupTypes() {
 		data := params.Get(string(typ))
 		if len(data) == 0 {
 			continue
@@ -54,12 +58,83 @@ func (s *Service) serveLookup(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	s.recordLookups(response)
 	s.filterResponse(response, shouldFilter)
 	s.logSignatureResponse(r, response)
 
 	succeed(w, response)
 }
 
+func (s *Service) serveBulkLookup(w http.ResponseWriter, r *http.Request) {
+	var req client.LookupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, err, "failed to decode body")
+		return
+	}
+
+	params := r.URL.Query()
+	shouldFilter := !params.Has("filter") || params.Get("filter") != "false"
+
+	total := 0
+	for typ, sels := range req {
+		if _, ok := signatureLens[typ]; !ok {
+			fail(w, http.StatusBadRequest, nil, fmt.Sprintf("invalid signature type: %s", typ))
+			return
+		}
+		total += len(sels)
+	}
+	if total > s.config.MaxLookupBatchSize {
+		fail(w, http.StatusRequestEntityTooLarge, nil, fmt.Sprintf("too many selectors, the maximum is %d", s.config.MaxLookupBatchSize))
+		return
+	}
+
+	response := client.NewSignatureResponse()
+
+	for _, typ := range client.LookupTypes() {
+		sels, err := normalizeSelectors(req[typ], signatureLens[typ])
+		if err != nil {
+			fail(w, http.StatusBadRequest, err, err.Error())
+			return
+		}
+		if len(sels) == 0 {
+			continue
+		}
+
+		// one round trip per type, no matter how many selectors were requested
+		response[typ], err = s.db.LoadSignatures(typ, sels)
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err, "failed to load signatures")
+			return
+		}
+	}
+
+	s.recordLookups(response)
+	s.filterResponse(response, shouldFilter)
+	s.logSignatureResponse(r, response)
+
+	succeed(w, response)
+}
+
+// normalizeSelectors lowercases and deduplicates the selectors, and checks that each one is of the expected length
+func normalizeSelectors(sels []string, length int) ([]string, error) {
+	seen := make(map[string]bool)
+
+	var result []string
+	for _, sel := range sels {
+		sel = strings.ToLower(sel)
+		b, err := hexutil.Decode(sel)
+		if err != nil || len(b) != length {
+			return nil, fmt.Errorf("invalid selector: %s", sel)
+		}
+		if seen[sel] {
+			continue
+		}
+		seen[sel] = true
+		result = append(result, sel)
+	}
+	return result, nil
+}
+
 func (s *Service) serveSearch(w http.ResponseWriter, r *http.Request) {
 	params := r.URL.Query()
 	query := params.Get("query")
@@ -102,36 +177,35 @@ func (s *Service) serveImport(w http.ResponseWriter, r *http.Request) {
 }
 
 func (s *Service) filterResponse(response client.SignatureResponse, shouldFilter bool) {
-	s.canonicalSignaturesLock.RLock()
-
-	for hash, values := range response[client.SignatureTypeFunction] {
-		if expected, ok := s.canonicalSignatures[hash]; ok {
+	for typ, hashes := range response {
+		for hash, values := range hashes {
+			expected, ok := s.expectedSignature(typ, hash)
 			for _, value := range values {
-				value.Filtered = value.Name != expected
+				value.Filtered = value.Quarantined || (ok && value.Name != expected)
 			}
 		}
 	}
 
-	s.canonicalSignaturesLock.RUnlock()
-
 	if shouldFilter {
-		for hash, values := range response[client.SignatureTypeFunction] {
-			var newValues []*client.SignatureData
-
-			for _, value := range values {
-				if !value.Filtered {
-					newValues = append(newValues, value)
+		for typ, hashes := range response {
+			for hash, values := range hashes {
+				var newValues []*client.SignatureData
+
+				for _, value := range values {
+					if !value.Filtered {
+						newValues = append(newValues, value)
+					}
 				}
-			}
 
-			response[client.SignatureTypeFunction][hash] = newValues
+				response[typ][hash] = newValues
+			}
 		}
 	}
 }
 
 func (s *Service) logSignatureResponse(r *http.Request, response client.SignatureResponse) {
 	fields := log.Fields{
-		"ip": core.GetRemoteIP(r),
+		"ip": s.remoteIP(r),
 		"ua": core.GetUserAgent(r),
 	}
 	for typ, b := range response {
@@ -150,7 +224,7 @@ func (s *Service) logSignatureResponse(r *http.Request, response client.Signatur
 
 func (s *Service) logImportResponse(r *http.Request, res client.ImportResponse) {
 	fields := log.Fields{
-		"ip": core.GetRemoteIP(r),
+		"ip": s.remoteIP(r),
 		"ua": core.GetUserAgent(r),
 	}
 	for _, typ := range client.SignatureTypes() {
@@ -181,29 +255,124 @@ func (s *Service) serveStats(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
+	if s.cache != nil {
+		resp.Cache = s.cache.Stats()
+	}
+
 	succeed(w, resp)
 }
 
 func (s *Service) serveRefreshCanonicalSignatures(w http.ResponseWriter, r *http.Request) {
-	if err := s.loadCanonicalSignatures(); err != nil {
+	result, err := s.loadCanonicalSignatures()
+	if err != nil {
 		fail(w, http.StatusInternalServerError, err, "failed to refresh")
 		return
 	}
 
-	succeed(w, nil)
+	succeed(w, result)
 }
 
 func (s *Service) serveExport(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	scope := exportScopeAll
+	types := client.SignatureTypes()
+	if params.Has("type") {
+		typ := client.SignatureType(params.Get("type"))
+		if !typ.Valid() {
+			fail(w, http.StatusBadRequest, nil, "invalid signature type")
+			return
+		}
+		scope = string(typ)
+		types = []client.SignatureType{typ}
+	}
+
+	format := exportFormatText
+	if params.Has("format") {
+		format = exportFormat(params.Get("format"))
+		if !format.Valid() {
+			fail(w, http.StatusBadRequest, nil, "invalid format")
+			return
+		}
+	}
+
+	compression := exportCompression(params.Get("compression"))
+	if !compression.Valid() {
+		fail(w, http.StatusBadRequest, nil, "invalid compression")
+		return
+	}
+
+	fields := log.Fields{
+		"ip":          s.remoteIP(r),
+		"ua":          core.GetUserAgent(r),
+		"type":        scope,
+		"format":      format,
+		"compression": compression,
+	}
+
+	contentType := format.ContentType()
+	if compression != exportCompressionNone {
+		contentType = compression.ContentType()
+	}
+
+	if params.Has("since") {
+		if !format.Incremental() {
+			fail(w, http.StatusBadRequest, nil, "incremental exports can't use the txt format")
+			return
+		}
+
+		// since is either the cursor returned by a previous export or, for mirrors which only know when they last
+		// synced, a timestamp
+		since, err := strconv.ParseUint(params.Get("since"), 10, 64)
+		if err != nil {
+			t, err := time.Parse(time.RFC3339, params.Get("since"))
+			if err != nil {
+				fail(w, http.StatusBadRequest, err, "invalid since, expected a cursor or an RFC 3339 timestamp")
+				return
+			}
+
+			since, err = s.db.ExportCursorAt(t)
+			if err != nil {
+				fail(w, http.StatusInternalServerError, err, "failed to get export cursor")
+				return
+			}
+		}
+
+		until, err := s.db.ExportCursor()
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err, "failed to get export cursor")
+			return
+		}
+
+		fields["since"] = since
+		fields["until"] = until
+		log.WithFields(fields).Infof("served incremental export")
+
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s-%d.%s%s"`, scope, since, format, compression.Extension()))
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("X-Export-Generated-At", time.Now().UTC().Format(time.RFC3339))
+		w.Header().Set("X-Export-Cursor", strconv.FormatUint(until, 10))
+		w.WriteHeader(http.StatusOK)
+
+		if err := s.writeIncrementalExport(w, types, since, until, format, compression); err != nil {
+			// the headers have already been sent, so all we can do is log the failure
+			log.WithError(err).Errorf("failed to write incremental export")
+		}
+		return
+	}
+
 	s.dataExportLock.Lock()
-	lastPath := s.dataExportPath
+	lastDir := s.dataExportDir
+	lastExportTime := s.lastDataExportTime
+	lastCursor := s.dataExportCursor
 	s.dataExportLock.Unlock()
 
-	if lastPath == "" {
+	if lastDir == "" {
 		fail(w, http.StatusInternalServerError, nil, "export is not ready yet")
 		return
 	}
 
-	f, err := os.Open(lastPath)
+	f, err := os.Open(path.Join(lastDir, exportFileName(scope, format, compression)))
 	if err != nil {
 		fail(w, http.StatusInternalServerError, err, "failed to open file")
 		return
@@ -216,39 +385,56 @@ func (s *Service) serveExport(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	fields := log.Fields{
-		"ip": core.GetRemoteIP(r),
-		"ua": core.GetUserAgent(r),
-	}
 	log.WithFields(fields).Infof("served export")
 
-	w.Header().Set("Content-Disposition", `attachment; filename="export.txt"`)
-	w.Header().Set("Content-Type", "text/plain")
+	filename := fmt.Sprintf("export.%s%s", format, compression.Extension())
+	if scope != exportScopeAll {
+		filename = fmt.Sprintf("export-%s.%s%s", scope, format, compression.Extension())
+	}
+
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Header().Set("Content-Type", contentType)
 	w.Header().Set("Content-Length", fmt.Sprintf("%d", stat.Size()))
+	w.Header().Set("X-Export-Generated-At", lastExportTime.UTC().Format(time.RFC3339))
+	w.Header().Set("X-Export-Cursor", strconv.FormatUint(lastCursor, 10))
 	w.WriteHeader(http.StatusOK)
 
 	if _, err := io.Copy(w, f); err != nil {
-		fail(w, http.StatusInternalServerError, err, "failed to copy file")
+		log.WithError(err).Errorf("failed to copy file")
 		return
 	}
-
-	return
-
 }
 
 func (s *Service) startServer() {
 	m := mux.NewRouter()
-	m.HandleFunc("/v1/lookup", s.serveLookup).Methods("GET")
-	m.HandleFunc("/v1/search", s.serveSearch).Methods("GET")
-	m.HandleFunc("/v1/import", s.serveImport).Methods("POST")
-	m.HandleFunc("/v1/stats", s.serveStats).Methods("GET")
-	m.HandleFunc("/v1/export", s.serveExport).Methods("GET")
-	m.HandleFunc("/v1/refresh_canonical_signatures", s.serveRefreshCanonicalSignatures).Methods("POST")
+	m.HandleFunc("/v1/lookup", s.guardLookup(s.serveLookup)).Methods("GET")
+	m.HandleFunc("/v1/lookup", s.guardLookup(s.serveBulkLookup)).Methods("POST")
+	m.HandleFunc("/v1/search", s.guard(client.APIKeyScopeRead, false, s.serveSearch)).Methods("GET")
+	m.HandleFunc("/v1/import", s.guard(client.APIKeyScopeImport, s.config.RequireImportKey, s.serveImport)).Methods("POST")
+	m.HandleFunc("/v1/stats", s.guard(client.APIKeyScopeRead, false, s.serveStats)).Methods("GET")
+	m.HandleFunc("/v1/stats/popular", s.guard(client.APIKeyScopeRead, false, s.serveSelectorStats(false))).Methods("GET")
+	m.HandleFunc("/v1/stats/unknown", s.guard(client.APIKeyScopeRead, false, s.serveSelectorStats(true))).Methods("GET")
+	m.HandleFunc("/v1/export", s.guard(client.APIKeyScopeRead, false, s.serveExport)).Methods("GET")
+	m.HandleFunc("/v1/refresh_canonical_signatures", s.guard(client.APIKeyScopeAdmin, true, s.serveRefreshCanonicalSignatures)).Methods("POST")
+	m.HandleFunc("/v1/collisions", s.guard(client.APIKeyScopeRead, false, s.serveCollisions)).Methods("GET")
+	m.HandleFunc("/v1/collisions/resolve", s.guard(client.APIKeyScopeAdmin, true, s.serveResolveCollision)).Methods("POST")
+	m.HandleFunc("/v1/contract/{chain}/{address}/selectors", s.guard(client.APIKeyScopeRead, false, s.serveContractSelectors)).Methods("GET")
+	m.HandleFunc("/v1/signatures/delete", s.guard(client.APIKeyScopeAdmin, true, s.serveDeleteSignatures)).Methods("POST")
+	m.HandleFunc("/v1/signatures/quarantine", s.guard(client.APIKeyScopeAdmin, true, s.serveQuarantineSignatures(true))).Methods("POST")
+	m.HandleFunc("/v1/signatures/release", s.guard(client.APIKeyScopeAdmin, true, s.serveQuarantineSignatures(false))).Methods("POST")
+	m.HandleFunc("/v1/signatures/quarantined", s.guard(client.APIKeyScopeAdmin, true, s.serveQuarantinedSignatures)).Methods("GET")
+	m.HandleFunc("/v1/guess", s.guard(client.APIKeyScopeRead, false, s.serveGuesses)).Methods("GET")
+	m.HandleFunc("/v1/guess", s.guard(client.APIKeyScopeImport, s.config.RequireImportKey, s.serveQueueGuesses)).Methods("POST")
+	m.HandleFunc("/v1/keys", s.guard(client.APIKeyScopeAdmin, true, s.serveListAPIKeys)).Methods("GET")
+	m.HandleFunc("/v1/keys", s.guard(client.APIKeyScopeAdmin, true, s.serveCreateAPIKey)).Methods("POST")
+	m.HandleFunc("/v1/keys/{id}", s.guard(client.APIKeyScopeAdmin, true, s.serveDeleteAPIKey)).Methods("DELETE")
+
+	s.registerCompatRoutes(m)
 
 	cors := handlers.CORS(
-		handlers.AllowedMethods([]string{"OPTIONS", "HEAD", "GET", "POST"}),
+		handlers.AllowedMethods([]string{"OPTIONS", "HEAD", "GET", "POST", "DELETE"}),
 		handlers.AllowedOrigins([]string{"*"}),
-		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type"}),
+		handlers.AllowedHeaders([]string{"X-Requested-With", "Content-Type", "Authorization", "X-API-Key"}),
 	)(m)
 
 	go func() {
@@ -1,12 +1,15 @@
 package signature_database_srv
 
 import (
+	"context"
 	"fmt"
-	"github.com/bwmarrin/discordgo"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/notify"
 	"github.com/openchainxyz/openchainxyz-monorepo/internal/solidity"
 	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
 	log "github.com/sirupsen/logrus"
+	"sort"
 	"strings"
+	"time"
 )
 
 func (s *Service) importRaw(data client.ImportRequest) (client.ImportResponse, error) {
@@ -39,17 +42,45 @@ func (s *Service) importRawType(typ client.SignatureType, input []string) (*clie
 		return nil, err
 	}
 
-	if s.discord != nil {
-		if err := s.notifyDiscord(typ, resp); err != nil {
-			log.WithError(err).Errorf("failed to notify discord of import")
-		}
+	if err := s.quarantineSuspiciousImports(typ, resp); err != nil {
+		return nil, err
 	}
 
+	s.notifyImport(typ, resp)
+
 	resp.Invalid = invalid
 	return resp, nil
 }
 
-func (s *Service) notifyDiscord(typ client.SignatureType, resp *client.ImportResponseDetails) error {
+func (s *Service) notifyImport(typ client.SignatureType, resp *client.ImportResponseDetails) {
+	if s.notifier == nil || len(resp.Imported) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	var lines []string
+	for name, hash := range resp.Imported {
+		lines = append(lines, fmt.Sprintf("`%s`: `%s`", hash, name))
+	}
+	sort.Strings(lines)
+
+	if err := s.notifier.Notify(ctx, notify.NewEvent(
+		notify.EventNewSignatures,
+		fmt.Sprintf("Imported %d new %s signatures:", len(resp.Imported), typ),
+		lines,
+		client.ImportResponse{typ: resp},
+	)); err != nil {
+		log.WithError(err).Errorf("failed to notify of new signatures")
+	}
+
+	if err := s.notifyCollisions(ctx, typ, resp); err != nil {
+		log.WithError(err).Errorf("failed to notify of new collisions")
+	}
+}
+
+func (s *Service) notifyCollisions(ctx context.Context, typ client.SignatureType, resp *client.ImportResponseDetails) error {
 	var imported []string
 	for _, hash := range resp.Imported {
 		imported = append(imported, hash)
@@ -61,6 +92,7 @@ func (s *Service) notifyDiscord(typ client.SignatureType, resp *client.ImportRes
 	}
 
 	var parts []string
+	collisions := make(map[string][]string)
 	for sig, data := range sigs {
 		if len(data) <= 1 {
 			continue
@@ -69,18 +101,22 @@ func (s *Service) notifyDiscord(typ client.SignatureType, resp *client.ImportRes
 		var names []string
 		for _, name := range data {
 			names = append(names, fmt.Sprintf("`%s`", name.Name))
+			collisions[sig] = append(collisions[sig], name.Name)
 		}
 
 		parts = append(parts, fmt.Sprintf("`%s`: %s", sig, strings.Join(names, ", ")))
 	}
 
-	if len(parts) > 0 {
-		if _, err := s.discord.Session.ChannelMessageSendComplex(s.config.DiscordChannel, &discordgo.MessageSend{
-			Content: fmt.Sprintf("Imported the following duplicate signatures:\n%s", strings.Join(parts, "\n")),
-		}); err != nil {
-			return err
-		}
+	if len(parts) == 0 {
+		return nil
 	}
 
-	return nil
+	sort.Strings(parts)
+
+	return s.notifier.Notify(ctx, notify.NewEvent(
+		notify.EventNewCollisions,
+		"Imported the following duplicate signatures:",
+		parts,
+		client.AllTypes[map[string][]string]{typ: collisions},
+	))
 }
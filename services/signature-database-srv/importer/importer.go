@@ -0,0 +1,225 @@
+package importer
+
+import (
+	"bytes"
+	"errors"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/solidity"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	log "github.com/sirupsen/logrus"
+	"io"
+	"time"
+)
+
+var signatureLens = map[client.SignatureType]int{
+	client.SignatureTypeFunction: 4,
+	client.SignatureTypeEvent:    32,
+}
+
+const (
+	// maxReported is the number of invalid rows and mismatches of each kind which are logged individually, after
+	// which they are only counted
+	maxReported = 1000
+
+	progressInterval = 5 * time.Second
+)
+
+type Stats struct {
+	Read       int64
+	Imported   int64
+	Duplicated int64
+	Invalid    int64
+	Mismatched int64
+}
+
+type Options struct {
+	// DefaultType is used for records whose type isn't given and can't be inferred because they have no hash
+	DefaultType client.SignatureType
+	// BatchSize is the number of signatures of each type which are copied into the database at once
+	BatchSize int
+}
+
+type batch struct {
+	names  []string
+	hashes [][]byte
+}
+
+// Importer verifies records and copies them into the database in batches. Unlike imports through the api, bulk
+// imports aren't screened by the spam heuristics, so they should only be used for trusted dumps.
+type Importer struct {
+	db      database.Storage
+	options Options
+
+	pending map[client.SignatureType]*batch
+	stats   Stats
+
+	lastProgress time.Time
+}
+
+func New(db database.Storage, options Options) *Importer {
+	if options.DefaultType == "" {
+		options.DefaultType = client.SignatureTypeFunction
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = 50000
+	}
+
+	return &Importer{
+		db:           db,
+		options:      options,
+		pending:      make(map[client.SignatureType]*batch),
+		lastProgress: time.Now(),
+	}
+}
+
+func (i *Importer) Stats() Stats {
+	return i.stats
+}
+
+func (i *Importer) reportInvalid(file string, line int, reason string) {
+	i.stats.Invalid++
+	if i.stats.Invalid <= maxReported {
+		log.WithFields(log.Fields{
+			"file": file,
+			"line": line,
+		}).Warnf("invalid row: %s", reason)
+	}
+}
+
+// verify checks the record and fills in its type and hash, reporting it and returning false if it is invalid
+func (i *Importer) verify(file string, record *Record) bool {
+	if !solidity.VerifySignature(record.Name) {
+		i.reportInvalid(file, record.Line, "invalid signature: "+record.Name)
+		return false
+	}
+
+	if record.Type == "" {
+		switch len(record.Hash) {
+		case 0:
+			record.Type = i.options.DefaultType
+		case signatureLens[client.SignatureTypeFunction]:
+			record.Type = client.SignatureTypeFunction
+		case signatureLens[client.SignatureTypeEvent]:
+			record.Type = client.SignatureTypeEvent
+		default:
+			i.reportInvalid(file, record.Line, "invalid hash length: "+hexutil.Encode(record.Hash))
+			return false
+		}
+	}
+
+	// errors share the table, and the hash length, of functions
+	if record.Type == client.SignatureTypeError {
+		record.Type = client.SignatureTypeFunction
+	}
+
+	length, ok := signatureLens[record.Type]
+	if !ok {
+		i.reportInvalid(file, record.Line, "invalid type: "+string(record.Type))
+		return false
+	}
+
+	// some dumps, like Etherface's, carry the full keccak hash rather than just the selector
+	fullHash := crypto.Keccak256([]byte(record.Name))
+	if len(record.Hash) > 0 && (len(record.Hash) < length || !bytes.Equal(record.Hash, fullHash[:len(record.Hash)])) {
+		i.stats.Mismatched++
+		if i.stats.Mismatched <= maxReported {
+			log.WithFields(log.Fields{
+				"file":     file,
+				"line":     record.Line,
+				"name":     record.Name,
+				"hash":     hexutil.Encode(record.Hash),
+				"expected": hexutil.Encode(fullHash[:length]),
+			}).Warnf("hash mismatch")
+		}
+		return false
+	}
+
+	record.Hash = fullHash[:length]
+	return true
+}
+
+// Import reads every record from r, file is only used for reporting
+func (i *Importer) Import(file string, r Reader) error {
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			i.stats.Read++
+			i.reportInvalid(file, rowErr.Line, rowErr.Reason)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		i.stats.Read++
+
+		if !i.verify(file, record) {
+			continue
+		}
+
+		b, ok := i.pending[record.Type]
+		if !ok {
+			b = &batch{}
+			i.pending[record.Type] = b
+		}
+		b.names = append(b.names, record.Name)
+		b.hashes = append(b.hashes, record.Hash)
+
+		if len(b.names) >= i.options.BatchSize {
+			if err := i.flushType(record.Type); err != nil {
+				return err
+			}
+		}
+
+		if time.Since(i.lastProgress) >= progressInterval {
+			i.logProgress(file)
+		}
+	}
+}
+
+func (i *Importer) flushType(typ client.SignatureType) error {
+	b, ok := i.pending[typ]
+	if !ok || len(b.names) == 0 {
+		return nil
+	}
+
+	imported, err := i.db.BulkImportSignatures(typ, b.names, b.hashes)
+	if err != nil {
+		return err
+	}
+
+	i.stats.Imported += imported
+	i.stats.Duplicated += int64(len(b.names)) - imported
+
+	delete(i.pending, typ)
+	return nil
+}
+
+// Flush imports every pending record, it must be called once all files have been imported
+func (i *Importer) Flush() error {
+	for typ := range i.pending {
+		if err := i.flushType(typ); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *Importer) logProgress(file string) {
+	i.lastProgress = time.Now()
+
+	log.WithFields(log.Fields{
+		"file":       file,
+		"read":       i.stats.Read,
+		"imported":   i.stats.Imported,
+		"duplicated": i.stats.Duplicated,
+		"invalid":    i.stats.Invalid,
+		"mismatched": i.stats.Mismatched,
+	}).Infof("importing")
+}
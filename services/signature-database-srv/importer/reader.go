@@ -0,0 +1,483 @@
+// Package importer bulk loads signatures from dump files, like the service's own exports or the 4byte.directory
+// and Etherface apis, straight into the database.
+package importer
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/klauspost/compress/zstd"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+type Format string
+
+const (
+	// FormatAuto picks the format from the file extension and, for csv files, the header
+	FormatAuto Format = "auto"
+	// FormatHashCSV is one "hash,name" pair per line, which includes the service's txt export
+	FormatHashCSV Format = "hashcsv"
+	// FormatCSV is the service's csv export
+	FormatCSV Format = "csv"
+	// FormatNDJSON is the service's ndjson export
+	FormatNDJSON Format = "ndjson"
+	// FormatJSON is pages of the 4byte.directory or Etherface apis, or arrays of their entries
+	FormatJSON Format = "json"
+)
+
+func (f Format) Valid() bool {
+	return f == FormatAuto || f == FormatHashCSV || f == FormatCSV || f == FormatNDJSON || f == FormatJSON
+}
+
+// Record is a single signature read from a dump. The type and hash are optional, a missing type is inferred from
+// the length of the hash and a missing hash is computed.
+type Record struct {
+	// Line is the line, or for json the entry, the record was read from
+	Line int
+	Type client.SignatureType
+	Name string
+	Hash []byte
+}
+
+// RowError is returned for a row which can't be parsed, the reader can still be used afterwards
+type RowError struct {
+	Line   int
+	Reason string
+}
+
+func (e *RowError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Reason)
+}
+
+// Reader reads records until it returns io.EOF
+type Reader interface {
+	Next() (*Record, error)
+}
+
+// decodeHash decodes a hash which may or may not be 0x-prefixed
+func decodeHash(hash string) ([]byte, error) {
+	return hexutil.Decode("0x" + strings.TrimPrefix(strings.ToLower(strings.TrimSpace(hash)), "0x"))
+}
+
+const (
+	// exportCSVHeader is the first line of the service's csv export
+	exportCSVHeader = "type,hash,name,created_at,removed"
+	// legacyExportCSVHeader is the first line of csv exports from before removals were exported
+	legacyExportCSVHeader = "type,hash,name,created_at"
+)
+
+type hashCSVReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newHashCSVReader(r io.Reader) *hashCSVReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &hashCSVReader{scanner: scanner}
+}
+
+func (r *hashCSVReader) Next() (*Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" || (r.line == 1 && strings.HasPrefix(line, "hash,")) {
+			continue
+		}
+
+		// names contain commas and aren't always quoted, so only the first comma separates the fields
+		hash, name, ok := strings.Cut(line, ",")
+		if !ok {
+			return nil, &RowError{Line: r.line, Reason: "missing name"}
+		}
+
+		b, err := decodeHash(strings.Trim(hash, `"`))
+		if err != nil {
+			return nil, &RowError{Line: r.line, Reason: fmt.Sprintf("invalid hash: %s", hash)}
+		}
+
+		return &Record{
+			Line: r.line,
+			Name: strings.Trim(strings.TrimSpace(name), `"`),
+			Hash: b,
+		}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+type exportCSVReader struct {
+	reader *csv.Reader
+}
+
+func newExportCSVReader(r io.Reader) *exportCSVReader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	return &exportCSVReader{reader: reader}
+}
+
+func (r *exportCSVReader) Next() (*Record, error) {
+	for {
+		row, err := r.reader.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return nil, &RowError{Line: parseErr.Line, Reason: parseErr.Err.Error()}
+			}
+			return nil, err
+		}
+
+		line, _ := r.reader.FieldPos(0)
+		if header := strings.Join(row, ","); line == 1 && (header == exportCSVHeader || header == legacyExportCSVHeader) {
+			continue
+		}
+
+		if len(row) < 3 {
+			return nil, &RowError{Line: line, Reason: "expected type, hash and name"}
+		}
+
+		// incremental exports list signatures which were deleted or quarantined, which mustn't be imported again
+		if len(row) > 4 && row[4] != "" {
+			removed, err := strconv.ParseBool(row[4])
+			if err != nil {
+				return nil, &RowError{Line: line, Reason: fmt.Sprintf("invalid removed: %s", row[4])}
+			}
+			if removed {
+				continue
+			}
+		}
+
+		hash, err := decodeHash(row[1])
+		if err != nil {
+			return nil, &RowError{Line: line, Reason: fmt.Sprintf("invalid hash: %s", row[1])}
+		}
+
+		return &Record{
+			Line: line,
+			Type: client.SignatureType(row[0]),
+			Name: row[2],
+			Hash: hash,
+		}, nil
+	}
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func newNDJSONReader(r io.Reader) *ndjsonReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	return &ndjsonReader{scanner: scanner}
+}
+
+func (r *ndjsonReader) Next() (*Record, error) {
+	for r.scanner.Scan() {
+		r.line++
+
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var entry client.ExportEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			return nil, &RowError{Line: r.line, Reason: fmt.Sprintf("invalid json: %s", err)}
+		}
+		if entry.Removed {
+			continue
+		}
+
+		hash, err := decodeHash(entry.Hash)
+		if err != nil {
+			return nil, &RowError{Line: r.line, Reason: fmt.Sprintf("invalid hash: %s", entry.Hash)}
+		}
+
+		return &Record{
+			Line: r.line,
+			Type: entry.Type,
+			Name: entry.Name,
+			Hash: hash,
+		}, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, io.EOF
+}
+
+// jsonEntry is an entry from either the 4byte.directory or the Etherface api
+type jsonEntry struct {
+	TextSignature string `json:"text_signature"`
+	HexSignature  string `json:"hex_signature"`
+
+	Text string `json:"text"`
+	Hash string `json:"hash"`
+	Kind string `json:"kind"`
+}
+
+// jsonElement is an element of a top-level array, which is either an entry or an api page
+type jsonElement struct {
+	jsonEntry
+
+	Results []jsonEntry `json:"results"`
+	Items   []jsonEntry `json:"items"`
+}
+
+func (e *jsonElement) isPage() bool {
+	return e.Results != nil || e.Items != nil
+}
+
+// jsonReader streams the entries out of any sequence of api pages, which keep their entries in "results" or
+// "items", and arrays of entries or pages, without holding more than a page in memory
+type jsonReader struct {
+	dec      *json.Decoder
+	entry    int
+	inObject bool
+	inArray  bool
+	// topLevel is set if the array being read isn't the entries of a page, so its elements may be pages too
+	topLevel bool
+	page     []jsonEntry
+}
+
+func newJSONReader(r io.Reader) *jsonReader {
+	return &jsonReader{dec: json.NewDecoder(r)}
+}
+
+func (r *jsonReader) Next() (*Record, error) {
+	for {
+		switch {
+		case len(r.page) > 0:
+			entry := r.page[0]
+			r.page = r.page[1:]
+			r.entry++
+
+			return entry.record(r.entry)
+		case r.inArray:
+			if !r.dec.More() {
+				if _, err := r.dec.Token(); err != nil {
+					return nil, err
+				}
+				r.inArray = false
+				continue
+			}
+
+			if !r.topLevel {
+				var entry jsonEntry
+				if err := r.dec.Decode(&entry); err != nil {
+					return nil, err
+				}
+				r.entry++
+
+				return entry.record(r.entry)
+			}
+
+			var element jsonElement
+			if err := r.dec.Decode(&element); err != nil {
+				return nil, err
+			}
+			if element.isPage() {
+				r.page = append(element.Results, element.Items...)
+				continue
+			}
+			r.entry++
+
+			return element.record(r.entry)
+		case r.inObject:
+			if !r.dec.More() {
+				if _, err := r.dec.Token(); err != nil {
+					return nil, err
+				}
+				r.inObject = false
+				continue
+			}
+
+			key, err := r.dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			if key == "results" || key == "items" {
+				tok, err := r.dec.Token()
+				if err != nil {
+					return nil, err
+				}
+				if tok != json.Delim('[') {
+					return nil, fmt.Errorf("expected %s to be an array", key)
+				}
+				r.inArray = true
+				r.topLevel = false
+				continue
+			}
+
+			var skip json.RawMessage
+			if err := r.dec.Decode(&skip); err != nil {
+				return nil, err
+			}
+		default:
+			tok, err := r.dec.Token()
+			if err != nil {
+				return nil, err
+			}
+
+			switch tok {
+			case json.Delim('['):
+				r.inArray = true
+				r.topLevel = true
+			case json.Delim('{'):
+				r.inObject = true
+			default:
+				return nil, fmt.Errorf("unexpected %v, expected an array or object", tok)
+			}
+		}
+	}
+}
+
+func (e *jsonEntry) record(entry int) (*Record, error) {
+	name, hash := e.TextSignature, e.HexSignature
+	if name == "" {
+		name, hash = e.Text, e.Hash
+	}
+
+	if name == "" {
+		return nil, &RowError{Line: entry, Reason: "missing signature"}
+	}
+
+	record := &Record{
+		Line: entry,
+		Name: name,
+	}
+
+	switch e.Kind {
+	case "":
+	case "event":
+		record.Type = client.SignatureTypeEvent
+	case "function", "error":
+		record.Type = client.SignatureTypeFunction
+	default:
+		return nil, &RowError{Line: entry, Reason: fmt.Sprintf("unknown kind: %s", e.Kind)}
+	}
+
+	if hash != "" {
+		b, err := decodeHash(hash)
+		if err != nil {
+			return nil, &RowError{Line: entry, Reason: fmt.Sprintf("invalid hash: %s", hash)}
+		}
+		record.Hash = b
+	}
+
+	return record, nil
+}
+
+// NewReader reads the given format, which must not be FormatAuto
+func NewReader(format Format, r io.Reader) (Reader, error) {
+	switch format {
+	case FormatHashCSV:
+		return newHashCSVReader(r), nil
+	case FormatCSV:
+		return newExportCSVReader(r), nil
+	case FormatNDJSON:
+		return newNDJSONReader(r), nil
+	case FormatJSON:
+		return newJSONReader(r), nil
+	default:
+		return nil, fmt.Errorf("unsupported format: %s", format)
+	}
+}
+
+type readCloser struct {
+	io.Reader
+	close func() error
+}
+
+func (r *readCloser) Close() error {
+	return r.close()
+}
+
+// Open opens a possibly gzip or zstd compressed dump, with "-" meaning stdin, and picks its format if format is
+// FormatAuto. The returned closer must be closed once the reader is no longer needed.
+func Open(name string, format Format) (Reader, io.Closer, error) {
+	var f *os.File
+	if name == "-" {
+		f = os.Stdin
+	} else {
+		var err error
+		f, err = os.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	var r io.Reader = f
+	closer := &readCloser{Reader: f, close: f.Close}
+
+	ext := path.Ext(name)
+	switch ext {
+	case ".gz":
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("failed to open gzip: %w", err)
+		}
+		r = gz
+		name = strings.TrimSuffix(name, ext)
+	case ".zst":
+		zr, err := zstd.NewReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("failed to open zstd: %w", err)
+		}
+		r = zr
+		closer.close = func() error {
+			zr.Close()
+			return f.Close()
+		}
+		name = strings.TrimSuffix(name, ext)
+	}
+
+	buffered := bufio.NewReaderSize(r, 64*1024)
+
+	if format == FormatAuto {
+		format = detectFormat(name, buffered)
+	}
+
+	reader, err := NewReader(format, buffered)
+	if err != nil {
+		closer.Close()
+		return nil, nil, err
+	}
+
+	return reader, closer, nil
+}
+
+func detectFormat(name string, r *bufio.Reader) Format {
+	switch path.Ext(name) {
+	case ".json":
+		return FormatJSON
+	case ".ndjson", ".jsonl":
+		return FormatNDJSON
+	case ".csv":
+		// the legacy header is a prefix of the current one
+		header, _ := r.Peek(len(legacyExportCSVHeader))
+		if string(header) == legacyExportCSVHeader {
+			return FormatCSV
+		}
+		return FormatHashCSV
+	default:
+		return FormatHashCSV
+	}
+}
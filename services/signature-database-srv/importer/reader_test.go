@@ -0,0 +1,165 @@
+package importer
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type readResult struct {
+	records []*Record
+	invalid []int
+}
+
+func readAll(t *testing.T, r Reader) readResult {
+	var result readResult
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return result
+		}
+
+		var rowErr *RowError
+		if errors.As(err, &rowErr) {
+			result.invalid = append(result.invalid, rowErr.Line)
+			continue
+		}
+		require.NoError(t, err)
+
+		result.records = append(result.records, record)
+	}
+}
+
+func TestHashCSVReader(t *testing.T) {
+	result := readAll(t, newHashCSVReader(strings.NewReader(`hash,name
+0xa9059cbb,transfer(address,uint256)
+70a08231,"balanceOf(address)"
+
+nothex,foo()
+0x1234
+`)))
+
+	require.Len(t, result.records, 2)
+	assert.Equal(t, "transfer(address,uint256)", result.records[0].Name)
+	assert.Equal(t, "0xa9059cbb", hexutil.Encode(result.records[0].Hash))
+	assert.Equal(t, "balanceOf(address)", result.records[1].Name)
+	assert.Equal(t, 3, result.records[1].Line)
+	assert.Equal(t, []int{5, 6}, result.invalid)
+}
+
+func TestExportCSVReader(t *testing.T) {
+	result := readAll(t, newExportCSVReader(strings.NewReader(`type,hash,name,created_at,removed
+function,0xa9059cbb,"transfer(address,uint256)",2023-01-01T00:00:00Z,false
+event,0xddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef,"Transfer(address,address,uint256)",2023-01-01T00:00:00Z,false
+function,0x12345678,"join_tg_invmru_haha_fd06787(address,bool)",2023-01-01T00:00:00Z,true
+function,0x70a08231,"balanceOf(address)",2023-01-01T00:00:00Z,maybe
+`)))
+
+	require.Len(t, result.records, 2)
+	assert.Equal(t, client.SignatureTypeFunction, result.records[0].Type)
+	assert.Equal(t, 2, result.records[0].Line)
+	assert.EqualValues(t, client.SignatureTypeEvent, result.records[1].Type)
+	assert.Equal(t, "Transfer(address,address,uint256)", result.records[1].Name)
+	assert.Equal(t, []int{5}, result.invalid)
+
+	// exports from before removals were exported have no removed column
+	result = readAll(t, newExportCSVReader(strings.NewReader(`type,hash,name,created_at
+function,0xa9059cbb,"transfer(address,uint256)",2023-01-01T00:00:00Z
+`)))
+
+	require.Len(t, result.records, 1)
+	assert.Empty(t, result.invalid)
+}
+
+func TestDetectFormat(t *testing.T) {
+	detect := func(name, content string) Format {
+		return detectFormat(name, bufio.NewReader(strings.NewReader(content)))
+	}
+
+	assert.Equal(t, FormatCSV, detect("signatures.csv", "type,hash,name,created_at,removed\n"))
+	assert.Equal(t, FormatCSV, detect("signatures.csv", "type,hash,name,created_at\n"))
+	assert.Equal(t, FormatHashCSV, detect("signatures.csv", "hash,name\n"))
+	assert.Equal(t, FormatHashCSV, detect("signatures.txt", "0xa9059cbb,transfer(address,uint256)\n"))
+	assert.Equal(t, FormatNDJSON, detect("signatures.ndjson", ""))
+}
+
+func TestNDJSONReader(t *testing.T) {
+	result := readAll(t, newNDJSONReader(strings.NewReader(`{"type":"function","hash":"0xa9059cbb","name":"transfer(address,uint256)","created_at":"2023-01-01T00:00:00Z"}
+not json
+{"type":"function","hash":"0x12345678","name":"join_tg_invmru_haha_fd06787(address,bool)","created_at":"2023-01-01T00:00:00Z","removed":true}
+`)))
+
+	require.Len(t, result.records, 1)
+	assert.Equal(t, "transfer(address,uint256)", result.records[0].Name)
+	assert.Equal(t, []int{2}, result.invalid)
+}
+
+func TestJSONReader(t *testing.T) {
+	result := readAll(t, newJSONReader(strings.NewReader(`
+{"count": 2, "next": null, "results": [
+	{"id": 1, "text_signature": "transfer(address,uint256)", "hex_signature": "0xa9059cbb"}
+], "previous": null}
+{"total_pages": 1, "items": [
+	{"id": 2, "text": "Transfer(address,address,uint256)", "hash": "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef", "kind": "event"},
+	{"id": 3, "text": "", "hash": "", "kind": "function"}
+]}
+[{"text_signature": "balanceOf(address)"}]
+`)))
+
+	require.Len(t, result.records, 3)
+	assert.Equal(t, "transfer(address,uint256)", result.records[0].Name)
+	assert.EqualValues(t, client.SignatureTypeEvent, result.records[1].Type)
+	assert.Equal(t, "balanceOf(address)", result.records[2].Name)
+	assert.Nil(t, result.records[2].Hash)
+	assert.Equal(t, []int{3}, result.invalid)
+}
+
+func TestJSONReaderPages(t *testing.T) {
+	// pages saved from the api are often concatenated into one array
+	result := readAll(t, newJSONReader(strings.NewReader(`[
+	{"count": 2, "next": "https://www.4byte.directory/api/v1/signatures/?page=2", "results": [
+		{"id": 1, "text_signature": "transfer(address,uint256)", "hex_signature": "0xa9059cbb"},
+		{"id": 2, "text_signature": "", "hex_signature": ""}
+	]},
+	{"count": 2, "next": null, "results": []},
+	{"total_pages": 1, "items": [
+		{"id": 3, "text": "Transfer(address,address,uint256)", "hash": "ddf252ad1be2c89b69c2b068fc378daa952ba7f163c4a11628f55a4df523b3ef", "kind": "event"}
+	]},
+	{"text_signature": "balanceOf(address)"}
+]`)))
+
+	require.Len(t, result.records, 3)
+	assert.Equal(t, "transfer(address,uint256)", result.records[0].Name)
+	assert.EqualValues(t, client.SignatureTypeEvent, result.records[1].Type)
+	assert.Equal(t, 3, result.records[1].Line)
+	assert.Equal(t, "balanceOf(address)", result.records[2].Name)
+	assert.Equal(t, []int{2}, result.invalid)
+}
+
+func TestVerify(t *testing.T) {
+	i := New(nil, Options{})
+
+	record := &Record{Name: "transfer(address,uint256)"}
+	assert.True(t, i.verify("test", record))
+	assert.Equal(t, client.SignatureTypeFunction, record.Type)
+	assert.Equal(t, "0xa9059cbb", hexutil.Encode(record.Hash))
+
+	// the full keccak hash is accepted and truncated
+	record = &Record{Type: client.SignatureTypeFunction, Name: "transfer(address,uint256)", Hash: crypto.Keccak256([]byte("transfer(address,uint256)"))}
+	assert.True(t, i.verify("test", record))
+	assert.Equal(t, "0xa9059cbb", hexutil.Encode(record.Hash))
+
+	assert.False(t, i.verify("test", &Record{Name: "transfer(address,uint256)", Hash: hexutil.MustDecode("0x12345678")}))
+	assert.False(t, i.verify("test", &Record{Name: "not a signature"}))
+
+	assert.Equal(t, int64(1), i.Stats().Mismatched)
+	assert.Equal(t, int64(1), i.Stats().Invalid)
+}
@@ -0,0 +1,273 @@
+package signature_database_srv
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/core"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxIdentifierLength is the longest name which isn't suspicious when it collides with a well-known signature
+	maxIdentifierLength = 40
+
+	defaultQuarantinedLimit = 100
+	maxQuarantinedLimit     = 1000
+)
+
+// vanityPatterns match the names used by known campaigns which mine collisions with well-known selectors to
+// advertise in block explorers and wallets
+var vanityPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`(?i)(^|_)(join|watch|follow|visit)_?(tg|telegram|twitter|discord)`),
+	regexp.MustCompile(`(?i)(^|_)t_?me_`),
+	regexp.MustCompile(`(?i)_(dot|at)_?(com|io|xyz|org|net|eth)(_|$)`),
+	regexp.MustCompile(`(?i)(airdrop|claim|reward)_?(now|here|free)`),
+}
+
+// identifierSegments splits an identifier on underscores and camel case boundaries
+func identifierSegments(identifier string) []string {
+	var segments []string
+	var current []rune
+	flush := func() {
+		if len(current) > 0 {
+			segments = append(segments, string(current))
+			current = nil
+		}
+	}
+
+	runes := []rune(identifier)
+	for i, r := range runes {
+		if r == '_' || r == '$' {
+			flush()
+			continue
+		}
+		if i > 0 && unicode.IsUpper(r) && !unicode.IsUpper(runes[i-1]) {
+			flush()
+		}
+		current = append(current, r)
+	}
+	flush()
+
+	return segments
+}
+
+// isRandomSegment reports whether a segment looks like the output of a collision miner, either a hex string or a
+// jumble of letters and digits, rather than a word optionally followed by a number like "erc20" or "v2"
+func isRandomSegment(segment string) bool {
+	if len(segment) < 6 {
+		return false
+	}
+
+	var letters, digits, transitions int
+	isHex := true
+	for i, r := range segment {
+		switch {
+		case unicode.IsDigit(r):
+			digits++
+		case unicode.IsLetter(r):
+			letters++
+			if !strings.ContainsRune("abcdefABCDEF", r) {
+				isHex = false
+			}
+		}
+		if i > 0 && unicode.IsDigit(r) != unicode.IsDigit(rune(segment[i-1])) {
+			transitions++
+		}
+	}
+
+	if letters == 0 || digits == 0 {
+		return false
+	}
+
+	return isHex || transitions >= 3
+}
+
+// flagSignature returns why name, which collides with the well-known signature expected, looks malicious, or an
+// empty string if it doesn't
+func flagSignature(name string, expected string) string {
+	identifier, params, _ := strings.Cut(name, "(")
+	_, expectedParams, _ := strings.Cut(expected, "(")
+
+	for _, pattern := range vanityPatterns {
+		if pattern.MatchString(identifier) {
+			return fmt.Sprintf("known spam pattern colliding with %s", expected)
+		}
+	}
+
+	for _, segment := range identifierSegments(identifier) {
+		if isRandomSegment(segment) {
+			return fmt.Sprintf("random name colliding with %s", expected)
+		}
+	}
+
+	if len(identifier) > maxIdentifierLength {
+		return fmt.Sprintf("long name colliding with %s", expected)
+	}
+
+	if params == expectedParams {
+		return fmt.Sprintf("impersonates %s", expected)
+	}
+
+	return ""
+}
+
+// quarantineSuspiciousImports quarantines the newly imported signatures which collide with a well-known
+// signature and look malicious, recording them in resp
+func (s *Service) quarantineSuspiciousImports(typ client.SignatureType, resp *client.ImportResponseDetails) error {
+	flagged := make(map[string][]string)
+	for name, hash := range resp.Imported {
+		expected, ok := s.expectedSignature(typ, hash)
+		if !ok || expected == name {
+			continue
+		}
+
+		if reason := flagSignature(name, expected); reason != "" {
+			flagged[reason] = append(flagged[reason], name)
+		}
+	}
+
+	for reason, names := range flagged {
+		quarantined, err := s.db.SetQuarantined(typ, names, true, reason)
+		if err != nil {
+			return err
+		}
+
+		for _, name := range quarantined {
+			if resp.Quarantined == nil {
+				resp.Quarantined = make(map[string]string)
+			}
+			resp.Quarantined[name] = reason
+		}
+
+		log.WithFields(log.Fields{
+			"type":   typ,
+			"names":  quarantined,
+			"reason": reason,
+		}).Infof("quarantined suspicious signatures")
+	}
+
+	return nil
+}
+
+func decodeModerationRequest(w http.ResponseWriter, r *http.Request) (*client.ModerationRequest, bool) {
+	var req client.ModerationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		fail(w, http.StatusBadRequest, err, "failed to decode body")
+		return nil, false
+	}
+
+	if req.Type != client.SignatureTypeFunction && req.Type != client.SignatureTypeEvent {
+		fail(w, http.StatusBadRequest, nil, "invalid signature type")
+		return nil, false
+	}
+
+	if len(req.Signatures) == 0 {
+		fail(w, http.StatusBadRequest, nil, "missing signatures")
+		return nil, false
+	}
+
+	return &req, true
+}
+
+func (s *Service) logModeration(r *http.Request, action string, req *client.ModerationRequest, affected []string) {
+	log.WithFields(log.Fields{
+		"ip":       s.remoteIP(r),
+		"ua":       core.GetUserAgent(r),
+		"type":     req.Type,
+		"affected": strings.Join(affected, ";"),
+		"reason":   req.Reason,
+	}).Infof("%s signatures", action)
+}
+
+func (s *Service) serveDeleteSignatures(w http.ResponseWriter, r *http.Request) {
+	req, ok := decodeModerationRequest(w, r)
+	if !ok {
+		return
+	}
+
+	deleted, err := s.db.DeleteSignatures(req.Type, req.Signatures)
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err, "failed to delete signatures")
+		return
+	}
+
+	// deleting a signature also removes its pin
+	if err := s.loadPreferredSignatures(); err != nil {
+		log.WithError(err).Errorf("failed to reload preferred signatures")
+	}
+
+	s.logModeration(r, "deleted", req, deleted)
+
+	succeed(w, &client.ModerationResponse{Affected: deleted})
+}
+
+func (s *Service) serveQuarantineSignatures(quarantined bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		req, ok := decodeModerationRequest(w, r)
+		if !ok {
+			return
+		}
+
+		if quarantined && req.Reason == "" {
+			req.Reason = "quarantined by a maintainer"
+		}
+
+		affected, err := s.db.SetQuarantined(req.Type, req.Signatures, quarantined, req.Reason)
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err, "failed to update signatures")
+			return
+		}
+
+		if quarantined {
+			s.logModeration(r, "quarantined", req, affected)
+		} else {
+			s.logModeration(r, "released", req, affected)
+		}
+
+		succeed(w, &client.ModerationResponse{Affected: affected})
+	}
+}
+
+func (s *Service) serveQuarantinedSignatures(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+
+	typ := client.SignatureTypeFunction
+	if params.Has("type") {
+		typ = client.SignatureType(params.Get("type"))
+		if typ != client.SignatureTypeFunction && typ != client.SignatureTypeEvent {
+			fail(w, http.StatusBadRequest, nil, "invalid signature type")
+			return
+		}
+	}
+
+	limit := defaultQuarantinedLimit
+	if params.Has("limit") {
+		v, err := strconv.Atoi(params.Get("limit"))
+		if err != nil || v <= 0 || v > maxQuarantinedLimit {
+			fail(w, http.StatusBadRequest, err, "invalid limit")
+			return
+		}
+		limit = v
+	}
+
+	signatures, err := s.db.ListQuarantinedSignatures(typ, params.Get("after"), limit)
+	if err != nil {
+		fail(w, http.StatusInternalServerError, err, "failed to list quarantined signatures")
+		return
+	}
+
+	response := &client.QuarantinedSignaturesResponse{
+		Signatures: signatures,
+	}
+	if len(signatures) == limit {
+		response.Next = signatures[len(signatures)-1].Name
+	}
+
+	succeed(w, response)
+}
@@ -0,0 +1,39 @@
+package signature_database_srv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFlagSignature(t *testing.T) {
+	const expected = "transfer(address,uint256)"
+
+	tests := []struct {
+		name   string
+		reason string
+	}{
+		{"join_tg_invmru_haha_fd06787(address,bool)", "known spam pattern colliding with " + expected},
+		{"visitTelegram_x(uint8)", "known spam pattern colliding with " + expected},
+		{"transfer_8c2f1a9(uint256)", "random name colliding with " + expected},
+		{"claimTokens_a1b2c3d4(bytes)", "random name colliding with " + expected},
+		{"watchMeNowAaaaBbbbCcccDdddEeeeFfffGgggHhhh(uint256)", "long name colliding with " + expected},
+		{"transferSafely_q(address,uint256)", "impersonates " + expected},
+		{"many_msg_babbage(bytes1)", ""},
+		{"erc20Transfer(uint256)", ""},
+		{"swapV2Tokens(uint256,address)", ""},
+		{"mint1155(address)", ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.reason, flagSignature(test.name, expected))
+		})
+	}
+}
+
+func TestIdentifierSegments(t *testing.T) {
+	assert.Equal(t, []string{"join", "tg", "haha"}, identifierSegments("join_tg_haha"))
+	assert.Equal(t, []string{"transfer", "From"}, identifierSegments("transferFrom"))
+	assert.Equal(t, []string{"ERC20", "Transfer"}, identifierSegments("_ERC20Transfer"))
+}
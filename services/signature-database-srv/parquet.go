@@ -0,0 +1,320 @@
+package signature_database_srv
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+)
+
+// parquetMagic starts and ends every parquet file
+const parquetMagic = "PAR1"
+
+// parquetRowGroupSize is the number of rows buffered before they're written as a row group, which bounds the memory
+// used by large exports
+const parquetRowGroupSize = 100000
+
+// the parts of the parquet format the encoder uses, see parquet.thrift
+const (
+	parquetTypeBoolean   = 0
+	parquetTypeInt64     = 2
+	parquetTypeByteArray = 6
+
+	parquetConvertedUTF8            = 0
+	parquetConvertedTimestampMillis = 9
+
+	parquetRepetitionRequired = 0
+	parquetEncodingPlain      = 0
+	parquetEncodingRLE        = 3
+	parquetCodecUncompressed  = 0
+	parquetPageData           = 0
+)
+
+type parquetColumn struct {
+	name          string
+	typ           int32
+	convertedType int32
+}
+
+// parquetColumns are the columns of an export, every one of which is required
+var parquetColumns = []parquetColumn{
+	{name: "type", typ: parquetTypeByteArray, convertedType: parquetConvertedUTF8},
+	{name: "hash", typ: parquetTypeByteArray, convertedType: parquetConvertedUTF8},
+	{name: "name", typ: parquetTypeByteArray, convertedType: parquetConvertedUTF8},
+	{name: "created_at", typ: parquetTypeInt64, convertedType: parquetConvertedTimestampMillis},
+	{name: "removed", typ: parquetTypeBoolean, convertedType: -1},
+}
+
+type parquetColumnChunk struct {
+	offset int64
+	size   int64
+}
+
+type parquetRowGroup struct {
+	rows    int64
+	columns []parquetColumnChunk
+}
+
+// parquetEncoder writes an uncompressed parquet file with a single plain encoded page per column in each row group.
+// The export as a whole can still be compressed, like every other format.
+type parquetEncoder struct {
+	w      io.Writer
+	offset int64
+
+	// values holds the encoded values of each column in the current row group
+	values [5]bytes.Buffer
+	rows   int
+
+	rowGroups []*parquetRowGroup
+}
+
+func newParquetEncoder(w io.Writer) (*parquetEncoder, error) {
+	e := &parquetEncoder{w: w}
+	if err := e.write([]byte(parquetMagic)); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+func (e *parquetEncoder) write(b []byte) error {
+	n, err := e.w.Write(b)
+	e.offset += int64(n)
+	return err
+}
+
+func (e *parquetEncoder) Encode(entry *client.ExportEntry) error {
+	putParquetBytes(&e.values[0], []byte(entry.Type))
+	putParquetBytes(&e.values[1], []byte(entry.Hash))
+	putParquetBytes(&e.values[2], []byte(entry.Name))
+
+	var millis [8]byte
+	binary.LittleEndian.PutUint64(millis[:], uint64(entry.CreatedAt.UnixMilli()))
+	e.values[3].Write(millis[:])
+
+	// booleans are bit packed, starting from the least significant bit
+	if e.rows%8 == 0 {
+		e.values[4].WriteByte(0)
+	}
+	if entry.Removed {
+		e.values[4].Bytes()[e.values[4].Len()-1] |= 1 << (e.rows % 8)
+	}
+
+	e.rows++
+	if e.rows >= parquetRowGroupSize {
+		return e.writeRowGroup()
+	}
+	return nil
+}
+
+func putParquetBytes(buf *bytes.Buffer, b []byte) {
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(len(b)))
+	buf.Write(length[:])
+	buf.Write(b)
+}
+
+func (e *parquetEncoder) writeRowGroup() error {
+	rowGroup := &parquetRowGroup{rows: int64(e.rows)}
+
+	for i := range parquetColumns {
+		values := e.values[i].Bytes()
+
+		header := &thriftWriter{}
+		header.i32(1, parquetPageData)
+		header.i32(2, int32(len(values)))
+		header.i32(3, int32(len(values)))
+		header.structBegin(5)
+		header.i32(1, int32(e.rows))
+		header.i32(2, parquetEncodingPlain)
+		header.i32(3, parquetEncodingRLE)
+		header.i32(4, parquetEncodingRLE)
+		header.structEnd()
+		header.structEnd()
+
+		chunk := parquetColumnChunk{offset: e.offset, size: int64(header.buf.Len() + len(values))}
+		if err := e.write(header.buf.Bytes()); err != nil {
+			return err
+		}
+		if err := e.write(values); err != nil {
+			return err
+		}
+		rowGroup.columns = append(rowGroup.columns, chunk)
+
+		e.values[i].Reset()
+	}
+
+	e.rowGroups = append(e.rowGroups, rowGroup)
+	e.rows = 0
+	return nil
+}
+
+// Flush writes the remaining rows and the footer, after which nothing else can be encoded
+func (e *parquetEncoder) Flush() error {
+	if e.rows > 0 {
+		if err := e.writeRowGroup(); err != nil {
+			return err
+		}
+	}
+
+	var totalRows int64
+	for _, rowGroup := range e.rowGroups {
+		totalRows += rowGroup.rows
+	}
+
+	meta := &thriftWriter{}
+	meta.i32(1, 1)
+
+	meta.listBegin(2, thriftStruct, len(parquetColumns)+1)
+	meta.elemBegin()
+	meta.binary(4, "schema")
+	meta.i32(5, int32(len(parquetColumns)))
+	meta.structEnd()
+	for _, column := range parquetColumns {
+		meta.elemBegin()
+		meta.i32(1, column.typ)
+		meta.i32(3, parquetRepetitionRequired)
+		meta.binary(4, column.name)
+		if column.convertedType >= 0 {
+			meta.i32(6, column.convertedType)
+		}
+		meta.structEnd()
+	}
+
+	meta.i64(3, totalRows)
+
+	meta.listBegin(4, thriftStruct, len(e.rowGroups))
+	for _, rowGroup := range e.rowGroups {
+		var totalSize int64
+		for _, chunk := range rowGroup.columns {
+			totalSize += chunk.size
+		}
+
+		meta.elemBegin()
+		meta.listBegin(1, thriftStruct, len(rowGroup.columns))
+		for i, chunk := range rowGroup.columns {
+			meta.elemBegin()
+			meta.i64(2, chunk.offset)
+			meta.structBegin(3)
+			meta.i32(1, parquetColumns[i].typ)
+			meta.listBegin(2, thriftI32, 1)
+			meta.zigzag(parquetEncodingPlain)
+			meta.listBegin(3, thriftBinary, 1)
+			meta.string(parquetColumns[i].name)
+			meta.i32(4, parquetCodecUncompressed)
+			meta.i64(5, rowGroup.rows)
+			meta.i64(6, chunk.size)
+			meta.i64(7, chunk.size)
+			meta.i64(9, chunk.offset)
+			meta.structEnd()
+			meta.structEnd()
+		}
+		meta.i64(2, totalSize)
+		meta.i64(3, rowGroup.rows)
+		meta.structEnd()
+	}
+
+	meta.binary(6, "openchain signature database")
+	meta.structEnd()
+
+	var length [4]byte
+	binary.LittleEndian.PutUint32(length[:], uint32(meta.buf.Len()))
+
+	if err := e.write(meta.buf.Bytes()); err != nil {
+		return err
+	}
+	if err := e.write(length[:]); err != nil {
+		return err
+	}
+	return e.write([]byte(parquetMagic))
+}
+
+// the thrift compact protocol types the encoder uses
+const (
+	thriftI32    = 5
+	thriftI64    = 6
+	thriftBinary = 8
+	thriftList   = 9
+	thriftStruct = 12
+)
+
+// thriftWriter writes structs in the thrift compact protocol, which is what parquet uses for its metadata. Field ids
+// are written as deltas from the previous field of the same struct, so the writer keeps track of the last field of
+// every struct being written.
+type thriftWriter struct {
+	buf       bytes.Buffer
+	lastField []int16
+	field     int16
+}
+
+func (t *thriftWriter) varint(v uint64) {
+	var b [binary.MaxVarintLen64]byte
+	t.buf.Write(b[:binary.PutUvarint(b[:], v)])
+}
+
+func (t *thriftWriter) zigzag(v int64) {
+	t.varint(uint64(v<<1) ^ uint64(v>>63))
+}
+
+func (t *thriftWriter) fieldHeader(id int16, typ byte) {
+	if delta := id - t.field; delta > 0 && delta <= 15 {
+		t.buf.WriteByte(byte(delta)<<4 | typ)
+	} else {
+		t.buf.WriteByte(typ)
+		t.zigzag(int64(id))
+	}
+	t.field = id
+}
+
+func (t *thriftWriter) i32(id int16, v int32) {
+	t.fieldHeader(id, thriftI32)
+	t.zigzag(int64(v))
+}
+
+func (t *thriftWriter) i64(id int16, v int64) {
+	t.fieldHeader(id, thriftI64)
+	t.zigzag(v)
+}
+
+func (t *thriftWriter) binary(id int16, v string) {
+	t.fieldHeader(id, thriftBinary)
+	t.string(v)
+}
+
+// string writes a string without a field header, as used by list elements
+func (t *thriftWriter) string(v string) {
+	t.varint(uint64(len(v)))
+	t.buf.WriteString(v)
+}
+
+// listBegin writes the header of a list field, which must be followed by exactly n elements
+func (t *thriftWriter) listBegin(id int16, elemType byte, n int) {
+	t.fieldHeader(id, thriftList)
+	if n < 15 {
+		t.buf.WriteByte(byte(n)<<4 | elemType)
+	} else {
+		t.buf.WriteByte(0xf0 | elemType)
+		t.varint(uint64(n))
+	}
+}
+
+// structBegin starts a struct field, which is ended by structEnd
+func (t *thriftWriter) structBegin(id int16) {
+	t.fieldHeader(id, thriftStruct)
+	t.elemBegin()
+}
+
+// elemBegin starts a struct without a field header, as used by list elements
+func (t *thriftWriter) elemBegin() {
+	t.lastField = append(t.lastField, t.field)
+	t.field = 0
+}
+
+// structEnd ends the current struct, or the top level struct if none were started
+func (t *thriftWriter) structEnd() {
+	t.buf.WriteByte(0)
+	if n := len(t.lastField); n > 0 {
+		t.field = t.lastField[n-1]
+		t.lastField = t.lastField[:n-1]
+	}
+}
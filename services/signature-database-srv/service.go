@@ -3,114 +3,324 @@ package signature_database_srv
 import (
 	"fmt"
 	"github.com/google/uuid"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/core"
 	"github.com/openchainxyz/openchainxyz-monorepo/internal/discord"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/ethclient"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/notify"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/ratelimit"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
 	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
 	log "github.com/sirupsen/logrus"
-	"gopkg.in/yaml.v3"
-	"net/http"
+	"net"
 	"os"
 	"path"
 	"sync"
 	"time"
 )
 
+// signatureLens is the length in bytes of the hash of each signature type
+var signatureLens = map[client.SignatureType]int{
+	client.SignatureTypeFunction: 4,
+	client.SignatureTypeEvent:    32,
+	client.SignatureTypeError:    4,
+}
+
 type Config struct {
 	DatabaseHost     string `def:"127.0.0.1" env:"DB_HOST"`
 	DatabasePort     int    `def:"5432" env:"DB_PORT"`
 	DatabaseName     string `def:"postgres" env:"DB_NAME"`
 	DatabaseUser     string `def:"ethereum" env:"DB_USER"`
 	DatabasePassword string `def:"ethereum" env:"DB_PASS"`
+	StorageBackend   string `def:"postgres" env:"STORAGE_BACKEND"`
+	BoltPath         string `def:"signatures.db" env:"BOLT_PATH"`
 	HttpPort         int    `def:"34887" env:"PORT"`
 	DiscordBotToken  string `env:"DISCORD_BOT_TOKEN"`
 	DiscordChannel   string `env:"DISCORD_CHANNEL"`
+	SlackWebhookURL  string `env:"SLACK_WEBHOOK_URL"`
+	WebhookURL       string `env:"WEBHOOK_URL"`
+	WebhookSecret    string `env:"WEBHOOK_SECRET"`
+	NotifyFile       string `env:"NOTIFY_FILE"`
+
+	// AdminToken authenticates as an api key with the admin scope, which is needed to create the first stored key
+	AdminToken string `env:"ADMIN_TOKEN"`
+
+	// RequireImportKey rejects imports and guess requests which aren't made with an api key that has the import
+	// scope. It's off by default since the public import page doesn't send a key.
+	RequireImportKey bool `env:"REQUIRE_IMPORT_KEY"`
+
+	// Requests made without an api key are limited per ip, requests made with one are limited per key. Rates are
+	// in requests per second, a rate of zero disables the limit. Lookups are only limited per ip if
+	// RateLimitLookups is set, since many clients may share an ip.
+	RateLimitLookups     bool    `env:"RATE_LIMIT_LOOKUPS"`
+	RateLimitPerIP       float64 `def:"5" env:"RATE_LIMIT_PER_IP"`
+	RateLimitBurstPerIP  int     `def:"20" env:"RATE_LIMIT_BURST_PER_IP"`
+	RateLimitPerKey      float64 `def:"50" env:"RATE_LIMIT_PER_KEY"`
+	RateLimitBurstPerKey int     `def:"200" env:"RATE_LIMIT_BURST_PER_KEY"`
+
+	// Keys which aren't cached are looked up in the database, these lookups are limited per ip so that guessing
+	// keys can't flood it
+	RateLimitKeyLookupsPerIP      float64 `def:"1" env:"RATE_LIMIT_KEY_LOOKUPS_PER_IP"`
+	RateLimitBurstKeyLookupsPerIP int     `def:"10" env:"RATE_LIMIT_BURST_KEY_LOOKUPS_PER_IP"`
+
+	// TrustedProxies are the CIDRs of the proxies in front of the service, whose forwarding headers are used to
+	// find the ip of the client. The headers of any other peer are ignored.
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+
+	// NotifyRoutes maps each notification sink (discord, slack, webhook or file) to the event kinds it receives,
+	// as JSON. Discord only receives new collisions by default, every other sink receives every event.
+	NotifyRoutes map[string][]string `env:"NOTIFY_ROUTES"`
 
 	DataDumpDir string `env:"DATA_DUMP_DIR"`
+
+	// CanonicalSignaturesSource is "database", an http(s) URL, or the path to a local YAML file
+	CanonicalSignaturesSource string `def:"https://raw.githubusercontent.com/openchainxyz/canonical-signatures/main/canonical.yaml" env:"CANONICAL_SIGNATURES_SOURCE"`
+
+	// Lookups are cached for CacheTTL, or NegativeCacheTTL for hashes without any signatures. A CacheSize of zero
+	// disables the cache.
+	CacheSize        int           `def:"100000" env:"CACHE_SIZE"`
+	CacheTTL         time.Duration `def:"1h" env:"CACHE_TTL"`
+	NegativeCacheTTL time.Duration `def:"1m" env:"NEGATIVE_CACHE_TTL"`
+
+	// The guesser tries to recover signatures for queued hashes by combining dictionary words with the most common
+	// argument lists. GuesserRate bounds the number of candidates hashed per second, and GuesserDictionary is an
+	// optional YAML file of extra verbs and nouns.
+	GuesserEnabled       bool   `env:"GUESSER_ENABLED"`
+	GuesserRate          int    `def:"200000" env:"GUESSER_RATE"`
+	GuesserArgumentLists int    `def:"200" env:"GUESSER_ARGUMENT_LISTS"`
+	GuesserDictionary    string `env:"GUESSER_DICTIONARY"`
+
+	// StatsWindow is how far back the selector popularity stats go
+	StatsWindow time.Duration `def:"168h" env:"STATS_WINDOW"`
+
+	// MaxLookupBatchSize is the maximum number of selectors, across all types, in a single bulk lookup
+	MaxLookupBatchSize int `def:"10000" env:"MAX_LOOKUP_BATCH_SIZE"`
+
+	// RPCEndpoints maps each supported chain to the JSON-RPC endpoint used to fetch contract code, as JSON
+	RPCEndpoints map[string]string `env:"RPC_ENDPOINTS"`
 }
 
 type Service struct {
-	config  *Config
-	db      *database.Database
-	discord *discord.Client
+	config   *Config
+	db       database.Storage
+	cache    *cachedStorage
+	notifier notify.Notifier
 
+	canonicalSource                canonicalSource
 	canonicalSignaturesLock        sync.RWMutex
 	canonicalSignatures            map[string]string
 	lastCanonicalSignaturesRefresh time.Time
 
+	preferredSignaturesLock sync.RWMutex
+	preferredSignatures     client.AllTypes[map[string]string]
+
+	ethClientsLock sync.Mutex
+	ethClients     map[string]*ethclient.Client
+
+	apiKeysLock sync.Mutex
+	apiKeys     map[string]*apiKeyCacheEntry
+
+	apiKeyUsageLock sync.Mutex
+	apiKeyUsage     map[int]*database.APIKeyUsage
+
+	trustedProxies []*net.IPNet
+
+	ipLimiter        *ratelimit.Limiter
+	keyLimiter       *ratelimit.Limiter
+	keyLookupLimiter *ratelimit.Limiter
+
+	selectorStatsLock sync.Mutex
+	selectorStats     map[client.SignatureType]map[string]*database.SelectorCounts
+	trackedSelectors  int
+	droppedSelectors  int
+
+	guessDictionary *guessDictionary
+	guessSpaces     map[client.SignatureType]*guessSpace
+
 	dataExportLock     sync.Mutex
-	dataExportPath     string
+	dataExportDir      string
+	dataExportCursor   uint64
 	lastDataExportTime time.Time
 }
 
 func New(config *Config) (*Service, error) {
-	db, err := database.New(config.DatabaseHost, config.DatabasePort, config.DatabaseName, config.DatabaseUser, config.DatabasePassword)
+	db, err := OpenStorage(config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create database: %w", err)
+		return nil, err
+	}
+
+	trustedProxies, err := core.ParseNetworks(config.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	var cache *cachedStorage
+	if config.CacheSize > 0 {
+		cache = newCachedStorage(db, config.CacheSize, config.CacheTTL, config.NegativeCacheTTL)
+		db = cache
 	}
 
 	service := &Service{
 		config: config,
 		db:     db,
+		cache:  cache,
 
+		canonicalSource:         newCanonicalSource(config.CanonicalSignaturesSource, db),
 		canonicalSignaturesLock: sync.RWMutex{},
 		canonicalSignatures:     make(map[string]string),
 
+		preferredSignaturesLock: sync.RWMutex{},
+		preferredSignatures:     make(client.AllTypes[map[string]string]),
+
+		ethClientsLock: sync.Mutex{},
+		ethClients:     make(map[string]*ethclient.Client),
+
+		apiKeysLock: sync.Mutex{},
+		apiKeys:     make(map[string]*apiKeyCacheEntry),
+
+		apiKeyUsageLock: sync.Mutex{},
+		apiKeyUsage:     make(map[int]*database.APIKeyUsage),
+
+		trustedProxies: trustedProxies,
+
+		ipLimiter:        ratelimit.New(config.RateLimitPerIP, config.RateLimitBurstPerIP),
+		keyLimiter:       ratelimit.New(config.RateLimitPerKey, config.RateLimitBurstPerKey),
+		keyLookupLimiter: ratelimit.New(config.RateLimitKeyLookupsPerIP, config.RateLimitBurstKeyLookupsPerIP),
+
+		selectorStatsLock: sync.Mutex{},
+		selectorStats:     make(map[client.SignatureType]map[string]*database.SelectorCounts),
+
+		guessSpaces: make(map[client.SignatureType]*guessSpace),
+
 		dataExportLock: sync.Mutex{},
 	}
 
-	if config.DiscordBotToken != "" {
-		discordClient, err := discord.New(config.DiscordBotToken)
+	if config.GuesserEnabled {
+		service.guessDictionary, err = loadGuessDictionary(config.GuesserDictionary)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create discord bot: %w", err)
+			return nil, err
 		}
-		service.discord = discordClient
 	}
 
-	if err := service.loadCanonicalSignatures(); err != nil {
+	notifier, err := newNotifier(config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create notifier: %w", err)
+	}
+	service.notifier = notifier
+
+	if _, err := service.loadCanonicalSignatures(); err != nil {
 		return nil, fmt.Errorf("failed to load canonical signatures: %w", err)
 	}
 
+	if err := service.loadPreferredSignatures(); err != nil {
+		return nil, fmt.Errorf("failed to load preferred signatures: %w", err)
+	}
+
 	return service, nil
 }
 
-func (s *Service) Start() error {
-	go s.startServer()
-	go s.runTasks()
+// OpenStorage opens the configured storage backend, which is either "postgres" or "bolt". The bolt backend keeps
+// everything in a single local file, so it is only meant for development.
+func OpenStorage(config *Config) (database.Storage, error) {
+	switch config.StorageBackend {
+	case "postgres":
+		db, err := database.New(config.DatabaseHost, config.DatabasePort, config.DatabaseName, config.DatabaseUser, config.DatabasePassword)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create database: %w", err)
+		}
+		return db, nil
+	case "bolt":
+		db, err := database.NewBolt(config.BoltPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create database: %w", err)
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend: %s", config.StorageBackend)
+	}
+}
 
-	return nil
+var defaultNotifyRoutes = map[string][]notify.EventKind{
+	"discord": {notify.EventNewCollisions},
+	"slack":   notify.EventKinds(),
+	"webhook": notify.EventKinds(),
+	"file":    notify.EventKinds(),
 }
 
-func (s *Service) loadCanonicalSignatures() error {
-	s.canonicalSignaturesLock.Lock()
-	lastRefresh := s.lastCanonicalSignaturesRefresh
-	s.canonicalSignaturesLock.Unlock()
+func newNotifier(config *Config) (notify.Notifier, error) {
+	routes, err := notifyRoutes(config.NotifyRoutes)
+	if err != nil {
+		return nil, err
+	}
+
+	sinks := make(map[string]notify.Notifier)
 
-	if time.Since(lastRefresh) < 1*time.Hour {
-		return fmt.Errorf("refreshing too soon")
+	if config.DiscordBotToken != "" {
+		discordClient, err := discord.New(config.DiscordBotToken)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create discord bot: %w", err)
+		}
+		sinks["discord"] = notify.NewDiscord(discordClient, config.DiscordChannel)
+	}
+	if config.SlackWebhookURL != "" {
+		sinks["slack"] = notify.NewSlack(config.SlackWebhookURL)
+	}
+	if config.WebhookURL != "" {
+		sinks["webhook"] = notify.NewWebhook(config.WebhookURL, config.WebhookSecret)
+	}
+	if config.NotifyFile != "" {
+		file, err := notify.NewFile(config.NotifyFile)
+		if err != nil {
+			return nil, err
+		}
+		sinks["file"] = file
 	}
 
-	resp, err := http.Get("https://raw.githubusercontent.com/openchainxyz/canonical-signatures/main/canonical.yaml")
-	if err != nil {
-		return fmt.Errorf("failed to fetch canonical signatures: %w", err)
+	if len(sinks) == 0 {
+		return nil, nil
 	}
 
-	var output map[string]struct {
-		Signature string `yaml:"signature"`
-		Source    string `yaml:"source"`
+	var multi notify.Multi
+	for name, sink := range sinks {
+		multi = append(multi, notify.WithKinds(sink, routes[name]...))
 	}
+	return multi, nil
+}
 
-	if err := yaml.NewDecoder(resp.Body).Decode(&output); err != nil {
-		return fmt.Errorf("failed to unmarshal yaml: %w", err)
+// notifyRoutes overrides the default routes with the configured ones, rejecting unknown sinks and event kinds so
+// that a typo doesn't silently stop notifications
+func notifyRoutes(configured map[string][]string) (map[string][]notify.EventKind, error) {
+	routes := make(map[string][]notify.EventKind)
+	for name, kinds := range defaultNotifyRoutes {
+		routes[name] = kinds
 	}
 
-	newCanonicalSignatures := make(map[string]string)
-	for k, v := range output {
-		newCanonicalSignatures[k] = v.Signature
+	for name, names := range configured {
+		if _, ok := defaultNotifyRoutes[name]; !ok {
+			return nil, fmt.Errorf("unknown notification sink: %s", name)
+		}
+
+		kinds := make([]notify.EventKind, 0, len(names))
+		for _, kindName := range names {
+			kind, err := notify.ParseEventKind(kindName)
+			if err != nil {
+				return nil, fmt.Errorf("invalid route for %s: %w", name, err)
+			}
+			kinds = append(kinds, kind)
+		}
+		routes[name] = kinds
 	}
+	return routes, nil
+}
 
-	s.canonicalSignaturesLock.Lock()
-	s.canonicalSignatures = newCanonicalSignatures
-	s.lastCanonicalSignaturesRefresh = time.Now()
-	s.canonicalSignaturesLock.Unlock()
+func (s *Service) Start() error {
+	go s.startServer()
+	go s.runTasks()
+	go s.runAuthTasks()
+	go s.runStatsTasks()
+
+	if s.config.GuesserEnabled {
+		go s.runGuesser()
+	}
 
 	return nil
 }
@@ -124,36 +334,36 @@ func (s *Service) exportData() error {
 		return fmt.Errorf("exporting too soon")
 	}
 
-	newPath := path.Join(s.config.DataDumpDir, uuid.New().String()+".txt")
+	newDir := path.Join(s.config.DataDumpDir, uuid.New().String())
 
-	f, err := os.Create(newPath)
-	if err != nil {
+	if err := os.MkdirAll(newDir, os.FileMode(0755)); err != nil {
 		return err
 	}
 
-	if err := s.db.ExportData(f); err != nil {
-		f.Close()
-		return err
-	}
-
-	if err := f.Close(); err != nil {
+	cursor, err := s.writeFullExport(newDir)
+	if err != nil {
+		os.RemoveAll(newDir)
 		return err
 	}
 
 	s.dataExportLock.Lock()
-	lastPath := s.dataExportPath
-	s.dataExportPath = newPath
+	lastDir := s.dataExportDir
+	s.dataExportDir = newDir
+	s.dataExportCursor = cursor
 	s.lastDataExportTime = time.Now()
 	s.dataExportLock.Unlock()
 
-	os.Remove(lastPath)
+	if lastDir != "" {
+		os.RemoveAll(lastDir)
+	}
 
 	return nil
 }
+
 func (s *Service) runTasks() {
 	ticker := time.NewTicker(24 * time.Hour)
 	for ; true; <-ticker.C {
-		if err := s.loadCanonicalSignatures(); err != nil {
+		if _, err := s.loadCanonicalSignatures(); err != nil {
 			log.WithError(err).Errorf("failed to load canonical signatures")
 		} else {
 			log.Info("successfully refreshed canonical signatures")
@@ -0,0 +1,30 @@
+package signature_database_srv
+
+import (
+	"testing"
+
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/notify"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNotifyRoutes(t *testing.T) {
+	routes, err := notifyRoutes(map[string][]string{
+		"discord": {"new_signatures", "canonical_changed"},
+		"webhook": {},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []notify.EventKind{notify.EventNewSignatures, notify.EventCanonicalChanged}, routes["discord"])
+	assert.Empty(t, routes["webhook"])
+	assert.Equal(t, notify.EventKinds(), routes["slack"])
+
+	_, err = notifyRoutes(map[string][]string{"discord": {"new_collision"}})
+	assert.ErrorContains(t, err, "unknown event kind: new_collision")
+
+	_, err = notifyRoutes(map[string][]string{"telegram": {"new_collisions"}})
+	assert.ErrorContains(t, err, "unknown notification sink: telegram")
+
+	// routes are checked even if their sink isn't configured
+	_, err = newNotifier(&Config{NotifyRoutes: map[string][]string{"slack": {"everything"}}})
+	assert.Error(t, err)
+}
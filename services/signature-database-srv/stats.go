@@ -0,0 +1,146 @@
+package signature_database_srv
+
+import (
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	log "github.com/sirupsen/logrus"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// maxTrackedSelectors bounds the number of distinct hashes counted between flushes, so a client looking up
+	// random hashes can't grow the counters without limit
+	maxTrackedSelectors = 100000
+
+	defaultSelectorStatsLimit = 100
+	maxSelectorStatsLimit     = 1000
+)
+
+// recordLookups counts every hash in the response, which must not have been filtered yet so that hashes whose
+// signatures are all filtered aren't counted as misses
+func (s *Service) recordLookups(response client.SignatureResponse) {
+	s.selectorStatsLock.Lock()
+	defer s.selectorStatsLock.Unlock()
+
+	for typ, hashes := range response {
+		// errors share the hashes of functions
+		if typ == client.SignatureTypeError {
+			typ = client.SignatureTypeFunction
+		}
+
+		if _, ok := s.selectorStats[typ]; !ok {
+			s.selectorStats[typ] = make(map[string]*database.SelectorCounts)
+		}
+
+		for hash, sigs := range hashes {
+			counts, ok := s.selectorStats[typ][hash]
+			if !ok {
+				if s.trackedSelectors >= maxTrackedSelectors {
+					s.droppedSelectors++
+					continue
+				}
+
+				counts = &database.SelectorCounts{}
+				s.selectorStats[typ][hash] = counts
+				s.trackedSelectors++
+			}
+
+			counts.Lookups++
+			if len(sigs) == 0 {
+				counts.Misses++
+			}
+		}
+	}
+}
+
+func (s *Service) flushSelectorStats() error {
+	s.selectorStatsLock.Lock()
+	stats := s.selectorStats
+	dropped := s.droppedSelectors
+	s.selectorStats = make(map[client.SignatureType]map[string]*database.SelectorCounts)
+	s.trackedSelectors = 0
+	s.droppedSelectors = 0
+	s.selectorStatsLock.Unlock()
+
+	if dropped > 0 {
+		log.WithField("dropped", dropped).Warnf("too many distinct selectors looked up, some lookups weren't counted")
+	}
+
+	if len(stats) > 0 {
+		if err := s.db.RecordSelectorStats(time.Now().UTC().Truncate(time.Hour), stats); err != nil {
+			return err
+		}
+	}
+
+	return s.db.PruneSelectorStats(time.Now().Add(-s.config.StatsWindow))
+}
+
+func (s *Service) runStatsTasks() {
+	ticker := time.NewTicker(time.Minute)
+	for range ticker.C {
+		if err := s.flushSelectorStats(); err != nil {
+			log.WithError(err).Errorf("failed to record selector stats")
+		}
+	}
+}
+
+func (s *Service) serveSelectorStats(unknown bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+
+		typ := client.SignatureTypeFunction
+		if params.Has("type") {
+			typ = client.SignatureType(params.Get("type"))
+			if !typ.Valid() {
+				fail(w, http.StatusBadRequest, nil, "invalid signature type")
+				return
+			}
+		}
+
+		limit := defaultSelectorStatsLimit
+		if params.Has("limit") {
+			v, err := strconv.Atoi(params.Get("limit"))
+			if err != nil || v <= 0 || v > maxSelectorStatsLimit {
+				fail(w, http.StatusBadRequest, err, "invalid limit")
+				return
+			}
+			limit = v
+		}
+
+		since := time.Now().Add(-s.config.StatsWindow).UTC().Truncate(time.Hour)
+
+		stats, err := s.db.ListSelectorStats(typ, since, unknown, limit)
+		if err != nil {
+			fail(w, http.StatusInternalServerError, err, "failed to list selector stats")
+			return
+		}
+
+		if !unknown && len(stats) > 0 {
+			var hashes []string
+			for _, stat := range stats {
+				hashes = append(hashes, stat.Hash)
+			}
+
+			sigs, err := s.db.LoadSignatures(typ, hashes)
+			if err != nil {
+				fail(w, http.StatusInternalServerError, err, "failed to load signatures")
+				return
+			}
+
+			response := client.SignatureResponse{typ: sigs}
+			s.filterResponse(response, true)
+
+			for _, stat := range stats {
+				stat.Signatures = response[typ][stat.Hash]
+			}
+		}
+
+		succeed(w, &client.SelectorStatsResponse{
+			Type:      typ,
+			Since:     since,
+			Selectors: stats,
+		})
+	}
+}
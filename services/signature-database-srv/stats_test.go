@@ -0,0 +1,85 @@
+package signature_database_srv
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/client"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/signature-database-srv/database"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectorStats(t *testing.T) {
+	db, err := database.NewBolt(filepath.Join(t.TempDir(), "signatures.db"))
+	require.NoError(t, err)
+	defer db.Close()
+
+	_, err = db.SaveSignatures(client.SignatureTypeFunction, []string{"transfer(address,uint256)"})
+	require.NoError(t, err)
+
+	s := &Service{
+		config:        &Config{StatsWindow: 24 * time.Hour},
+		db:            db,
+		selectorStats: make(map[client.SignatureType]map[string]*database.SelectorCounts),
+	}
+
+	known := hexutil.Encode(crypto.Keccak256([]byte("transfer(address,uint256)"))[:4])
+	unknown := "0x12345678"
+
+	for i := 0; i < 3; i++ {
+		response, err := db.LoadSignatures(client.SignatureTypeFunction, []string{known})
+		require.NoError(t, err)
+		s.recordLookups(client.SignatureResponse{client.SignatureTypeFunction: response})
+	}
+
+	// errors are counted as functions
+	response, err := db.LoadSignatures(client.SignatureTypeError, []string{unknown})
+	require.NoError(t, err)
+	s.recordLookups(client.SignatureResponse{client.SignatureTypeError: response})
+
+	require.NoError(t, s.flushSelectorStats())
+	assert.Empty(t, s.selectorStats)
+
+	serve := func(unknown bool) *client.SelectorStatsResponse {
+		w := httptest.NewRecorder()
+		s.serveSelectorStats(unknown)(w, httptest.NewRequest("GET", "/v1/stats/popular", nil))
+
+		var resp struct {
+			Ok     bool                          `json:"ok"`
+			Result *client.SelectorStatsResponse `json:"result"`
+		}
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&resp))
+		require.True(t, resp.Ok)
+		return resp.Result
+	}
+
+	popular := serve(false)
+	require.Len(t, popular.Selectors, 2)
+	assert.Equal(t, known, popular.Selectors[0].Hash)
+	assert.Equal(t, int64(3), popular.Selectors[0].Lookups)
+	require.Len(t, popular.Selectors[0].Signatures, 1)
+	assert.Equal(t, "transfer(address,uint256)", popular.Selectors[0].Signatures[0].Name)
+
+	unknowns := serve(true)
+	require.Len(t, unknowns.Selectors, 1)
+	assert.Equal(t, unknown, unknowns.Selectors[0].Hash)
+	assert.Equal(t, int64(1), unknowns.Selectors[0].Misses)
+}
+
+func TestRecordLookupsLimit(t *testing.T) {
+	s := &Service{
+		selectorStats:    make(map[client.SignatureType]map[string]*database.SelectorCounts),
+		trackedSelectors: maxTrackedSelectors,
+	}
+
+	s.recordLookups(client.SignatureResponse{client.SignatureTypeFunction: {"0x12345678": nil}})
+
+	assert.Empty(t, s.selectorStats[client.SignatureTypeFunction])
+	assert.Equal(t, 1, s.droppedSelectors)
+}
@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 )
 
 type Client struct {
@@ -42,9 +43,7 @@ func (c *Client) Compile(input *CompileRequest) (*SolcStandardOutput, error) {
 		return nil, fmt.Errorf("%w: %s", ErrCompilerUnavailable, err.Error())
 	}
 
-	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("%w: expected http 200 but got %d", ErrCompilerUnavailable, resp.StatusCode)
-	}
+	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
@@ -53,12 +52,111 @@ func (c *Client) Compile(input *CompileRequest) (*SolcStandardOutput, error) {
 
 	var compilerResp CompileResponse
 	if err := json.Unmarshal(body, &compilerResp); err != nil {
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("%w: expected http 200 but got %d", ErrCompilerUnavailable, resp.StatusCode)
+		}
 		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
 	}
 
+	if len(compilerResp.Result) == 0 {
+		if !compilerResp.Ok {
+			return nil, fmt.Errorf("%w: %s", ErrCompilerUnavailable, compilerResp.Error)
+		}
+		return nil, fmt.Errorf("response has no result")
+	}
+
+	result := &SolcStandardOutput{Raw: compilerResp.Result}
+	if err := json.Unmarshal(compilerResp.Result, result); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal result: %w", err)
+	}
+
 	if !compilerResp.Ok {
-		return nil, fmt.Errorf("%w: %s", ErrCompilerUnavailable, compilerResp.Error)
+		return nil, &CompileError{
+			Message: compilerResp.Error,
+			Errors:  result.Errors,
+		}
+	}
+
+	return result, nil
+}
+
+// Versions returns the compiler versions the service can compile with
+func (c *Client) Versions() (*VersionList, error) {
+	resp, err := c.client.Get(c.host + "/v1/versions")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCompilerUnavailable, err.Error())
+	}
+	defer resp.Body.Close()
+
+	var versionsResp VersionsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&versionsResp); err != nil {
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("%w: expected http 200 but got %d", ErrCompilerUnavailable, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if !versionsResp.Ok {
+		return nil, fmt.Errorf("%w: %s", ErrCompilerUnavailable, versionsResp.Error)
+	}
+
+	return versionsResp.Result, nil
+}
+
+// Verify checks that the contract deployed at the address was compiled from the input. Verified sources are stored
+// by the service.
+func (c *Client) Verify(request *VerifyRequest) (*VerifyResult, error) {
+	b, err := json.Marshal(request)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	resp, err := c.client.Post(c.host+"/v1/verify", "application/json", bytes.NewReader(b))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCompilerUnavailable, err.Error())
+	}
+	defer resp.Body.Close()
+
+	var verifyResp VerifyResponse
+	if err := json.NewDecoder(resp.Body).Decode(&verifyResp); err != nil {
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("%w: expected http 200 but got %d", ErrCompilerUnavailable, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if !verifyResp.Ok {
+		if resp.StatusCode == http.StatusBadRequest {
+			return nil, fmt.Errorf("%w: %s", ErrNotVerified, verifyResp.Error)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrCompilerUnavailable, verifyResp.Error)
+	}
+
+	return verifyResp.Result, nil
+}
+
+// Metadata returns the compiler metadata of the contract deployed at the address
+func (c *Client) Metadata(chain string, address string) (*MetadataResult, error) {
+	resp, err := c.client.Get(c.host + "/v1/metadata/" + url.PathEscape(chain) + "/" + url.PathEscape(address))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrCompilerUnavailable, err.Error())
+	}
+	defer resp.Body.Close()
+
+	var metadataResp MetadataResponse
+	if err := json.NewDecoder(resp.Body).Decode(&metadataResp); err != nil {
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("%w: expected http 200 but got %d", ErrCompilerUnavailable, resp.StatusCode)
+		}
+		return nil, fmt.Errorf("failed to unmarshal response: %w", err)
+	}
+
+	if !metadataResp.Ok {
+		if resp.StatusCode == http.StatusNotFound {
+			return nil, fmt.Errorf("%w: %s", ErrNoMetadata, metadataResp.Error)
+		}
+		return nil, fmt.Errorf("%w: %s", ErrCompilerUnavailable, metadataResp.Error)
 	}
 
-	return compilerResp.Result, nil
+	return metadataResp.Result, nil
 }
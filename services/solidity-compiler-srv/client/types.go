@@ -1,48 +1,106 @@
 package solidityclient
 
-import "errors"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
 
-var ErrCompilerUnavailable = errors.New("compiler unavailable")
+var (
+	ErrCompilerUnavailable = errors.New("compiler unavailable")
+	ErrNotVerified         = errors.New("contract couldn't be verified")
+	ErrNoMetadata          = errors.New("contract has no metadata")
+)
 
 type SolcSource struct {
-	Content string `json:"content"`
+	Content string   `json:"content,omitempty"`
+	URLs    []string `json:"urls,omitempty"`
 }
 
+// SolcStandardInput is solc's standard JSON input. Settings are passed to the compiler as they are, see
+// https://docs.soliditylang.org/en/latest/using-the-compiler.html#input-description
 type SolcStandardInput struct {
 	Language string                `json:"language"`
 	Sources  map[string]SolcSource `json:"sources"`
 	Settings map[string]any        `json:"settings"`
 }
 
+// SolcStandardOutput is the part of solc's standard JSON output the client decodes. Raw holds all of it, including
+// the outputs which aren't modeled here, like the AST or gas estimates.
 type SolcStandardOutput struct {
-	Errors    []SolcError                         `json:"errors"`
+	Raw json.RawMessage `json:"-"`
+
+	// Errors holds all diagnostics, so a successful compilation may still carry warnings
+	Errors []SolcError `json:"errors"`
+	// Contracts are keyed by source name and then contract name
 	Contracts map[string]map[string]*SolcContract `json:"contracts"`
+	Sources   map[string]*SolcSourceOutput        `json:"sources,omitempty"`
+}
+
+type SolcSourceOutput struct {
+	// ID is the index of the source used in source maps
+	ID int `json:"id"`
 }
 
+// SolcError is a diagnostic reported by solc. Despite the name, warnings and infos are reported the same way and
+// can be told apart by Severity.
 type SolcError struct {
-	//Component        string `json:"component"`
-	//FormattedMessage string `json:"formattedMessage"`
-	//Message          string `json:"message"`
-	Severity string `json:"severity"`
-	//SourceLocation   string `json:"sourceLocation"`
-	//Type             string `json:"type"`
+	// Component is where the diagnostic came from, usually "general"
+	Component string `json:"component"`
+	// Type is the kind of diagnostic, e.g. TypeError, ParserError or Warning
+	Type      string `json:"type"`
+	ErrorCode string `json:"errorCode,omitempty"`
+	// Severity is one of error, warning or info
+	Severity         string              `json:"severity"`
+	Message          string              `json:"message"`
+	FormattedMessage string              `json:"formattedMessage"`
+	SourceLocation   *SolcSourceLocation `json:"sourceLocation,omitempty"`
+	// SecondarySourceLocations point at related code, e.g. the previous declaration of an identifier
+	SecondarySourceLocations []*SolcSourceLocation `json:"secondarySourceLocations,omitempty"`
+}
+
+// SolcSourceLocation is a byte range within one of the input sources. Start and End are -1 if the location is unknown.
+type SolcSourceLocation struct {
+	File    string `json:"file"`
+	Start   int    `json:"start"`
+	End     int    `json:"end"`
+	Message string `json:"message,omitempty"`
+}
+
+// CompileError is returned by the client when solc rejects the input
+type CompileError struct {
+	Message string
+	// Errors holds every diagnostic solc reported, including warnings
+	Errors []SolcError
+}
+
+func (e *CompileError) Error() string {
+	return fmt.Sprintf("compilation failed: %s", e.Message)
 }
 
 type SolcContract struct {
-	ABI      any     `json:"abi"`
-	Metadata string  `json:"metadata"`
-	EVM      SolcEVM `json:"evm"`
+	ABI           any                `json:"abi"`
+	Metadata      string             `json:"metadata"`
+	UserDoc       any                `json:"userdoc,omitempty"`
+	DevDoc        any                `json:"devdoc,omitempty"`
+	EVM           SolcEVM            `json:"evm"`
+	StorageLayout *SolcStorageLayout `json:"storageLayout,omitempty"`
 }
 
 type SolcEVM struct {
 	Bytecode         SolcBytecode `json:"bytecode"`
 	DeployedBytecode SolcBytecode `json:"deployedBytecode"`
+	// MethodIdentifiers maps each function signature to its selector, without a 0x prefix
+	MethodIdentifiers map[string]string `json:"methodIdentifiers,omitempty"`
 }
 
 type SolcBytecode struct {
 	Object         string                                    `json:"object"`
+	Opcodes        string                                    `json:"opcodes,omitempty"`
 	SourceMap      string                                    `json:"sourceMap"`
 	LinkReferences map[string]map[string][]SolcLinkReference `json:"linkReferences"`
+	// ImmutableReferences is only set for deployed bytecode, and is keyed by the AST id of the immutable
+	ImmutableReferences map[string][]SolcLinkReference `json:"immutableReferences,omitempty"`
 }
 
 type SolcLinkReference struct {
@@ -50,13 +108,132 @@ type SolcLinkReference struct {
 	Length uint64 `json:"length"`
 }
 
+type SolcStorageLayout struct {
+	Storage []*SolcStorageEntry         `json:"storage"`
+	Types   map[string]*SolcStorageType `json:"types"`
+}
+
+type SolcStorageEntry struct {
+	AstID    int    `json:"astId"`
+	Contract string `json:"contract"`
+	Label    string `json:"label"`
+	Offset   int    `json:"offset"`
+	Slot     string `json:"slot"`
+	Type     string `json:"type"`
+}
+
+type SolcStorageType struct {
+	Encoding      string              `json:"encoding"`
+	Label         string              `json:"label"`
+	NumberOfBytes string              `json:"numberOfBytes"`
+	Members       []*SolcStorageEntry `json:"members,omitempty"`
+	Key           string              `json:"key,omitempty"`
+	Value         string              `json:"value,omitempty"`
+	Base          string              `json:"base,omitempty"`
+}
+
 type CompileRequest struct {
-	Version string             `json:"version"`
+	// Version is optional, if it's empty the newest release which satisfies the pragmas of every source is used
+	Version string             `json:"version,omitempty"`
 	Input   *SolcStandardInput `json:"input"`
 }
 
+// CompileResponse is returned for both successful and failed compilations. If solc rejected the input, Result is
+// still set so that its diagnostics can be inspected. Result is solc's output as it is, with every output the input
+// selected, and can be decoded into a SolcStandardOutput.
 type CompileResponse struct {
-	Ok     bool                `json:"ok"`
-	Error  string              `json:"error"`
-	Result *SolcStandardOutput `json:"result"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Version is the solc version the input was compiled with
+	Version string          `json:"version,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+}
+
+type VerifyRequest struct {
+	// Chain is the name of the chain the contract is deployed on, e.g. ethereum
+	Chain   string `json:"chain"`
+	Address string `json:"address"`
+	// Version is optional, if it's empty the newest release which satisfies the pragmas of every source is used
+	Version string             `json:"version,omitempty"`
+	Input   *SolcStandardInput `json:"input"`
+	// Contract is the fully qualified name of the contract, e.g. contracts/Token.sol:Token. If it's empty, every
+	// contract in the sources is tried.
+	Contract string `json:"contract,omitempty"`
+}
+
+type VerifyResult struct {
+	// Match is exact if the deployed code is identical to the compiled code, or partial if only the metadata differs
+	Match string `json:"match"`
+	// Contract is the fully qualified name of the contract which matched
+	Contract string `json:"contract"`
+	Version  string `json:"version"`
+	CodeHash string `json:"codeHash"`
+	// Libraries holds the address each library is linked to, keyed by fully qualified name
+	Libraries map[string]string `json:"libraries,omitempty"`
+	// Immutables holds the value of each immutable, keyed by AST id
+	Immutables map[string]string `json:"immutables,omitempty"`
+}
+
+type VerifyResponse struct {
+	Ok     bool          `json:"ok"`
+	Error  string        `json:"error,omitempty"`
+	Result *VerifyResult `json:"result,omitempty"`
+}
+
+// MetadataResult is the metadata the compiler appended to the code of a contract
+type MetadataResult struct {
+	// Compiler is solc or vyper, and is empty for solc before 0.5.9 which didn't include it
+	Compiler string `json:"compiler,omitempty"`
+	// Version is empty for solc before 0.5.9, and includes the commit and date for prereleases
+	Version      string `json:"version,omitempty"`
+	Experimental bool   `json:"experimental,omitempty"`
+	// Hash is the location of the metadata JSON, e.g. ipfs://Qm... or bzz-raw://...
+	Hash     string `json:"hash,omitempty"`
+	CodeHash string `json:"codeHash"`
+}
+
+type MetadataResponse struct {
+	Ok     bool            `json:"ok"`
+	Error  string          `json:"error,omitempty"`
+	Result *MetadataResult `json:"result,omitempty"`
+}
+
+// CompilerVersion is a compiler release which can be used to compile
+type CompilerVersion struct {
+	Version     string `json:"version"`
+	LongVersion string `json:"longVersion"`
+	// Installed is whether the binary is already available, the first compile with any other version downloads it
+	Installed bool `json:"installed"`
+}
+
+type VersionList struct {
+	LatestRelease string `json:"latestRelease"`
+	// Releases are ordered newest first
+	Releases []*CompilerVersion `json:"releases"`
+}
+
+type VersionsResponse struct {
+	Ok     bool         `json:"ok"`
+	Error  string       `json:"error,omitempty"`
+	Result *VersionList `json:"result,omitempty"`
+}
+
+// Stats describes the load on the compiler service
+type Stats struct {
+	Workers int `json:"workers"`
+	// Running and Queued are the number of compilations currently running and waiting for a worker
+	Running int64 `json:"running"`
+	Queued  int64 `json:"queued"`
+	// Completed and Failed count the compilations which have finished, Failed includes Timeouts
+	Completed uint64 `json:"completed"`
+	Failed    uint64 `json:"failed"`
+	Timeouts  uint64 `json:"timeouts"`
+	// Rejected counts the compilations which were turned away because the queue was full
+	Rejected uint64 `json:"rejected"`
+}
+
+type StatsResponse struct {
+	Ok     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Result *Stats `json:"result,omitempty"`
 }
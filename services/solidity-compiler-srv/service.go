@@ -1,9 +1,13 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -14,15 +18,80 @@ import (
 
 type Config struct {
 	HttpPort int `def:"8082" env:"HTTP_PORT"`
+
+	// CompilerManifest overrides where the list of solc releases is read from, either a url or a local path.
+	// CompilerDir is where solc binaries are installed, and CompilerOfflineDir holds preloaded binaries.
+	CompilerManifest   string `env:"COMPILER_MANIFEST"`
+	CompilerDir        string `env:"COMPILER_DIR"`
+	CompilerOfflineDir string `env:"COMPILER_OFFLINE_DIR"`
+
+	// CacheSize is the number of compilation results kept in memory, taking up to CacheMemoryMB, and CacheDir is
+	// where results are stored on disk. Results are only kept in memory if CacheDir isn't set.
+	CacheSize     int    `def:"256" env:"CACHE_SIZE"`
+	CacheMemoryMB int64  `def:"1024" env:"CACHE_MEMORY_MB"`
+	CacheDir      string `env:"CACHE_DIR"`
+
+	// Workers is the number of compilers run at once, defaulting to the number of cpus. Up to QueueSize compilations
+	// wait for a worker, any more are rejected with a 503.
+	Workers   int `env:"WORKERS"`
+	QueueSize int `def:"64" env:"QUEUE_SIZE"`
+
+	// CompileTimeout, CompileMemoryMB and CompileOutputMB limit the resources of a single compilation
+	CompileTimeout  time.Duration `def:"60s" env:"COMPILE_TIMEOUT"`
+	CompileMemoryMB uint64        `def:"4096" env:"COMPILE_MEMORY_MB"`
+	CompileOutputMB int64         `def:"64" env:"COMPILE_OUTPUT_MB"`
+
+	// RPCEndpoints maps each chain contracts can be verified on to the JSON-RPC endpoint used to fetch their code,
+	// as JSON. VerifiedDir is where verified sources are stored, which the tracer reads them from.
+	RPCEndpoints map[string]string `env:"RPC_ENDPOINTS"`
+	VerifiedDir  string            `env:"VERIFIED_DIR"`
 }
 
 type Service struct {
 	config *Config
+
+	compilers *compiler.Manager
+	results   *compiler.ResultCache
+	runner    *compiler.Runner
+
+	nodesLock sync.Mutex
+	nodes     map[string]codeReader
+	verified  *compiler.VerifiedStore
 }
 
 func New(config *Config) (*Service, error) {
+	compilers, err := compiler.NewManager(compiler.LanguageSolidity, &compiler.ManagerConfig{
+		Manifest:   config.CompilerManifest,
+		Dir:        config.CompilerDir,
+		OfflineDir: config.CompilerOfflineDir,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compiler manager: %w", err)
+	}
+
+	results, err := compiler.NewResultCache(config.CacheDir, config.CacheSize, config.CacheMemoryMB<<20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create result cache: %w", err)
+	}
+
+	verified, err := compiler.NewVerifiedStore(config.VerifiedDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create verified store: %w", err)
+	}
+
 	return &Service{
-		config: config,
+		config:    config,
+		compilers: compilers,
+		results:   results,
+		nodes:     make(map[string]codeReader),
+		verified:  verified,
+		runner: compiler.NewRunner(&compiler.RunnerConfig{
+			Workers:     config.Workers,
+			QueueSize:   config.QueueSize,
+			Timeout:     config.CompileTimeout,
+			MemoryBytes: config.CompileMemoryMB << 20,
+			OutputBytes: config.CompileOutputMB << 20,
+		}),
 	}, nil
 }
 
@@ -31,108 +100,173 @@ func (s *Service) Start() error {
 	return nil
 }
 
+// defaultOutputSelection is used when a request doesn't select any outputs, since solc produces nothing without one
+var defaultOutputSelection = map[string]any{
+	"*": map[string]any{
+		"*": []string{"abi", "metadata", "userdoc", "devdoc", "evm.bytecode", "evm.deployedBytecode", "evm.methodIdentifiers", "storageLayout"},
+	},
+}
+
+// standardJsonInput converts the request into the input passed to solc. Settings are passed through as they are,
+// except that the default output selection is filled in if there isn't one.
+func standardJsonInput(input *solidityclient.SolcStandardInput) *compiler.StandardJsonInput {
+	result := &compiler.StandardJsonInput{
+		Language: input.Language,
+		Sources:  make(map[string]*compiler.StandardJsonSourceFile),
+		Settings: make(map[string]any),
+	}
+	if result.Language == "" {
+		result.Language = "Solidity"
+	}
+
+	for name, source := range input.Sources {
+		result.Sources[name] = &compiler.StandardJsonSourceFile{
+			Content: source.Content,
+			URLs:    source.URLs,
+		}
+	}
+
+	for k, v := range input.Settings {
+		result.Settings[k] = v
+	}
+	if _, ok := result.Settings["outputSelection"]; !ok {
+		result.Settings["outputSelection"] = defaultOutputSelection
+	}
+
+	return result
+}
+
+// compileErrors returns the diagnostics which stopped the compilation, as opposed to warnings and infos. Only the
+// diagnostics are decoded, the rest of the output is passed on as solc wrote it.
+func compileErrors(output json.RawMessage) ([]*compiler.StandardJsonError, error) {
+	var diagnostics struct {
+		Errors []*compiler.StandardJsonError `json:"errors"`
+	}
+	if err := json.Unmarshal(output, &diagnostics); err != nil {
+		return nil, fmt.Errorf("failed to decode diagnostics: %w", err)
+	}
+	return fatalErrors(diagnostics.Errors), nil
+}
+
+// fatalErrors returns the diagnostics with an error severity
+func fatalErrors(diagnostics []*compiler.StandardJsonError) []*compiler.StandardJsonError {
+	var result []*compiler.StandardJsonError
+	for _, e := range diagnostics {
+		if e.Severity == "error" {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// compileErrorMessage summarizes the diagnostics, the full details are returned alongside it
+func compileErrorMessage(errs []*compiler.StandardJsonError) string {
+	messages := make([]string, 0, len(errs))
+	for _, e := range errs {
+		messages = append(messages, fmt.Sprintf("%s: %s", e.Type, e.Message))
+	}
+	return strings.Join(messages, "\n")
+}
+
+// resolveVersion picks the newest solc release which satisfies the pragmas of every source
+func (s *Service) resolveVersion(ctx context.Context, input *solidityclient.SolcStandardInput) (string, error) {
+	var constraints []*compiler.Constraint
+	for name, source := range input.Sources {
+		pragmas, err := compiler.SolidityPragmas(source.Content)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		constraints = append(constraints, pragmas...)
+	}
+
+	return s.compilers.Resolve(ctx, constraints)
+}
+
+// compile runs solc on the input, or returns the cached output if the same input has been compiled before. Outputs
+// are cached as solc wrote them, whether or not solc reported errors, as both are deterministic.
+func (s *Service) compile(ctx context.Context, version string, input *compiler.StandardJsonInput) (json.RawMessage, bool, error) {
+	key, err := compiler.ResultKey(version, input)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if cached, ok := s.results.Get(key); ok {
+		if json.Valid(cached) {
+			return cached, true, nil
+		}
+		log.WithField("key", key).Warnf("ignoring invalid cached result")
+	}
+
+	solidity, err := compiler.NewSolidityCompiler(ctx, s.compilers, s.runner, version)
+	if err != nil {
+		return nil, false, &compiler.InstallError{Err: err}
+	}
+
+	output, err := solidity.CompileFromStandardJSON(ctx, input)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := s.results.Set(key, output); err != nil {
+		log.WithError(err).WithField("key", key).Warnf("failed to cache result")
+	}
+
+	return output, false, nil
+}
+
 func (s *Service) serveCompile(w http.ResponseWriter, r *http.Request) {
 	var request solidityclient.CompileRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]any{
-			"status":  "failed",
-			"message": err.Error(),
-		})
+		compiler.FailCompile(w, http.StatusBadRequest, "", err.Error(), nil)
 		return
 	}
 
-	solidity, err := compiler.NewSolidityCompiler(request.Version)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]any{
-			"status":  "failed",
-			"message": err.Error(),
-		})
+	if request.Input == nil || len(request.Input.Sources) == 0 {
+		compiler.FailCompile(w, http.StatusBadRequest, "", "no sources to compile", nil)
 		return
 	}
 
-	// Get the first source file
-	var sourceContent string
-	for _, source := range request.Input.Sources {
-		sourceContent = source.Content
-		break
+	version := request.Version
+	if version == "" {
+		var err error
+		version, err = s.resolveVersion(r.Context(), request.Input)
+		if err != nil {
+			compiler.FailCompile(w, compiler.ResolveStatus(err), "", err.Error(), nil)
+			return
+		}
 	}
 
-	output, err := solidity.CompileFromString(sourceContent)
+	output, cached, err := s.compile(r.Context(), version, standardJsonInput(request.Input))
+	if cached {
+		w.Header().Set("X-Cache", "hit")
+	} else {
+		w.Header().Set("X-Cache", "miss")
+	}
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]any{
-			"status":  "failed",
-			"message": err.Error(),
-		})
+		compiler.FailCompile(w, compiler.CompileStatus(err), "", err.Error(), nil)
 		return
 	}
 
-	// Get the first contract (assuming single contract compilation)
-	var contract *compiler.Contract
-	for _, c := range output {
-		contract = c
-		break
-	}
-
-	if contract == nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]any{
-			"status":  "failed",
-			"message": "no contract found in compilation output",
-		})
+	errs, err := compileErrors(output)
+	if err != nil {
+		compiler.FailCompile(w, http.StatusInternalServerError, "", err.Error(), nil)
 		return
 	}
-
-	// Type assertion for ABI
-	abi, ok := contract.Info.AbiDefinition.([]any)
-	if !ok {
-		// If AbiDefinition is not []any, try to convert it
-		if abiBytes, ok := contract.Info.AbiDefinition.([]byte); ok {
-			var abiData []any
-			if err := json.Unmarshal(abiBytes, &abiData); err == nil {
-				abi = abiData
-			}
-		}
-		// If still not ok, use empty slice
-		if !ok {
-			abi = []any{}
-		}
+	if len(errs) > 0 {
+		compiler.FailCompile(w, http.StatusBadRequest, version, compileErrorMessage(errs), output)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(&solidityclient.CompileResponse{
-		Ok:    true,
-		Error: "",
-		Result: &solidityclient.SolcStandardOutput{
-			Contracts: map[string]map[string]*solidityclient.SolcContract{
-				"contract.sol": {
-					"Contract": {
-						ABI: abi,
-						EVM: solidityclient.SolcEVM{
-							Bytecode: solidityclient.SolcBytecode{
-								Object: contract.Code,
-							},
-							DeployedBytecode: solidityclient.SolcBytecode{
-								Object: contract.RuntimeCode,
-							},
-						},
-					},
-				},
-			},
-		},
-	})
+	compiler.SucceedCompile(w, version, output)
 }
 
 func (s *Service) startServer() {
 	m := mux.NewRouter()
 	m.HandleFunc("/v1/compile", s.serveCompile).Methods("POST")
+	m.HandleFunc("/v1/verify", s.serveVerify).Methods("POST")
+	m.HandleFunc("/v1/metadata/{chain}/{address}", s.serveMetadata).Methods("GET")
+	m.HandleFunc("/v1/versions", compiler.ServeVersions(s.compilers)).Methods("GET")
+	m.HandleFunc("/v1/stats", compiler.ServeStats(s.runner)).Methods("GET")
 
 	cors := handlers.CORS(
 		handlers.AllowedMethods([]string{"OPTIONS", "HEAD", "GET", "POST"}),
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/compiler"
+	solidityclient "github.com/openchainxyz/openchainxyz-monorepo/services/solidity-compiler-srv/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStandardJsonInput(t *testing.T) {
+	optimizer := map[string]any{"enabled": true, "runs": 200}
+
+	input := standardJsonInput(&solidityclient.SolcStandardInput{
+		Sources: map[string]solidityclient.SolcSource{
+			"contracts/Token.sol": {Content: "contract Token {}"},
+			"contracts/Lib.sol":   {Content: "library Lib {}"},
+		},
+		Settings: map[string]any{
+			"optimizer":  optimizer,
+			"evmVersion": "london",
+		},
+	})
+
+	assert.Equal(t, "Solidity", input.Language)
+	assert.Len(t, input.Sources, 2)
+	assert.Equal(t, "library Lib {}", input.Sources["contracts/Lib.sol"].Content)
+	assert.Equal(t, optimizer, input.Settings["optimizer"])
+	assert.Equal(t, "london", input.Settings["evmVersion"])
+	assert.Equal(t, defaultOutputSelection, input.Settings["outputSelection"])
+
+	// an explicit output selection is kept
+	selection := map[string]any{"*": map[string]any{"*": []any{"abi"}}}
+	input = standardJsonInput(&solidityclient.SolcStandardInput{
+		Language: "Yul",
+		Settings: map[string]any{"outputSelection": selection},
+	})
+	assert.Equal(t, "Yul", input.Language)
+	assert.Equal(t, selection, input.Settings["outputSelection"])
+}
+
+func TestCompileErrors(t *testing.T) {
+	output := json.RawMessage(`{"errors":[
+		{"type":"Warning","component":"general","severity":"warning","message":"Unused local variable."},
+		{"type":"ParserError","component":"general","severity":"error","errorCode":"2314","message":"Expected ';' but got '}'"}
+	]}`)
+
+	errs, err := compileErrors(output)
+	require.NoError(t, err)
+	assert.Equal(t, []*compiler.StandardJsonError{{
+		Type:      "ParserError",
+		Component: "general",
+		Severity:  "error",
+		ErrorCode: "2314",
+		Message:   "Expected ';' but got '}'",
+	}}, errs)
+	assert.Equal(t, "ParserError: Expected ';' but got '}'", compileErrorMessage(errs))
+
+	_, err = compileErrors(json.RawMessage(`[]`))
+	assert.Error(t, err)
+}
+
+func TestServeCompileFailure(t *testing.T) {
+	s := &Service{config: &Config{}}
+
+	for _, body := range []string{`{`, `{"version":"0.8.17","input":{"sources":{}}}`} {
+		w := httptest.NewRecorder()
+		s.serveCompile(w, httptest.NewRequest("POST", "/v1/compile", strings.NewReader(body)))
+
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var response solidityclient.CompileResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		assert.False(t, response.Ok)
+		assert.NotEmpty(t, response.Error)
+		assert.Nil(t, response.Result)
+	}
+}
+
+func TestServeVersions(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `{
+		"builds": [
+			{"path": "solc-v0.8.9", "version": "0.8.9", "longVersion": "0.8.9+commit.e5eed63a", "sha256": "0x00"},
+			{"path": "solc-v0.8.17", "version": "0.8.17", "longVersion": "0.8.17+commit.8df45f5f", "sha256": "0x00"}
+		],
+		"releases": {"0.8.9": "solc-v0.8.9", "0.8.17": "solc-v0.8.17"},
+		"latestRelease": "0.8.17"
+	}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "list.json"), []byte(manifest), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "solc-v0.8.9"), []byte("solc"), 0755))
+
+	s, err := New(&Config{CompilerOfflineDir: dir, CompilerDir: t.TempDir()})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	compiler.ServeVersions(s.compilers)(w, httptest.NewRequest("GET", "/v1/versions", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var response solidityclient.VersionsResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.True(t, response.Ok)
+	assert.Equal(t, &solidityclient.VersionList{
+		LatestRelease: "0.8.17",
+		Releases: []*solidityclient.CompilerVersion{
+			{Version: "0.8.17", LongVersion: "0.8.17+commit.8df45f5f"},
+			{Version: "0.8.9", LongVersion: "0.8.9+commit.e5eed63a", Installed: true},
+		},
+	}, response.Result)
+}
+
+func TestServeCompileCached(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "list.json"), []byte(`{"builds":[],"releases":{}}`), 0644))
+
+	s, err := New(&Config{CompilerOfflineDir: dir, CompilerDir: t.TempDir(), CacheSize: 16})
+	require.NoError(t, err)
+
+	input := &solidityclient.SolcStandardInput{
+		Sources: map[string]solidityclient.SolcSource{"A.sol": {Content: "contract A {}"}},
+	}
+	key, err := compiler.ResultKey("0.8.17", standardJsonInput(input))
+	require.NoError(t, err)
+	// outputs which aren't modeled by the client types, like gas estimates and the AST, are passed through as they are
+	output := `{"contracts":{"A.sol":{"A":{"abi":[],"metadata":"{}","evm":{"gasEstimates":{"creation":{"totalCost":"infinite"}}}}}},"errors":[{"type":"Warning","severity":"warning","message":"unused"}],"sources":{"A.sol":{"id":0,"ast":{"id":2,"nodeType":"SourceUnit","nodes":[]}}}}`
+	require.NoError(t, s.results.Set(key, []byte(output)))
+
+	compile := func(version string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(&solidityclient.CompileRequest{Version: version, Input: input})
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		s.serveCompile(w, httptest.NewRequest("POST", "/v1/compile", strings.NewReader(string(body))))
+		return w
+	}
+
+	// the cached output is returned without the compiler being installed
+	w := compile("0.8.17")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hit", w.Header().Get("X-Cache"))
+
+	var response solidityclient.CompileResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.True(t, response.Ok)
+	assert.JSONEq(t, output, string(response.Result))
+
+	var result solidityclient.SolcStandardOutput
+	require.NoError(t, json.Unmarshal(response.Result, &result))
+	assert.Contains(t, result.Contracts["A.sol"], "A")
+	assert.Equal(t, "unused", result.Errors[0].Message)
+
+	// the version is part of the key
+	w = compile("0.8.16")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "miss", w.Header().Get("X-Cache"))
+}
+
+func TestServeCompileResolvesVersion(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `{
+		"builds": [
+			{"path": "solc-v0.7.6", "version": "0.7.6", "sha256": "0x00"},
+			{"path": "solc-v0.8.17", "version": "0.8.17", "sha256": "0x00"}
+		],
+		"releases": {"0.7.6": "solc-v0.7.6", "0.8.17": "solc-v0.8.17"}
+	}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "list.json"), []byte(manifest), 0644))
+
+	s, err := New(&Config{CompilerOfflineDir: dir, CompilerDir: t.TempDir(), CacheSize: 16})
+	require.NoError(t, err)
+
+	input := func(pragmas ...string) *solidityclient.SolcStandardInput {
+		result := &solidityclient.SolcStandardInput{Sources: make(map[string]solidityclient.SolcSource)}
+		for i, pragma := range pragmas {
+			result.Sources[fmt.Sprintf("%d.sol", i)] = solidityclient.SolcSource{Content: pragma + "\ncontract A {}"}
+		}
+		return result
+	}
+
+	compile := func(input *solidityclient.SolcStandardInput) (*httptest.ResponseRecorder, *solidityclient.CompileResponse) {
+		body, err := json.Marshal(&solidityclient.CompileRequest{Input: input})
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		s.serveCompile(w, httptest.NewRequest("POST", "/v1/compile", strings.NewReader(string(body))))
+
+		var response solidityclient.CompileResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return w, &response
+	}
+
+	// the pragmas of every source are intersected, and the cached output for the resolved version is used
+	resolved := input("pragma solidity >=0.6.0;", "pragma solidity <0.8.0;")
+	key, err := compiler.ResultKey("0.7.6", standardJsonInput(resolved))
+	require.NoError(t, err)
+	require.NoError(t, s.results.Set(key, []byte(`{"contracts":{}}`)))
+
+	w, response := compile(resolved)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, response.Ok)
+	assert.Equal(t, "0.7.6", response.Version)
+
+	w, response = compile(input("pragma solidity ^0.8.0;", "pragma solidity ^0.7.0;"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, response.Error, "no compiler version satisfies")
+
+	w, response = compile(input("pragma solidity latest;"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, response.Error, "invalid version pragma")
+}
@@ -0,0 +1,307 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/mux"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/compiler"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/ethclient"
+	solidityclient "github.com/openchainxyz/openchainxyz-monorepo/services/solidity-compiler-srv/client"
+	log "github.com/sirupsen/logrus"
+)
+
+// codeReader is the part of a node client needed to verify contracts
+type codeReader interface {
+	CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error)
+}
+
+// getNode returns a client for the node of the chain, dialing it the first time it's needed
+func (s *Service) getNode(chain string) (codeReader, error) {
+	s.nodesLock.Lock()
+	defer s.nodesLock.Unlock()
+
+	if c, ok := s.nodes[chain]; ok {
+		return c, nil
+	}
+
+	url, ok := s.config.RPCEndpoints[chain]
+	if !ok {
+		return nil, fmt.Errorf("unsupported chain: %s", chain)
+	}
+
+	c, err := ethclient.Dial(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", chain, err)
+	}
+
+	s.nodes[chain] = c
+	return c, nil
+}
+
+// verifyOutputSelection is what verification needs from solc: the deployed bytecode to match, and the storage
+// layout and ASTs for the tracer
+var verifyOutputSelection = map[string]any{
+	"*": map[string]any{
+		"*": []string{"evm.deployedBytecode", "storageLayout"},
+		"":  []string{"ast"},
+	},
+}
+
+// verifyInput converts the request into the input passed to solc, replacing the output selection with the outputs
+// verification needs
+func verifyInput(input *solidityclient.SolcStandardInput) *compiler.StandardJsonInput {
+	result := standardJsonInput(input)
+	result.Settings["outputSelection"] = verifyOutputSelection
+	return result
+}
+
+// verification is a compiled contract which matched the deployed code
+type verification struct {
+	file, name string
+	contract   *compiler.StandardJsonContract
+	match      *compiler.BytecodeMatch
+}
+
+// matchContracts finds the compiled contract which matches the deployed code, preferring an exact match. If name is
+// set, only the contract with that fully qualified name is considered.
+func matchContracts(deployed []byte, output *compiler.StandardJsonOutput, name string) (*verification, error) {
+	var candidates []*verification
+	for file, contracts := range output.Contracts {
+		for contractName, contract := range contracts {
+			if name != "" && name != file+":"+contractName {
+				continue
+			}
+			candidates = append(candidates, &verification{file: file, name: contractName, contract: contract})
+		}
+	}
+	if len(candidates) == 0 {
+		if name != "" {
+			return nil, fmt.Errorf("contract %s isn't in the sources", name)
+		}
+		return nil, fmt.Errorf("no contracts were compiled")
+	}
+
+	// the result shouldn't depend on the order of a map
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].file != candidates[j].file {
+			return candidates[i].file < candidates[j].file
+		}
+		return candidates[i].name < candidates[j].name
+	})
+
+	var best *verification
+	for _, candidate := range candidates {
+		if candidate.contract.EVM == nil {
+			continue
+		}
+
+		match, err := compiler.MatchDeployedBytecode(deployed, candidate.contract.EVM.DeployedBytecode)
+		if err != nil {
+			continue
+		}
+
+		candidate.match = match
+		if match.Match == compiler.MatchExact {
+			return candidate, nil
+		}
+		if best == nil {
+			best = candidate
+		}
+	}
+
+	if best == nil {
+		return nil, compiler.ErrBytecodeMismatch
+	}
+	return best, nil
+}
+
+// fetchCode returns the code deployed at the address
+func fetchCode(ctx context.Context, node codeReader, address common.Address) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	code, err := node.CodeAt(ctx, address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch code: %w", err)
+	}
+	return code, nil
+}
+
+func failVerify(w http.ResponseWriter, status int, message string) {
+	compiler.WriteResponse(w, status, &solidityclient.VerifyResponse{
+		Ok:    false,
+		Error: message,
+	})
+}
+
+func (s *Service) serveVerify(w http.ResponseWriter, r *http.Request) {
+	var request solidityclient.VerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		failVerify(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if !common.IsHexAddress(request.Address) {
+		failVerify(w, http.StatusBadRequest, fmt.Sprintf("invalid address %q", request.Address))
+		return
+	}
+	address := common.HexToAddress(request.Address)
+
+	node, err := s.getNode(request.Chain)
+	if err != nil {
+		failVerify(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if request.Input == nil || len(request.Input.Sources) == 0 {
+		failVerify(w, http.StatusBadRequest, "no sources to compile")
+		return
+	}
+
+	deployed, err := fetchCode(r.Context(), node, address)
+	if err != nil {
+		failVerify(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if len(deployed) == 0 {
+		failVerify(w, http.StatusBadRequest, fmt.Sprintf("no code at %s", address))
+		return
+	}
+
+	// the metadata says which version the contract was compiled with, which is more precise than the pragmas
+	version := request.Version
+	if version == "" {
+		if metadata, err := compiler.DecodeMetadata(deployed); err == nil && metadata.Compiler == "solc" && metadata.IsRelease() {
+			version = metadata.Version
+		}
+	}
+	if version == "" {
+		version, err = s.resolveVersion(r.Context(), request.Input)
+		if err != nil {
+			failVerify(w, compiler.ResolveStatus(err), err.Error())
+			return
+		}
+	}
+
+	input := verifyInput(request.Input)
+	raw, _, err := s.compile(r.Context(), version, input)
+	if err != nil {
+		failVerify(w, compiler.CompileStatus(err), err.Error())
+		return
+	}
+
+	var output compiler.StandardJsonOutput
+	if err := json.Unmarshal(raw, &output); err != nil {
+		failVerify(w, http.StatusInternalServerError, fmt.Sprintf("failed to decode output: %v", err))
+		return
+	}
+	if errs := fatalErrors(output.Errors); len(errs) > 0 {
+		failVerify(w, http.StatusBadRequest, compileErrorMessage(errs))
+		return
+	}
+
+	verified, err := matchContracts(deployed, &output, request.Contract)
+	if err != nil {
+		failVerify(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	record := &compiler.VerifiedContract{
+		Chain:         request.Chain,
+		Address:       address,
+		CodeHash:      crypto.Keccak256Hash(deployed),
+		Match:         verified.match.Match,
+		Version:       version,
+		File:          verified.file,
+		Name:          verified.name,
+		Input:         input,
+		Sources:       output.Sources,
+		StorageLayout: verified.contract.StorageLayout,
+		Libraries:     verified.match.Libraries,
+		Immutables:    verified.match.Immutables,
+		VerifiedAt:    time.Now(),
+	}
+	if err := s.verified.Put(record); err != nil {
+		log.WithError(err).WithField("address", address).Errorf("failed to store verified contract")
+		failVerify(w, http.StatusInternalServerError, "failed to store verified contract")
+		return
+	}
+
+	result := &solidityclient.VerifyResult{
+		Match:      string(record.Match),
+		Contract:   record.File + ":" + record.Name,
+		Version:    version,
+		CodeHash:   record.CodeHash.Hex(),
+		Libraries:  make(map[string]string),
+		Immutables: make(map[string]string),
+	}
+	for library, libraryAddress := range record.Libraries {
+		result.Libraries[library] = libraryAddress.Hex()
+	}
+	for id, value := range record.Immutables {
+		result.Immutables[id] = value.String()
+	}
+
+	compiler.WriteResponse(w, http.StatusOK, &solidityclient.VerifyResponse{
+		Ok:     true,
+		Result: result,
+	})
+}
+
+func failMetadata(w http.ResponseWriter, status int, message string) {
+	compiler.WriteResponse(w, status, &solidityclient.MetadataResponse{
+		Ok:    false,
+		Error: message,
+	})
+}
+
+func (s *Service) serveMetadata(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	if !common.IsHexAddress(vars["address"]) {
+		failMetadata(w, http.StatusBadRequest, fmt.Sprintf("invalid address %q", vars["address"]))
+		return
+	}
+	address := common.HexToAddress(vars["address"])
+
+	node, err := s.getNode(vars["chain"])
+	if err != nil {
+		failMetadata(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	deployed, err := fetchCode(r.Context(), node, address)
+	if err != nil {
+		failMetadata(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+	if len(deployed) == 0 {
+		failMetadata(w, http.StatusNotFound, fmt.Sprintf("no code at %s", address))
+		return
+	}
+
+	metadata, err := compiler.DecodeMetadata(deployed)
+	if err != nil {
+		failMetadata(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	compiler.WriteResponse(w, http.StatusOK, &solidityclient.MetadataResponse{
+		Ok: true,
+		Result: &solidityclient.MetadataResult{
+			Compiler:     metadata.Compiler,
+			Version:      metadata.Version,
+			Experimental: metadata.Experimental,
+			Hash:         metadata.HashURI(),
+			CodeHash:     crypto.Keccak256Hash(deployed).Hex(),
+		},
+	})
+}
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/mux"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/compiler"
+	solidityclient "github.com/openchainxyz/openchainxyz-monorepo/services/solidity-compiler-srv/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testNode serves the code of a single contract
+type testNode struct {
+	code []byte
+	err  error
+}
+
+func (n *testNode) CodeAt(ctx context.Context, account common.Address, blockNumber *big.Int) ([]byte, error) {
+	return n.code, n.err
+}
+
+// metadata is the CBOR metadata appended by solc 0.8.17, with an ipfs hash made of b
+func metadata(b byte) string {
+	return metadataVersion(b, 17)
+}
+
+// metadataVersion is the CBOR metadata appended by solc 0.8.patch, with an ipfs hash made of b
+func metadataVersion(b byte, patch byte) string {
+	return "a264697066735822" + strings.Repeat(hex.EncodeToString([]byte{b}), 34) + "64736f6c63430008" + hex.EncodeToString([]byte{patch}) + "0033"
+}
+
+func TestServeVerify(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `{
+		"builds": [{"path": "solc-v0.8.17", "version": "0.8.17", "sha256": "0x00"}],
+		"releases": {"0.8.17": "solc-v0.8.17"}
+	}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "list.json"), []byte(manifest), 0644))
+
+	s, err := New(&Config{CompilerOfflineDir: dir, CompilerDir: t.TempDir(), CacheSize: 16, VerifiedDir: t.TempDir()})
+	require.NoError(t, err)
+
+	node := &testNode{}
+	s.nodes["ethereum"] = node
+
+	input := &solidityclient.SolcStandardInput{
+		Sources: map[string]solidityclient.SolcSource{
+			"contracts/Token.sol": {Content: "pragma solidity ^0.8.0;\ncontract Token { uint256 totalSupply; }\n"},
+		},
+	}
+	key, err := compiler.ResultKey("0.8.17", verifyInput(input))
+	require.NoError(t, err)
+	require.NoError(t, s.results.Set(key, []byte(`{
+		"contracts": {"contracts/Token.sol": {
+			"Token": {"abi": [], "evm": {"deployedBytecode": {"object": "6080604052`+metadata(1)+`"}}},
+			"Empty": {"abi": [], "evm": {"deployedBytecode": {"object": ""}}}
+		}},
+		"sources": {"contracts/Token.sol": {"id": 0, "ast": {
+			"id": 4,
+			"nodeType": "SourceUnit",
+			"nodes": [{"id": 3, "nodeType": "ContractDefinition", "name": "Token", "linearizedBaseContracts": [3], "nodes": []}]
+		}}}
+	}`)))
+
+	address := "0x1111111111111111111111111111111111111111"
+	verify := func(request *solidityclient.VerifyRequest) (*httptest.ResponseRecorder, *solidityclient.VerifyResponse) {
+		body, err := json.Marshal(request)
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		s.serveVerify(w, httptest.NewRequest("POST", "/v1/verify", strings.NewReader(string(body))))
+
+		var response solidityclient.VerifyResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return w, &response
+	}
+
+	// only the metadata differs, so the sources compile to the same code but aren't necessarily the same
+	node.code = common.FromHex("6080604052" + metadata(2))
+	w, response := verify(&solidityclient.VerifyRequest{Chain: "ethereum", Address: address, Version: "0.8.17", Input: input})
+	require.Equal(t, http.StatusOK, w.Code, response.Error)
+	assert.Equal(t, "partial", response.Result.Match)
+	assert.Equal(t, "contracts/Token.sol:Token", response.Result.Contract)
+	assert.Equal(t, crypto.Keccak256Hash(node.code).Hex(), response.Result.CodeHash)
+
+	node.code = common.FromHex("6080604052" + metadata(1))
+	w, response = verify(&solidityclient.VerifyRequest{Chain: "ethereum", Address: address, Input: input, Contract: "contracts/Token.sol:Token"})
+	require.Equal(t, http.StatusOK, w.Code, response.Error)
+	assert.Equal(t, "exact", response.Result.Match)
+	assert.Equal(t, "0.8.17", response.Result.Version)
+
+	// the sources are stored for the tracer
+	stored, err := s.verified.Get("ethereum", common.HexToAddress(address))
+	require.NoError(t, err)
+	assert.Equal(t, compiler.MatchExact, stored.Match)
+	assert.Equal(t, crypto.Keccak256Hash(node.code), stored.CodeHash)
+	assert.Contains(t, compiler.IndexNodes(stored.Sources), 3)
+
+	node.code = common.FromHex("6080604053" + metadata(1))
+	w, response = verify(&solidityclient.VerifyRequest{Chain: "ethereum", Address: address, Version: "0.8.17", Input: input})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, response.Error, "doesn't match")
+
+	w, response = verify(&solidityclient.VerifyRequest{Chain: "ethereum", Address: address, Version: "0.8.17", Input: input, Contract: "contracts/Token.sol:Missing"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, response.Error, "isn't in the sources")
+
+	node.code = nil
+	w, response = verify(&solidityclient.VerifyRequest{Chain: "ethereum", Address: address, Version: "0.8.17", Input: input})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, response.Error, "no code")
+
+	node.err = errors.New("connection refused")
+	w, _ = verify(&solidityclient.VerifyRequest{Chain: "ethereum", Address: address, Version: "0.8.17", Input: input})
+	assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+
+	w, response = verify(&solidityclient.VerifyRequest{Chain: "polygon", Address: address, Version: "0.8.17", Input: input})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, response.Error, "unsupported chain")
+
+	w, _ = verify(&solidityclient.VerifyRequest{Chain: "ethereum", Address: "0x1234", Version: "0.8.17", Input: input})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestServeVerifyMetadataVersion(t *testing.T) {
+	s, err := New(&Config{CompilerDir: t.TempDir(), CacheSize: 16, VerifiedDir: t.TempDir()})
+	require.NoError(t, err)
+
+	input := &solidityclient.SolcStandardInput{
+		Sources: map[string]solidityclient.SolcSource{
+			"contracts/Token.sol": {Content: "pragma solidity ^0.8.0;\ncontract Token {}\n"},
+		},
+	}
+	key, err := compiler.ResultKey("0.8.16", verifyInput(input))
+	require.NoError(t, err)
+	require.NoError(t, s.results.Set(key, []byte(`{
+		"contracts": {"contracts/Token.sol": {"Token": {"abi": [], "evm": {"deployedBytecode": {"object": "6080604052`+metadataVersion(1, 16)+`"}}}}},
+		"sources": {"contracts/Token.sol": {"id": 0, "ast": {"id": 2, "nodeType": "SourceUnit", "nodes": []}}}
+	}`)))
+
+	// the pragma allows any 0.8 release, but the metadata says which one was used, so the compiler list isn't needed
+	s.nodes["ethereum"] = &testNode{code: common.FromHex("6080604052" + metadataVersion(1, 16))}
+
+	body, err := json.Marshal(&solidityclient.VerifyRequest{Chain: "ethereum", Address: "0x1111111111111111111111111111111111111111", Input: input})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	s.serveVerify(w, httptest.NewRequest("POST", "/v1/verify", strings.NewReader(string(body))))
+
+	var response solidityclient.VerifyResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.Equal(t, http.StatusOK, w.Code, response.Error)
+	assert.Equal(t, "0.8.16", response.Result.Version)
+	assert.Equal(t, "exact", response.Result.Match)
+}
+
+func TestServeMetadata(t *testing.T) {
+	s, err := New(&Config{CompilerDir: t.TempDir(), CacheSize: 16, VerifiedDir: t.TempDir()})
+	require.NoError(t, err)
+
+	node := &testNode{}
+	s.nodes["ethereum"] = node
+
+	get := func(chain string, address string) (*httptest.ResponseRecorder, *solidityclient.MetadataResponse) {
+		r := httptest.NewRequest("GET", "/v1/metadata/"+chain+"/"+address, nil)
+		r = mux.SetURLVars(r, map[string]string{"chain": chain, "address": address})
+
+		w := httptest.NewRecorder()
+		s.serveMetadata(w, r)
+
+		var response solidityclient.MetadataResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return w, &response
+	}
+
+	address := "0x1111111111111111111111111111111111111111"
+
+	node.code = common.FromHex("6080604052" + metadata(1))
+	w, response := get("ethereum", address)
+	require.Equal(t, http.StatusOK, w.Code, response.Error)
+	assert.Equal(t, "solc", response.Result.Compiler)
+	assert.Equal(t, "0.8.17", response.Result.Version)
+	assert.True(t, strings.HasPrefix(response.Result.Hash, "ipfs://"))
+	assert.Equal(t, crypto.Keccak256Hash(node.code).Hex(), response.Result.CodeHash)
+
+	node.code = common.FromHex("6080604052")
+	w, _ = get("ethereum", address)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	node.code = nil
+	w, _ = get("ethereum", address)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, _ = get("polygon", address)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w, _ = get("ethereum", "0x1234")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
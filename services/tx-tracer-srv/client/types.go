@@ -74,6 +74,7 @@ type TypeDescriptions struct {
 type TypeName struct {
 	NodeType         string           `json:"nodeType"`
 	TypeDescriptions TypeDescriptions `json:"typeDescriptions"`
+	BaseType         *TypeName        `json:"baseType,omitempty"`
 	KeyType          *TypeName        `json:"keyType,omitempty"`
 	ValueType        *TypeName        `json:"valueType,omitempty"`
 }
@@ -135,9 +136,11 @@ type StructSlotInfo struct {
 type SlotInfo interface{}
 
 // StorageResponse 对应前端的 StorageResponse 类型
+// Slots 是槽位 => 偏移（位）=> 变量，前端用它填充 SlotInfo 的 variables
+// Arrays 和 Structs 是定长数组和结构体起始的槽位，AllStructs 是每个结构体自身的布局
 type StorageResponse struct {
-	AllStructs []interface{}       `json:"allStructs"`
-	Arrays     []interface{}       `json:"arrays"`
-	Structs    []interface{}       `json:"structs"`
-	Slots      map[string]SlotInfo `json:"slots"`
+	Slots      map[string]map[int]VariableInfo `json:"slots"`
+	Arrays     map[string]VariableInfo         `json:"arrays"`
+	Structs    map[string]VariableInfo         `json:"structs"`
+	AllStructs map[string]*StorageResponse     `json:"allStructs,omitempty"`
 }
@@ -3,6 +3,7 @@ package service
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -11,6 +12,7 @@ import (
 	"github.com/ethereum/go-ethereum/eth/tracers"
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/compiler"
 	"github.com/openchainxyz/openchainxyz-monorepo/internal/ethclient"
 	"github.com/openchainxyz/openchainxyz-monorepo/services/tx-tracer-srv/client"
 	log "github.com/sirupsen/logrus"
@@ -18,15 +20,26 @@ import (
 
 type Config struct {
 	HttpPort int `def:"8083" env:"HTTP_PORT"`
+
+	// VerifiedDir is where the solidity compiler service stores verified sources
+	VerifiedDir string `env:"VERIFIED_DIR"`
 }
 
 type Service struct {
 	config *Config
+
+	verified *compiler.VerifiedStore
 }
 
 func New(config *Config) (*Service, error) {
+	verified, err := compiler.NewVerifiedStore(config.VerifiedDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open verified store: %w", err)
+	}
+
 	return &Service{
-		config: config,
+		config:   config,
+		verified: verified,
 	}, nil
 }
 
@@ -226,62 +239,39 @@ func (s *Service) serveStorage(w http.ResponseWriter, r *http.Request) {
 	address := vars["address"]
 	codehash := vars["codehash"]
 
-	_ = chain
-	_ = address
-	_ = codehash
-
-	// 构造完整的 StorageResponse，包含所有必要字段
-	response := client.StorageResponse{
-		AllStructs: []interface{}{
-			map[string]interface{}{
-				"name": "ExampleStruct",
-				"members": []interface{}{
-					map[string]interface{}{
-						"name": "value",
-						"type": "uint256",
-					},
-				},
-			},
-		},
-		Arrays: []interface{}{
-			map[string]interface{}{
-				"name": "ExampleArray",
-				"type": "uint256[]",
-			},
-		},
-		Structs: []interface{}{
-			map[string]interface{}{
-				"name": "ExampleStruct",
-				"members": []interface{}{
-					map[string]interface{}{
-						"name": "value",
-						"type": "uint256",
-					},
-				},
-			},
-		},
-		Slots: map[string]client.SlotInfo{
-			"0x0000000000000000000000000000000000000000000000000000000000000000": client.RawSlotInfo{
-				BaseSlotInfo: client.BaseSlotInfo{
-					Resolved: true,
-					Variables: map[int]client.VariableInfo{
-						0: {
-							Name:     "value",
-							FullName: "ExampleStruct.value",
-							TypeName: client.TypeName{
-								NodeType: "ElementaryTypeName",
-								TypeDescriptions: client.TypeDescriptions{
-									TypeIdentifier: "t_uint256",
-									TypeString:     "uint256",
-								},
-							},
-							Bits: 256,
-						},
-					},
-				},
-				Type: "raw",
-			},
-		},
+	writeError := func(status int, message string) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(map[string]any{
+			"ok":    false,
+			"error": message,
+		})
+	}
+
+	if !common.IsHexAddress(address) {
+		writeError(http.StatusBadRequest, "invalid address format")
+		return
+	}
+
+	// 只有验证过源码的合约才能解析存储布局
+	contract, err := s.verified.Get(chain, common.HexToAddress(address))
+	if errors.Is(err, compiler.ErrNotVerified) {
+		writeError(http.StatusNotFound, fmt.Sprintf("no verified source for %s", address))
+		return
+	} else if err != nil {
+		writeError(http.StatusInternalServerError, fmt.Sprintf("failed to load verified source: %v", err))
+		return
+	}
+
+	if common.HexToHash(codehash) != contract.CodeHash {
+		writeError(http.StatusNotFound, fmt.Sprintf("the verified source of %s is for different code", address))
+		return
+	}
+
+	layout, err := compiler.ContractStorageLayout(contract.Sources, contract.File, contract.Name)
+	if err != nil {
+		writeError(http.StatusInternalServerError, fmt.Sprintf("failed to generate storage layout: %v", err))
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -290,7 +280,7 @@ func (s *Service) serveStorage(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]any{
 		"ok":     true,
 		"error":  "",
-		"result": response,
+		"result": convertStorageLayout(layout),
 	})
 }
 
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/compiler"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/tx-tracer-srv/client"
+)
+
+// convertStorageLayout 把编译器生成的存储布局转换成前端使用的 StorageResponse
+func convertStorageLayout(layout *compiler.ASTStorageLayout) *client.StorageResponse {
+	response := &client.StorageResponse{
+		Slots:   make(map[string]map[int]client.VariableInfo, len(layout.Slots)),
+		Arrays:  make(map[string]client.VariableInfo, len(layout.Arrays)),
+		Structs: make(map[string]client.VariableInfo, len(layout.Structs)),
+	}
+
+	for slot, variables := range layout.Slots {
+		converted := make(map[int]client.VariableInfo, len(variables))
+		for offset, variable := range variables {
+			converted[offset] = convertVariable(variable)
+		}
+		response.Slots[slot.Hex()] = converted
+	}
+	for slot, variable := range layout.Arrays {
+		response.Arrays[slot.Hex()] = convertVariable(variable)
+	}
+	for slot, variable := range layout.Structs {
+		response.Structs[slot.Hex()] = convertVariable(variable)
+	}
+
+	if len(layout.AllStructs) > 0 {
+		response.AllStructs = make(map[string]*client.StorageResponse, len(layout.AllStructs))
+		for name, structLayout := range layout.AllStructs {
+			response.AllStructs[name] = convertStorageLayout(structLayout)
+		}
+	}
+
+	return response
+}
+
+func convertVariable(variable *compiler.ASTVariable) client.VariableInfo {
+	info := client.VariableInfo{
+		Name:     variable.Name,
+		FullName: variable.FullName,
+		Bits:     variable.Bits,
+	}
+	if typeName := convertTypeName(variable.TypeName); typeName != nil {
+		info.TypeName = *typeName
+	}
+	return info
+}
+
+func convertTypeName(typeName *compiler.TypeName) *client.TypeName {
+	if typeName == nil {
+		return nil
+	}
+
+	result := &client.TypeName{
+		NodeType:  typeName.NodeType,
+		BaseType:  convertTypeName(typeName.BaseType),
+		KeyType:   convertTypeName(typeName.KeyType),
+		ValueType: convertTypeName(typeName.ValueType),
+	}
+	if typeName.TypeDescriptions != nil {
+		result.TypeDescriptions = client.TypeDescriptions{
+			TypeIdentifier: typeName.TypeDescriptions.TypeIdentifier,
+			TypeString:     typeName.TypeDescriptions.TypeString,
+		}
+	}
+	return result
+}
@@ -0,0 +1,130 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/compiler"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/tx-tracer-srv/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func uint256Variable(id int, name string, mutability string) string {
+	return fmt.Sprintf(`{
+		"id": %d,
+		"nodeType": "VariableDeclaration",
+		"name": %q,
+		"constant": %t,
+		"mutability": %q,
+		"typeName": {"nodeType": "ElementaryTypeName", "typeDescriptions": {"typeIdentifier": "t_uint256", "typeString": "uint256"}}
+	}`, id, name, mutability == "constant", mutability)
+}
+
+// Token is Ownable, so Ownable's variables come first
+var testSource = fmt.Sprintf(`{"id": 0, "ast": {
+	"id": 9,
+	"nodeType": "SourceUnit",
+	"nodes": [
+		{"id": 1, "nodeType": "ContractDefinition", "name": "Ownable", "linearizedBaseContracts": [1], "nodes": [%s]},
+		{"id": 3, "nodeType": "ContractDefinition", "name": "Token", "linearizedBaseContracts": [3, 1], "nodes": [%s, %s, %s]}
+	]
+}}`,
+	uint256Variable(2, "owner", "mutable"),
+	uint256Variable(4, "totalSupply", "mutable"),
+	uint256Variable(5, "DECIMALS", "constant"),
+	uint256Variable(6, "deployedAt", "immutable"),
+)
+
+func TestServeStorage(t *testing.T) {
+	s, err := New(&Config{VerifiedDir: t.TempDir()})
+	require.NoError(t, err)
+
+	var source compiler.StandardJsonSource
+	require.NoError(t, json.Unmarshal([]byte(testSource), &source))
+
+	address := common.HexToAddress("0x1111111111111111111111111111111111111111")
+	codehash := common.HexToHash("0x01")
+	require.NoError(t, s.verified.Put(&compiler.VerifiedContract{
+		Chain:    "ethereum",
+		Address:  address,
+		CodeHash: codehash,
+		Match:    compiler.MatchExact,
+		File:     "contracts/Token.sol",
+		Name:     "Token",
+		Sources:  map[string]*compiler.StandardJsonSource{"contracts/Token.sol": &source},
+	}))
+
+	storage := func(address string, codehash string) (*httptest.ResponseRecorder, map[string]json.RawMessage) {
+		r := httptest.NewRequest("GET", "/api/v1/storage/ethereum/"+address+"/"+codehash, nil)
+		r = mux.SetURLVars(r, map[string]string{"chain": "ethereum", "address": address, "codehash": codehash})
+
+		w := httptest.NewRecorder()
+		s.serveStorage(w, r)
+
+		var response map[string]json.RawMessage
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return w, response
+	}
+
+	w, response := storage(address.Hex(), codehash.Hex())
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var layout client.StorageResponse
+	require.NoError(t, json.Unmarshal(response["result"], &layout))
+	assert.Len(t, layout.Slots, 2)
+	assert.Equal(t, "owner", layout.Slots[common.BigToHash(common.Big0).Hex()][0].Name)
+	assert.Equal(t, "totalSupply", layout.Slots[common.BigToHash(common.Big1).Hex()][0].Name)
+	assert.Equal(t, "uint256", layout.Slots[common.BigToHash(common.Big1).Hex()][0].TypeName.TypeDescriptions.TypeString)
+	assert.Equal(t, 256, layout.Slots[common.BigToHash(common.Big1).Hex()][0].Bits)
+
+	// the source is for different code, e.g. the contract was redeployed
+	w, _ = storage(address.Hex(), common.HexToHash("0x02").Hex())
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, _ = storage("0x2222222222222222222222222222222222222222", codehash.Hex())
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	w, _ = storage("0x1234", codehash.Hex())
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func TestConvertStorageLayout(t *testing.T) {
+	uint256 := &compiler.TypeName{
+		NodeType:         "ElementaryTypeName",
+		TypeDescriptions: &compiler.TypeDescriptions{TypeIdentifier: "t_uint256", TypeString: "uint256"},
+	}
+	point := &compiler.TypeName{
+		NodeType:         "UserDefinedTypeName",
+		TypeDescriptions: &compiler.TypeDescriptions{TypeIdentifier: "t_struct$_Point_$3_storage", TypeString: "struct Point"},
+	}
+	points := &compiler.ASTVariable{
+		Name:     "points",
+		FullName: "points",
+		TypeName: &compiler.TypeName{NodeType: "ArrayTypeName", BaseType: point},
+	}
+	x := &compiler.ASTVariable{Name: "x", FullName: "x", TypeName: uint256, Bits: 256}
+
+	slot0 := common.BigToHash(common.Big0)
+	response := convertStorageLayout(&compiler.ASTStorageLayout{
+		Slots:   map[common.Hash]map[int]*compiler.ASTVariable{slot0: {0: {Name: "points", FullName: "points[0].x", TypeName: uint256, Bits: 256}}},
+		Arrays:  map[common.Hash]*compiler.ASTVariable{slot0: points},
+		Structs: map[common.Hash]*compiler.ASTVariable{},
+		AllStructs: map[string]*compiler.ASTStorageLayout{
+			"Point": {Slots: map[common.Hash]map[int]*compiler.ASTVariable{slot0: {0: x}}},
+		},
+	})
+
+	assert.Equal(t, "points[0].x", response.Slots[slot0.Hex()][0].FullName)
+	require.NotNil(t, response.Arrays[slot0.Hex()].TypeName.BaseType)
+	assert.Equal(t, "struct Point", response.Arrays[slot0.Hex()].TypeName.BaseType.TypeDescriptions.TypeString)
+	assert.NotNil(t, response.Structs)
+	require.Contains(t, response.AllStructs, "Point")
+	assert.Equal(t, "x", response.AllStructs["Point"].Slots[slot0.Hex()][0].Name)
+	assert.Nil(t, response.AllStructs["Point"].AllStructs)
+}
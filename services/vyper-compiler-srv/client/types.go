@@ -1,22 +1,144 @@
 package client
 
-type CompileRequest struct {
-	Version    string `json:"version"`
-	Code       string `json:"code"`
-	EVMVersion string `json:"evm_version"`
+import (
+	"encoding/json"
+)
+
+type VyperSource struct {
+	Content string `json:"content"`
 }
 
-type Status string
+// VyperInterface is an interface imported by the sources, either vyper source for .vy files or an ABI for .json files
+type VyperInterface struct {
+	Content string `json:"content,omitempty"`
+	ABI     any    `json:"abi,omitempty"`
+}
 
-const (
-	StatusSuccess Status = "success"
-	StatusFailed  Status = "failed"
-)
+// VyperStandardInput is vyper's standard JSON input. Settings, such as evmVersion, optimize and outputSelection, are
+// passed to the compiler as they are, see https://docs.vyperlang.org/en/stable/compiling-a-contract.html
+type VyperStandardInput struct {
+	Language   string                    `json:"language"`
+	Sources    map[string]VyperSource    `json:"sources"`
+	Interfaces map[string]VyperInterface `json:"interfaces,omitempty"`
+	Settings   map[string]any            `json:"settings"`
+}
+
+// VyperStandardOutput is the part of vyper's standard JSON output which is common to every version
+type VyperStandardOutput struct {
+	// Compiler is the full version string of vyper, e.g. vyper-0.3.7
+	Compiler string `json:"compiler,omitempty"`
+	// Errors holds the diagnostics reported by vyper
+	Errors []VyperError `json:"errors"`
+	// Contracts are keyed by source name and then contract name
+	Contracts map[string]map[string]*VyperContract `json:"contracts,omitempty"`
+	Sources   map[string]*VyperSourceOutput        `json:"sources,omitempty"`
+}
+
+type VyperSourceOutput struct {
+	// ID is the index of the source used in source maps
+	ID int `json:"id"`
+}
+
+type VyperContract struct {
+	ABI     any `json:"abi"`
+	UserDoc any `json:"userdoc,omitempty"`
+	DevDoc  any `json:"devdoc,omitempty"`
+	// Layout is the storage layout, whose shape depends on the vyper version
+	Layout any      `json:"layout,omitempty"`
+	EVM    VyperEVM `json:"evm"`
+}
+
+type VyperEVM struct {
+	Bytecode         VyperBytecode `json:"bytecode"`
+	DeployedBytecode VyperBytecode `json:"deployedBytecode"`
+	// MethodIdentifiers maps each function signature to its selector
+	MethodIdentifiers map[string]string `json:"methodIdentifiers,omitempty"`
+}
+
+type VyperBytecode struct {
+	Object  string `json:"object"`
+	Opcodes string `json:"opcodes,omitempty"`
+	// SourceMap is a compressed string like solc's in most vyper versions
+	SourceMap any `json:"sourceMap,omitempty"`
+}
+
+type CompileRequest struct {
+	// Version is optional, if it's empty the newest release which satisfies the version pragmas of every source is
+	// used
+	Version string              `json:"version,omitempty"`
+	Input   *VyperStandardInput `json:"input,omitempty"`
+
+	// Code and EVMVersion are a shorthand for an input with a single source, contract.vy, and are ignored if Input
+	// is set
+	Code       string `json:"code,omitempty"`
+	EVMVersion string `json:"evm_version,omitempty"`
+}
 
+// CompileResponse is returned for both successful and failed compilations. If vyper rejected the input, Result is
+// still set so that its diagnostics can be inspected. Result is vyper's output as it is, with every output the input
+// selected, and can be decoded into a VyperStandardOutput.
 type CompileResponse struct {
-	Status          Status `json:"status"`
-	Message         string `json:"message,omitempty"`
-	ABI             []any  `json:"abi"`
-	Bytecode        string `json:"bytecode,omitempty"`
-	BytecodeRuntime string `json:"bytecode_runtime,omitempty"`
+	Ok    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+	// Version is the vyper version the input was compiled with
+	Version string          `json:"version,omitempty"`
+	Result  json.RawMessage `json:"result,omitempty"`
+}
+
+// VyperError is a diagnostic reported by vyper
+type VyperError struct {
+	// Type is the exception raised by vyper, e.g. StructureException
+	Type             string               `json:"type"`
+	Component        string               `json:"component,omitempty"`
+	Severity         string               `json:"severity"`
+	Message          string               `json:"message"`
+	FormattedMessage string               `json:"formattedMessage"`
+	SourceLocation   *VyperSourceLocation `json:"sourceLocation,omitempty"`
+}
+
+// VyperSourceLocation is a position within a source. Lines start at 1 and columns at 0.
+type VyperSourceLocation struct {
+	File   string `json:"file,omitempty"`
+	Line   int    `json:"lineno"`
+	Column int    `json:"col_offset"`
+}
+
+// CompilerVersion is a compiler release which can be used to compile
+type CompilerVersion struct {
+	Version     string `json:"version"`
+	LongVersion string `json:"longVersion"`
+	// Installed is whether the binary is already available, the first compile with any other version downloads it
+	Installed bool `json:"installed"`
+}
+
+type VersionList struct {
+	LatestRelease string `json:"latestRelease"`
+	// Releases are ordered newest first
+	Releases []*CompilerVersion `json:"releases"`
+}
+
+type VersionsResponse struct {
+	Ok     bool         `json:"ok"`
+	Error  string       `json:"error,omitempty"`
+	Result *VersionList `json:"result,omitempty"`
+}
+
+// Stats describes the load on the compiler service
+type Stats struct {
+	Workers int `json:"workers"`
+	// Running and Queued are the number of compilations currently running and waiting for a worker
+	Running int64 `json:"running"`
+	Queued  int64 `json:"queued"`
+	// Completed and Failed count the compilations which have finished, Failed includes Timeouts
+	Completed uint64 `json:"completed"`
+	Failed    uint64 `json:"failed"`
+	Timeouts  uint64 `json:"timeouts"`
+	// Rejected counts the compilations which were turned away because the queue was full
+	Rejected uint64 `json:"rejected"`
+}
+
+type StatsResponse struct {
+	Ok     bool   `json:"ok"`
+	Error  string `json:"error,omitempty"`
+	Result *Stats `json:"result,omitempty"`
 }
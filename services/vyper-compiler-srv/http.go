@@ -1,9 +1,12 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -12,71 +15,235 @@ import (
 	log "github.com/sirupsen/logrus"
 )
 
+// vyperDiagnostic converts an error raised by vyper into the diagnostic returned to clients
+func vyperDiagnostic(err *compiler.VyperError) client.VyperError {
+	result := client.VyperError{
+		Type:             err.Type,
+		Severity:         "error",
+		Message:          err.Message,
+		FormattedMessage: err.Output,
+	}
+	if err.Line > 0 {
+		result.SourceLocation = &client.VyperSourceLocation{
+			Line:   err.Line,
+			Column: err.Column,
+		}
+	}
+	return result
+}
+
+// resolveVersion picks the newest vyper release which satisfies the version pragmas of every source
+func (s *Service) resolveVersion(ctx context.Context, input *client.VyperStandardInput) (string, error) {
+	var constraints []*compiler.Constraint
+	for name, source := range input.Sources {
+		pragmas, err := compiler.VyperPragmas(source.Content)
+		if err != nil {
+			return "", fmt.Errorf("%s: %w", name, err)
+		}
+		constraints = append(constraints, pragmas...)
+	}
+
+	return s.compilers.Resolve(ctx, constraints)
+}
+
+// shorthandSource is the name given to the code of a request which doesn't use the standard JSON input
+const shorthandSource = "contract.vy"
+
+// requestInput returns the standard JSON input of the request, building one from the shorthand if there isn't one
+func requestInput(request *client.CompileRequest) *client.VyperStandardInput {
+	if request.Input != nil {
+		return request.Input
+	}
+	if request.Code == "" {
+		return nil
+	}
+
+	input := &client.VyperStandardInput{
+		Language: "Vyper",
+		Sources: map[string]client.VyperSource{
+			shorthandSource: {Content: request.Code},
+		},
+		Settings: make(map[string]any),
+	}
+	if request.EVMVersion != "" {
+		input.Settings["evmVersion"] = request.EVMVersion
+	}
+	return input
+}
+
+// defaultOutputSelection is used when a request doesn't select any outputs. The storage layout is only selected from
+// 0.3.0 onwards, as vyper rejects the whole input if it doesn't know one of the outputs.
+func defaultOutputSelection(version string) map[string]any {
+	outputs := []string{"abi", "userdoc", "devdoc", "evm.bytecode.object", "evm.deployedBytecode.object", "evm.deployedBytecode.sourceMap", "evm.methodIdentifiers"}
+	if compiler.CompareVersions(version, "0.3.0") >= 0 {
+		outputs = append(outputs, "layout")
+	}
+	return map[string]any{
+		"*": outputs,
+	}
+}
+
+// standardJsonInput converts the request into the input passed to vyper. Settings are passed through as they are,
+// except that the default output selection is filled in if there isn't one.
+func standardJsonInput(version string, input *client.VyperStandardInput) *compiler.VyperStandardJsonInput {
+	result := &compiler.VyperStandardJsonInput{
+		Language: input.Language,
+		Sources:  make(map[string]*compiler.StandardJsonSourceFile),
+		Settings: make(map[string]any),
+	}
+	if result.Language == "" {
+		result.Language = "Vyper"
+	}
+
+	for name, source := range input.Sources {
+		result.Sources[name] = &compiler.StandardJsonSourceFile{
+			Content: source.Content,
+		}
+	}
+
+	if len(input.Interfaces) > 0 {
+		result.Interfaces = make(map[string]*compiler.VyperInterface)
+		for name, iface := range input.Interfaces {
+			result.Interfaces[name] = &compiler.VyperInterface{
+				Content: iface.Content,
+				ABI:     iface.ABI,
+			}
+		}
+	}
+
+	for k, v := range input.Settings {
+		result.Settings[k] = v
+	}
+	if _, ok := result.Settings["outputSelection"]; !ok {
+		result.Settings["outputSelection"] = defaultOutputSelection(version)
+	}
+
+	return result
+}
+
+// compileErrors returns the diagnostics which stopped the compilation. Only the diagnostics are decoded, the rest
+// of the output is passed on as vyper wrote it.
+func compileErrors(output json.RawMessage) ([]*compiler.VyperStandardJsonError, error) {
+	var diagnostics struct {
+		Errors []*compiler.VyperStandardJsonError `json:"errors"`
+	}
+	if err := json.Unmarshal(output, &diagnostics); err != nil {
+		return nil, fmt.Errorf("failed to decode diagnostics: %w", err)
+	}
+
+	var result []*compiler.VyperStandardJsonError
+	for _, e := range diagnostics.Errors {
+		if e.Severity == "error" {
+			result = append(result, e)
+		}
+	}
+	return result, nil
+}
+
+// compileErrorMessage summarizes the diagnostics, the full details are returned alongside it
+func compileErrorMessage(errs []*compiler.VyperStandardJsonError) string {
+	messages := make([]string, 0, len(errs))
+	for _, e := range errs {
+		messages = append(messages, fmt.Sprintf("%s: %s", e.Type, e.Message))
+	}
+	return strings.Join(messages, "\n")
+}
+
+// compile runs vyper on the input, or returns the cached output if the same input has been compiled before. Outputs
+// are cached as vyper wrote them, whether or not vyper reported errors, as both are deterministic.
+func (s *Service) compile(ctx context.Context, version string, input *compiler.VyperStandardJsonInput) (json.RawMessage, bool, error) {
+	key, err := compiler.ResultKey(version, input)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if cached, ok := s.results.Get(key); ok {
+		if json.Valid(cached) {
+			return cached, true, nil
+		}
+		log.WithField("key", key).Warnf("ignoring invalid cached result")
+	}
+
+	vyper, err := compiler.NewVyperCompiler(ctx, s.compilers, s.runner, version)
+	if err != nil {
+		return nil, false, &compiler.InstallError{Err: err}
+	}
+
+	output, err := vyper.CompileFromStandardJSON(ctx, input)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if err := s.results.Set(key, output); err != nil {
+		log.WithError(err).WithField("key", key).Warnf("failed to cache result")
+	}
+
+	return output, false, nil
+}
+
 func (s *Service) serveCompile(w http.ResponseWriter, r *http.Request) {
 	var request client.CompileRequest
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]any{
-			"status":  "failed",
-			"message": err.Error(),
-		})
+		compiler.FailCompile(w, http.StatusBadRequest, "", err.Error(), nil)
 		return
 	}
 
-	vyper, err := compiler.NewVyperCompiler(request.Version)
-	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]any{
-			"status":  "failed",
-			"message": err.Error(),
-		})
+	input := requestInput(&request)
+	if input == nil || len(input.Sources) == 0 {
+		compiler.FailCompile(w, http.StatusBadRequest, "", "no sources to compile", nil)
 		return
 	}
 
-	output, err := vyper.CompileFromString(request.Code)
+	version := request.Version
+	if version == "" {
+		var err error
+		version, err = s.resolveVersion(r.Context(), input)
+		if err != nil {
+			compiler.FailCompile(w, compiler.ResolveStatus(err), "", err.Error(), nil)
+			return
+		}
+	}
+
+	output, cached, err := s.compile(r.Context(), version, standardJsonInput(version, input))
+	if cached {
+		w.Header().Set("X-Cache", "hit")
+	} else {
+		w.Header().Set("X-Cache", "miss")
+	}
 	if err != nil {
-		w.Header().Set("Content-Type", "application/json")
-		w.WriteHeader(http.StatusBadRequest)
-		json.NewEncoder(w).Encode(map[string]any{
-			"status":  "failed",
-			"message": err.Error(),
-		})
+		var vyperErr *compiler.VyperError
+		if errors.As(err, &vyperErr) {
+			// vyper didn't write any output, so one is made up to carry the diagnostic
+			diagnostic := vyperDiagnostic(vyperErr)
+			result, _ := json.Marshal(&client.VyperStandardOutput{
+				Errors: []client.VyperError{diagnostic},
+			})
+			compiler.FailCompile(w, http.StatusBadRequest, version, fmt.Sprintf("%s: %s", diagnostic.Type, diagnostic.Message), result)
+			return
+		}
+
+		compiler.FailCompile(w, compiler.CompileStatus(err), "", err.Error(), nil)
 		return
 	}
 
-	obj := output["/dev/stdin"]
-
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
-	// Type assertion for ABI
-	abi, ok := obj.Info.AbiDefinition.([]any)
-	if !ok {
-		// If AbiDefinition is not []any, try to convert it
-		if abiBytes, ok := obj.Info.AbiDefinition.([]byte); ok {
-			var abiData []any
-			if err := json.Unmarshal(abiBytes, &abiData); err == nil {
-				abi = abiData
-			}
-		}
-		// If still not ok, use empty slice
-		if !ok {
-			abi = []any{}
-		}
+	errs, err := compileErrors(output)
+	if err != nil {
+		compiler.FailCompile(w, http.StatusInternalServerError, "", err.Error(), nil)
+		return
+	}
+	if len(errs) > 0 {
+		compiler.FailCompile(w, http.StatusBadRequest, version, compileErrorMessage(errs), output)
+		return
 	}
 
-	json.NewEncoder(w).Encode(&client.CompileResponse{
-		Status:          client.StatusSuccess,
-		ABI:             abi,
-		Bytecode:        obj.Code,
-		BytecodeRuntime: obj.RuntimeCode,
-	})
+	compiler.SucceedCompile(w, version, output)
 }
 
 func (s *Service) startServer() {
 	m := mux.NewRouter()
 	m.HandleFunc("/v1/compile", s.serveCompile).Methods("POST")
+	m.HandleFunc("/v1/versions", compiler.ServeVersions(s.compilers)).Methods("GET")
+	m.HandleFunc("/v1/stats", compiler.ServeStats(s.runner)).Methods("GET")
 
 	cors := handlers.CORS(
 		handlers.AllowedMethods([]string{"OPTIONS", "HEAD", "GET", "POST"}),
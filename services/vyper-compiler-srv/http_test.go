@@ -0,0 +1,228 @@
+package service
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/compiler"
+	"github.com/openchainxyz/openchainxyz-monorepo/services/vyper-compiler-srv/client"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVyperDiagnostic(t *testing.T) {
+	assert.Equal(t, client.VyperError{
+		Type:             "StructureException",
+		Severity:         "error",
+		Message:          "Invalid top-level statement",
+		FormattedMessage: "vyper.exceptions.StructureException: Invalid top-level statement\n  line 3:4",
+		SourceLocation:   &client.VyperSourceLocation{Line: 3, Column: 4},
+	}, vyperDiagnostic(&compiler.VyperError{
+		Type:    "StructureException",
+		Message: "Invalid top-level statement",
+		Line:    3,
+		Column:  4,
+		Output:  "vyper.exceptions.StructureException: Invalid top-level statement\n  line 3:4",
+	}))
+
+	// without a line there's no location to report
+	assert.Nil(t, vyperDiagnostic(&compiler.VyperError{Message: "KeyboardInterrupt"}).SourceLocation)
+}
+
+func TestServeCompileFailure(t *testing.T) {
+	s := &Service{config: &Config{}}
+
+	w := httptest.NewRecorder()
+	s.serveCompile(w, httptest.NewRequest("POST", "/v1/compile", strings.NewReader(`{`)))
+
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response client.CompileResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.False(t, response.Ok)
+	assert.NotEmpty(t, response.Error)
+	assert.Nil(t, response.Result)
+}
+
+func TestStandardJsonInput(t *testing.T) {
+	// the shorthand becomes a single source, and the evm version is passed on
+	input := standardJsonInput("0.3.7", requestInput(&client.CompileRequest{Code: "x: uint256\n", EVMVersion: "paris"}))
+	assert.Equal(t, "Vyper", input.Language)
+	assert.Equal(t, "x: uint256\n", input.Sources["contract.vy"].Content)
+	assert.Equal(t, "paris", input.Settings["evmVersion"])
+	assert.Contains(t, input.Settings["outputSelection"].(map[string]any)["*"], "layout")
+
+	// older versions don't know about the storage layout
+	input = standardJsonInput("0.2.16", requestInput(&client.CompileRequest{Code: "x: uint256\n"}))
+	assert.NotContains(t, input.Settings["outputSelection"].(map[string]any)["*"], "layout")
+	assert.NotContains(t, input.Settings, "evmVersion")
+
+	// the standard JSON input takes precedence, and its settings are passed through
+	input = standardJsonInput("0.3.7", requestInput(&client.CompileRequest{
+		Code: "ignored",
+		Input: &client.VyperStandardInput{
+			Sources: map[string]client.VyperSource{
+				"contracts/Foo.vy": {Content: "import interfaces.Bar as Bar\n"},
+			},
+			Interfaces: map[string]client.VyperInterface{
+				"interfaces/Bar.vy":   {Content: "@external\ndef bar():\n    pass\n"},
+				"interfaces/Baz.json": {ABI: []any{}},
+			},
+			Settings: map[string]any{
+				"optimize":        "codesize",
+				"outputSelection": map[string]any{"contracts/Foo.vy": []any{"abi"}},
+			},
+		},
+	}))
+	assert.Len(t, input.Sources, 1)
+	assert.Contains(t, input.Sources, "contracts/Foo.vy")
+	assert.Len(t, input.Interfaces, 2)
+	assert.Equal(t, []any{}, input.Interfaces["interfaces/Baz.json"].ABI)
+	assert.Equal(t, "codesize", input.Settings["optimize"])
+	assert.Equal(t, map[string]any{"contracts/Foo.vy": []any{"abi"}}, input.Settings["outputSelection"])
+}
+
+// preload caches the output for a request, since there is no vyper to compile it
+func preload(t *testing.T, s *Service, version string, request *client.CompileRequest, output string) {
+	key, err := compiler.ResultKey(version, standardJsonInput(version, requestInput(request)))
+	require.NoError(t, err)
+	require.NoError(t, s.results.Set(key, []byte(output)))
+}
+
+func TestServeCompileCached(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "list.json"), []byte(`{"builds":[],"releases":{}}`), 0644))
+
+	s, err := New(&Config{CompilerOfflineDir: dir, CompilerDir: t.TempDir(), CacheSize: 16})
+	require.NoError(t, err)
+
+	input := &client.VyperStandardInput{
+		Language: "Vyper",
+		Sources: map[string]client.VyperSource{
+			"contracts/Foo.vy": {Content: "@external\ndef foo() -> uint256:\n    return 1\n"},
+		},
+	}
+	// outputs which aren't modeled by the client types, like the IR and the AST, are passed through as they are
+	output := `{
+		"compiler": "vyper-0.3.7",
+		"contracts": {"contracts/Foo.vy": {"Foo": {
+			"abi": [],
+			"ir": "seq",
+			"layout": {"storage_layout": {}},
+			"evm": {"bytecode": {"object": "0x01"}, "deployedBytecode": {"object": "0x00", "sourceMap": "0:1:0"}}
+		}}},
+		"sources": {"contracts/Foo.vy": {"id": 0, "ast": {"ast_type": "Module", "body": []}}}
+	}`
+	preload(t, s, "0.3.7", &client.CompileRequest{Input: input}, output)
+
+	compile := func(version string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(&client.CompileRequest{Version: version, Input: input})
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		s.serveCompile(w, httptest.NewRequest("POST", "/v1/compile", strings.NewReader(string(body))))
+		return w
+	}
+
+	w := compile("0.3.7")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "hit", w.Header().Get("X-Cache"))
+
+	var response client.CompileResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	require.True(t, response.Ok)
+	assert.JSONEq(t, output, string(response.Result))
+
+	var result client.VyperStandardOutput
+	require.NoError(t, json.Unmarshal(response.Result, &result))
+	contract := result.Contracts["contracts/Foo.vy"]["Foo"]
+	require.NotNil(t, contract)
+	assert.Equal(t, "0x00", contract.EVM.DeployedBytecode.Object)
+	assert.Equal(t, "0:1:0", contract.EVM.DeployedBytecode.SourceMap)
+	assert.NotNil(t, contract.Layout)
+	assert.Empty(t, result.Errors)
+
+	w = compile("0.3.6")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "miss", w.Header().Get("X-Cache"))
+}
+
+func TestServeCompileErrors(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "list.json"), []byte(`{"builds":[],"releases":{}}`), 0644))
+
+	s, err := New(&Config{CompilerOfflineDir: dir, CompilerDir: t.TempDir(), CacheSize: 16})
+	require.NoError(t, err)
+
+	request := &client.CompileRequest{Version: "0.3.7", Code: "x: uint256\nfoo\n"}
+	preload(t, s, "0.3.7", request, `{
+		"compiler": "vyper-0.3.7",
+		"errors": [{
+			"type": "StructureException",
+			"component": "compiler",
+			"severity": "error",
+			"message": "Invalid top-level statement",
+			"sourceLocation": {"file": "contract.vy", "lineno": 2, "col_offset": 0}
+		}]
+	}`)
+
+	body, err := json.Marshal(request)
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	s.serveCompile(w, httptest.NewRequest("POST", "/v1/compile", strings.NewReader(string(body))))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var response client.CompileResponse
+	require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+	assert.False(t, response.Ok)
+	assert.Equal(t, "StructureException: Invalid top-level statement", response.Error)
+	assert.Equal(t, "0.3.7", response.Version)
+	var result client.VyperStandardOutput
+	require.NoError(t, json.Unmarshal(response.Result, &result))
+	require.Len(t, result.Errors, 1)
+	assert.Equal(t, &client.VyperSourceLocation{File: "contract.vy", Line: 2}, result.Errors[0].SourceLocation)
+}
+
+func TestServeCompileResolvesVersion(t *testing.T) {
+	dir := t.TempDir()
+	manifest := `{
+		"builds": [
+			{"path": "vyper-0.2.16", "version": "0.2.16", "sha256": "0x00"},
+			{"path": "vyper-0.3.7", "version": "0.3.7", "sha256": "0x00"}
+		],
+		"releases": {"0.2.16": "vyper-0.2.16", "0.3.7": "vyper-0.3.7"}
+	}`
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "list.json"), []byte(manifest), 0644))
+
+	s, err := New(&Config{CompilerOfflineDir: dir, CompilerDir: t.TempDir(), CacheSize: 16})
+	require.NoError(t, err)
+
+	code := "# @version ^0.2.0\n\n@external\ndef foo() -> uint256:\n    return 1\n"
+	preload(t, s, "0.2.16", &client.CompileRequest{Code: code}, `{"compiler":"vyper-0.2.16","contracts":{}}`)
+
+	compile := func(code string) (*httptest.ResponseRecorder, *client.CompileResponse) {
+		body, err := json.Marshal(&client.CompileRequest{Code: code})
+		require.NoError(t, err)
+
+		w := httptest.NewRecorder()
+		s.serveCompile(w, httptest.NewRequest("POST", "/v1/compile", strings.NewReader(string(body))))
+
+		var response client.CompileResponse
+		require.NoError(t, json.NewDecoder(w.Body).Decode(&response))
+		return w, &response
+	}
+
+	w, response := compile(code)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "0.2.16", response.Version)
+
+	w, response = compile("# @version ^0.4.0\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, response.Error, "no compiler version satisfies")
+}
@@ -1,15 +1,73 @@
 package service
 
+import (
+	"fmt"
+	"time"
+
+	"github.com/openchainxyz/openchainxyz-monorepo/internal/compiler"
+)
+
 type Config struct {
 	HttpPort int `def:"34887" env:"PORT"`
+
+	// CompilerManifest overrides where the list of vyper releases is read from, either a url or a local path.
+	// CompilerDir is where vyper binaries are installed, and CompilerOfflineDir holds preloaded binaries.
+	CompilerManifest   string `env:"COMPILER_MANIFEST"`
+	CompilerDir        string `env:"COMPILER_DIR"`
+	CompilerOfflineDir string `env:"COMPILER_OFFLINE_DIR"`
+
+	// CacheSize is the number of compilation results kept in memory, taking up to CacheMemoryMB, and CacheDir is
+	// where results are stored on disk. Results are only kept in memory if CacheDir isn't set.
+	CacheSize     int    `def:"256" env:"CACHE_SIZE"`
+	CacheMemoryMB int64  `def:"1024" env:"CACHE_MEMORY_MB"`
+	CacheDir      string `env:"CACHE_DIR"`
+
+	// Workers is the number of compilers run at once, defaulting to the number of cpus. Up to QueueSize compilations
+	// wait for a worker, any more are rejected with a 503.
+	Workers   int `env:"WORKERS"`
+	QueueSize int `def:"64" env:"QUEUE_SIZE"`
+
+	// CompileTimeout, CompileMemoryMB and CompileOutputMB limit the resources of a single compilation
+	CompileTimeout  time.Duration `def:"60s" env:"COMPILE_TIMEOUT"`
+	CompileMemoryMB uint64        `def:"4096" env:"COMPILE_MEMORY_MB"`
+	CompileOutputMB int64         `def:"64" env:"COMPILE_OUTPUT_MB"`
 }
 
 type Service struct {
 	config *Config
+
+	compilers *compiler.Manager
+	results   *compiler.ResultCache
+	runner    *compiler.Runner
 }
 
 func New(config *Config) (*Service, error) {
-	return &Service{config: config}, nil
+	compilers, err := compiler.NewManager(compiler.LanguageVyper, &compiler.ManagerConfig{
+		Manifest:   config.CompilerManifest,
+		Dir:        config.CompilerDir,
+		OfflineDir: config.CompilerOfflineDir,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create compiler manager: %w", err)
+	}
+
+	results, err := compiler.NewResultCache(config.CacheDir, config.CacheSize, config.CacheMemoryMB<<20)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create result cache: %w", err)
+	}
+
+	return &Service{
+		config:    config,
+		compilers: compilers,
+		results:   results,
+		runner: compiler.NewRunner(&compiler.RunnerConfig{
+			Workers:     config.Workers,
+			QueueSize:   config.QueueSize,
+			Timeout:     config.CompileTimeout,
+			MemoryBytes: config.CompileMemoryMB << 20,
+			OutputBytes: config.CompileOutputMB << 20,
+		}),
+	}, nil
 }
 
 func (s *Service) Start() error {